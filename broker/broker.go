@@ -31,6 +31,12 @@ type Event interface {
 	Error() error
 }
 
+// Nacker is implemented by the events of the brokers which redeliver a
+// message its subscriber failed to handle
+type Nacker interface {
+	Nack() error
+}
+
 // Subscriber is a convenience return type for the Subscribe method
 type Subscriber interface {
 	Options() SubscribeOptions
@@ -12,9 +12,15 @@ import (
 import (
 	"xmicro/broker"
 	"xmicro/codec/json"
+	"xmicro/common/component"
+	"xmicro/common/constant"
 	"xmicro/logger"
 )
 
+func init() {
+	component.SetBrokerFactory(constant.KafkaKey, NewBroker)
+}
+
 type kBroker struct {
 	addrs []string
 
@@ -41,6 +47,51 @@ type publication struct {
 	km   *sarama.ConsumerMessage
 	m    *broker.Message
 	sess sarama.ConsumerGroupSession
+	// offsets of the claim the message was received from
+	offsets *offsets
+}
+
+// offsets marks the offsets of a claim acked in any order. An offset is
+// only committed once all the messages before it were acked, a message
+// which is still handled or failed holds back the commit so that it is
+// delivered again after a rebalance or a restart.
+type offsets struct {
+	sync.Mutex
+	sess sarama.ConsumerGroupSession
+	// the offsets received and not yet marked, in order
+	pending []int64
+	acked   map[int64]bool
+}
+
+func newOffsets(sess sarama.ConsumerGroupSession) *offsets {
+	return &offsets{sess: sess, acked: make(map[int64]bool)}
+}
+
+// add records the offset of a message handed out
+func (o *offsets) add(offset int64) {
+	o.Lock()
+	o.pending = append(o.pending, offset)
+	o.Unlock()
+}
+
+// ack marks the offsets up to the first message not acked
+func (o *offsets) ack(msg *sarama.ConsumerMessage) {
+	o.Lock()
+	defer o.Unlock()
+
+	o.acked[msg.Offset] = true
+
+	var n int
+	for n < len(o.pending) && o.acked[o.pending[n]] {
+		delete(o.acked, o.pending[n])
+		n++
+	}
+	if n == 0 {
+		return
+	}
+	next := o.pending[n-1] + 1
+	o.pending = o.pending[n:]
+	o.sess.MarkOffset(msg.Topic, msg.Partition, next, "")
 }
 
 func (p *publication) Topic() string {
@@ -52,7 +103,7 @@ func (p *publication) Message() *broker.Message {
 }
 
 func (p *publication) Ack() error {
-	p.sess.MarkMessage(p.km, "")
+	p.offsets.ack(p.km)
 	return nil
 }
 
@@ -241,6 +292,13 @@ func NewBroker(opts ...broker.Option) broker.Broker {
 	for _, o := range opts {
 		o(&options)
 	}
+	if popts, err := paramOptions(broker.GetParams(options)); err != nil {
+		logger.Errorf("[kafka] invalid params: %v", err)
+	} else {
+		for _, o := range popts {
+			o(&options)
+		}
+	}
 
 	var cAddrs []string
 	for _, addr := range options.Addrs {
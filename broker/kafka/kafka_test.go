@@ -0,0 +1,46 @@
+package kafka
+
+import (
+	"testing"
+
+	"github.com/Shopify/sarama"
+)
+
+// session records the offsets marked
+type session struct {
+	sarama.ConsumerGroupSession
+	marked []int64
+}
+
+func (s *session) MarkOffset(topic string, partition int32, offset int64, metadata string) {
+	s.marked = append(s.marked, offset)
+}
+
+func TestOffsets(t *testing.T) {
+	sess := &session{}
+	o := newOffsets(sess)
+
+	msgs := make([]*sarama.ConsumerMessage, 4)
+	for i := range msgs {
+		msgs[i] = &sarama.ConsumerMessage{Topic: "test", Offset: int64(10 + i)}
+		o.add(msgs[i].Offset)
+	}
+
+	// a later message acked first isn't committed past the earlier ones
+	o.ack(msgs[2])
+	o.ack(msgs[1])
+	if len(sess.marked) != 0 {
+		t.Fatalf("Expected no offset marked got %v", sess.marked)
+	}
+
+	// the acked messages after the first are committed with it
+	o.ack(msgs[0])
+	if len(sess.marked) != 1 || sess.marked[0] != 13 {
+		t.Fatalf("Expected offset 13 marked got %v", sess.marked)
+	}
+
+	o.ack(msgs[3])
+	if len(sess.marked) != 2 || sess.marked[1] != 14 {
+		t.Fatalf("Expected offset 14 marked got %v", sess.marked)
+	}
+}
@@ -2,6 +2,7 @@ package kafka
 
 import (
 	"context"
+	"fmt"
 
 	"github.com/Shopify/sarama"
 	"xmicro/broker"
@@ -49,10 +50,12 @@ type consumerGroupHandler struct {
 func (*consumerGroupHandler) Setup(_ sarama.ConsumerGroupSession) error   { return nil }
 func (*consumerGroupHandler) Cleanup(_ sarama.ConsumerGroupSession) error { return nil }
 func (h *consumerGroupHandler) ConsumeClaim(sess sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	offsets := newOffsets(sess)
 	for msg := range claim.Messages() {
 		var m broker.Message
-		p := &publication{m: &m, t: msg.Topic, km: msg, cg: h.cg, sess: sess}
+		p := &publication{m: &m, t: msg.Topic, km: msg, cg: h.cg, sess: sess, offsets: offsets}
 		eh := h.kopts.ErrorHandler
+		offsets.add(msg.Offset)
 
 		if err := h.kopts.Codec.Unmarshal(msg.Value, &m); err != nil {
 			p.err = err
@@ -62,12 +65,14 @@ func (h *consumerGroupHandler) ConsumeClaim(sess sarama.ConsumerGroupSession, cl
 			} else {
 				logger.Errorf("[kafka]: failed to unmarshal: %v", err)
 			}
+			// the message can't be handled when delivered again
+			p.Ack()
 			continue
 		}
 
 		err := h.handler(p)
 		if err == nil && h.subopts.AutoAck {
-			sess.MarkMessage(msg, "")
+			p.Ack()
 		} else if err != nil {
 			p.err = err
 			if eh != nil {
@@ -79,3 +84,45 @@ func (h *consumerGroupHandler) ConsumeClaim(sess sarama.ConsumerGroupSession, cl
 	}
 	return nil
 }
+
+// paramOptions returns the options of the broker parameters version,
+// clientId and offsetsInitial, oldest or newest
+func paramOptions(params map[string]string) ([]broker.Option, error) {
+	if len(params) == 0 {
+		return nil, nil
+	}
+
+	brokerConfig := sarama.NewConfig()
+	clusterConfig := sarama.NewConfig()
+	clusterConfig.Version = sarama.V0_10_2_0
+	clusterConfig.Consumer.Return.Errors = true
+	clusterConfig.Consumer.Offsets.Initial = sarama.OffsetNewest
+
+	for k, v := range params {
+		switch k {
+		case "version":
+			version, err := sarama.ParseKafkaVersion(v)
+			if err != nil {
+				return nil, err
+			}
+			brokerConfig.Version = version
+			if version.IsAtLeast(sarama.V0_10_2_0) {
+				clusterConfig.Version = version
+			}
+		case "clientId":
+			brokerConfig.ClientID = v
+			clusterConfig.ClientID = v
+		case "offsetsInitial":
+			switch v {
+			case "oldest":
+				clusterConfig.Consumer.Offsets.Initial = sarama.OffsetOldest
+			case "newest":
+				clusterConfig.Consumer.Offsets.Initial = sarama.OffsetNewest
+			default:
+				return nil, fmt.Errorf("invalid offsetsInitial %q", v)
+			}
+		}
+	}
+
+	return []broker.Option{BrokerConfig(brokerConfig), ClusterConfig(clusterConfig)}, nil
+}
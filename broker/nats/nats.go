@@ -0,0 +1,392 @@
+// Package nats provides a NATS broker with optional JetStream persistence
+package nats
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+
+	"github.com/nats-io/nats.go"
+)
+
+import (
+	"xmicro/broker"
+	"xmicro/codec/json"
+	"xmicro/common/component"
+	"xmicro/common/constant"
+	"xmicro/logger"
+)
+
+func init() {
+	component.SetBrokerFactory(constant.NatsKey, NewBroker)
+}
+
+type natsBroker struct {
+	sync.RWMutex
+
+	addrs []string
+	conn  *nats.Conn
+	js    nats.JetStreamContext
+	opts  broker.Options
+	nopts nats.Options
+
+	// streams known to exist
+	streams map[string]bool
+}
+
+type subscriber struct {
+	s    *nats.Subscription
+	t    string
+	opts broker.SubscribeOptions
+}
+
+type publication struct {
+	t   string
+	err error
+	m   *broker.Message
+	msg *nats.Msg
+	// delivered by JetStream
+	js bool
+}
+
+func (p *publication) Topic() string {
+	return p.t
+}
+
+func (p *publication) Message() *broker.Message {
+	return p.m
+}
+
+// Ack acknowledges a JetStream message. It's a no-op for core NATS.
+func (p *publication) Ack() error {
+	if !p.js {
+		return nil
+	}
+	return p.msg.Ack()
+}
+
+// Nack asks JetStream to redeliver the message
+func (p *publication) Nack() error {
+	if !p.js {
+		return nil
+	}
+	return p.msg.Nak()
+}
+
+func (p *publication) Error() error {
+	return p.err
+}
+
+func (s *subscriber) Options() broker.SubscribeOptions {
+	return s.opts
+}
+
+func (s *subscriber) Topic() string {
+	return s.t
+}
+
+func (s *subscriber) Unsubscribe() error {
+	return s.s.Unsubscribe()
+}
+
+func (n *natsBroker) Address() string {
+	n.RLock()
+	defer n.RUnlock()
+
+	if n.conn != nil && n.conn.IsConnected() {
+		return n.conn.ConnectedUrl()
+	}
+	if len(n.addrs) > 0 {
+		return n.addrs[0]
+	}
+	return nats.DefaultURL
+}
+
+func (n *natsBroker) jetStream() bool {
+	b, _ := n.opts.Context.Value(jetStreamKey{}).(bool)
+	return b
+}
+
+func (n *natsBroker) Connect() error {
+	n.Lock()
+	defer n.Unlock()
+
+	if n.conn != nil {
+		return nil
+	}
+
+	opts := n.nopts
+	opts.Servers = n.addrs
+	opts.Secure = n.opts.Secure
+	opts.TLSConfig = n.opts.TLSConfig
+
+	// secure might not be set
+	if n.opts.TLSConfig != nil {
+		opts.Secure = true
+	}
+
+	c, err := opts.Connect()
+	if err != nil {
+		return err
+	}
+
+	if n.jetStream() {
+		js, err := c.JetStream()
+		if err != nil {
+			c.Close()
+			return err
+		}
+		n.js = js
+	}
+
+	n.conn = c
+	return nil
+}
+
+func (n *natsBroker) Disconnect() error {
+	n.Lock()
+	defer n.Unlock()
+
+	if n.conn == nil {
+		return nil
+	}
+
+	n.conn.Close()
+	n.conn = nil
+	n.js = nil
+	n.streams = make(map[string]bool)
+	return nil
+}
+
+func (n *natsBroker) Init(opts ...broker.Option) error {
+	n.Lock()
+	defer n.Unlock()
+
+	for _, o := range opts {
+		o(&n.opts)
+	}
+	n.configure()
+	return nil
+}
+
+func (n *natsBroker) configure() {
+	if nopts, ok := n.opts.Context.Value(optionsKey{}).(nats.Options); ok {
+		n.nopts = nopts
+	}
+
+	// broker.Addrs take precedence over nats.Options.Servers
+	addrs := n.opts.Addrs
+	if len(addrs) == 0 {
+		addrs = n.nopts.Servers
+	}
+
+	var cAddrs []string
+	for _, addr := range addrs {
+		if len(addr) == 0 {
+			continue
+		}
+		if !strings.HasPrefix(addr, "nats://") && !strings.HasPrefix(addr, "tls://") {
+			addr = "nats://" + addr
+		}
+		cAddrs = append(cAddrs, addr)
+	}
+	if len(cAddrs) == 0 {
+		cAddrs = []string{nats.DefaultURL}
+	}
+	n.addrs = cAddrs
+}
+
+func (n *natsBroker) Options() broker.Options {
+	return n.opts
+}
+
+// stream returns the JetStream stream holding the topic,
+// creating one named after the topic when it does not exist
+func (n *natsBroker) stream(topic string) (string, error) {
+	if name, ok := n.opts.Context.Value(streamKey{}).(string); ok && len(name) > 0 {
+		return name, nil
+	}
+
+	name := sanitize(topic)
+
+	n.Lock()
+	defer n.Unlock()
+
+	if n.js == nil {
+		return "", errors.New("not connected")
+	}
+
+	if n.streams[name] {
+		return name, nil
+	}
+
+	if _, err := n.js.StreamInfo(name); err != nil {
+		if _, err := n.js.AddStream(&nats.StreamConfig{
+			Name:     name,
+			Subjects: []string{topic},
+		}); err != nil {
+			return "", err
+		}
+	}
+
+	n.streams[name] = true
+	return name, nil
+}
+
+func (n *natsBroker) Publish(topic string, msg *broker.Message, opts ...broker.PublishOption) error {
+	b, err := n.opts.Codec.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	n.RLock()
+	conn, js := n.conn, n.js
+	n.RUnlock()
+
+	if conn == nil {
+		return errors.New("not connected")
+	}
+
+	if js == nil {
+		return conn.Publish(topic, b)
+	}
+
+	if _, err := n.stream(topic); err != nil {
+		return err
+	}
+	_, err = js.Publish(topic, b)
+	return err
+}
+
+func (n *natsBroker) Subscribe(topic string, handler broker.Handler, opts ...broker.SubscribeOption) (broker.Subscriber, error) {
+	options := broker.NewSubscribeOptions(opts...)
+
+	n.RLock()
+	conn, js := n.conn, n.js
+	n.RUnlock()
+
+	if conn == nil {
+		return nil, errors.New("not connected")
+	}
+
+	fn := func(msg *nats.Msg) {
+		var m broker.Message
+		p := &publication{m: &m, t: msg.Subject, msg: msg, js: js != nil}
+		eh := n.opts.ErrorHandler
+
+		if err := n.opts.Codec.Unmarshal(msg.Data, &m); err != nil {
+			p.err = err
+			p.m.Body = msg.Data
+			if eh != nil {
+				eh(p)
+			} else {
+				logger.Errorf("[nats]: failed to unmarshal: %v", err)
+			}
+			// never redeliver a message which can't be decoded
+			if p.js {
+				msg.Term()
+			}
+			return
+		}
+
+		if err := handler(p); err != nil {
+			p.err = err
+			p.Nack()
+			if eh != nil {
+				eh(p)
+			} else {
+				logger.Errorf("[nats]: subscriber error: %v", err)
+			}
+			return
+		}
+
+		if options.AutoAck {
+			if err := p.Ack(); err != nil {
+				logger.Errorf("[nats]: failed to ack: %v", err)
+			}
+		}
+	}
+
+	var sub *nats.Subscription
+	var err error
+
+	if js == nil {
+		if len(options.Queue) > 0 {
+			sub, err = conn.QueueSubscribe(topic, options.Queue, fn)
+		} else {
+			sub, err = conn.Subscribe(topic, fn)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return &subscriber{s: sub, t: topic, opts: options}, nil
+	}
+
+	stream, err := n.stream(topic)
+	if err != nil {
+		return nil, err
+	}
+
+	subOpts := []nats.SubOpt{nats.ManualAck(), nats.BindStream(stream)}
+	if options.MaxInFlight > 0 {
+		subOpts = append(subOpts, nats.MaxAckPending(options.MaxInFlight))
+	}
+
+	// members of a queue group share one durable consumer,
+	// otherwise each of them would receive every message
+	var durable string
+	if options.Context != nil {
+		durable, _ = options.Context.Value(durableKey{}).(string)
+	}
+	if len(durable) == 0 {
+		durable = options.Queue
+	}
+	if len(durable) > 0 {
+		subOpts = append(subOpts, nats.Durable(sanitize(durable)))
+	}
+
+	if len(options.Queue) > 0 {
+		sub, err = js.QueueSubscribe(topic, options.Queue, fn, subOpts...)
+	} else {
+		sub, err = js.Subscribe(topic, fn, subOpts...)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &subscriber{s: sub, t: topic, opts: options}, nil
+}
+
+func (n *natsBroker) String() string {
+	return "nats"
+}
+
+// sanitize replaces the characters which are not allowed
+// in stream and consumer names
+func sanitize(name string) string {
+	return strings.NewReplacer(".", "_", "*", "_", ">", "_", " ", "_").Replace(name)
+}
+
+// NewBroker returns a NATS broker. Use the JetStream option
+// for at least once delivery with acknowledgements.
+func NewBroker(opts ...broker.Option) broker.Broker {
+	options := broker.Options{
+		// Default codec
+		Codec:   json.Marshaler{},
+		Context: context.Background(),
+	}
+
+	n := &natsBroker{
+		opts:    options,
+		nopts:   nats.GetDefaultOptions(),
+		streams: make(map[string]bool),
+	}
+
+	for _, o := range opts {
+		o(&n.opts)
+	}
+	n.configure()
+
+	return n
+}
@@ -0,0 +1,120 @@
+package nats
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+
+	"xmicro/broker"
+)
+
+func runServer(t *testing.T) *server.Server {
+	s, err := server.NewServer(&server.Options{
+		Host:      "127.0.0.1",
+		Port:      -1,
+		NoLog:     true,
+		NoSigs:    true,
+		JetStream: true,
+		StoreDir:  t.TempDir(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Start()
+	if !s.ReadyForConnections(5 * time.Second) {
+		t.Fatal("nats server not ready")
+	}
+	t.Cleanup(s.Shutdown)
+	return s
+}
+
+func newBroker(t *testing.T, s *server.Server, opts ...broker.Option) broker.Broker {
+	b := NewBroker(append(opts, broker.Addrs(s.ClientURL()))...)
+	if err := b.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { b.Disconnect() })
+	return b
+}
+
+func TestQueueGroup(t *testing.T) {
+	b := newBroker(t, runServer(t))
+
+	var count int32
+	done := make(chan bool, 10)
+
+	for i := 0; i < 2; i++ {
+		_, err := b.Subscribe("orders", func(e broker.Event) error {
+			atomic.AddInt32(&count, 1)
+			done <- true
+			return nil
+		}, broker.Queue("billing"))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for i := 0; i < 4; i++ {
+		if err := b.Publish("orders", &broker.Message{Body: []byte("hello")}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for i := 0; i < 4; i++ {
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for messages")
+		}
+	}
+
+	// give duplicates a chance to arrive
+	time.Sleep(100 * time.Millisecond)
+
+	if c := atomic.LoadInt32(&count); c != 4 {
+		t.Fatalf("Expected 4 messages for the queue group got %d", c)
+	}
+}
+
+func TestJetStreamRedelivery(t *testing.T) {
+	b := newBroker(t, runServer(t), JetStream())
+
+	var attempts int32
+	done := make(chan *broker.Message, 1)
+
+	_, err := b.Subscribe("payments.created", func(e broker.Event) error {
+		// fail the first delivery, the nak asks for a redelivery
+		if atomic.AddInt32(&attempts, 1) == 1 {
+			return errors.New("not yet")
+		}
+		done <- e.Message()
+		return nil
+	}, broker.Queue("ledger"), Durable("ledger"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg := &broker.Message{
+		Header: map[string]string{"Micro-Id": "1"},
+		Body:   []byte(`{"amount":1}`),
+	}
+	if err := b.Publish("payments.created", msg); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case m := <-done:
+		if m.Header["Micro-Id"] != "1" || string(m.Body) != `{"amount":1}` {
+			t.Fatalf("Unexpected message %+v", m)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out waiting for redelivery")
+	}
+
+	if a := atomic.LoadInt32(&attempts); a != 2 {
+		t.Fatalf("Expected 2 delivery attempts got %d", a)
+	}
+}
@@ -0,0 +1,41 @@
+package nats
+
+import (
+	"github.com/nats-io/nats.go"
+
+	"xmicro/broker"
+	"xmicro/server"
+)
+
+type optionsKey struct{}
+type jetStreamKey struct{}
+type streamKey struct{}
+type durableKey struct{}
+
+// Options accepts nats.Options
+func Options(opts nats.Options) broker.Option {
+	return setBrokerOption(optionsKey{}, opts)
+}
+
+// JetStream publishes and consumes through JetStream instead of core
+// NATS. Messages are persisted and must be acknowledged by subscribers.
+func JetStream() broker.Option {
+	return setBrokerOption(jetStreamKey{}, true)
+}
+
+// Stream binds every topic to an existing JetStream stream. By default
+// a stream named after the topic is created on first use.
+func Stream(name string) broker.Option {
+	return setBrokerOption(streamKey{}, name)
+}
+
+// Durable sets the name of the JetStream consumer so that delivery
+// resumes where it stopped after the subscriber reconnects.
+func Durable(name string) broker.SubscribeOption {
+	return setSubscribeOption(durableKey{}, name)
+}
+
+// SubscriberDurable sets the durable consumer name of a server subscriber
+func SubscriberDurable(name string) server.SubscriberOption {
+	return setServerSubscriberOption(durableKey{}, name)
+}
@@ -39,6 +39,10 @@ type SubscribeOptions struct {
 	// will create a shared subscription where each
 	// receives a subset of messages.
 	Queue string
+	// MaxInFlight bounds the events handed out and not yet acked, the
+	// broker default if 0. Brokers which bound the unacked deliveries,
+	// the RabbitMQ prefetch and the JetStream max ack pending, use it.
+	MaxInFlight int
 
 	// Other options for implementations of the interface
 	// can be stored in a context
@@ -93,6 +97,14 @@ func DisableAutoAck() SubscribeOption {
 	}
 }
 
+// MaxInFlight bounds the events handed out and not yet acked so that a
+// subscriber acking asynchronously holds back the broker when behind
+func MaxInFlight(n int) SubscribeOption {
+	return func(o *SubscribeOptions) {
+		o.MaxInFlight = n
+	}
+}
+
 // ErrorHandler will catch all broker errors that cant be handled
 // in normal way, for example Codec errors
 func ErrorHandler(h Handler) Option {
@@ -128,6 +140,28 @@ func TLSConfig(t *tls.Config) Option {
 	}
 }
 
+type paramsKey struct{}
+
+// Params passes the parameters of the implementation, usually read from
+// the configuration. Each implementation documents the ones it supports.
+func Params(p map[string]string) Option {
+	return func(o *Options) {
+		if o.Context == nil {
+			o.Context = context.Background()
+		}
+		o.Context = context.WithValue(o.Context, paramsKey{}, p)
+	}
+}
+
+// GetParams returns the parameters of the implementation
+func GetParams(o Options) map[string]string {
+	if o.Context == nil {
+		return nil
+	}
+	p, _ := o.Context.Value(paramsKey{}).(map[string]string)
+	return p
+}
+
 // SubscribeContext set context
 func SubscribeContext(ctx context.Context) SubscribeOption {
 	return func(o *SubscribeOptions) {
@@ -218,8 +218,13 @@ func (r *rabbitMQConn) tryConnect(secure bool, config *amqp.Config) error {
 	return err
 }
 
-func (r *rabbitMQConn) Consume(queue, key string, headers amqp.Table, qArgs amqp.Table, autoAck, durableQueue bool) (*rabbitMQChannel, <-chan amqp.Delivery, error) {
-	consumerChannel, err := newRabbitChannel(r.Connection, r.prefetchCount, r.prefetchGlobal)
+// Consume consumes the queue on its own channel, the prefetch count of the
+// connection is used unless prefetchCount is set
+func (r *rabbitMQConn) Consume(queue, key string, headers amqp.Table, qArgs amqp.Table, autoAck, durableQueue bool, prefetchCount int) (*rabbitMQChannel, <-chan amqp.Delivery, error) {
+	if prefetchCount <= 0 {
+		prefetchCount = r.prefetchCount
+	}
+	consumerChannel, err := newRabbitChannel(r.Connection, prefetchCount, r.prefetchGlobal)
 	if err != nil {
 		return nil, nil, err
 	}
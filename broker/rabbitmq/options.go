@@ -2,8 +2,10 @@ package rabbitmq
 
 import (
 	"context"
+	"strconv"
 
 	"xmicro/broker"
+	"xmicro/logger"
 )
 
 type durableQueueKey struct{}
@@ -85,3 +87,40 @@ type ackSuccessKey struct{}
 func AckOnSuccess() broker.SubscribeOption {
 	return setSubscribeOption(ackSuccessKey{}, true)
 }
+
+// paramOptions returns the options of the broker parameters exchange,
+// durableExchange, prefetchCount, prefetchGlobal and externalAuth
+func paramOptions(params map[string]string) []broker.Option {
+	var opts []broker.Option
+	for k, v := range params {
+		switch k {
+		case "exchange":
+			opts = append(opts, ExchangeName(v))
+		case "prefetchCount":
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				logger.Errorf("[rabbitmq] invalid %s %q: %v", k, v, err)
+				continue
+			}
+			opts = append(opts, PrefetchCount(n))
+		case "durableExchange", "prefetchGlobal", "externalAuth":
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				logger.Errorf("[rabbitmq] invalid %s %q: %v", k, v, err)
+				continue
+			}
+			if !b {
+				continue
+			}
+			switch k {
+			case "durableExchange":
+				opts = append(opts, DurableExchange())
+			case "prefetchGlobal":
+				opts = append(opts, PrefetchGlobal())
+			default:
+				opts = append(opts, ExternalAuth())
+			}
+		}
+	}
+	return opts
+}
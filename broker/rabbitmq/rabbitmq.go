@@ -9,6 +9,8 @@ import (
 
 	"github.com/streadway/amqp"
 	"xmicro/broker"
+	"xmicro/common/component"
+	"xmicro/common/constant"
 )
 
 type rbroker struct {
@@ -42,13 +44,18 @@ type publication struct {
 }
 
 func init() {
-	cmd.DefaultBrokers["rabbitmq"] = NewBroker
+	component.SetBrokerFactory(constant.RabbitmqKey, NewBroker)
 }
 
 func (p *publication) Ack() error {
 	return p.d.Ack(false)
 }
 
+// Nack requeues the message
+func (p *publication) Nack() error {
+	return p.d.Nack(false, true)
+}
+
 func (p *publication) Error() error {
 	return p.err
 }
@@ -117,6 +124,8 @@ func (s *subscriber) resubscribe() {
 			s.queueArgs,
 			s.opts.AutoAck,
 			s.durableQueue,
+			// the unacked deliveries are bounded by the subscriber
+			s.opts.MaxInFlight,
 		)
 
 		s.r.mtx.Unlock()
@@ -302,6 +311,9 @@ func NewBroker(opts ...broker.Option) broker.Broker {
 	for _, o := range opts {
 		o(&options)
 	}
+	for _, o := range paramOptions(broker.GetParams(options)) {
+		o(&options)
+	}
 
 	return &rbroker{
 		addrs: options.Addrs,
@@ -1,9 +1,11 @@
 package redis
 
 import (
+	"strconv"
 	"time"
 
 	"xmicro/broker"
+	"xmicro/logger"
 )
 
 var (
@@ -70,3 +72,41 @@ func IdleTimeout(d time.Duration) broker.Option {
 		bo.idleTimeout = d
 	}
 }
+
+// paramOptions returns the options of the broker parameters maxIdle,
+// maxActive, idleTimeout, connectTimeout, readTimeout and writeTimeout
+func paramOptions(params map[string]string) []broker.Option {
+	var opts []broker.Option
+	for k, v := range params {
+		switch k {
+		case "maxIdle", "maxActive":
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				logger.Errorf("[redis] invalid %s %q: %v", k, v, err)
+				continue
+			}
+			if k == "maxIdle" {
+				opts = append(opts, MaxIdle(n))
+			} else {
+				opts = append(opts, MaxActive(n))
+			}
+		case "idleTimeout", "connectTimeout", "readTimeout", "writeTimeout":
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				logger.Errorf("[redis] invalid %s %q: %v", k, v, err)
+				continue
+			}
+			switch k {
+			case "idleTimeout":
+				opts = append(opts, IdleTimeout(d))
+			case "connectTimeout":
+				opts = append(opts, ConnectTimeout(d))
+			case "readTimeout":
+				opts = append(opts, ReadTimeout(d))
+			default:
+				opts = append(opts, WriteTimeout(d))
+			}
+		}
+	}
+	return opts
+}
@@ -8,9 +8,15 @@ import (
 	"xmicro/broker"
 	"xmicro/codec"
 	"xmicro/codec/json"
+	"xmicro/common/component"
+	"xmicro/common/constant"
 	"xmicro/logger"
 )
 
+func init() {
+	component.SetBrokerFactory(constant.RedisKey, NewBroker)
+}
+
 // publication is an internal publication for the Redis broker.
 type publication struct {
 	topic   string
@@ -258,6 +264,9 @@ func NewBroker(opts ...broker.Option) broker.Broker {
 	for _, o := range opts {
 		o(&options)
 	}
+	for _, o := range paramOptions(broker.GetParams(options)) {
+		o(&options)
+	}
 
 	return &redisBroker{
 		opts:  options,
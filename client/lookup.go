@@ -27,6 +27,11 @@ func LookupRoute(ctx context.Context, req Request, opts CallOptions) ([]string,
 		query = append(query, router.LookupNetwork(opts.Network))
 	}
 
+	// a domain requested for the call is looked up instead of the one of the router
+	if len(opts.Domain) > 0 {
+		query = append(query, router.LookupDomain(opts.Domain))
+	}
+
 	// lookup the routes which can be used to execute the request
 	routes, err := opts.Router.Lookup(req.Service(), query...)
 	if err == router.ErrRouteNotFound {
@@ -35,8 +40,9 @@ func LookupRoute(ctx context.Context, req Request, opts CallOptions) ([]string,
 		return nil, errors.InternalServerError("micro", "error getting next %s node: %s", req.Service(), err.Error())
 	}
 
-	// sort by lowest metric first
-	sort.Slice(routes, func(i, j int) bool {
+	// sort by lowest metric first, the routes which cost more are
+	// left for the selector and the retries to fall through to
+	sort.SliceStable(routes, func(i, j int) bool {
 		return routes[i].Metric < routes[j].Metric
 	})
 
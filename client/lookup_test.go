@@ -0,0 +1,94 @@
+package client
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"xmicro/registry"
+	"xmicro/registry/memory"
+	"xmicro/router"
+	regRouter "xmicro/router/registry"
+)
+
+type lookupRequest struct {
+	Request
+}
+
+func (lookupRequest) Service() string {
+	return "greeter"
+}
+
+func TestLookupRouteDomain(t *testing.T) {
+	reg := memory.NewRegistry()
+	for domain, address := range map[string]string{
+		registry.DefaultDomain: "10.0.0.1:8080",
+		"staging":              "10.0.0.2:8080",
+	} {
+		s := &registry.Service{
+			Name:  "greeter",
+			Nodes: []*registry.Node{{Id: "greeter-" + domain, Address: address}},
+		}
+		if err := reg.Register(s, registry.RegisterDomain(domain)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r := regRouter.NewRouter(router.Registry(reg), router.Domain(registry.DefaultDomain))
+	defer r.Close()
+
+	for _, tc := range []struct {
+		domain string
+		want   []string
+	}{
+		{want: []string{"10.0.0.1:8080"}},
+		{domain: "staging", want: []string{"10.0.0.2:8080"}},
+	} {
+		var opts CallOptions
+		for _, o := range []CallOption{WithRouter(r), WithDomain(tc.domain)} {
+			o(&opts)
+		}
+		addrs, err := LookupRoute(context.Background(), lookupRequest{}, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(addrs, tc.want) {
+			t.Fatalf("Expected %v in domain %q got %v", tc.want, tc.domain, addrs)
+		}
+	}
+
+	var opts CallOptions
+	WithRouter(r)(&opts)
+	WithDomain("unknown")(&opts)
+	if _, err := LookupRoute(context.Background(), lookupRequest{}, opts); err == nil {
+		t.Fatal("Expected an error for an unknown domain")
+	}
+}
+
+func TestLookupRouteMetric(t *testing.T) {
+	reg := memory.NewRegistry()
+	s := &registry.Service{
+		Name: "greeter",
+		Nodes: []*registry.Node{
+			{Id: "greeter-a", Address: "10.0.0.1:8080", Metadata: map[string]string{registry.ZoneKey: "zone-a"}},
+			{Id: "greeter-b", Address: "10.0.0.2:8080", Metadata: map[string]string{registry.ZoneKey: "zone-b"}},
+		},
+	}
+	if err := reg.Register(s); err != nil {
+		t.Fatal(err)
+	}
+
+	r := regRouter.NewRouter(router.Registry(reg), router.Zone("zone-b"))
+	defer r.Close()
+
+	// the routes of other zones cost more but are kept to fall through to
+	var opts CallOptions
+	WithRouter(r)(&opts)
+	addrs, err := LookupRoute(context.Background(), lookupRequest{}, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"10.0.0.2:8080", "10.0.0.1:8080"}; !reflect.DeepEqual(addrs, want) {
+		t.Fatalf("Expected %v got %v", want, addrs)
+	}
+}
@@ -15,6 +15,7 @@ import (
 	"xmicro/selector"
 	"xmicro/selector/roundrobin"
 	"xmicro/transport"
+	"xmicro/util/cloudevents"
 )
 
 type Options struct {
@@ -40,6 +41,11 @@ type Options struct {
 	// Middleware for client
 	Wrappers []Wrapper
 
+	// Envelope published messages as CloudEvents
+	// from the given source, disabled by default
+	Envelope cloudevents.Mode
+	Source   string
+
 	// Default Call Options
 	CallOptions CallOptions
 
@@ -73,6 +79,10 @@ type CallOptions struct {
 	AuthToken bool
 	// Network to lookup the route within
 	Network string
+	// Registry domain to lookup the service in
+	Domain string
+	// Send the request over the broker rather than the transport
+	BrokerCall bool
 
 	// Middleware for low level call func
 	CallWrappers []CallWrapper
@@ -187,6 +197,13 @@ func Registry(r registry.Registry) Option {
 	}
 }
 
+// Zone prefers the routes to the nodes in the zone
+func Zone(z string) Option {
+	return func(o *Options) {
+		o.Router.Init(router.Zone(z))
+	}
+}
+
 // Router is used to lookup routes for a service
 func Router(r router.Router) Option {
 	return func(o *Options) {
@@ -201,6 +218,15 @@ func Selector(s selector.Selector) Option {
 	}
 }
 
+// CloudEvents wraps published messages in a CloudEvents envelope using the
+// binary or structured content mode. The source is usually the service name.
+func CloudEvents(mode cloudevents.Mode, source string) Option {
+	return func(o *Options) {
+		o.Envelope = mode
+		o.Source = source
+	}
+}
+
 // Adds a Wrapper to a list of options passed into the client
 func Wrap(w Wrapper) Option {
 	return func(o *Options) {
@@ -245,6 +271,14 @@ func Retry(fn RetryFunc) Option {
 	}
 }
 
+// BrokerCall sends requests over the broker by default. The request is
+// published to the service name and the response awaited on a reply topic.
+func BrokerCall(b bool) Option {
+	return func(o *Options) {
+		o.CallOptions.BrokerCall = b
+	}
+}
+
 // The request timeout.
 // Should this be a Call Option?
 func RequestTimeout(d time.Duration) Option {
@@ -359,6 +393,22 @@ func WithNetwork(n string) CallOption {
 	}
 }
 
+// WithDomain is a CallOption which looks the service up in the registry
+// domain instead of the domain of the router
+func WithDomain(d string) CallOption {
+	return func(o *CallOptions) {
+		o.Domain = d
+	}
+}
+
+// WithBrokerCall is a CallOption which overrides that which
+// set in Options.CallOptions
+func WithBrokerCall(b bool) CallOption {
+	return func(o *CallOptions) {
+		o.BrokerCall = b
+	}
+}
+
 // WithRouter sets the router to use for this call
 func WithRouter(r router.Router) CallOption {
 	return func(o *CallOptions) {
@@ -16,7 +16,9 @@ import (
 	"xmicro/metadata"
 	"xmicro/transport"
 	"xmicro/util/buf"
+	"xmicro/util/cloudevents"
 	"xmicro/util/pool"
+	"xmicro/util/socket"
 )
 
 type rpcClient struct {
@@ -24,6 +26,9 @@ type rpcClient struct {
 	opts client.Options
 	pool pool.Pool
 	seq  uint64
+
+	// routes responses of calls made over the broker
+	replies *replyRouter
 }
 
 // NewClient returns a new micro client interface
@@ -37,9 +42,10 @@ func NewClient(opt ...client.Option) client.Client {
 	)
 
 	rc := &rpcClient{
-		opts: opts,
-		pool: p,
-		seq:  0,
+		opts:    opts,
+		pool:    p,
+		seq:     0,
+		replies: newReplyRouter("micro.reply." + uuid.New().String()),
 	}
 	rc.once.Store(false)
 
@@ -173,6 +179,143 @@ func (r *rpcClient) call(ctx context.Context, addr string, req client.Request, r
 	return nil
 }
 
+// brokerCall publishes the request to the service topic and waits for the
+// response published to the reply topic of the client
+func (r *rpcClient) brokerCall(ctx context.Context, topic string, req client.Request, resp interface{}, opts client.CallOptions) error {
+	msg := &transport.Message{
+		Header: make(map[string]string),
+	}
+
+	md, ok := metadata.FromContext(ctx)
+	if ok {
+		for k, v := range md {
+			// don't copy Micro-Topic header, that used for pub/sub
+			if k == "Micro-Topic" {
+				continue
+			}
+			msg.Header[k] = v
+		}
+	}
+
+	// set timeout in nanoseconds
+	msg.Header["Timeout"] = fmt.Sprintf("%d", opts.RequestTimeout)
+	// set the content type for the request
+	msg.Header["Content-Type"] = req.ContentType()
+	// set the accept header
+	msg.Header["Accept"] = req.ContentType()
+
+	cf, err := r.newCodec(req.ContentType())
+	if err != nil {
+		return errors.InternalServerError("micro", err.Error())
+	}
+
+	if err := r.connect(); err != nil {
+		return errors.InternalServerError("micro", err.Error())
+	}
+
+	if err := r.replies.subscribe(r.opts.Broker); err != nil {
+		return errors.InternalServerError("micro", "reply subscribe error: %v", err)
+	}
+
+	// the correlation id ties the response to this call
+	id := uuid.New().String()
+	msg.Header["Micro-Correlation-Id"] = id
+	msg.Header["Micro-Reply-To"] = r.replies.topic
+
+	// the pseudo socket carries the request out and the response in
+	sock := socket.New(id)
+	r.replies.add(id, sock)
+
+	seq := atomic.AddUint64(&r.seq, 1) - 1
+	codec := newRpcCodec(msg, sock, cf, "")
+
+	rsp := &rpcResponse{
+		socket: sock,
+		codec:  codec,
+	}
+
+	stream := &rpcStream{
+		id:       fmt.Sprintf("%v", seq),
+		context:  ctx,
+		request:  req,
+		response: rsp,
+		codec:    codec,
+		closed:   make(chan bool),
+		release:  func(err error) { r.replies.remove(id) },
+		sendEOS:  false,
+	}
+	// close the stream on exiting this function
+	defer stream.Close()
+
+	// wait for error response
+	ch := make(chan error, 1)
+
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				ch <- errors.InternalServerError("micro", "panic recovered: %v", r)
+			}
+		}()
+
+		// encode the request onto the socket
+		if err := stream.Send(req.Body()); err != nil {
+			ch <- err
+			return
+		}
+
+		var out transport.Message
+		if err := sock.Process(&out); err != nil {
+			ch <- errors.InternalServerError("micro", err.Error())
+			return
+		}
+
+		// publish the request to the service
+		if err := r.opts.Broker.Publish(topic, &broker.Message{
+			Header: out.Header,
+			Body:   out.Body,
+		}, broker.PublishContext(ctx)); err != nil {
+			ch <- errors.InternalServerError("micro", "publish error: %v", err)
+			return
+		}
+
+		// recv response
+		if err := stream.Recv(resp); err != nil {
+			ch <- err
+			return
+		}
+
+		// success
+		ch <- nil
+	}()
+
+	var grr error
+
+	select {
+	case err := <-ch:
+		return err
+	case <-ctx.Done():
+		grr = errors.Timeout("micro", fmt.Sprintf("%v", ctx.Err()))
+	}
+
+	stream.Lock()
+	stream.err = grr
+	stream.Unlock()
+
+	return grr
+}
+
+// connect connects the broker on first use
+func (r *rpcClient) connect() error {
+	if r.once.Load().(bool) {
+		return nil
+	}
+	if err := r.opts.Broker.Connect(); err != nil {
+		return err
+	}
+	r.once.Store(true)
+	return nil
+}
+
 func (r *rpcClient) stream(ctx context.Context, addr string, req client.Request, opts client.CallOptions) (client.Stream, error) {
 	msg := &transport.Message{
 		Header: make(map[string]string),
@@ -332,6 +475,11 @@ func (r *rpcClient) Call(ctx context.Context, request client.Request, response i
 	// make copy of call method
 	rcall := r.call
 
+	// requests over the broker go to the service topic
+	if callOpts.BrokerCall {
+		rcall = r.brokerCall
+	}
+
 	// wrap the call in reverse
 	for i := len(callOpts.CallWrappers); i > 0; i-- {
 		rcall = callOpts.CallWrappers[i-1](rcall)
@@ -352,6 +500,11 @@ func (r *rpcClient) Call(ctx context.Context, request client.Request, response i
 		callOpts.Address = []string{r.opts.Proxy}
 	}
 
+	// the broker routes the request so the topic is the only address
+	if callOpts.BrokerCall {
+		callOpts.Address = []string{request.Service()}
+	}
+
 	// lookup the route to send the reques to
 	// TODO apply any filtering here
 	routes, err := r.opts.Lookup(ctx, request, callOpts)
@@ -385,7 +538,7 @@ func (r *rpcClient) Call(ctx context.Context, request client.Request, response i
 		err = rcall(ctx, node, request, response, callOpts)
 
 		// record the result of the call to inform future routing decisions
-		r.opts.Selector.Record(node, err)
+		callOpts.Selector.Record(node, err)
 
 		return err
 	}
@@ -492,7 +645,7 @@ func (r *rpcClient) Stream(ctx context.Context, request client.Request, opts ...
 		stream, err := r.stream(ctx, node, request, callOpts)
 
 		// record the result of the call to inform future routing decisions
-		r.opts.Selector.Record(node, err)
+		callOpts.Selector.Record(node, err)
 
 		return stream, err
 	}
@@ -600,17 +753,23 @@ func (r *rpcClient) Publish(ctx context.Context, msg client.Message, opts ...cli
 		body = b.Bytes()
 	}
 
-	if !r.once.Load().(bool) {
-		if err = r.opts.Broker.Connect(); err != nil {
-			return errors.InternalServerError("micro", err.Error())
-		}
-		r.once.Store(true)
+	if err = r.connect(); err != nil {
+		return errors.InternalServerError("micro", err.Error())
 	}
 
-	return r.opts.Broker.Publish(topic, &broker.Message{
+	m := &broker.Message{
 		Header: md,
 		Body:   body,
-	}, broker.PublishContext(options.Context))
+	}
+
+	// wrap the message in a cloudevents envelope
+	if r.opts.Envelope > 0 {
+		if m, err = cloudevents.Encode(m, r.opts.Envelope, r.opts.Source, msg.Topic()); err != nil {
+			return errors.InternalServerError("micro", err.Error())
+		}
+	}
+
+	return r.opts.Broker.Publish(topic, m, broker.PublishContext(options.Context))
 }
 
 func (r *rpcClient) NewMessage(topic string, message interface{}, opts ...client.MessageOption) client.Message {
@@ -0,0 +1,77 @@
+package rpc
+
+import (
+	"sync"
+
+	"xmicro/broker"
+	"xmicro/transport"
+	"xmicro/util/socket"
+)
+
+// replyRouter routes responses published to the reply topic of
+// the client back to the calls waiting on them
+type replyRouter struct {
+	sync.Mutex
+	topic string
+	sub   broker.Subscriber
+	calls map[string]*socket.Socket
+}
+
+func newReplyRouter(topic string) *replyRouter {
+	return &replyRouter{
+		topic: topic,
+		calls: make(map[string]*socket.Socket),
+	}
+}
+
+// subscribe subscribes to the reply topic once
+func (r *replyRouter) subscribe(b broker.Broker) error {
+	r.Lock()
+	defer r.Unlock()
+
+	if r.sub != nil {
+		return nil
+	}
+
+	sub, err := b.Subscribe(r.topic, r.handle)
+	if err != nil {
+		return err
+	}
+
+	r.sub = sub
+	return nil
+}
+
+// add registers a call waiting for a response with the correlation id
+func (r *replyRouter) add(id string, sock *socket.Socket) {
+	r.Lock()
+	r.calls[id] = sock
+	r.Unlock()
+}
+
+func (r *replyRouter) remove(id string) {
+	r.Lock()
+	delete(r.calls, id)
+	r.Unlock()
+}
+
+func (r *replyRouter) handle(e broker.Event) error {
+	msg := e.Message()
+	if msg == nil {
+		return nil
+	}
+
+	r.Lock()
+	sock, ok := r.calls[msg.Header["Micro-Correlation-Id"]]
+	r.Unlock()
+
+	// the call already timed out or was answered
+	if !ok {
+		return nil
+	}
+
+	return sock.Accept(&transport.Message{
+		Header: msg.Header,
+		Body:   msg.Body,
+	})
+}
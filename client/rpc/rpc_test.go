@@ -0,0 +1,103 @@
+package rpc
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	mbroker "xmicro/broker/memory"
+	"xmicro/client"
+	"xmicro/errors"
+	"xmicro/server"
+	srpc "xmicro/server/rpc"
+)
+
+type HelloRequest struct {
+	Name string
+}
+
+type HelloResponse struct {
+	Greeting string
+}
+
+type Greeter struct {
+	// the calls failing before the handler succeeds
+	failures int32
+}
+
+func (h *Greeter) Hello(ctx context.Context, req *HelloRequest, rsp *HelloResponse) error {
+	if req.Name == "" {
+		return errors.BadRequest("test", "name is required")
+	}
+	if atomic.AddInt32(&h.failures, -1) >= 0 {
+		return errors.InternalServerError("test", "temporary failure")
+	}
+	rsp.Greeting = "hello " + req.Name
+	return nil
+}
+
+func TestBrokerCall(t *testing.T) {
+	b := mbroker.NewBroker()
+	h := &Greeter{}
+
+	srv := srpc.NewServer(
+		server.Name("test"),
+		server.Broker(b),
+		server.BrokerRequests(true),
+	)
+	if err := srv.Handle(srv.NewHandler(h)); err != nil {
+		t.Fatalf("Unexpected handle error %v", err)
+	}
+	if err := srv.Start(); err != nil {
+		t.Fatalf("Unexpected start error %v", err)
+	}
+	defer srv.Stop()
+
+	c := NewClient(client.Broker(b), client.Retries(0))
+	ctx := context.Background()
+
+	// the reply is published back to the caller
+	var rsp HelloResponse
+	req := c.NewRequest("test", "Greeter.Hello", &HelloRequest{Name: "john"})
+	if err := c.Call(ctx, req, &rsp, client.WithBrokerCall(true)); err != nil {
+		t.Fatalf("Unexpected call error %v", err)
+	}
+	if rsp.Greeting != "hello john" {
+		t.Fatalf("Expected greeting hello john got %s", rsp.Greeting)
+	}
+
+	// the handler error is passed back to the caller
+	req = c.NewRequest("test", "Greeter.Hello", &HelloRequest{})
+	err := c.Call(ctx, req, &rsp, client.WithBrokerCall(true))
+	if e := errors.Parse(err.Error()); e.Code != 400 || e.Detail != "name is required" {
+		t.Fatalf("Expected bad request got %v", err)
+	}
+
+	// the call times out without a responder
+	req = c.NewRequest("unknown", "Greeter.Hello", &HelloRequest{Name: "john"})
+	start := time.Now()
+	err = c.Call(ctx, req, &rsp, client.WithBrokerCall(true), client.WithRequestTimeout(100*time.Millisecond))
+	if e := errors.Parse(err.Error()); e.Code != 408 {
+		t.Fatalf("Expected timeout got %v", err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Fatalf("Expected the call to time out after 100ms got %v", d)
+	}
+
+	// the failed attempts are retried
+	atomic.StoreInt32(&h.failures, 2)
+	rsp = HelloResponse{}
+	req = c.NewRequest("test", "Greeter.Hello", &HelloRequest{Name: "jane"})
+	err = c.Call(ctx, req, &rsp, client.WithBrokerCall(true),
+		client.WithRetries(2), client.WithRetry(client.RetryOnError))
+	if err != nil {
+		t.Fatalf("Unexpected call error %v", err)
+	}
+	if rsp.Greeting != "hello jane" {
+		t.Fatalf("Expected greeting hello jane got %s", rsp.Greeting)
+	}
+	if n := atomic.LoadInt32(&h.failures); n != -1 {
+		t.Fatalf("Expected 3 attempts got %d", 2-n)
+	}
+}
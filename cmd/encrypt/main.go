@@ -0,0 +1,52 @@
+// Command encrypt seals a value into the ENC(...) syntax of the config
+// files, or generates a key with -gen.
+//
+//	go run ./cmd/encrypt -gen
+//	XMICRO_ENC_KEY=<key> go run ./cmd/encrypt <value>
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"os"
+)
+
+import (
+	"xmicro/common/constant"
+	"xmicro/config/encrypt"
+)
+
+func main() {
+	gen := flag.Bool("gen", false, "generate a base64 key of 32 bytes")
+	key := flag.String("key", os.Getenv(constant.EncryptKeyEnv), "the base64 key, "+constant.EncryptKeyEnv+" by default")
+	flag.Parse()
+
+	if *gen {
+		b := make([]byte, 32)
+		if _, err := rand.Read(b); err != nil {
+			fail(err)
+		}
+		fmt.Println(base64.StdEncoding.EncodeToString(b))
+		return
+	}
+
+	if flag.NArg() != 1 {
+		fail(fmt.Errorf("usage: encrypt [-key base64] <value>"))
+	}
+	b, err := base64.StdEncoding.DecodeString(*key)
+	if err != nil {
+		fail(fmt.Errorf("invalid key: %v", err))
+	}
+	value, err := encrypt.Encrypt(b, flag.Arg(0))
+	if err != nil {
+		fail(err)
+	}
+	fmt.Println(value)
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(1)
+}
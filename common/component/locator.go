@@ -1,8 +1,17 @@
 package component
 
 import (
+	"xmicro/broker"
+	mbroker "xmicro/broker/memory"
+	"xmicro/common/constant"
 	"xmicro/config"
+	"xmicro/config/encrypt"
 	"xmicro/registry"
+	"xmicro/selector"
+	"xmicro/selector/random"
+	"xmicro/selector/roundrobin"
+	"xmicro/transport"
+	tmem "xmicro/transport/memory"
 )
 
 // component manager
@@ -31,3 +40,75 @@ func GetRegistryFactory(com string) registry.RegistryFactory {
 	}
 	return registryFactories[com]
 }
+
+// the memory broker is built in, the others register themselves
+var brokerFactories = map[string]func(...broker.Option) broker.Broker{
+	constant.MemoryKey: mbroker.NewBroker,
+}
+
+func SetBrokerFactory(com string, factory func(...broker.Option) broker.Broker) {
+	brokerFactories[com] = factory
+}
+
+func GetBrokerFactory(com string) func(...broker.Option) broker.Broker {
+	if brokerFactories[com] == nil {
+		panic("BrokerFactory for " + com + " is not existing, make sure you have import the package.")
+	}
+	return brokerFactories[com]
+}
+
+// the memory transport is built in, the others register themselves
+var transportFactories = map[string]func(...transport.Option) transport.Transport{
+	constant.MemoryKey: tmem.NewTransport,
+}
+
+func SetTransportFactory(com string, factory func(...transport.Option) transport.Transport) {
+	transportFactories[com] = factory
+}
+
+func GetTransportFactory(com string) func(...transport.Option) transport.Transport {
+	if transportFactories[com] == nil {
+		panic("TransportFactory for " + com + " is not existing, make sure you have import the package.")
+	}
+	return transportFactories[com]
+}
+
+// the selectors are built in, the client depends on them
+var selectorFactories = map[string]func(...selector.Option) selector.Selector{
+	constant.RandomKey:     random.NewSelector,
+	constant.RoundRobinKey: roundrobin.NewSelector,
+}
+
+func SetSelectorFactory(com string, factory func(...selector.Option) selector.Selector) {
+	selectorFactories[com] = factory
+}
+
+func GetSelectorFactory(com string) func(...selector.Option) selector.Selector {
+	if selectorFactories[com] == nil {
+		panic("SelectorFactory for " + com + " is not existing, make sure you have import the package.")
+	}
+	return selectorFactories[com]
+}
+
+// HasSelectorFactory reports whether the selector is registered
+func HasSelectorFactory(com string) bool {
+	return selectorFactories[com] != nil
+}
+
+// the key providers of the encrypted config values are built in
+var keyProviderFactories = map[string]encrypt.KeyProviderFactory{
+	constant.FILE_KEY:        encrypt.NewFileKeyProvider,
+	constant.EncryptEnvKey:   encrypt.NewEnvKeyProvider,
+	constant.EncryptVaultKey: encrypt.NewVaultKeyProvider,
+}
+
+func SetKeyProviderFactory(com string, factory encrypt.KeyProviderFactory) {
+	keyProviderFactories[com] = factory
+}
+
+func GetKeyProviderFactory(com string) encrypt.KeyProviderFactory {
+	if keyProviderFactories[com] == nil {
+		panic("KeyProviderFactory for " + com + " is not existing, make sure you have import the package.")
+	}
+	return keyProviderFactories[com]
+}
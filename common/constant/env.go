@@ -27,4 +27,10 @@ const (
 	AppLogConfFile = "APP_LOG_CONF_FILE"
 	// CONF_ROUTER_FILE_PATH Specify Path variable of router config file
 	ConfRouterFilePath = "CONF_ROUTER_FILE_PATH"
+	// XMICRO_REGISTRY_ADDRESS overrides registry.address of the config file
+	ConfEnvPrefix = "XMICRO_"
+	// XMICRO_ENC_KEY holds the base64 key of the ENC(...) values by default
+	EncryptKeyEnv = "XMICRO_ENC_KEY"
+	// VAULT_TOKEN is the token of the vault key provider if not configured
+	VaultTokenEnv = "VAULT_TOKEN"
 )
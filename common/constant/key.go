@@ -62,6 +62,23 @@ const (
 	WrapperSentinelKey  = "sentinel"
 )
 
+// the parameters of the configurator rules applied to the routes
+const (
+	DisabledKey  = "disabled"
+	ProviderSide = "provider"
+	ConsumerSide = "consumer"
+)
+
+// the keys of the environment applied to the running service
+const (
+	TuningLogLevelKey       = "logger.level"
+	TuningRequestTimeoutKey = "requestTimeout"
+	TuningRetriesKey        = "retries"
+	TuningSelectorKey       = "selector"
+	TuningRateLimitKey      = "rateLimit"
+	TuningWrapperKey        = "wrapper"
+)
+
 const (
 	TimestampKey       = "timestamp"
 	RemoteTimestampKey = "remote.timestamp"
@@ -148,10 +165,17 @@ const (
 	NacosNamespaceId          = "namespaceId"
 	NacosPassword             = "password"
 	NacosUsername             = "username"
+	NacosClusterKey           = "cluster"
 )
 
 const (
 	FILE_KEY = "file"
+	// path of the file of the file registry
+	FILE_PATH_KEY = "file-path"
+)
+
+const (
+	MdnsKey = "mdns"
 )
 
 const (
@@ -160,6 +184,7 @@ const (
 
 const (
 	ETCDV3_KEY = "etcdv3"
+	EtcdKey    = "etcd"
 )
 
 const (
@@ -172,6 +197,67 @@ const (
 	// default deregister critical server after
 	DEFAULT_DEREGISTER_TIME = "20s"
 	DEREGISTER_AFTER        = "consul-deregister-critical-service-after"
+	CONSUL_NAMESPACE        = "consul-namespace"
+	CONSUL_DATACENTER       = "consul-datacenter"
+	// the health check of the nodes, ttl (default), http or grpc
+	CONSUL_CHECK          = "consul-check"
+	CONSUL_CHECK_PATH     = "consul-check-path"
+	CONSUL_CHECK_INTERVAL = "consul-check-interval"
+	// the port of the health endpoint when it is not the port of the node
+	CONSUL_CHECK_PORT = "consul-check-port"
+	// default path and interval of the http and grpc checks
+	DEFAULT_CHECK_PATH     = "/health"
+	DEFAULT_CHECK_INTERVAL = "10s"
+)
+
+const (
+	NatsKey = "nats"
+)
+
+const (
+	MemoryKey   = "memory"
+	KafkaKey    = "kafka"
+	RedisKey    = "redis"
+	RabbitmqKey = "rabbitmq"
+	GrpcKey     = "grpc"
+	TcpKey      = "tcp"
+	// selectors of the client
+	RandomKey     = "random"
+	RoundRobinKey = "roundrobin"
+)
+
+const (
+	KubernetesKey = "kubernetes"
+	// discovery mode of the kubernetes registry, pods or endpointslices
+	KubernetesModeKey           = "kubernetes-mode"
+	KubernetesEndpointSlicesKey = "endpointslices"
+	// kind of the objects of the kubernetes config center, configmap or secret
+	KubernetesConfigKindKey = "kubernetes-config-kind"
+	KubernetesConfigMapKey  = "configmap"
+	KubernetesSecretKey     = "secret"
+)
+
+const (
+	ApolloKey = "apollo"
+	// the portal of the apollo open api, the token of its app, the env and
+	// the operator of the changes
+	ApolloPortalKey   = "apollo-portal"
+	ApolloTokenKey    = "apollo-token"
+	ApolloEnvKey      = "apollo-env"
+	ApolloOperatorKey = "apollo-operator"
+)
+
+const (
+	// key providers of the ENC(...) values, FILE_KEY reads a key file
+	EncryptEnvKey   = "env"
+	EncryptVaultKey = "vault"
+	// params of the key providers
+	EncryptPathKey    = "path"
+	EncryptNameKey    = "name"
+	EncryptAddressKey = "address"
+	EncryptTokenKey   = "token"
+	EncryptFieldKey   = "field"
+	EncryptTimeoutKey = "timeout"
 )
 
 const (
@@ -2,7 +2,25 @@ package ext
 
 //use to package init
 import (
+	_ "xmicro/broker/kafka"
+	_ "xmicro/broker/nats"
+	_ "xmicro/broker/rabbitmq"
+	_ "xmicro/broker/redis"
+	_ "xmicro/config/source/apollo"
+	_ "xmicro/config/source/consul"
+	_ "xmicro/config/source/etcd"
+	_ "xmicro/config/source/kubernetes"
 	_ "xmicro/config/source/nacos"
+	_ "xmicro/registry/consul"
+	_ "xmicro/registry/etcd"
+	_ "xmicro/registry/file"
+	_ "xmicro/registry/kubernetes"
+	_ "xmicro/registry/mdns"
 	_ "xmicro/registry/nacos"
+	_ "xmicro/registry/zookeeper"
 	_ "xmicro/trace/opentracing/jaeger"
+	_ "xmicro/transport/grpc"
+	_ "xmicro/transport/nats"
+	_ "xmicro/transport/tcp"
+	_ "xmicro/util/ratelimit"
 )
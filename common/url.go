@@ -321,6 +321,15 @@ func (c *URL) String() string {
 	return buf.String()
 }
 
+// MaskedString returns the string of the url with the password masked to be
+// logged, the password may have been decrypted from the config
+func (c *URL) MaskedString() string {
+	if len(c.Password) == 0 {
+		return c.String()
+	}
+	return strings.Replace(c.String(), ":"+c.Password+"@", ":******@", 1)
+}
+
 // Key gets key
 func (c *URL) Key() string {
 	buildString := fmt.Sprintf("%s://%s:%s@%s:%s/?interface=%s&group=%s&version=%s",
@@ -0,0 +1,547 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package cache provides a dynamic configuration decorator which saves the
+// contents read from the config center to a snapshot file. The snapshot is
+// served while the config center is unreachable and reconciled once it is
+// back.
+package cache
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+import (
+	gxset "github.com/dubbogo/gost/container/set"
+	perrors "github.com/pkg/errors"
+)
+
+import (
+	"xmicro/config"
+	"xmicro/config/parser"
+	"xmicro/logger"
+)
+
+// ErrOffline is returned by the writes while the config center is unreachable
+var ErrOffline = perrors.New("config center is offline")
+
+// Cache is a dynamic configuration backed by a snapshot of its contents
+type Cache interface {
+	config.DynamicConfiguration
+	// Online reports whether the config center was connected
+	Online() bool
+	// Stats returns the cache counters
+	Stats() Stats
+	// Stop the retries and save the last snapshot
+	Stop()
+}
+
+// Stats are the counters of a cache
+type Stats struct {
+	// Fetches are the contents read from the config center
+	Fetches uint64
+	// Fallbacks are the contents served from the snapshot because the
+	// config center failed
+	Fallbacks uint64
+	// Reconciles are the contents fetched again once the config center is back
+	Reconciles uint64
+	// Stale is the number of contents currently served from the snapshot
+	Stale int
+	// Missing is the number of contents which failed to be read and are not
+	// in the snapshot
+	Missing int
+}
+
+// listener forwards the events of the config center and keeps the
+// snapshot current
+type listener struct {
+	c        *cache
+	key      string
+	group    string
+	listener config.ConfigurationListener
+}
+
+func (l *listener) Process(event *config.ChangeEvent) {
+	k := entryKey(l.key, l.group)
+	if event.ConfigType == config.EventTypeDel {
+		l.c.remove(k)
+	} else if content, ok := event.Value.(string); ok {
+		l.c.set(k, content)
+	}
+	l.listener.Process(event)
+}
+
+type cache struct {
+	opts    Options
+	connect func() (config.DynamicConfiguration, error)
+
+	fetches, fallbacks, reconciles uint64
+
+	sync.RWMutex
+	// nil until the config center is connected
+	source config.DynamicConfiguration
+	parser parser.ConfigurationParser
+	// the contents keyed by group and key
+	entries map[string]string
+	// the failed reads, served from the snapshot if it has them, to be
+	// fetched again
+	stale     map[string]*read
+	listeners []*listener
+
+	ready chan struct{}
+	exit  chan struct{}
+	once  sync.Once
+}
+
+// New returns a cache of the configuration the connect function returns.
+// The snapshot which was saved before is loaded. New waits for the config
+// center until the start timeout, which the caller checks with Online,
+// and keeps connecting in the background.
+func New(connect func() (config.DynamicConfiguration, error), opts ...Option) Cache {
+	options := Options{
+		StartTimeout:  DefaultStartTimeout,
+		Timeout:       DefaultTimeout,
+		RetryInterval: DefaultRetryInterval,
+	}
+	for _, o := range opts {
+		o(&options)
+	}
+
+	c := &cache{
+		opts:    options,
+		connect: connect,
+		entries: make(map[string]string),
+		stale:   make(map[string]*read),
+		ready:   make(chan struct{}),
+		exit:    make(chan struct{}),
+	}
+
+	if len(options.Snapshot) > 0 {
+		if err := c.load(); err != nil && !os.IsNotExist(err) {
+			logger.Warnf("[config cache] failed to load snapshot %s: %v", options.Snapshot, err)
+		}
+	}
+
+	go c.run()
+
+	select {
+	case <-c.ready:
+	case <-time.After(options.StartTimeout):
+		logger.Warnf("[config cache] config center unreachable after %v, serving snapshot %s",
+			options.StartTimeout, options.Snapshot)
+	}
+	return c
+}
+
+// read is a read of a key of the config center by one of its getters
+type read struct {
+	key  string
+	opts []config.Option
+	fn   func(string, ...config.Option) (string, error)
+}
+
+func entryKey(key, group string) string {
+	return group + "/" + key
+}
+
+func group(opts ...config.Option) string {
+	options := &config.Options{}
+	for _, o := range opts {
+		o(options)
+	}
+	return options.Group
+}
+
+func (c *cache) current() config.DynamicConfiguration {
+	c.RLock()
+	defer c.RUnlock()
+	return c.source
+}
+
+// run connects the config center and then fetches the stale contents
+// on every interval
+func (c *cache) run() {
+	for c.current() == nil {
+		source, err := c.connect()
+		if err == nil {
+			c.online(source)
+			break
+		}
+		logger.Warnf("[config cache] failed to connect config center: %v", err)
+
+		select {
+		case <-c.exit:
+			return
+		case <-time.After(c.opts.RetryInterval):
+		}
+	}
+
+	t := time.NewTicker(c.opts.RetryInterval)
+	defer t.Stop()
+
+	for {
+		c.reconcile()
+
+		select {
+		case <-c.exit:
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// online sets the connected config center and adds the listeners
+// which were added while it was unreachable
+func (c *cache) online(source config.DynamicConfiguration) {
+	c.Lock()
+	c.source = source
+	if c.parser != nil {
+		source.SetParser(c.parser)
+	} else {
+		c.parser = source.Parser()
+	}
+	listeners := make([]*listener, len(c.listeners))
+	copy(listeners, c.listeners)
+	c.Unlock()
+
+	for _, l := range listeners {
+		source.AddListener(l.key, l, config.WithGroup(l.group))
+	}
+	close(c.ready)
+}
+
+// reconcile fetches the contents served from the snapshot and notifies
+// the listeners of the ones which changed meanwhile
+func (c *cache) reconcile() {
+	c.RLock()
+	stale := make(map[string]*read, len(c.stale))
+	for k, r := range c.stale {
+		stale[k] = r
+	}
+	c.RUnlock()
+
+	for k, r := range stale {
+		content, err := c.fetch(r)
+		if err != nil {
+			continue
+		}
+		atomic.AddUint64(&c.reconciles, 1)
+
+		c.RLock()
+		old := c.entries[k]
+		c.RUnlock()
+		c.set(k, content)
+
+		if content == old {
+			continue
+		}
+		logger.Infof("[config cache] %s changed while the config center was unreachable", k)
+		event := &config.ChangeEvent{Key: r.key, Value: content, ConfigType: config.EventTypeUpdate}
+		for _, l := range c.listenersOf(k) {
+			l.listener.Process(event)
+		}
+	}
+}
+
+func (c *cache) listenersOf(k string) []*listener {
+	c.RLock()
+	defer c.RUnlock()
+
+	var out []*listener
+	for _, l := range c.listeners {
+		if entryKey(l.key, l.group) == k {
+			out = append(out, l)
+		}
+	}
+	return out
+}
+
+// get reads the content from the config center, or from the snapshot
+// if the config center fails
+func (c *cache) get(fn func(string, ...config.Option) (string, error), key string, opts ...config.Option) (string, error) {
+	k := entryKey(key, group(opts...))
+	r := &read{key: key, opts: opts, fn: fn}
+
+	err := ErrOffline
+	if c.current() != nil {
+		var content string
+		if content, err = c.fetch(r); err == nil {
+			atomic.AddUint64(&c.fetches, 1)
+			c.set(k, content)
+			return content, nil
+		}
+	}
+
+	c.Lock()
+	content, ok := c.entries[k]
+	c.stale[k] = r
+	c.Unlock()
+	if !ok {
+		return "", err
+	}
+
+	atomic.AddUint64(&c.fallbacks, 1)
+	logger.Warnf("[config cache] serving %s from snapshot: %v", k, err)
+	return content, nil
+}
+
+// fetch reads the key by the getter of the read until the timeout
+func (c *cache) fetch(r *read) (string, error) {
+	type result struct {
+		content string
+		err     error
+	}
+	ch := make(chan result, 1)
+	go func() {
+		content, err := r.fn(r.key, r.opts...)
+		ch <- result{content, err}
+	}()
+
+	select {
+	case r := <-ch:
+		return r.content, r.err
+	case <-time.After(c.opts.Timeout):
+		return "", perrors.Errorf("read %s timeout after %v", r.key, c.opts.Timeout)
+	}
+}
+
+// set saves the content of the config center if it changed
+func (c *cache) set(k, content string) {
+	c.Lock()
+	delete(c.stale, k)
+	if old, ok := c.entries[k]; ok && old == content {
+		c.Unlock()
+		return
+	}
+	c.entries[k] = content
+	c.Unlock()
+
+	c.save()
+}
+
+func (c *cache) remove(k string) {
+	c.Lock()
+	if _, ok := c.entries[k]; !ok {
+		c.Unlock()
+		return
+	}
+	delete(c.entries, k)
+	delete(c.stale, k)
+	c.Unlock()
+
+	c.save()
+}
+
+// save writes the contents to the snapshot file
+func (c *cache) save() {
+	if len(c.opts.Snapshot) == 0 {
+		return
+	}
+	if err := c.write(); err != nil {
+		logger.Errorf("[config cache] failed to save snapshot %s: %v", c.opts.Snapshot, err)
+	}
+}
+
+func (c *cache) write() error {
+	c.RLock()
+	b, err := json.Marshal(c.entries)
+	c.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	// write to a temp file first so a crash never leaves half a snapshot,
+	// the contents may hold credentials
+	dir := filepath.Dir(c.opts.Snapshot)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(dir, filepath.Base(c.opts.Snapshot)+".*")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), c.opts.Snapshot)
+}
+
+// load reads the snapshot file
+func (c *cache) load() error {
+	b, err := ioutil.ReadFile(c.opts.Snapshot)
+	if err != nil {
+		return err
+	}
+
+	var snap map[string]string
+	if err := json.Unmarshal(b, &snap); err != nil {
+		return err
+	}
+
+	c.Lock()
+	for k, content := range snap {
+		c.entries[k] = content
+	}
+	c.Unlock()
+	return nil
+}
+
+// Parser Get Parser
+func (c *cache) Parser() parser.ConfigurationParser {
+	c.RLock()
+	defer c.RUnlock()
+	return c.parser
+}
+
+// SetParser Set Parser
+func (c *cache) SetParser(p parser.ConfigurationParser) {
+	c.Lock()
+	c.parser = p
+	source := c.source
+	c.Unlock()
+
+	if source != nil {
+		source.SetParser(p)
+	}
+}
+
+// AddListener adds the listener to the config center, once it is connected
+func (c *cache) AddListener(key string, l config.ConfigurationListener, opts ...config.Option) {
+	proxy := &listener{c: c, key: key, group: group(opts...), listener: l}
+
+	c.Lock()
+	c.listeners = append(c.listeners, proxy)
+	source := c.source
+	c.Unlock()
+
+	if source != nil {
+		source.AddListener(key, proxy, opts...)
+	}
+}
+
+// RemoveListener Remove listener
+func (c *cache) RemoveListener(key string, l config.ConfigurationListener, opts ...config.Option) {
+	g := group(opts...)
+
+	c.Lock()
+	var proxy *listener
+	for i, v := range c.listeners {
+		if v.key == key && v.group == g && v.listener == l {
+			proxy = v
+			c.listeners = append(c.listeners[:i], c.listeners[i+1:]...)
+			break
+		}
+	}
+	source := c.source
+	c.Unlock()
+
+	if proxy != nil && source != nil {
+		source.RemoveListener(key, proxy, opts...)
+	}
+}
+
+// GetProperties get properties file
+func (c *cache) GetProperties(key string, opts ...config.Option) (string, error) {
+	return c.get(func(key string, opts ...config.Option) (string, error) {
+		return c.current().GetProperties(key, opts...)
+	}, key, opts...)
+}
+
+// GetRule get Router rule properties file
+func (c *cache) GetRule(key string, opts ...config.Option) (string, error) {
+	return c.get(func(key string, opts ...config.Option) (string, error) {
+		return c.current().GetRule(key, opts...)
+	}, key, opts...)
+}
+
+// GetInternalProperty get value by key in Default properties file
+func (c *cache) GetInternalProperty(key string, opts ...config.Option) (string, error) {
+	return c.get(func(key string, opts ...config.Option) (string, error) {
+		return c.current().GetInternalProperty(key, opts...)
+	}, key, opts...)
+}
+
+// PublishConfig will publish the config with the (key, group, value) pair
+func (c *cache) PublishConfig(key string, group string, value string) error {
+	source := c.current()
+	if source == nil {
+		return ErrOffline
+	}
+	return source.PublishConfig(key, group, value)
+}
+
+// RemoveConfig will remove the config white the (key, group) pair
+func (c *cache) RemoveConfig(key string, group string) error {
+	source := c.current()
+	if source == nil {
+		return ErrOffline
+	}
+	return source.RemoveConfig(key, group)
+}
+
+// GetConfigKeysByGroup will return all keys with the group
+func (c *cache) GetConfigKeysByGroup(group string) (*gxset.HashSet, error) {
+	source := c.current()
+	if source == nil {
+		return nil, ErrOffline
+	}
+	return source.GetConfigKeysByGroup(group)
+}
+
+func (c *cache) Online() bool {
+	return c.current() != nil
+}
+
+func (c *cache) Stats() Stats {
+	var stale, missing int
+	c.RLock()
+	for k := range c.stale {
+		if _, ok := c.entries[k]; ok {
+			stale++
+		} else {
+			missing++
+		}
+	}
+	c.RUnlock()
+
+	return Stats{
+		Fetches:    atomic.LoadUint64(&c.fetches),
+		Fallbacks:  atomic.LoadUint64(&c.fallbacks),
+		Reconciles: atomic.LoadUint64(&c.reconciles),
+		Stale:      stale,
+		Missing:    missing,
+	}
+}
+
+func (c *cache) Stop() {
+	c.once.Do(func() {
+		close(c.exit)
+		c.save()
+	})
+}
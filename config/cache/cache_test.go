@@ -0,0 +1,272 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cache
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+import (
+	gxset "github.com/dubbogo/gost/container/set"
+	"github.com/stretchr/testify/assert"
+)
+
+import (
+	"xmicro/config"
+	"xmicro/config/parser"
+)
+
+// memory is a config center in memory which fails while down is set,
+// the rules are kept apart from the properties
+type memory struct {
+	sync.Mutex
+	down      bool
+	contents  map[string]string
+	rules     map[string]string
+	listeners map[string]config.ConfigurationListener
+	parser    parser.ConfigurationParser
+}
+
+func newMemory() *memory {
+	return &memory{
+		contents:  make(map[string]string),
+		rules:     make(map[string]string),
+		listeners: make(map[string]config.ConfigurationListener),
+	}
+}
+
+func (m *memory) Parser() parser.ConfigurationParser     { return m.parser }
+func (m *memory) SetParser(p parser.ConfigurationParser) { m.parser = p }
+
+func (m *memory) AddListener(key string, l config.ConfigurationListener, opts ...config.Option) {
+	m.Lock()
+	m.listeners[entryKey(key, group(opts...))] = l
+	m.Unlock()
+}
+
+func (m *memory) RemoveListener(key string, l config.ConfigurationListener, opts ...config.Option) {
+	m.Lock()
+	delete(m.listeners, entryKey(key, group(opts...)))
+	m.Unlock()
+}
+
+func (m *memory) GetProperties(key string, opts ...config.Option) (string, error) {
+	m.Lock()
+	defer m.Unlock()
+	if m.down {
+		return "", errors.New("config center down")
+	}
+	content, ok := m.contents[entryKey(key, group(opts...))]
+	if !ok {
+		return "", errors.New("not found")
+	}
+	return content, nil
+}
+
+func (m *memory) GetRule(key string, opts ...config.Option) (string, error) {
+	m.Lock()
+	defer m.Unlock()
+	if m.down {
+		return "", errors.New("config center down")
+	}
+	content, ok := m.rules[entryKey(key, group(opts...))]
+	if !ok {
+		return "", errors.New("not found")
+	}
+	return content, nil
+}
+
+func (m *memory) GetInternalProperty(key string, opts ...config.Option) (string, error) {
+	return m.GetProperties(key, opts...)
+}
+
+func (m *memory) PublishConfig(key, group, value string) error {
+	m.Lock()
+	m.contents[entryKey(key, group)] = value
+	l := m.listeners[entryKey(key, group)]
+	m.Unlock()
+	if l != nil {
+		l.Process(&config.ChangeEvent{Key: key, Value: value, ConfigType: config.EventTypeUpdate})
+	}
+	return nil
+}
+
+func (m *memory) RemoveConfig(key, group string) error {
+	m.Lock()
+	delete(m.contents, entryKey(key, group))
+	m.Unlock()
+	return nil
+}
+
+func (m *memory) GetConfigKeysByGroup(group string) (*gxset.HashSet, error) {
+	return gxset.NewSet(), nil
+}
+
+type events struct {
+	ch chan *config.ChangeEvent
+}
+
+func (e *events) Process(event *config.ChangeEvent) {
+	e.ch <- event
+}
+
+func TestCache(t *testing.T) {
+	snapshot := filepath.Join(t.TempDir(), "config", "snapshot.json")
+	m := newMemory()
+	assert.NoError(t, m.PublishConfig("micro.yml", "orders", "a: 1"))
+
+	c := New(func() (config.DynamicConfiguration, error) {
+		return m, nil
+	}, WithSnapshot(snapshot))
+	assert.True(t, c.Online())
+
+	content, err := c.GetProperties("micro.yml", config.WithGroup("orders"))
+	assert.NoError(t, err)
+	assert.Equal(t, "a: 1", content)
+
+	// the changes of the config center are saved
+	l := &events{ch: make(chan *config.ChangeEvent, 4)}
+	c.AddListener("micro.yml", l, config.WithGroup("orders"))
+	assert.NoError(t, m.PublishConfig("micro.yml", "orders", "a: 2"))
+	assert.Equal(t, "a: 2", (<-l.ch).Value)
+	c.Stop()
+
+	b, err := ioutil.ReadFile(snapshot)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"orders/micro.yml": "a: 2"}`, string(b))
+	assert.Equal(t, uint64(1), c.Stats().Fetches)
+}
+
+func TestOfflineStart(t *testing.T) {
+	snapshot := filepath.Join(t.TempDir(), "snapshot.json")
+	assert.NoError(t, ioutil.WriteFile(snapshot, []byte(`{"orders/micro.yml": "a: 1"}`), 0600))
+
+	m := newMemory()
+	var (
+		mu   sync.Mutex
+		down = true
+	)
+	c := New(func() (config.DynamicConfiguration, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if down {
+			return nil, errors.New("unreachable")
+		}
+		return m, nil
+	}, WithSnapshot(snapshot), WithStartTimeout(50*time.Millisecond), WithRetryInterval(20*time.Millisecond))
+	defer c.Stop()
+	assert.False(t, c.Online())
+
+	// the snapshot is served while the config center is unreachable
+	content, err := c.GetProperties("micro.yml", config.WithGroup("orders"))
+	assert.NoError(t, err)
+	assert.Equal(t, "a: 1", content)
+	_, err = c.GetProperties("other.yml", config.WithGroup("orders"))
+	assert.Equal(t, ErrOffline, err)
+	assert.Equal(t, ErrOffline, c.PublishConfig("micro.yml", "orders", "a: 3"))
+	assert.Equal(t, Stats{Fallbacks: 1, Stale: 1, Missing: 1}, c.Stats())
+
+	l := &events{ch: make(chan *config.ChangeEvent, 4)}
+	c.AddListener("micro.yml", l, config.WithGroup("orders"))
+
+	// the content changed meanwhile is reconciled once it is back
+	assert.NoError(t, m.PublishConfig("micro.yml", "orders", "a: 2"))
+	mu.Lock()
+	down = false
+	mu.Unlock()
+
+	select {
+	case e := <-l.ch:
+		assert.Equal(t, "micro.yml", e.Key)
+		assert.Equal(t, "a: 2", e.Value)
+	case <-time.After(time.Second):
+		t.Fatal("no reconciled event")
+	}
+	assert.True(t, c.Online())
+	s := c.Stats()
+	assert.Equal(t, uint64(1), s.Reconciles)
+	assert.Equal(t, 0, s.Stale)
+
+	// the listener was added to the config center
+	assert.NoError(t, m.PublishConfig("micro.yml", "orders", "a: 3"))
+	assert.Equal(t, "a: 3", (<-l.ch).Value)
+}
+
+func TestStartWithoutSnapshot(t *testing.T) {
+	m := newMemory()
+	m.down = true
+	c := New(func() (config.DynamicConfiguration, error) {
+		return m, nil
+	}, WithSnapshot(filepath.Join(t.TempDir(), "snapshot.json")), WithRetryInterval(20*time.Millisecond))
+	defer c.Stop()
+	assert.True(t, c.Online())
+
+	// the failed read is fetched again though the snapshot doesn't have it
+	_, err := c.GetProperties("micro.yml", config.WithGroup("orders"))
+	assert.Error(t, err)
+	assert.Equal(t, Stats{Missing: 1}, c.Stats())
+
+	l := &events{ch: make(chan *config.ChangeEvent, 4)}
+	c.AddListener("micro.yml", l, config.WithGroup("orders"))
+	m.Lock()
+	m.down = false
+	m.contents[entryKey("micro.yml", "orders")] = "a: 1"
+	m.Unlock()
+
+	select {
+	case e := <-l.ch:
+		assert.Equal(t, "a: 1", e.Value)
+	case <-time.After(time.Second):
+		t.Fatal("no reconciled event")
+	}
+	s := c.Stats()
+	assert.Equal(t, uint64(1), s.Reconciles)
+	assert.Equal(t, 0, s.Missing)
+}
+
+func TestReconcileRule(t *testing.T) {
+	m := newMemory()
+	m.down = true
+	c := New(func() (config.DynamicConfiguration, error) {
+		return m, nil
+	}, WithSnapshot(filepath.Join(t.TempDir(), "snapshot.json")), WithRetryInterval(20*time.Millisecond))
+	defer c.Stop()
+
+	_, err := c.GetRule("greeter.condition-router", config.WithGroup("orders"))
+	assert.Error(t, err)
+
+	l := &events{ch: make(chan *config.ChangeEvent, 4)}
+	c.AddListener("greeter.condition-router", l, config.WithGroup("orders"))
+	m.Lock()
+	m.down = false
+	m.rules[entryKey("greeter.condition-router", "orders")] = "scope: service"
+	m.Unlock()
+
+	// the rule is fetched again as a rule
+	select {
+	case e := <-l.ch:
+		assert.Equal(t, "scope: service", e.Value)
+	case <-time.After(time.Second):
+		t.Fatal("no reconciled event")
+	}
+}
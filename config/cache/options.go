@@ -0,0 +1,73 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cache
+
+import (
+	"time"
+)
+
+var (
+	// DefaultStartTimeout is how long the config center is waited for at start
+	DefaultStartTimeout = 5 * time.Second
+	// DefaultTimeout is how long a content is waited for
+	DefaultTimeout = 10 * time.Second
+	// DefaultRetryInterval is how often an unreachable config center is retried
+	DefaultRetryInterval = 5 * time.Second
+)
+
+type Options struct {
+	// Snapshot is the file the contents are saved to and loaded from
+	Snapshot string
+	// StartTimeout is how long New waits for the config center
+	StartTimeout time.Duration
+	// Timeout of a content read from the config center
+	Timeout time.Duration
+	// RetryInterval is how often the config center is connected again, and
+	// the contents served from the snapshot are fetched again
+	RetryInterval time.Duration
+}
+
+type Option func(o *Options)
+
+// WithSnapshot saves the contents to the file and loads it on start
+func WithSnapshot(file string) Option {
+	return func(o *Options) {
+		o.Snapshot = file
+	}
+}
+
+// WithStartTimeout sets how long the config center is waited for at start
+func WithStartTimeout(t time.Duration) Option {
+	return func(o *Options) {
+		o.StartTimeout = t
+	}
+}
+
+// WithTimeout sets the timeout of the reads of the config center
+func WithTimeout(t time.Duration) Option {
+	return func(o *Options) {
+		o.Timeout = t
+	}
+}
+
+// WithRetryInterval sets how often the config center is retried
+func WithRetryInterval(t time.Duration) Option {
+	return func(o *Options) {
+		o.RetryInterval = t
+	}
+}
@@ -41,8 +41,10 @@ type ConfigurationListener interface {
 
 // ConfigChangeEvent for changing listener's event
 type ChangeEvent struct {
-	Key        string
-	Value      interface{}
+	Key   string
+	Value interface{}
+	// OldValue is the value before the change, if it's known
+	OldValue   interface{}
 	ConfigType EventType
 }
 
@@ -0,0 +1,172 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package configurator
+
+import (
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+import (
+	"xmicro/common"
+	"xmicro/common/constant"
+)
+
+// conditionKeys are the parameters of a rule which select the routes it
+// applies to, the others are set on the routes
+var conditionKeys = map[string]bool{
+	constant.CategoryKey:          true,
+	constant.EnabledKey:           true,
+	constant.GroupKey:             true,
+	constant.VersionKey:           true,
+	constant.ApplicationKey:       true,
+	constant.SIDE_KEY:             true,
+	constant.CONFIG_VERSION_KEY:   true,
+	constant.OverrideProvidersKey: true,
+	constant.InterfaceKey:         true,
+}
+
+// Configurator overrides the parameters of the routes its rule matches. A
+// consumer side rule matches the client by its address and the providers in
+// its providerAddresses, all by default. A provider side rule matches the
+// providers by its address. Both match any host for 0.0.0.0.
+type Configurator struct {
+	url         *common.URL
+	host        string
+	port        string
+	service     string
+	application string
+	consumer    bool
+	providers   []string
+}
+
+// NewConfigurator returns the configurator of an override url parsed from a
+// rule of the config center
+func NewConfigurator(url *common.URL) *Configurator {
+	c := &Configurator{
+		url:         url,
+		host:        url.Ip,
+		port:        url.Port,
+		service:     strings.TrimPrefix(url.Path, "/"),
+		application: url.GetParam(constant.ApplicationKey, ""),
+	}
+	if len(c.host) == 0 {
+		c.host = url.Location
+	}
+	if c.port == "0" {
+		c.port = ""
+	}
+
+	side := url.GetParam(constant.SIDE_KEY, "")
+	c.consumer = side == constant.ConsumerSide || (side != constant.ProviderSide && len(c.port) == 0)
+	for _, p := range strings.Split(url.GetParam(constant.OverrideProvidersKey, ""), ",") {
+		if p = strings.TrimSpace(p); len(p) != 0 {
+			c.providers = append(c.providers, p)
+		}
+	}
+	return c
+}
+
+// URL returns the override url of the rule
+func (c *Configurator) URL() *common.URL {
+	return c.url
+}
+
+// Configure sets the parameters of the rule on the url of a route of the
+// service to the provider at the address of the url. The host and the
+// application are the ones of the client.
+func (c *Configurator) Configure(url *common.URL, host, application string) {
+	if !c.Match(url, host, application) {
+		return
+	}
+	c.url.RangeParams(func(key, value string) bool {
+		if !conditionKeys[key] {
+			url.SetParam(key, value)
+		}
+		return true
+	})
+}
+
+// Match reports whether the rule applies to the route of the url
+func (c *Configurator) Match(url *common.URL, host, application string) bool {
+	if !c.url.GetParamBool(constant.EnabledKey, true) {
+		return false
+	}
+	service := strings.TrimPrefix(url.Path, "/")
+	if c.service != constant.AnyValue && c.service != service {
+		return false
+	}
+
+	if c.consumer {
+		if !anyOrEqual(c.application, application) || !anyOrEqual(c.host, host) {
+			return false
+		}
+		if len(c.providers) == 0 {
+			return true
+		}
+		for _, p := range c.providers {
+			if p == constant.AnyhostValue || p == url.Location || p == url.Ip {
+				return true
+			}
+		}
+		return false
+	}
+
+	// the application of a provider is the service it serves
+	return anyOrEqual(c.application, service) && anyOrEqual(c.host, url.Ip) &&
+		(len(c.port) == 0 || c.port == url.Port)
+}
+
+func anyOrEqual(rule, value string) bool {
+	return len(rule) == 0 || rule == constant.AnyValue || rule == constant.AnyhostValue || rule == value
+}
+
+// routeURL returns the url of the route of the service to the address, the
+// address is empty for the parameters of the whole service
+func routeURL(service, address string) *common.URL {
+	opts := []common.UrlOption{
+		common.WithProtocol(constant.OverrideProtocol),
+		common.WithPath("/" + service),
+		common.WithParams(url.Values{}),
+	}
+	if host, port, err := net.SplitHostPort(address); err == nil {
+		opts = append(opts, common.WithIp(host), common.WithPort(port))
+	} else if len(address) != 0 {
+		opts = append(opts, common.WithIp(address))
+	}
+	u := common.NewURLWithUrlOptions(opts...)
+	u.Location = address
+	return u
+}
+
+// timeout returns the timeout parameter of the url, in milliseconds or as a
+// duration such as 3s
+func timeout(url *common.URL) (time.Duration, bool) {
+	value := url.GetParam(constant.TimeoutKey, "")
+	if len(value) == 0 {
+		return 0, false
+	}
+	if ms, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Duration(ms) * time.Millisecond, ms > 0
+	}
+	d, err := time.ParseDuration(value)
+	return d, err == nil && d > 0
+}
@@ -0,0 +1,354 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package configurator
+
+import (
+	"context"
+	"math/rand"
+	"sort"
+	"sync"
+)
+
+import (
+	"xmicro/client"
+	"xmicro/common"
+	"xmicro/common/constant"
+	"xmicro/config"
+	"xmicro/config/parser"
+	"xmicro/errors"
+	"xmicro/logger"
+	"xmicro/util/addr"
+)
+
+// the most routes a service is expanded to by the weights
+const maxWeightedRoutes = 100
+
+// Manager watches the configurator rules of the config center and applies
+// them to the lookup and the calls of a client. The rules of a service are
+// kept under {service}.configurators, the rules of {application}.configurators
+// apply to all services.
+type Manager struct {
+	dc   config.DynamicConfiguration
+	opts Options
+
+	sync.RWMutex
+	listeners map[string]*ruleListener
+	rules     map[string][]*Configurator
+	// the rules of all keys, the ones of any host first
+	sorted []*Configurator
+}
+
+// NewManager returns a manager of the rules of the config center, the rules
+// of the application are read at once and the ones of a service in the
+// background once it is called
+func NewManager(dc config.DynamicConfiguration, opts ...Option) *Manager {
+	options := Options{}
+	for _, o := range opts {
+		o(&options)
+	}
+	if len(options.Host) == 0 {
+		options.Host, _ = addr.Extract("")
+	}
+
+	m := &Manager{
+		dc:        dc,
+		opts:      options,
+		listeners: make(map[string]*ruleListener),
+		rules:     make(map[string][]*Configurator),
+	}
+	// the rules of the application are read before the first call
+	if len(options.Application) != 0 {
+		m.load(m.listen(options.Application))
+	}
+	return m
+}
+
+// Close stops watching the rules
+func (m *Manager) Close() {
+	m.Lock()
+	listeners := m.listeners
+	m.listeners = make(map[string]*ruleListener)
+	m.Unlock()
+
+	for key, l := range listeners {
+		m.dc.RemoveListener(key, l, config.WithGroup(m.opts.Group))
+	}
+}
+
+// Configure returns the url of the route of the service to the address with
+// the parameters of the rules, the address is empty for the parameters of
+// the whole service
+func (m *Manager) Configure(service, address string) *common.URL {
+	m.RLock()
+	rules := m.sorted
+	m.RUnlock()
+
+	url := routeURL(service, address)
+	for _, c := range rules {
+		c.Configure(url, m.opts.Host, m.opts.Application)
+	}
+	return url
+}
+
+// Lookup filters the disabled routes of the lookup and weights the others,
+// the addresses of the call options are kept
+func (m *Manager) Lookup(lookup client.LookupFunc) client.LookupFunc {
+	return func(ctx context.Context, req client.Request, opts client.CallOptions) ([]string, error) {
+		routes, err := lookup(ctx, req, opts)
+		if err != nil || len(opts.Address) > 0 {
+			return routes, err
+		}
+		m.watch(req.Service())
+		return m.route(req.Service(), routes)
+	}
+}
+
+// CallWrapper applies the timeout of the rules of the provider to the
+// calls, bounded by the timeout of the request
+func (m *Manager) CallWrapper(fn client.CallFunc) client.CallFunc {
+	return func(ctx context.Context, address string, req client.Request, rsp interface{}, opts client.CallOptions) error {
+		if d, ok := timeout(m.Configure(req.Service(), address)); ok && d != opts.RequestTimeout {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, d)
+			defer cancel()
+			opts.RequestTimeout = d
+		}
+		return fn(ctx, address, req, rsp, opts)
+	}
+}
+
+// Wrapper applies the timeout and the retries of the rules of the service to
+// the calls and the streams, over the ones of the call
+func (m *Manager) Wrapper(c client.Client) client.Client {
+	return &configuredClient{Client: c, m: m}
+}
+
+type configuredClient struct {
+	client.Client
+	m *Manager
+}
+
+func (c *configuredClient) Call(ctx context.Context, req client.Request, rsp interface{}, opts ...client.CallOption) error {
+	return c.Client.Call(ctx, req, rsp, append(opts, c.m.callOptions(req.Service())...)...)
+}
+
+func (c *configuredClient) Stream(ctx context.Context, req client.Request, opts ...client.CallOption) (client.Stream, error) {
+	return c.Client.Stream(ctx, req, append(opts, c.m.callOptions(req.Service())...)...)
+}
+
+// callOptions returns the call options of the rules of the whole service
+func (m *Manager) callOptions(service string) []client.CallOption {
+	m.watch(service)
+	url := m.Configure(service, "")
+
+	var opts []client.CallOption
+	if d, ok := timeout(url); ok {
+		opts = append(opts, client.WithRequestTimeout(d))
+	}
+	if retries := url.GetParamByIntValue(constant.RetriesKey, -1); retries >= 0 {
+		opts = append(opts, client.WithRetries(retries))
+	}
+	return opts
+}
+
+// route drops the disabled routes and repeats the others by their weights
+func (m *Manager) route(service string, routes []string) ([]string, error) {
+	m.RLock()
+	empty := len(m.sorted) == 0
+	m.RUnlock()
+	if empty || len(routes) == 0 {
+		return routes, nil
+	}
+
+	enabled := make([]string, 0, len(routes))
+	weights := make([]int, 0, len(routes))
+	for _, route := range routes {
+		url := m.Configure(service, route)
+		if url.GetParamBool(constant.DisabledKey, false) {
+			continue
+		}
+		enabled = append(enabled, route)
+		weights = append(weights, url.GetParamByIntValue(constant.WeightKey, constant.DefaultWeight))
+	}
+	if len(enabled) == 0 {
+		return nil, errors.InternalServerError("micro", "service %s: all %d routes are disabled", service, len(routes))
+	}
+	return weighted(enabled, weights), nil
+}
+
+// weighted repeats the routes by their weights in a random order, so the
+// selectors pick them by weight. Equal weights keep the routes as they are.
+func weighted(routes []string, weights []int) []string {
+	total, divisor, same := 0, 0, true
+	for _, w := range weights {
+		if w < 0 {
+			w = 0
+		}
+		total += w
+		divisor = gcd(divisor, w)
+		same = same && w == weights[0]
+	}
+	if same || total == 0 {
+		return routes
+	}
+
+	scale := 1.0
+	if total/divisor > maxWeightedRoutes {
+		scale = float64(maxWeightedRoutes) / float64(total/divisor)
+	}
+	var out []string
+	for i, route := range routes {
+		if weights[i] <= 0 {
+			continue
+		}
+		n := int(float64(weights[i]/divisor) * scale)
+		if n == 0 {
+			n = 1
+		}
+		for j := 0; j < n; j++ {
+			out = append(out, route)
+		}
+	}
+	rand.Shuffle(len(out), func(i, j int) {
+		out[i], out[j] = out[j], out[i]
+	})
+	return out
+}
+
+func gcd(a, b int) int {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
+
+// watch reads the rules of the name in the background and listens to their
+// changes, the calls don't wait for the config center and go without the
+// rules until they are read
+func (m *Manager) watch(name string) {
+	if l := m.listen(name); l != nil {
+		go m.load(l)
+	}
+}
+
+// listen returns the listener of the rules of the name, nil if it was added
+func (m *Manager) listen(name string) *ruleListener {
+	key := name + constant.ConfiguratorsSuffix
+
+	m.Lock()
+	defer m.Unlock()
+	if _, ok := m.listeners[key]; ok {
+		return nil
+	}
+	l := &ruleListener{m: m, key: key}
+	m.listeners[key] = l
+	return l
+}
+
+// load listens to the rules of the listener and reads them, unless they
+// changed meanwhile
+func (m *Manager) load(l *ruleListener) {
+	// the manager was closed meanwhile
+	m.RLock()
+	closed := m.listeners[l.key] != l
+	m.RUnlock()
+	if closed {
+		return
+	}
+	m.dc.AddListener(l.key, l, config.WithGroup(m.opts.Group))
+
+	content, err := m.dc.GetRule(l.key, config.WithGroup(m.opts.Group))
+	if err != nil {
+		logger.Debugf("Configurator: get rules %s error %v", l.key, err)
+		return
+	}
+
+	l.Lock()
+	defer l.Unlock()
+	if !l.changed {
+		m.update(l.key, content)
+	}
+}
+
+// update replaces the rules of the key with the ones of the content
+func (m *Manager) update(key, content string) {
+	var rules []*Configurator
+	if len(content) != 0 {
+		p := m.dc.Parser()
+		if p == nil {
+			p = &parser.DefaultConfigurationParser{}
+		}
+		urls, err := p.ParseToUrls(content)
+		if err != nil {
+			logger.Errorf("Configurator: parse rules %s error %v, the previous rules are kept", key, err)
+			return
+		}
+		for _, url := range urls {
+			rules = append(rules, NewConfigurator(url))
+		}
+	}
+
+	m.Lock()
+	defer m.Unlock()
+
+	if len(rules) == 0 {
+		delete(m.rules, key)
+	} else {
+		m.rules[key] = rules
+	}
+	keys := make([]string, 0, len(m.rules))
+	for k := range m.rules {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	sorted := make([]*Configurator, 0, len(m.sorted)+len(rules))
+	for _, k := range keys {
+		sorted = append(sorted, m.rules[k]...)
+	}
+	// the rules of a host override the ones of any host
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].host == constant.AnyhostValue && sorted[j].host != constant.AnyhostValue
+	})
+	m.sorted = sorted
+	logger.Infof("Configurator: %d rules of %s applied", len(rules), key)
+}
+
+// ruleListener updates the rules of a key
+type ruleListener struct {
+	m   *Manager
+	key string
+
+	sync.Mutex
+	// whether a change was processed, which the rules read by load predate
+	changed bool
+}
+
+// Process updates the rules of the changed key
+func (l *ruleListener) Process(event *config.ChangeEvent) {
+	l.Lock()
+	defer l.Unlock()
+	l.changed = true
+
+	if event.ConfigType == config.EventTypeDel {
+		l.m.update(l.key, "")
+		return
+	}
+	if content, ok := event.Value.(string); ok {
+		l.m.update(l.key, content)
+	}
+}
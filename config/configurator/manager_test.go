@@ -0,0 +1,310 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package configurator
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+import (
+	gxset "github.com/dubbogo/gost/container/set"
+	"github.com/stretchr/testify/assert"
+)
+
+import (
+	"xmicro/client"
+	"xmicro/config"
+	"xmicro/config/parser"
+)
+
+// memory is a config center in memory
+type memory struct {
+	sync.Mutex
+	contents  map[string]string
+	listeners map[string]config.ConfigurationListener
+}
+
+func newMemory() *memory {
+	return &memory{contents: make(map[string]string), listeners: make(map[string]config.ConfigurationListener)}
+}
+
+func group(opts ...config.Option) string {
+	o := &config.Options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o.Group
+}
+
+func (m *memory) Parser() parser.ConfigurationParser     { return &parser.DefaultConfigurationParser{} }
+func (m *memory) SetParser(p parser.ConfigurationParser) {}
+
+func (m *memory) AddListener(key string, l config.ConfigurationListener, opts ...config.Option) {
+	m.Lock()
+	m.listeners[group(opts...)+"/"+key] = l
+	m.Unlock()
+}
+
+func (m *memory) RemoveListener(key string, l config.ConfigurationListener, opts ...config.Option) {
+	m.Lock()
+	delete(m.listeners, group(opts...)+"/"+key)
+	m.Unlock()
+}
+
+func (m *memory) GetProperties(key string, opts ...config.Option) (string, error) {
+	m.Lock()
+	defer m.Unlock()
+	content, ok := m.contents[group(opts...)+"/"+key]
+	if !ok {
+		return "", errors.New("not found")
+	}
+	return content, nil
+}
+
+func (m *memory) GetRule(key string, opts ...config.Option) (string, error) {
+	return m.GetProperties(key, opts...)
+}
+
+func (m *memory) GetInternalProperty(key string, opts ...config.Option) (string, error) {
+	return m.GetProperties(key, opts...)
+}
+
+func (m *memory) PublishConfig(key, group, value string) error {
+	m.Lock()
+	m.contents[group+"/"+key] = value
+	l := m.listeners[group+"/"+key]
+	m.Unlock()
+	if l != nil {
+		l.Process(&config.ChangeEvent{Key: key, Value: value, ConfigType: config.EventTypeUpdate})
+	}
+	return nil
+}
+
+func (m *memory) RemoveConfig(key, group string) error {
+	m.Lock()
+	delete(m.contents, group+"/"+key)
+	l := m.listeners[group+"/"+key]
+	m.Unlock()
+	if l != nil {
+		l.Process(&config.ChangeEvent{Key: key, ConfigType: config.EventTypeDel})
+	}
+	return nil
+}
+
+func (m *memory) GetConfigKeysByGroup(group string) (*gxset.HashSet, error) {
+	return gxset.NewSet(), nil
+}
+
+const serviceRules = `
+configVersion: v2.7
+scope: service
+key: greeter
+configs:
+  - addresses: ["10.0.0.2:8090"]
+    side: provider
+    parameters:
+      disabled: "true"
+  - side: consumer
+    parameters:
+      timeout: 3000
+      retries: 0
+  - addresses: ["10.0.0.3:8090"]
+    side: provider
+    parameters:
+      timeout: 500ms
+  - addresses: ["0.0.0.0"]
+    side: consumer
+    providerAddresses: ["10.0.0.3:8090"]
+    parameters:
+      weight: 300
+`
+
+const appRules = `
+configVersion: v2.7
+scope: application
+key: client
+configs:
+  - side: consumer
+    services: ["echo"]
+    parameters:
+      timeout: 1s
+  - side: consumer
+    addresses: ["10.0.0.8"]
+    services: ["echo"]
+    parameters:
+      retries: 5
+`
+
+type request struct {
+	client.Request
+	service string
+}
+
+func (r *request) Service() string {
+	return r.service
+}
+
+// optionsClient records the call options of a call
+type optionsClient struct {
+	client.Client
+	opts client.CallOptions
+}
+
+func (c *optionsClient) Call(ctx context.Context, req client.Request, rsp interface{}, opts ...client.CallOption) error {
+	c.opts = client.CallOptions{RequestTimeout: client.DefaultRequestTimeout, Retries: client.DefaultRetries}
+	for _, o := range opts {
+		o(&c.opts)
+	}
+	return nil
+}
+
+func TestManager(t *testing.T) {
+	mem := newMemory()
+	assert.NoError(t, mem.PublishConfig("client.configurators", "micro", appRules))
+	m := NewManager(mem, WithGroup("micro"), WithApplication("client"), WithHost("10.0.0.9"))
+	defer m.Close()
+
+	all := []string{"10.0.0.1:8090", "10.0.0.2:8090", "10.0.0.3:8090"}
+	lookup := m.Lookup(func(ctx context.Context, req client.Request, opts client.CallOptions) ([]string, error) {
+		return all, nil
+	})
+	greeter := &request{service: "greeter"}
+
+	// no rules of the service yet
+	routes, err := lookup(context.Background(), greeter, client.CallOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, all, routes)
+
+	// the disabled provider is dropped, the weighted one repeated once the
+	// rules of the service are read
+	assert.NoError(t, mem.PublishConfig("greeter.configurators", "micro", serviceRules))
+	assert.Eventually(t, func() bool {
+		routes, err = lookup(context.Background(), greeter, client.CallOptions{})
+		return err == nil && len(routes) == 4
+	}, time.Second, 10*time.Millisecond)
+	assert.NotContains(t, routes, "10.0.0.2:8090")
+	counts := map[string]int{}
+	for _, r := range routes {
+		counts[r]++
+	}
+	assert.Equal(t, map[string]int{"10.0.0.1:8090": 1, "10.0.0.3:8090": 3}, counts)
+
+	// the addresses of the call are kept
+	routes, err = lookup(context.Background(), greeter, client.CallOptions{Address: []string{"10.0.0.2:8090"}})
+	assert.NoError(t, err)
+	assert.Equal(t, all, routes)
+
+	// the timeout and the retries of the service override the call
+	c := &optionsClient{}
+	wrapped := m.Wrapper(c)
+	assert.NoError(t, wrapped.Call(context.Background(), greeter, nil, client.WithRetries(3)))
+	assert.Equal(t, 3*time.Second, c.opts.RequestTimeout)
+	assert.Equal(t, 0, c.opts.Retries)
+
+	// the timeout of a provider applies to its calls
+	var got time.Duration
+	call := m.CallWrapper(func(ctx context.Context, address string, req client.Request, rsp interface{}, opts client.CallOptions) error {
+		got = opts.RequestTimeout
+		return nil
+	})
+	assert.NoError(t, call(context.Background(), "10.0.0.3:8090", greeter, nil, c.opts))
+	assert.Equal(t, 500*time.Millisecond, got)
+	assert.NoError(t, call(context.Background(), "10.0.0.1:8090", greeter, nil, c.opts))
+	assert.Equal(t, 3*time.Second, got)
+
+	// the rules of the application apply to the client by its host
+	echo := &request{service: "echo"}
+	assert.NoError(t, wrapped.Call(context.Background(), echo, nil))
+	assert.Equal(t, time.Second, c.opts.RequestTimeout)
+	assert.Equal(t, client.DefaultRetries, c.opts.Retries)
+
+	// removing the rules restores the routes
+	assert.NoError(t, mem.RemoveConfig("greeter.configurators", "micro"))
+	routes, err = lookup(context.Background(), greeter, client.CallOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, all, routes)
+
+	// a service without routes left fails
+	assert.NoError(t, mem.PublishConfig("greeter.configurators", "micro", `
+scope: service
+key: greeter
+configs:
+  - side: provider
+    parameters:
+      disabled: "true"
+`))
+	_, err = lookup(context.Background(), greeter, client.CallOptions{})
+	assert.Error(t, err)
+
+	// invalid rules keep the previous ones
+	assert.NoError(t, mem.PublishConfig("greeter.configurators", "micro", "configs: ["))
+	_, err = lookup(context.Background(), greeter, client.CallOptions{})
+	assert.Error(t, err)
+}
+
+// slowMemory is a config center reading the rules slowly
+type slowMemory struct {
+	*memory
+	delay time.Duration
+}
+
+func (m *slowMemory) GetRule(key string, opts ...config.Option) (string, error) {
+	time.Sleep(m.delay)
+	return m.memory.GetRule(key, opts...)
+}
+
+func TestManagerSlowConfigCenter(t *testing.T) {
+	mem := &slowMemory{memory: newMemory(), delay: 300 * time.Millisecond}
+	assert.NoError(t, mem.PublishConfig("greeter.configurators", "micro", serviceRules))
+	m := NewManager(mem, WithGroup("micro"), WithHost("10.0.0.9"))
+	defer m.Close()
+
+	all := []string{"10.0.0.1:8090", "10.0.0.2:8090", "10.0.0.3:8090"}
+	lookup := m.Lookup(func(ctx context.Context, req client.Request, opts client.CallOptions) ([]string, error) {
+		return all, nil
+	})
+	greeter := &request{service: "greeter"}
+	c := &optionsClient{}
+	wrapped := m.Wrapper(c)
+
+	// the calls don't wait for the rules
+	start := time.Now()
+	routes, err := lookup(context.Background(), greeter, client.CallOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, all, routes)
+	assert.NoError(t, wrapped.Call(context.Background(), greeter, nil))
+	assert.Equal(t, client.DefaultRequestTimeout, c.opts.RequestTimeout)
+	assert.Less(t, int64(time.Since(start)), int64(100*time.Millisecond))
+
+	// and apply them once they are read
+	assert.Eventually(t, func() bool {
+		return wrapped.Call(context.Background(), greeter, nil) == nil && c.opts.RequestTimeout == 3*time.Second
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestWeighted(t *testing.T) {
+	routes := []string{"a", "b"}
+	assert.Equal(t, routes, weighted(routes, []int{100, 100}))
+	assert.Equal(t, routes, weighted(routes, []int{0, 0}))
+	assert.Equal(t, []string{"b"}, weighted(routes, []int{0, 100}))
+	assert.Len(t, weighted(routes, []int{1, 1000}), maxWeightedRoutes)
+}
@@ -0,0 +1,52 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package configurator
+
+// Options are the options of a Manager
+type Options struct {
+	// Group is the group of the rules in the config center
+	Group string
+	// Application is the application of the client, the rules of its key
+	// apply to all the services it calls
+	Application string
+	// Host is the host of the client the consumer side rules match
+	Host string
+}
+
+type Option func(o *Options)
+
+// WithGroup reads the rules from the group of the config center
+func WithGroup(group string) Option {
+	return func(o *Options) {
+		o.Group = group
+	}
+}
+
+// WithApplication sets the application of the client
+func WithApplication(app string) Option {
+	return func(o *Options) {
+		o.Application = app
+	}
+}
+
+// WithHost sets the host of the client, the local address by default
+func WithHost(host string) Option {
+	return func(o *Options) {
+		o.Host = host
+	}
+}
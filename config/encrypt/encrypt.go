@@ -0,0 +1,176 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package encrypt decrypts the ENC(...) values of the configuration.
+// A value is ENC(base64(nonce | ciphertext)) sealed with AES-GCM by a
+// key of 16, 24 or 32 bytes, which a KeyProvider supplies.
+package encrypt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"io"
+	"regexp"
+	"sync"
+)
+
+import (
+	perrors "github.com/pkg/errors"
+)
+
+// Mask replaces the decrypted values in dumps of the configuration
+const Mask = "******"
+
+var pattern = regexp.MustCompile(`ENC\(([A-Za-z0-9+/=]*)\)`)
+
+// KeyProvider provides the AES key of the encrypted values
+type KeyProvider interface {
+	Key() ([]byte, error)
+}
+
+// KeyProviderFactory creates a key provider from its params
+type KeyProviderFactory func(params map[string]string) (KeyProvider, error)
+
+// IsEncrypted reports whether the value holds an ENC(...) part
+func IsEncrypted(value string) bool {
+	return pattern.MatchString(value)
+}
+
+// Encrypt seals the plain text into an ENC(...) value
+func Encrypt(key []byte, plain string) (string, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", perrors.WithStack(err)
+	}
+	sealed := gcm.Seal(nonce, nonce, []byte(plain), nil)
+	return "ENC(" + base64.StdEncoding.EncodeToString(sealed) + ")", nil
+}
+
+// Decrypt replaces the ENC(...) parts of the value by their plain text
+func Decrypt(key []byte, value string) (string, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+
+	var failed error
+	plain := pattern.ReplaceAllStringFunc(value, func(m string) string {
+		if failed != nil {
+			return m
+		}
+		sealed, err := base64.StdEncoding.DecodeString(pattern.FindStringSubmatch(m)[1])
+		if err != nil || len(sealed) < gcm.NonceSize() {
+			failed = perrors.New("malformed encrypted value")
+			return m
+		}
+		opened, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], nil)
+		if err != nil {
+			// the error does not tell more than a wrong key or a corrupted value
+			failed = perrors.New("encrypted value can not be decrypted, check the key")
+			return m
+		}
+		return string(opened)
+	})
+	if failed != nil {
+		return "", failed
+	}
+	return plain, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, perrors.WithMessage(err, "invalid encrypt key")
+	}
+	return cipher.NewGCM(block)
+}
+
+// Resolver decrypts the values with the key of its provider, which is
+// read once the first encrypted value is seen and read again after an error
+type Resolver struct {
+	provider KeyProvider
+
+	mu  sync.Mutex
+	key []byte
+}
+
+// NewResolver creates a resolver of the key provider
+func NewResolver(provider KeyProvider) *Resolver {
+	return &Resolver{provider: provider}
+}
+
+// Resolve returns the plain text of the value and whether it was encrypted,
+// the values without ENC(...) are returned as they are
+func (r *Resolver) Resolve(value string) (string, bool, error) {
+	if !IsEncrypted(value) {
+		return value, false, nil
+	}
+	if r == nil || r.provider == nil {
+		return "", true, perrors.New("encrypted value found but no key provider is configured")
+	}
+
+	key, err := r.readKey()
+	if err != nil {
+		return "", true, perrors.WithMessage(err, "read encrypt key")
+	}
+
+	plain, err := Decrypt(key, value)
+	return plain, true, err
+}
+
+// readKey returns the key of the provider, only a key which was read is kept
+func (r *Resolver) readKey() ([]byte, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.key != nil {
+		return r.key, nil
+	}
+	key, err := r.provider.Key()
+	if err != nil {
+		return nil, err
+	}
+	r.key = key
+	return key, nil
+}
+
+// ResolveMap decrypts the values of the map into a new map and returns
+// the keys which were encrypted
+func (r *Resolver) ResolveMap(values map[string]string) (map[string]string, map[string]bool, error) {
+	out := make(map[string]string, len(values))
+	var secrets map[string]bool
+	for k, v := range values {
+		plain, encrypted, err := r.Resolve(v)
+		if err != nil {
+			return nil, nil, perrors.WithMessagef(err, "decrypt %s", k)
+		}
+		if encrypted {
+			if secrets == nil {
+				secrets = make(map[string]bool)
+			}
+			secrets[k] = true
+		}
+		out[k] = plain
+	}
+	return out, secrets, nil
+}
@@ -0,0 +1,153 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package encrypt
+
+import (
+	"encoding/base64"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+import (
+	"github.com/stretchr/testify/assert"
+)
+
+var testKey = []byte("0123456789abcdef0123456789abcdef")
+
+type staticKey []byte
+
+func (k staticKey) Key() ([]byte, error) {
+	return k, nil
+}
+
+// flakyKey fails to read the key until it is available
+type flakyKey struct {
+	available bool
+	reads     int
+}
+
+func (k *flakyKey) Key() ([]byte, error) {
+	k.reads++
+	if !k.available {
+		return nil, errors.New("vault unreachable")
+	}
+	return testKey, nil
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	value, err := Encrypt(testKey, "s3cret")
+	assert.NoError(t, err)
+	assert.True(t, IsEncrypted(value))
+	assert.NotContains(t, value, "s3cret")
+
+	plain, err := Decrypt(testKey, value)
+	assert.NoError(t, err)
+	assert.Equal(t, "s3cret", plain)
+
+	// the parts of a document are decrypted
+	plain, err = Decrypt(testKey, "password: "+value+"\nuser: app")
+	assert.NoError(t, err)
+	assert.Equal(t, "password: s3cret\nuser: app", plain)
+
+	_, err = Decrypt([]byte("fedcba9876543210fedcba9876543210"), value)
+	assert.Error(t, err)
+	assert.NotContains(t, err.Error(), "s3cret")
+}
+
+func TestResolver(t *testing.T) {
+	value, err := Encrypt(testKey, "s3cret")
+	assert.NoError(t, err)
+
+	values, secrets, err := NewResolver(staticKey(testKey)).ResolveMap(map[string]string{
+		"registry.password": value,
+		"registry.username": "app",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"registry.password": "s3cret", "registry.username": "app"}, values)
+	assert.Equal(t, map[string]bool{"registry.password": true}, secrets)
+
+	// the plain values need no provider
+	plain, encrypted, err := (*Resolver)(nil).Resolve("app")
+	assert.NoError(t, err)
+	assert.False(t, encrypted)
+	assert.Equal(t, "app", plain)
+	_, _, err = (*Resolver)(nil).Resolve(value)
+	assert.Error(t, err)
+
+	// the key is read again after an error and kept once it is read
+	provider := &flakyKey{}
+	r := NewResolver(provider)
+	_, _, err = r.Resolve(value)
+	assert.Error(t, err)
+	provider.available = true
+	for i := 0; i < 2; i++ {
+		plain, _, err = r.Resolve(value)
+		assert.NoError(t, err)
+		assert.Equal(t, "s3cret", plain)
+	}
+	assert.Equal(t, 2, provider.reads)
+}
+
+func TestKeyProviders(t *testing.T) {
+	encoded := base64.StdEncoding.EncodeToString(testKey)
+
+	file := filepath.Join(t.TempDir(), "key")
+	assert.NoError(t, ioutil.WriteFile(file, []byte(encoded+"\n"), 0600))
+	p, err := NewFileKeyProvider(map[string]string{"path": file})
+	assert.NoError(t, err)
+	key, err := p.Key()
+	assert.NoError(t, err)
+	assert.Equal(t, testKey, key)
+
+	t.Setenv("TEST_ENC_KEY", encoded)
+	p, err = NewEnvKeyProvider(map[string]string{"name": "TEST_ENC_KEY"})
+	assert.NoError(t, err)
+	key, err = p.Key()
+	assert.NoError(t, err)
+	assert.Equal(t, testKey, key)
+
+	// a KV v2 secret of vault
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "root" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		assert.Equal(t, "/v1/secret/data/xmicro", r.URL.Path)
+		_, _ = w.Write([]byte(`{"data":{"data":{"key":"` + encoded + `"}}}`))
+	}))
+	defer srv.Close()
+
+	p, err = NewVaultKeyProvider(map[string]string{"address": srv.URL, "path": "/secret/data/xmicro", "token": "root"})
+	assert.NoError(t, err)
+	key, err = p.Key()
+	assert.NoError(t, err)
+	assert.Equal(t, testKey, key)
+
+	p, err = NewVaultKeyProvider(map[string]string{"address": srv.URL, "path": "secret/data/xmicro", "token": "wrong"})
+	assert.NoError(t, err)
+	_, err = p.Key()
+	assert.True(t, err != nil && strings.Contains(err.Error(), "403"))
+
+	_, err = NewVaultKeyProvider(map[string]string{"path": "secret/data/xmicro"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,171 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package encrypt
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+import (
+	perrors "github.com/pkg/errors"
+)
+
+import (
+	"xmicro/common/constant"
+)
+
+// NewFileKeyProvider reads the key from the file of the path param, the
+// file holds the key base64 encoded or raw
+func NewFileKeyProvider(params map[string]string) (KeyProvider, error) {
+	path := params[constant.EncryptPathKey]
+	if len(path) == 0 {
+		return nil, perrors.Errorf("the %s of the key file is not configured", constant.EncryptPathKey)
+	}
+	return &fileKeyProvider{path: path}, nil
+}
+
+type fileKeyProvider struct {
+	path string
+}
+
+func (p *fileKeyProvider) Key() ([]byte, error) {
+	data, err := ioutil.ReadFile(p.path)
+	if err != nil {
+		return nil, perrors.WithStack(err)
+	}
+	return parseKey(data)
+}
+
+// NewEnvKeyProvider reads the base64 key from the environment variable of
+// the name param, XMICRO_ENC_KEY by default
+func NewEnvKeyProvider(params map[string]string) (KeyProvider, error) {
+	name := params[constant.EncryptNameKey]
+	if len(name) == 0 {
+		name = constant.EncryptKeyEnv
+	}
+	return &envKeyProvider{name: name}, nil
+}
+
+type envKeyProvider struct {
+	name string
+}
+
+func (p *envKeyProvider) Key() ([]byte, error) {
+	value, ok := os.LookupEnv(p.name)
+	if !ok {
+		return nil, perrors.Errorf("environment variable %s of the encrypt key is not set", p.name)
+	}
+	return parseKey([]byte(value))
+}
+
+// NewVaultKeyProvider reads the base64 key from a secret of a vault
+// compatible KV store. The params are the address of the server, the path
+// of the secret, such as secret/data/xmicro, the field of the key, key by
+// default, and the token, VAULT_TOKEN by default.
+func NewVaultKeyProvider(params map[string]string) (KeyProvider, error) {
+	p := &vaultKeyProvider{
+		address: strings.TrimSuffix(params[constant.EncryptAddressKey], "/"),
+		path:    strings.Trim(params[constant.EncryptPathKey], "/"),
+		field:   params[constant.EncryptFieldKey],
+		token:   params[constant.EncryptTokenKey],
+		timeout: 5 * time.Second,
+	}
+	if len(p.address) == 0 || len(p.path) == 0 {
+		return nil, perrors.Errorf("the %s and the %s of the vault secret must be configured",
+			constant.EncryptAddressKey, constant.EncryptPathKey)
+	}
+	if len(p.field) == 0 {
+		p.field = "key"
+	}
+	if len(p.token) == 0 {
+		p.token = os.Getenv(constant.VaultTokenEnv)
+	}
+	if t, ok := params[constant.EncryptTimeoutKey]; ok {
+		d, err := time.ParseDuration(t)
+		if err != nil {
+			return nil, perrors.WithMessagef(err, "vault timeout %s", t)
+		}
+		p.timeout = d
+	}
+	return p, nil
+}
+
+type vaultKeyProvider struct {
+	address string
+	path    string
+	field   string
+	token   string
+	timeout time.Duration
+}
+
+func (p *vaultKeyProvider) Key() ([]byte, error) {
+	req, err := http.NewRequest(http.MethodGet, p.address+"/v1/"+p.path, nil)
+	if err != nil {
+		return nil, perrors.WithStack(err)
+	}
+	req.Header.Set("X-Vault-Token", p.token)
+
+	res, err := (&http.Client{Timeout: p.timeout}).Do(req)
+	if err != nil {
+		return nil, perrors.WithMessagef(err, "read vault secret %s", p.path)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, perrors.Errorf("read vault secret %s: status %d", p.path, res.StatusCode)
+	}
+
+	// the data of a KV v2 secret is nested in data
+	var secret struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&secret); err != nil {
+		return nil, perrors.WithMessagef(err, "decode vault secret %s", p.path)
+	}
+	data := secret.Data
+	if nested, ok := data["data"].(map[string]interface{}); ok {
+		data = nested
+	}
+	value, ok := data[p.field].(string)
+	if !ok {
+		return nil, perrors.Errorf("vault secret %s has no field %s", p.path, p.field)
+	}
+	return parseKey([]byte(value))
+}
+
+// parseKey decodes a base64 key, or takes a raw key of a valid size
+func parseKey(data []byte) ([]byte, error) {
+	data = bytes.TrimSpace(data)
+	if key, err := base64.StdEncoding.DecodeString(string(data)); err == nil && validSize(len(key)) {
+		return key, nil
+	}
+	if validSize(len(data)) {
+		return data, nil
+	}
+	return nil, perrors.New("the encrypt key must be 16, 24 or 32 bytes")
+}
+
+func validSize(n int) bool {
+	return n == 16 || n == 24 || n == 32
+}
@@ -0,0 +1,169 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+)
+
+import (
+	"github.com/pelletier/go-toml"
+	perrors "github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+import (
+	uyaml "xmicro/util/yaml"
+)
+
+const (
+	// FormatProperties is the format of java properties
+	FormatProperties = "properties"
+	// FormatYAML is the format of yaml documents
+	FormatYAML = "yaml"
+	// FormatJSON is the format of json documents
+	FormatJSON = "json"
+	// FormatTOML is the format of toml documents
+	FormatTOML = "toml"
+)
+
+// TreeParser parses the content into its original tree, the values of
+// the flattened keys of Parse are the leaves of the tree
+type TreeParser interface {
+	ConfigurationParser
+	ParseTree(string) (map[string]interface{}, error)
+}
+
+// YAMLParser parses yaml documents into dotted keys
+type YAMLParser struct {
+	DefaultConfigurationParser
+}
+
+// JSONParser parses json documents into dotted keys
+type JSONParser struct {
+	DefaultConfigurationParser
+}
+
+// TOMLParser parses toml documents into dotted keys
+type TOMLParser struct {
+	DefaultConfigurationParser
+}
+
+// Format returns the format of the key by its extension, properties if
+// the extension is unknown
+func Format(key string) string {
+	switch strings.ToLower(strings.TrimPrefix(path.Ext(key), ".")) {
+	case "yml", "yaml":
+		return FormatYAML
+	case "json":
+		return FormatJSON
+	case "toml":
+		return FormatTOML
+	}
+	return FormatProperties
+}
+
+// ForFormat returns the parser of the format or content type, e.g. yaml or
+// application/json, the properties parser if the format is unknown
+func ForFormat(format string) ConfigurationParser {
+	format = strings.ToLower(format)
+	if i := strings.LastIndexAny(format, "/+"); i >= 0 {
+		format = format[i+1:]
+	}
+	switch strings.TrimPrefix(format, "x-") {
+	case "yml", FormatYAML:
+		return &YAMLParser{}
+	case FormatJSON:
+		return &JSONParser{}
+	case FormatTOML:
+		return &TOMLParser{}
+	}
+	return &DefaultConfigurationParser{}
+}
+
+// Parse flattens the yaml document
+func (p *YAMLParser) Parse(content string) (map[string]string, error) {
+	if len(strings.TrimSpace(content)) == 0 {
+		return map[string]string{}, nil
+	}
+	return uyaml.Flatten([]byte(content))
+}
+
+// ParseTree parses the yaml document
+func (p *YAMLParser) ParseTree(content string) (map[string]interface{}, error) {
+	in := make(map[interface{}]interface{})
+	if err := yaml.Unmarshal([]byte(content), &in); err != nil {
+		return nil, perrors.WithMessage(err, "parse yaml")
+	}
+	return stringKeys(in).(map[string]interface{}), nil
+}
+
+// Parse flattens the json document
+func (p *JSONParser) Parse(content string) (map[string]string, error) {
+	tree, err := p.ParseTree(content)
+	if err != nil {
+		return nil, err
+	}
+	return flatten(tree)
+}
+
+// ParseTree parses the json document, the numbers are kept as json.Number
+func (p *JSONParser) ParseTree(content string) (map[string]interface{}, error) {
+	tree := make(map[string]interface{})
+	if len(strings.TrimSpace(content)) == 0 {
+		return tree, nil
+	}
+	decoder := json.NewDecoder(bytes.NewBufferString(content))
+	decoder.UseNumber()
+	if err := decoder.Decode(&tree); err != nil {
+		return nil, perrors.WithMessage(err, "parse json")
+	}
+	return tree, nil
+}
+
+// Parse flattens the toml document
+func (p *TOMLParser) Parse(content string) (map[string]string, error) {
+	tree, err := p.ParseTree(content)
+	if err != nil {
+		return nil, err
+	}
+	return flatten(tree)
+}
+
+// ParseTree parses the toml document
+func (p *TOMLParser) ParseTree(content string) (map[string]interface{}, error) {
+	tree, err := toml.Load(content)
+	if err != nil {
+		return nil, perrors.WithMessage(err, "parse toml")
+	}
+	return tree.ToMap(), nil
+}
+
+// flatten flattens the tree the way the yaml documents are
+func flatten(tree map[string]interface{}) (map[string]string, error) {
+	data, err := yaml.Marshal(tree)
+	if err != nil {
+		return nil, err
+	}
+	return uyaml.Flatten(data)
+}
+
+// stringKeys turns the yaml maps into maps keyed by strings
+func stringKeys(in interface{}) interface{} {
+	switch v := in.(type) {
+	case map[interface{}]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for k, value := range v {
+			out[fmt.Sprint(k)] = stringKeys(value)
+		}
+		return out
+	case []interface{}:
+		for i, value := range v {
+			v[i] = stringKeys(value)
+		}
+		return v
+	}
+	return in
+}
@@ -0,0 +1,59 @@
+package parser
+
+import (
+	"testing"
+)
+
+import (
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormat(t *testing.T) {
+	assert.Equal(t, FormatYAML, Format("micro.yml"))
+	assert.Equal(t, FormatYAML, Format("micro.YAML"))
+	assert.Equal(t, FormatJSON, Format("micro.json"))
+	assert.Equal(t, FormatTOML, Format("micro.toml"))
+	assert.Equal(t, FormatProperties, Format("micro.properties"))
+	assert.Equal(t, FormatProperties, Format("micro"))
+
+	assert.IsType(t, &JSONParser{}, ForFormat("application/json"))
+	assert.IsType(t, &YAMLParser{}, ForFormat("application/x-yaml"))
+	assert.IsType(t, &TOMLParser{}, ForFormat("toml"))
+	assert.IsType(t, &DefaultConfigurationParser{}, ForFormat("text/plain"))
+}
+
+func TestParse(t *testing.T) {
+	want := map[string]string{
+		"server.name":  "demo",
+		"server.port":  "8080",
+		"server.tags":  "a,b",
+		"server.debug": "true",
+	}
+
+	for format, content := range map[string]string{
+		FormatYAML: "server:\n  name: demo\n  port: 8080\n  debug: true\n  tags: [a, b]\n",
+		FormatJSON: `{"server": {"name": "demo", "port": 8080, "debug": true, "tags": ["a", "b"]}}`,
+		FormatTOML: "[server]\nname = \"demo\"\nport = 8080\ndebug = true\ntags = [\"a\", \"b\"]\n",
+	} {
+		p := ForFormat(format)
+		m, err := p.Parse(content)
+		assert.NoError(t, err, format)
+		assert.Equal(t, want, m, format)
+
+		tree, err := p.(TreeParser).ParseTree(content)
+		assert.NoError(t, err, format)
+		assert.Equal(t, "demo", tree["server"].(map[string]interface{})["name"], format)
+	}
+
+	// the lists of maps are kept in the tree
+	tree, err := ForFormat(FormatYAML).(TreeParser).ParseTree("server:\n  routes:\n    - path: /a\n")
+	assert.NoError(t, err)
+	routes := tree["server"].(map[string]interface{})["routes"].([]interface{})
+	assert.Equal(t, "/a", routes[0].(map[string]interface{})["path"])
+
+	m, err := ForFormat(FormatJSON).Parse("")
+	assert.NoError(t, err)
+	assert.Empty(t, m)
+	_, err = ForFormat(FormatJSON).Parse("{")
+	assert.Error(t, err)
+}
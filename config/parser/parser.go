@@ -83,7 +83,8 @@ func (parser *DefaultConfigurationParser) Parse(content string) (map[string]stri
 
 // ParseToUrls is used to parse content to urls
 func (parser *DefaultConfigurationParser) ParseToUrls(content string) ([]*common.URL, error) {
-	config := ConfiguratorConfig{}
+	// a rule is enabled unless it says otherwise
+	config := ConfiguratorConfig{Enabled: true}
 	if err := yaml.Unmarshal([]byte(content), &config); err != nil {
 		return nil, err
 	}
@@ -138,7 +139,7 @@ func serviceItemToUrls(item ConfigItem, config ConfiguratorConfig) ([]*common.UR
 		if len(apps) > 0 {
 			for _, v := range apps {
 				newUrlStr := urlStr
-				newUrlStr = newUrlStr + "&application"
+				newUrlStr = newUrlStr + "&application="
 				newUrlStr = newUrlStr + v
 				url, err := common.NewURL(newUrlStr)
 				if err != nil {
@@ -165,12 +166,12 @@ func appItemToUrls(item ConfigItem, config ConfiguratorConfig) ([]*common.URL, e
 	}
 	var urls []*common.URL
 	for _, v := range addresses {
-		urlStr := constant.OverrideProtocol + "://" + v + "/"
 		services := item.Services
 		if len(services) == 0 {
 			services = append(services, constant.AnyValue)
 		}
 		for _, vs := range services {
+			urlStr := constant.OverrideProtocol + "://" + v + "/"
 			serviceStr, err := getServiceString(vs)
 			if err != nil {
 				return nil, perrors.WithStack(err)
@@ -0,0 +1,267 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package apollo
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+import (
+	"github.com/magiconair/properties"
+	perrors "github.com/pkg/errors"
+)
+
+import (
+	"xmicro/common/constant"
+)
+
+const (
+	// the config service holds a poll for 60 seconds
+	pollTimeout = 90 * time.Second
+	// the item holding the content of a namespace which is not properties
+	contentKey = "content"
+	// the suffix of the properties namespaces, which is not in their name
+	propertiesSuffix = ".properties"
+)
+
+var errNotFound = perrors.New("apollo namespace not found")
+
+// apolloConfig is a release of a namespace of the config service
+type apolloConfig struct {
+	AppID          string            `json:"appId"`
+	Cluster        string            `json:"cluster"`
+	NamespaceName  string            `json:"namespaceName"`
+	Configurations map[string]string `json:"configurations"`
+	ReleaseKey     string            `json:"releaseKey"`
+}
+
+// content returns the content of the namespace, the items of a properties
+// namespace are written as properties
+func (c *apolloConfig) content() string {
+	if !isProperties(c.NamespaceName) {
+		return c.Configurations[contentKey]
+	}
+
+	keys := make([]string, 0, len(c.Configurations))
+	for k := range c.Configurations {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	p := properties.NewProperties()
+	for _, k := range keys {
+		_, _, _ = p.Set(k, c.Configurations[k])
+	}
+	var buf bytes.Buffer
+	_, _ = p.Write(&buf, properties.UTF8)
+	return buf.String()
+}
+
+// notification is the release number of a namespace
+type notification struct {
+	NamespaceName  string `json:"namespaceName"`
+	NotificationID int64  `json:"notificationId"`
+}
+
+// client reads the config service and changes the items through the open
+// api of the portal
+type client struct {
+	http *http.Client
+	poll *http.Client
+
+	config   string
+	portal   string
+	token    string
+	env      string
+	operator string
+	appID    string
+	cluster  string
+}
+
+// namespaceName returns the name of the namespace in the apis
+func namespaceName(namespace string) string {
+	return strings.TrimSuffix(namespace, propertiesSuffix)
+}
+
+// isProperties reports whether the namespace holds properties, the others
+// have the suffix of their format such as micro.yml
+func isProperties(namespace string) bool {
+	namespace = namespaceName(namespace)
+	i := strings.LastIndex(namespace, ".")
+	if i < 0 {
+		return true
+	}
+	switch namespace[i+1:] {
+	case "yml", "yaml", "json", "xml", "txt":
+		return false
+	}
+	return true
+}
+
+// getConfig reads the latest release of the namespace
+func (c *client) getConfig(namespace string) (*apolloConfig, error) {
+	u := fmt.Sprintf("%s/configs/%s/%s/%s", c.config, url.PathEscape(c.appID), url.PathEscape(c.cluster),
+		url.PathEscape(namespaceName(namespace)))
+	res, err := c.http.Get(u)
+	if err != nil {
+		return nil, perrors.WithStack(err)
+	}
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, errNotFound
+	default:
+		return nil, perrors.Errorf("get apollo namespace %s: status %d", namespace, res.StatusCode)
+	}
+
+	cfg := &apolloConfig{}
+	if err := json.NewDecoder(res.Body).Decode(cfg); err != nil {
+		return nil, perrors.WithMessagef(err, "decode apollo namespace %s", namespace)
+	}
+	cfg.NamespaceName = namespace
+	return cfg, nil
+}
+
+// notifications polls the changes of the namespaces, nil is returned when
+// none changed until the config service timed out
+func (c *client) notifications(ctx context.Context, ns []notification) ([]notification, error) {
+	b, err := json.Marshal(ns)
+	if err != nil {
+		return nil, err
+	}
+	params := url.Values{}
+	params.Set("appId", c.appID)
+	params.Set("cluster", c.cluster)
+	params.Set("notifications", string(b))
+
+	req, err := http.NewRequest(http.MethodGet, c.config+"/notifications/v2?"+params.Encode(), nil)
+	if err != nil {
+		return nil, perrors.WithStack(err)
+	}
+	res, err := c.poll.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, perrors.WithStack(err)
+	}
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotModified:
+		return nil, nil
+	default:
+		return nil, perrors.Errorf("poll apollo notifications: status %d", res.StatusCode)
+	}
+
+	var changed []notification
+	if err := json.NewDecoder(res.Body).Decode(&changed); err != nil {
+		return nil, perrors.WithMessage(err, "decode apollo notifications")
+	}
+	return changed, nil
+}
+
+// namespaceURL is the url of the namespace in the open api
+func (c *client) namespaceURL(namespace string) (string, error) {
+	if len(c.portal) == 0 || len(c.token) == 0 {
+		return "", perrors.Errorf("the apollo open api needs the %s and the %s params",
+			constant.ApolloPortalKey, constant.ApolloTokenKey)
+	}
+	return fmt.Sprintf("%s/openapi/v1/envs/%s/apps/%s/clusters/%s/namespaces/%s", c.portal, url.PathEscape(c.env),
+		url.PathEscape(c.appID), url.PathEscape(c.cluster), url.PathEscape(namespaceName(namespace))), nil
+}
+
+// do sends a request of the open api
+func (c *client) do(method, u string, body interface{}) error {
+	var reader *bytes.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(b)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+
+	req, err := http.NewRequest(method, u, reader)
+	if err != nil {
+		return perrors.WithStack(err)
+	}
+	req.Header.Set("Authorization", c.token)
+	req.Header.Set("Content-Type", "application/json;charset=UTF-8")
+
+	res, err := c.http.Do(req)
+	if err != nil {
+		return perrors.WithStack(err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusNotFound && method == http.MethodDelete {
+		return nil
+	}
+	if res.StatusCode/100 != 2 {
+		msg, _ := ioutil.ReadAll(res.Body)
+		return perrors.Errorf("apollo open api %s %s: status %d %s", method, u, res.StatusCode, msg)
+	}
+	return nil
+}
+
+// setItem creates or updates the item of the namespace
+func (c *client) setItem(namespace, key, value string) error {
+	u, err := c.namespaceURL(namespace)
+	if err != nil {
+		return err
+	}
+	return c.do(http.MethodPut, u+"/items/"+url.PathEscape(key)+"?createIfNotExists=true", map[string]string{
+		"key":                      key,
+		"value":                    value,
+		"dataChangeCreatedBy":      c.operator,
+		"dataChangeLastModifiedBy": c.operator,
+	})
+}
+
+// deleteItem deletes the item of the namespace
+func (c *client) deleteItem(namespace, key string) error {
+	u, err := c.namespaceURL(namespace)
+	if err != nil {
+		return err
+	}
+	return c.do(http.MethodDelete, u+"/items/"+url.PathEscape(key)+"?operator="+url.QueryEscape(c.operator), nil)
+}
+
+// release releases the items of the namespace to the config service
+func (c *client) release(namespace string) error {
+	u, err := c.namespaceURL(namespace)
+	if err != nil {
+		return err
+	}
+	return c.do(http.MethodPost, u+"/releases", map[string]string{
+		"releaseTitle": time.Now().Format("20060102150405") + "-release",
+		"releasedBy":   c.operator,
+	})
+}
@@ -18,22 +18,21 @@
 package apollo
 
 import (
-	"fmt"
+	"net/http"
 	"regexp"
 	"strings"
 	"sync"
+	"time"
 )
 
 import (
 	gxset "github.com/dubbogo/gost/container/set"
 	perrors "github.com/pkg/errors"
-	"github.com/zouyx/agollo/v3"
-	agolloConstant "github.com/zouyx/agollo/v3/constant"
-	"github.com/zouyx/agollo/v3/env/config"
 )
 
 import (
 	"xmicro/common"
+	"xmicro/common/component"
 	"xmicro/common/constant"
 	cc "xmicro/config"
 	"xmicro/config/parser"
@@ -41,104 +40,169 @@ import (
 
 const (
 	apolloProtocolPrefix = "http://"
-	apolloConfigFormat   = "%s%s"
+	defaultCluster       = "default"
+	defaultEnv           = "DEV"
+	defaultOperator      = "apollo"
 )
 
-type apolloConfiguration struct {
-	url *common.URL
-
-	listeners sync.Map
-	appConf   *config.AppConfig
-	parser    parser.ConfigurationParser
+func init() {
+	component.SetConfigCenterFactory(constant.ApolloKey, &apolloConfigurationFactory{})
 }
 
-func newApolloConfiguration(url *common.URL) (*apolloConfiguration, error) {
-	c := &apolloConfiguration{
-		url: url,
-	}
-	configAddr := c.getAddressWithProtocolPrefix(url)
-	configCluster := url.GetParam(constant.ConfigClusterKey, "")
+type apolloConfigurationFactory struct {
+}
 
-	appId := url.GetParam(constant.ConfigAppIdKey, "")
-	namespaces := getProperties(url.GetParam(constant.ConfigNamespaceKey, cc.DefaultGroup))
-	c.appConf = &config.AppConfig{
-		AppID:         appId,
-		Cluster:       configCluster,
-		NamespaceName: namespaces,
-		IP:            configAddr,
+// GetDynamicConfiguration Get Configuration with URL
+func (f *apolloConfigurationFactory) GetDynamicConfiguration(url *common.URL) (cc.DynamicConfiguration, error) {
+	dynamicConfiguration, err := newApolloConfiguration(url)
+	if err != nil {
+		return nil, err
 	}
+	dynamicConfiguration.SetParser(&parser.DefaultConfigurationParser{})
+	return dynamicConfiguration, nil
+}
 
-	agollo.InitCustomConfig(func() (*config.AppConfig, error) {
-		return c.appConf, nil
-	})
+// apolloConfiguration is the implementation of DynamicConfiguration based on apollo.
+// A key of a config file is an apollo namespace, such as micro.yml. The items are
+// kept in the namespace of the group, or of the config namespace param.
+type apolloConfiguration struct {
+	url       *common.URL
+	client    *client
+	namespace string
+	parser    parser.ConfigurationParser
 
-	return c, agollo.Start()
+	// the watched namespaces by name
+	sync.Mutex
+	watches map[string]*namespaceWatch
+	polling bool
+	done    chan struct{}
 }
 
-func (c *apolloConfiguration) AddListener(key string, listener cc.ConfigurationListener, opts ...cc.Option) {
-	k := &cc.Options{}
-	for _, opt := range opts {
-		opt(k)
+func newApolloConfiguration(url *common.URL) (*apolloConfiguration, error) {
+	timeout, err := time.ParseDuration(url.GetParam(constant.CONFIG_TIMEOUT_KET, cc.DefaultConfigTimeout))
+	if err != nil {
+		return nil, perrors.WithMessagef(err, "newApolloConfiguration(address:%+v)", url.Location)
 	}
 
-	key = k.Group + key
-	l, _ := c.listeners.LoadOrStore(key, newApolloListener())
-	l.(*apolloListener).AddListener(listener)
-}
-
-func (c *apolloConfiguration) RemoveListener(key string, listener cc.ConfigurationListener, opts ...cc.Option) {
-	k := &cc.Options{}
-	for _, opt := range opts {
-		opt(k)
+	c := &apolloConfiguration{
+		url:       url,
+		namespace: url.GetParam(constant.ConfigNamespaceKey, cc.DefaultGroup),
+		watches:   make(map[string]*namespaceWatch),
+		done:      make(chan struct{}),
+	}
+	c.client = &client{
+		http:     &http.Client{Timeout: timeout},
+		poll:     &http.Client{Timeout: pollTimeout},
+		config:   strings.Split(c.getAddressWithProtocolPrefix(url), ",")[0],
+		portal:   strings.TrimSuffix(url.GetParam(constant.ApolloPortalKey, ""), "/"),
+		token:    url.GetParam(constant.ApolloTokenKey, ""),
+		env:      url.GetParam(constant.ApolloEnvKey, defaultEnv),
+		operator: url.GetParam(constant.ApolloOperatorKey, defaultOperator),
+		appID:    url.GetParam(constant.ConfigAppIdKey, ""),
+		cluster:  url.GetParam(constant.ConfigClusterKey, ""),
+	}
+	if len(c.client.cluster) == 0 {
+		c.client.cluster = defaultCluster
 	}
 
-	key = k.Group + key
-	l, ok := c.listeners.Load(key)
-	if ok {
-		l.(*apolloListener).RemoveListener(listener)
+	// the config service must be reachable, the namespace may not be released yet
+	if _, err := c.client.getConfig(c.namespace); err != nil && err != errNotFound {
+		return nil, perrors.WithMessagef(err, "newApolloConfiguration(address:%+v)", url.Location)
 	}
+	return c, nil
 }
 
-func getProperties(namespace string) string {
-	return getNamespaceName(namespace, agolloConstant.Properties)
+// AddListener listens to the changes of the namespace of the key
+func (c *apolloConfiguration) AddListener(key string, listener cc.ConfigurationListener, opts ...cc.Option) {
+	c.addListener(key, listener)
+}
+
+// RemoveListener Remove listener
+func (c *apolloConfiguration) RemoveListener(key string, listener cc.ConfigurationListener, opts ...cc.Option) {
+	c.removeListener(key, listener)
 }
 
-func getNamespaceName(namespace string, configFileFormat agolloConstant.ConfigFileFormat) string {
-	return fmt.Sprintf(apolloConfigFormat, namespace, configFileFormat)
+// GetProperties returns the content of the namespace of the key
+func (c *apolloConfiguration) GetProperties(key string, opts ...cc.Option) (string, error) {
+	cfg, err := c.client.getConfig(key)
+	if err != nil {
+		return "", perrors.WithMessagef(err, "nothing in namespace:%s", key)
+	}
+	return cfg.content(), nil
 }
 
+// GetInternalProperty returns the item of the namespace of the group
 func (c *apolloConfiguration) GetInternalProperty(key string, opts ...cc.Option) (string, error) {
-	newConfig := agollo.GetConfig(c.appConf.NamespaceName)
-	if newConfig == nil {
-		return "", perrors.New(fmt.Sprintf("nothing in namespace:%s ", key))
+	cfg, err := c.client.getConfig(c.groupNamespace(opts...))
+	if err != nil {
+		return "", perrors.WithMessagef(err, "nothing in namespace:%s", c.groupNamespace(opts...))
 	}
-	return newConfig.GetStringValue(key, ""), nil
+	return cfg.Configurations[key], nil
 }
 
+// GetRule Get router rule
 func (c *apolloConfiguration) GetRule(key string, opts ...cc.Option) (string, error) {
 	return c.GetInternalProperty(key, opts...)
 }
 
-// PublishConfig will publish the config with the (key, group, value) pair
-func (c *apolloConfiguration) PublishConfig(string, string, string) error {
-	return perrors.New("unsupport operation")
+// PublishConfig sets the item of the namespace of the group and releases it,
+// the content of a namespace which is not properties is its content item
+func (c *apolloConfiguration) PublishConfig(key string, group string, value string) error {
+	namespace := c.groupNamespace(cc.WithGroup(group))
+	if err := c.client.setItem(namespace, key, value); err != nil {
+		return err
+	}
+	return c.client.release(namespace)
+}
+
+// RemoveConfig deletes the item of the namespace of the group and releases it
+func (c *apolloConfiguration) RemoveConfig(key string, group string) error {
+	namespace := c.groupNamespace(cc.WithGroup(group))
+	if err := c.client.deleteItem(namespace, key); err != nil {
+		return err
+	}
+	return c.client.release(namespace)
 }
 
-// GetConfigKeysByGroup will return all keys with the group
+// GetConfigKeysByGroup returns the keys of the items of the namespace of the group
 func (c *apolloConfiguration) GetConfigKeysByGroup(group string) (*gxset.HashSet, error) {
-	return nil, perrors.New("unsupport operation")
+	result := gxset.NewSet()
+	cfg, err := c.client.getConfig(c.groupNamespace(cc.WithGroup(group)))
+	if err == errNotFound {
+		return result, nil
+	}
+	if err != nil {
+		return result, perrors.WithMessage(err, "can not find the client config")
+	}
+	for k := range cfg.Configurations {
+		result.Add(k)
+	}
+	return result, nil
 }
 
-func (c *apolloConfiguration) GetProperties(key string, opts ...cc.Option) (string, error) {
-	/**
-	 * when group is not null, we are getting startup configs(config file) from Config Center, for example:
-	 * key=dubbo.propertie
-	 */
-	tmpConfig := agollo.GetConfig(key)
-	if tmpConfig == nil {
-		return "", perrors.New(fmt.Sprintf("nothing in namespace:%s ", key))
-	}
-	return tmpConfig.GetContent(), nil
+// Destroy stops the polls of the namespaces
+func (c *apolloConfiguration) Destroy() {
+	c.Lock()
+	defer c.Unlock()
+
+	select {
+	case <-c.done:
+	default:
+		close(c.done)
+	}
+}
+
+// groupNamespace returns the namespace of the group, the config namespace
+// by default
+func (c *apolloConfiguration) groupNamespace(opts ...cc.Option) string {
+	k := &cc.Options{}
+	for _, opt := range opts {
+		opt(k)
+	}
+	if len(k.Group) == 0 {
+		return c.namespace
+	}
+	return k.Group
 }
 
 func (c *apolloConfiguration) getAddressWithProtocolPrefix(url *common.URL) string {
@@ -0,0 +1,336 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package apollo
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+import (
+	"github.com/stretchr/testify/assert"
+)
+
+import (
+	"xmicro/common"
+	"xmicro/common/constant"
+	"xmicro/config"
+)
+
+const (
+	testAppID = "xmicro"
+	testToken = "token"
+)
+
+// fakeNamespace is a namespace with its items and its last release
+type fakeNamespace struct {
+	items          map[string]string
+	released       map[string]string
+	notificationID int64
+}
+
+// fakeApollo serves the config service and the open api of the portal,
+// the reads of the configs fail while failConfigs is set
+type fakeApollo struct {
+	sync.Mutex
+	namespaces  map[string]*fakeNamespace
+	changed     chan struct{}
+	failConfigs bool
+	configReads int
+}
+
+func newFakeApollo() *fakeApollo {
+	return &fakeApollo{namespaces: make(map[string]*fakeNamespace), changed: make(chan struct{})}
+}
+
+func (f *fakeApollo) namespace(name string) *fakeNamespace {
+	ns, ok := f.namespaces[name]
+	if !ok {
+		ns = &fakeNamespace{items: make(map[string]string)}
+		f.namespaces[name] = ns
+	}
+	return ns
+}
+
+func (f *fakeApollo) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	switch {
+	case parts[0] == "configs" && len(parts) == 4:
+		f.serveConfig(w, parts[1], parts[2], parts[3])
+	case parts[0] == "notifications":
+		f.serveNotifications(w, r)
+	case parts[0] == "openapi" && len(parts) >= 11:
+		if r.Header.Get("Authorization") != testToken {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		f.serveOpenAPI(w, r, parts[9], parts[10:])
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (f *fakeApollo) serveConfig(w http.ResponseWriter, appID, cluster, name string) {
+	f.Lock()
+	defer f.Unlock()
+
+	f.configReads++
+	if f.failConfigs {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	ns, ok := f.namespaces[name]
+	if !ok || ns.released == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	_ = json.NewEncoder(w).Encode(&apolloConfig{
+		AppID:          appID,
+		Cluster:        cluster,
+		NamespaceName:  name,
+		Configurations: ns.released,
+	})
+}
+
+func (f *fakeApollo) serveNotifications(w http.ResponseWriter, r *http.Request) {
+	var ns []notification
+	if err := json.Unmarshal([]byte(r.URL.Query().Get("notifications")), &ns); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	timeout := time.After(time.Second)
+	for {
+		f.Lock()
+		changed := make([]notification, 0)
+		for _, n := range ns {
+			if cur, ok := f.namespaces[n.NamespaceName]; ok && cur.notificationID > n.NotificationID {
+				changed = append(changed, notification{NamespaceName: n.NamespaceName, NotificationID: cur.notificationID})
+			}
+		}
+		wait := f.changed
+		f.Unlock()
+
+		if len(changed) > 0 {
+			_ = json.NewEncoder(w).Encode(changed)
+			return
+		}
+		select {
+		case <-wait:
+		case <-timeout:
+			w.WriteHeader(http.StatusNotModified)
+			return
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func (f *fakeApollo) serveOpenAPI(w http.ResponseWriter, r *http.Request, name string, rest []string) {
+	f.Lock()
+	defer f.Unlock()
+
+	ns := f.namespace(name)
+	switch {
+	case r.Method == http.MethodPut && len(rest) == 2 && rest[0] == "items":
+		item := map[string]string{}
+		if err := json.NewDecoder(r.Body).Decode(&item); err != nil || item["key"] != rest[1] {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		ns.items[item["key"]] = item["value"]
+	case r.Method == http.MethodDelete && len(rest) == 2 && rest[0] == "items":
+		if _, ok := ns.items[rest[1]]; !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		delete(ns.items, rest[1])
+	case r.Method == http.MethodPost && len(rest) == 1 && rest[0] == "releases":
+		ns.released = make(map[string]string, len(ns.items))
+		for k, v := range ns.items {
+			ns.released[k] = v
+		}
+		ns.notificationID++
+		close(f.changed)
+		f.changed = make(chan struct{})
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	_, _ = w.Write([]byte("{}"))
+}
+
+type listener struct {
+	events chan *config.ChangeEvent
+}
+
+func (l *listener) Process(e *config.ChangeEvent) {
+	l.events <- e
+}
+
+func (l *listener) next(t *testing.T) *config.ChangeEvent {
+	select {
+	case e := <-l.events:
+		return e
+	case <-time.After(5 * time.Second):
+		t.Fatal("no change event")
+		return nil
+	}
+}
+
+func newTestConfiguration(t *testing.T, srv *httptest.Server) *apolloConfiguration {
+	params := url.Values{}
+	params.Set(constant.ConfigAppIdKey, testAppID)
+	params.Set(constant.ConfigNamespaceKey, "application")
+	params.Set(constant.ApolloPortalKey, srv.URL)
+	params.Set(constant.ApolloTokenKey, testToken)
+	u, err := common.NewURL("apollo://" + strings.TrimPrefix(srv.URL, "http://") + "?" + params.Encode())
+	assert.NoError(t, err)
+
+	dc, err := (&apolloConfigurationFactory{}).GetDynamicConfiguration(u)
+	assert.NoError(t, err)
+	return dc.(*apolloConfiguration)
+}
+
+func TestPublishConfig(t *testing.T) {
+	srv := httptest.NewServer(newFakeApollo())
+	defer srv.Close()
+	c := newTestConfiguration(t, srv)
+	defer c.Destroy()
+
+	keys, err := c.GetConfigKeysByGroup("")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, keys.Size())
+
+	assert.NoError(t, c.PublishConfig("timeout", "", "3s"))
+	assert.NoError(t, c.PublishConfig("retries", "", "2"))
+	assert.NoError(t, c.PublishConfig(contentKey, "micro.yml", "micro:\n  name: demo\n"))
+
+	v, err := c.GetInternalProperty("timeout")
+	assert.NoError(t, err)
+	assert.Equal(t, "3s", v)
+	v, err = c.GetProperties("application")
+	assert.NoError(t, err)
+	assert.Equal(t, "retries = 2\ntimeout = 3s\n", v)
+	v, err = c.GetProperties("micro.yml")
+	assert.NoError(t, err)
+	assert.Equal(t, "micro:\n  name: demo\n", v)
+
+	keys, err = c.GetConfigKeysByGroup("")
+	assert.NoError(t, err)
+	assert.True(t, keys.Contains("timeout"))
+	assert.True(t, keys.Contains("retries"))
+	assert.Equal(t, 2, keys.Size())
+
+	assert.NoError(t, c.RemoveConfig("retries", ""))
+	assert.NoError(t, c.RemoveConfig("missing", ""))
+	keys, err = c.GetConfigKeysByGroup("")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, keys.Size())
+
+	c.client.token = ""
+	assert.Error(t, c.PublishConfig("timeout", "", "5s"))
+}
+
+func TestListeners(t *testing.T) {
+	srv := httptest.NewServer(newFakeApollo())
+	defer srv.Close()
+	c := newTestConfiguration(t, srv)
+	defer c.Destroy()
+
+	assert.NoError(t, c.PublishConfig(contentKey, "micro.yml", "a: 1\n"))
+
+	yml := &listener{events: make(chan *config.ChangeEvent, 8)}
+	props := &listener{events: make(chan *config.ChangeEvent, 8)}
+	c.AddListener("micro.yml", yml)
+	c.AddListener("application.properties", props)
+
+	assert.NoError(t, c.PublishConfig(contentKey, "micro.yml", "a: 2\n"))
+	e := yml.next(t)
+	assert.Equal(t, "micro.yml", e.Key)
+	assert.EqualValues(t, config.EventTypeUpdate, e.ConfigType)
+	assert.Equal(t, "a: 2\n", e.Value)
+
+	assert.NoError(t, c.PublishConfig("timeout", "application", "3s"))
+	e = props.next(t)
+	assert.Equal(t, "application.properties", e.Key)
+	assert.EqualValues(t, config.EventTypeAdd, e.ConfigType)
+	assert.Equal(t, "timeout = 3s\n", e.Value)
+
+	c.RemoveListener("micro.yml", yml)
+	assert.NoError(t, c.PublishConfig(contentKey, "micro.yml", "a: 3\n"))
+	assert.NoError(t, c.PublishConfig("timeout", "application", "5s"))
+	e = props.next(t)
+	assert.Equal(t, "timeout = 5s\n", e.Value)
+	select {
+	case e := <-yml.events:
+		t.Fatalf("removed listener got %v", e)
+	default:
+	}
+}
+
+func TestRefreshFailure(t *testing.T) {
+	delay := retryDelay
+	retryDelay = 100 * time.Millisecond
+	defer func() {
+		retryDelay = delay
+	}()
+
+	f := newFakeApollo()
+	srv := httptest.NewServer(f)
+	defer srv.Close()
+	c := newTestConfiguration(t, srv)
+	defer c.Destroy()
+
+	assert.NoError(t, c.PublishConfig(contentKey, "micro.yml", "a: 1\n"))
+	yml := &listener{events: make(chan *config.ChangeEvent, 8)}
+	c.AddListener("micro.yml", yml)
+
+	// the release which can't be read is read again after the delay
+	f.Lock()
+	f.failConfigs = true
+	f.configReads = 0
+	f.Unlock()
+	assert.NoError(t, c.PublishConfig(contentKey, "micro.yml", "a: 2\n"))
+	time.Sleep(250 * time.Millisecond)
+
+	f.Lock()
+	reads := f.configReads
+	f.failConfigs = false
+	f.Unlock()
+	assert.True(t, reads > 0 && reads <= 4, "%d reads", reads)
+
+	e := yml.next(t)
+	assert.Equal(t, "a: 2\n", e.Value)
+}
+
+func TestUnreachable(t *testing.T) {
+	srv := httptest.NewServer(newFakeApollo())
+	srv.Close()
+
+	u, err := common.NewURL("apollo://" + strings.TrimPrefix(srv.URL, "http://") + "?config.timeout=1s")
+	assert.NoError(t, err)
+	_, err = (&apolloConfigurationFactory{}).GetDynamicConfiguration(u)
+	assert.Error(t, err)
+}
@@ -18,55 +18,180 @@
 package apollo
 
 import (
-	"github.com/zouyx/agollo/v3"
-	"github.com/zouyx/agollo/v3/storage"
+	"context"
+	"time"
+)
+
+import (
 	"xmicro/config"
 	"xmicro/logger"
-	"gopkg.in/yaml.v2"
 )
 
-type apolloListener struct {
-	listeners map[config.ConfigurationListener]struct{}
+// the delay of a poll after an error
+var retryDelay = time.Second
+
+// namespaceWatch holds the last release of a namespace for its listeners
+type namespaceWatch struct {
+	key            string
+	notificationID int64
+	content        string
+	loaded         bool
+	listeners      map[config.ConfigurationListener]struct{}
 }
 
-// nolint
-func newApolloListener() *apolloListener {
-	return &apolloListener{
-		listeners: make(map[config.ConfigurationListener]struct{}, 0),
+func (c *apolloConfiguration) addListener(key string, listener config.ConfigurationListener) {
+	name := namespaceName(key)
+
+	c.Lock()
+	w, ok := c.watches[name]
+	if ok {
+		w.listeners[listener] = struct{}{}
+		c.Unlock()
+		return
 	}
-}
+	w = &namespaceWatch{
+		key:            key,
+		notificationID: -1,
+		listeners:      map[config.ConfigurationListener]struct{}{listener: {}},
+	}
+	c.watches[name] = w
+	start := !c.polling
+	c.polling = true
+	c.Unlock()
 
-// OnChange process each listener
-func (a *apolloListener) OnChange(changeEvent *storage.ChangeEvent) {
+	// the content the changes are compared to
+	if cfg, err := c.client.getConfig(key); err == nil {
+		c.Lock()
+		if !w.loaded {
+			w.content, w.loaded = cfg.content(), true
+		}
+		c.Unlock()
+	} else if err == errNotFound {
+		c.Lock()
+		w.loaded = true
+		c.Unlock()
+	}
 
+	if start {
+		go c.poll()
+	}
 }
 
-// OnNewestChange process each listener by all changes
-func (a *apolloListener) OnNewestChange(changeEvent *storage.FullChangeEvent) {
-	b, err := yaml.Marshal(changeEvent.Changes)
-	if err != nil {
-		logger.Errorf("apollo onNewestChange err %+v", err)
-		return
+func (c *apolloConfiguration) removeListener(key string, listener config.ConfigurationListener) {
+	c.Lock()
+	defer c.Unlock()
+
+	name := namespaceName(key)
+	if w, ok := c.watches[name]; ok {
+		delete(w.listeners, listener)
+		if len(w.listeners) == 0 {
+			delete(c.watches, name)
+		}
 	}
-	content := string(b)
-	for listener := range a.listeners {
-		listener.Process(&config.ChangeEvent{
-			ConfigType: config.EventTypeUpdate,
-			Key:        changeEvent.Namespace,
-			Value:      content,
-		})
+}
+
+// poll polls the notifications of the watched namespaces until none is left
+func (c *apolloConfiguration) poll() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-c.done:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	for {
+		c.Lock()
+		ns := make([]notification, 0, len(c.watches))
+		for name, w := range c.watches {
+			ns = append(ns, notification{NamespaceName: name, NotificationID: w.notificationID})
+		}
+		if len(ns) == 0 {
+			c.polling = false
+			c.Unlock()
+			return
+		}
+		c.Unlock()
+
+		changed, err := c.client.notifications(ctx, ns)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			logger.Errorf("apollo : poll notifications fail, error:%v", err)
+			if !wait(ctx) {
+				return
+			}
+			continue
+		}
+
+		// the namespaces which failed to refresh keep their notification
+		// id, so they are notified again at once
+		var failed bool
+		for _, n := range changed {
+			if err := c.refresh(n); err != nil {
+				failed = true
+			}
+		}
+		if failed && !wait(ctx) {
+			return
+		}
 	}
 }
 
-// AddListener adds a listener for apollo
-func (a *apolloListener) AddListener(l config.ConfigurationListener) {
-	if _, ok := a.listeners[l]; !ok {
-		a.listeners[l] = struct{}{}
-		agollo.AddChangeListener(a)
+// wait waits the retry delay, it returns false if the context is done
+func wait(ctx context.Context) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(retryDelay):
+		return true
 	}
 }
 
-// RemoveListener removes listeners of apollo
-func (a *apolloListener) RemoveListener(l config.ConfigurationListener) {
-	delete(a.listeners, l)
+// refresh reads the released namespace and notifies its listeners if the
+// content changed
+func (c *apolloConfiguration) refresh(n notification) error {
+	c.Lock()
+	w, ok := c.watches[n.NamespaceName]
+	c.Unlock()
+	if !ok {
+		return nil
+	}
+
+	event := &config.ChangeEvent{Key: w.key, ConfigType: config.EventTypeUpdate}
+	cfg, err := c.client.getConfig(w.key)
+	switch {
+	case err == errNotFound:
+		event.ConfigType = config.EventTypeDel
+	case err != nil:
+		logger.Errorf("apollo : get namespace %s fail, error:%v", w.key, err)
+		return err
+	default:
+		event.Value = cfg.content()
+	}
+	content, _ := event.Value.(string)
+
+	c.Lock()
+	w.notificationID = n.NotificationID
+	changed := w.loaded && content != w.content
+	if changed && len(w.content) == 0 {
+		event.ConfigType = config.EventTypeAdd
+	}
+	w.content, w.loaded = content, true
+	listeners := make([]config.ConfigurationListener, 0, len(w.listeners))
+	for l := range w.listeners {
+		listeners = append(listeners, l)
+	}
+	c.Unlock()
+
+	if !changed {
+		return nil
+	}
+	for _, l := range listeners {
+		l.Process(event)
+	}
+	return nil
 }
@@ -0,0 +1,204 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package consul
+
+import (
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+import (
+	gxset "github.com/dubbogo/gost/container/set"
+	consul "github.com/hashicorp/consul/api"
+	perrors "github.com/pkg/errors"
+)
+
+import (
+	"xmicro/common"
+	"xmicro/common/component"
+	"xmicro/common/constant"
+	"xmicro/config"
+	"xmicro/config/parser"
+)
+
+func init() {
+	component.SetConfigCenterFactory(constant.CONSUL_KEY, &consulDynamicConfigurationFactory{})
+}
+
+type consulDynamicConfigurationFactory struct {
+}
+
+// GetDynamicConfiguration Get Configuration with URL
+func (f *consulDynamicConfigurationFactory) GetDynamicConfiguration(url *common.URL) (config.DynamicConfiguration, error) {
+	dynamicConfiguration, err := newConsulDynamicConfiguration(url)
+	if err != nil {
+		return nil, err
+	}
+	dynamicConfiguration.SetParser(&parser.DefaultConfigurationParser{})
+	return dynamicConfiguration, nil
+}
+
+// consulDynamicConfiguration is the implementation of DynamicConfiguration based on
+// the consul KV store, the config of a key is stored at {namespace}/config/{group}/{key}
+type consulDynamicConfiguration struct {
+	url      *common.URL
+	rootPath string
+	timeout  time.Duration
+	client   *consul.Client
+	parser   parser.ConfigurationParser
+
+	// watches by path
+	sync.Mutex
+	watches map[string]*keyWatch
+}
+
+func newConsulDynamicConfiguration(url *common.URL) (*consulDynamicConfiguration, error) {
+	timeout, err := time.ParseDuration(url.GetParam(constant.CONFIG_TIMEOUT_KET, config.DefaultConfigTimeout))
+	if err != nil {
+		return nil, perrors.WithMessagef(err, "newConsulDynamicConfiguration(address:%+v)", url.Location)
+	}
+
+	cfg := consul.DefaultConfig()
+	cfg.Address = strings.Split(url.Location, ",")[0]
+	cfg.Token = url.GetParam(constant.ACL_TOKEN, "")
+	cfg.Datacenter = url.GetParam(constant.CONSUL_DATACENTER, "")
+	cfg.Namespace = url.GetParam(constant.CONSUL_NAMESPACE, "")
+	cfg.WaitTime = timeout
+	if len(url.Username) > 0 {
+		cfg.HttpAuth = &consul.HttpBasicAuth{
+			Username: url.Username,
+			Password: url.Password,
+		}
+	}
+
+	client, err := consul.NewClient(cfg)
+	if err != nil {
+		return nil, perrors.WithMessagef(err, "newConsulDynamicConfiguration(address:%+v)", url.Location)
+	}
+
+	return &consulDynamicConfiguration{
+		url:      url,
+		rootPath: url.GetParam(constant.ConfigNamespaceKey, config.DefaultGroup) + "/config",
+		timeout:  timeout,
+		client:   client,
+		watches:  make(map[string]*keyWatch),
+	}, nil
+}
+
+// Parser Get Parser
+func (c *consulDynamicConfiguration) Parser() parser.ConfigurationParser {
+	return c.parser
+}
+
+// SetParser Set Parser
+func (c *consulDynamicConfiguration) SetParser(p parser.ConfigurationParser) {
+	c.parser = p
+}
+
+// AddListener Add listener
+func (c *consulDynamicConfiguration) AddListener(key string, listener config.ConfigurationListener, opts ...config.Option) {
+	c.addListener(key, c.path(key, opts...), listener)
+}
+
+// RemoveListener Remove listener
+func (c *consulDynamicConfiguration) RemoveListener(key string, listener config.ConfigurationListener, opts ...config.Option) {
+	c.removeListener(c.path(key, opts...), listener)
+}
+
+// GetProperties get the config of the key in the group
+func (c *consulDynamicConfiguration) GetProperties(key string, opts ...config.Option) (string, error) {
+	return c.GetRule(key, opts...)
+}
+
+// GetRule Get router rule
+func (c *consulDynamicConfiguration) GetRule(key string, opts ...config.Option) (string, error) {
+	p := c.path(key, opts...)
+	pair, _, err := c.client.KV().Get(p, nil)
+	if err != nil {
+		return "", perrors.WithStack(err)
+	}
+	if pair == nil {
+		return "", perrors.Errorf("config %s not found", p)
+	}
+	return string(pair.Value), nil
+}
+
+// GetInternalProperty Get properties value by key
+func (c *consulDynamicConfiguration) GetInternalProperty(key string, opts ...config.Option) (string, error) {
+	return c.GetProperties(key, opts...)
+}
+
+// PublishConfig will publish the config with the (key, group, value) pair
+func (c *consulDynamicConfiguration) PublishConfig(key string, group string, value string) error {
+	_, err := c.client.KV().Put(&consul.KVPair{
+		Key:   c.path(key, config.WithGroup(group)),
+		Value: []byte(value),
+	}, nil)
+	return perrors.WithStack(err)
+}
+
+// RemoveConfig will remove the config with the (key, group) pair
+func (c *consulDynamicConfiguration) RemoveConfig(key string, group string) error {
+	_, err := c.client.KV().Delete(c.path(key, config.WithGroup(group)), nil)
+	return perrors.WithStack(err)
+}
+
+// GetConfigKeysByGroup will return all keys with the group
+func (c *consulDynamicConfiguration) GetConfigKeysByGroup(group string) (*gxset.HashSet, error) {
+	prefix := c.groupPath(group) + "/"
+	result := gxset.NewSet()
+	keys, _, err := c.client.KV().Keys(prefix, "/", nil)
+	if err != nil {
+		return result, perrors.WithMessage(err, "can not find the client config")
+	}
+	for _, k := range keys {
+		// the sub folders are not keys of the group
+		if k = strings.TrimPrefix(k, prefix); len(k) > 0 && !strings.HasSuffix(k, "/") {
+			result.Add(k)
+		}
+	}
+	return result, nil
+}
+
+// Destroy stops the listeners
+func (c *consulDynamicConfiguration) Destroy() {
+	c.Lock()
+	defer c.Unlock()
+
+	for p, w := range c.watches {
+		close(w.done)
+		delete(c.watches, p)
+	}
+}
+
+func (c *consulDynamicConfiguration) groupPath(group string) string {
+	if len(group) == 0 {
+		group = config.DefaultGroup
+	}
+	return path.Join(c.rootPath, group)
+}
+
+func (c *consulDynamicConfiguration) path(key string, opts ...config.Option) string {
+	tmpOpts := &config.Options{}
+	for _, opt := range opts {
+		opt(tmpOpts)
+	}
+	return path.Join(c.groupPath(tmpOpts.Group), key)
+}
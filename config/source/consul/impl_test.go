@@ -0,0 +1,187 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package consul
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+import (
+	consul "github.com/hashicorp/consul/api"
+	"github.com/stretchr/testify/assert"
+)
+
+import (
+	"xmicro/common"
+	"xmicro/config"
+)
+
+// fakeKV serves the consul KV endpoints with blocking queries
+type fakeKV struct {
+	sync.Mutex
+	index   uint64
+	pairs   map[string]*consul.KVPair
+	changed chan struct{}
+}
+
+func newFakeKV() *fakeKV {
+	return &fakeKV{index: 1, pairs: make(map[string]*consul.KVPair), changed: make(chan struct{})}
+}
+
+func (f *fakeKV) update(fn func()) {
+	f.Lock()
+	f.index++
+	fn()
+	close(f.changed)
+	f.changed = make(chan struct{})
+	f.Unlock()
+}
+
+func (f *fakeKV) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	key := strings.TrimPrefix(r.URL.Path, "/v1/kv/")
+	query := r.URL.Query()
+
+	switch r.Method {
+	case http.MethodPut:
+		value, _ := ioutil.ReadAll(r.Body)
+		f.update(func() {
+			pair := &consul.KVPair{Key: key, Value: value, CreateIndex: f.index, ModifyIndex: f.index}
+			if old, ok := f.pairs[key]; ok {
+				pair.CreateIndex = old.CreateIndex
+			}
+			f.pairs[key] = pair
+		})
+		_, _ = w.Write([]byte("true"))
+		return
+	case http.MethodDelete:
+		f.update(func() {
+			delete(f.pairs, key)
+		})
+		_, _ = w.Write([]byte("true"))
+		return
+	}
+
+	f.Lock()
+	if index, _ := strconv.ParseUint(query.Get("index"), 10, 64); index >= f.index {
+		changed := f.changed
+		f.Unlock()
+		select {
+		case <-changed:
+		case <-r.Context().Done():
+			return
+		case <-time.After(time.Second):
+		}
+		f.Lock()
+	}
+	defer f.Unlock()
+
+	w.Header().Set("X-Consul-Index", strconv.FormatUint(f.index, 10))
+	if _, ok := query["keys"]; ok {
+		keys := []string{}
+		for k := range f.pairs {
+			if strings.HasPrefix(k, key) {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		_ = json.NewEncoder(w).Encode(keys)
+		return
+	}
+	pair, ok := f.pairs[key]
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	_ = json.NewEncoder(w).Encode([]*consul.KVPair{pair})
+}
+
+type listener struct {
+	events chan *config.ChangeEvent
+}
+
+func (l *listener) Process(e *config.ChangeEvent) {
+	l.events <- e
+}
+
+func (l *listener) next(t *testing.T) *config.ChangeEvent {
+	select {
+	case e := <-l.events:
+		return e
+	case <-time.After(5 * time.Second):
+		t.Fatal("no change event")
+		return nil
+	}
+}
+
+func TestDynamicConfiguration(t *testing.T) {
+	srv := httptest.NewServer(newFakeKV())
+	defer srv.Close()
+
+	u, err := common.NewURL("consul://" + strings.TrimPrefix(srv.URL, "http://"))
+	assert.NoError(t, err)
+	dc, err := (&consulDynamicConfigurationFactory{}).GetDynamicConfiguration(u)
+	assert.NoError(t, err)
+	defer dc.(*consulDynamicConfiguration).Destroy()
+
+	_, err = dc.GetProperties("micro.yml", config.WithGroup("orders"))
+	assert.Error(t, err)
+
+	l := &listener{events: make(chan *config.ChangeEvent, 8)}
+	dc.AddListener("micro.yml", l, config.WithGroup("orders"))
+	// wait for the first query of the watch
+	time.Sleep(100 * time.Millisecond)
+
+	assert.NoError(t, dc.PublishConfig("micro.yml", "orders", "a: 1"))
+	e := l.next(t)
+	assert.EqualValues(t, config.EventTypeAdd, e.ConfigType)
+	assert.Equal(t, "micro.yml", e.Key)
+	assert.Equal(t, "a: 1", e.Value)
+
+	assert.NoError(t, dc.PublishConfig("micro.yml", "orders", "a: 2"))
+	assert.EqualValues(t, config.EventTypeUpdate, l.next(t).ConfigType)
+
+	content, err := dc.GetProperties("micro.yml", config.WithGroup("orders"))
+	assert.NoError(t, err)
+	assert.Equal(t, "a: 2", content)
+
+	// other groups are not seen
+	assert.NoError(t, dc.PublishConfig("micro.yml", "", "b: 1"))
+	keys, err := dc.GetConfigKeysByGroup("orders")
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{"micro.yml"}, keys.Values())
+
+	assert.NoError(t, dc.RemoveConfig("micro.yml", "orders"))
+	assert.EqualValues(t, config.EventTypeDel, l.next(t).ConfigType)
+
+	dc.RemoveListener("micro.yml", l, config.WithGroup("orders"))
+	assert.NoError(t, dc.PublishConfig("micro.yml", "orders", "a: 3"))
+	select {
+	case e := <-l.events:
+		t.Fatalf("unexpected event %v", e)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
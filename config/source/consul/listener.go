@@ -0,0 +1,150 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package consul
+
+import (
+	"context"
+	"time"
+)
+
+import (
+	consul "github.com/hashicorp/consul/api"
+)
+
+import (
+	"xmicro/config"
+	"xmicro/logger"
+)
+
+// the delay of a blocking query after an error
+var retryDelay = time.Second
+
+// keyWatch watches a path with blocking queries for its listeners
+type keyWatch struct {
+	done      chan struct{}
+	listeners map[config.ConfigurationListener]struct{}
+}
+
+func (c *consulDynamicConfiguration) addListener(key, p string, listener config.ConfigurationListener) {
+	c.Lock()
+	defer c.Unlock()
+
+	if w, ok := c.watches[p]; ok {
+		w.listeners[listener] = struct{}{}
+		return
+	}
+
+	w := &keyWatch{
+		done:      make(chan struct{}),
+		listeners: map[config.ConfigurationListener]struct{}{listener: {}},
+	}
+	c.watches[p] = w
+
+	go c.watch(key, p, w.done)
+}
+
+func (c *consulDynamicConfiguration) removeListener(p string, listener config.ConfigurationListener) {
+	c.Lock()
+	defer c.Unlock()
+
+	w, ok := c.watches[p]
+	if !ok {
+		return
+	}
+	delete(w.listeners, listener)
+	if len(w.listeners) == 0 {
+		close(w.done)
+		delete(c.watches, p)
+	}
+}
+
+func (c *consulDynamicConfiguration) watch(key, p string, done chan struct{}) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-done
+		cancel()
+	}()
+
+	var (
+		index uint64
+		last  *consul.KVPair
+		first = true
+	)
+	for {
+		pair, meta, err := c.client.KV().Get(p, (&consul.QueryOptions{WaitIndex: index}).WithContext(ctx))
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			logger.Errorf("consul : watch config %s fail, error:%v", p, err)
+			select {
+			case <-done:
+				return
+			case <-time.After(retryDelay):
+			}
+			continue
+		}
+		// the index went backwards, e.g. after a restore of consul
+		if meta.LastIndex < index {
+			index = 0
+		} else {
+			index = meta.LastIndex
+		}
+
+		// the first query reads the current value
+		if first {
+			first = false
+			last = pair
+			continue
+		}
+
+		event := &config.ChangeEvent{Key: key}
+		switch {
+		case pair == nil && last == nil:
+			continue
+		case pair == nil:
+			event.ConfigType = config.EventTypeDel
+		case last == nil:
+			event.ConfigType = config.EventTypeAdd
+			event.Value = string(pair.Value)
+		case pair.ModifyIndex != last.ModifyIndex:
+			event.ConfigType = config.EventTypeUpdate
+			event.Value = string(pair.Value)
+		default:
+			continue
+		}
+		last = pair
+		c.notify(p, event)
+	}
+}
+
+func (c *consulDynamicConfiguration) notify(p string, event *config.ChangeEvent) {
+	c.Lock()
+	var listeners []config.ConfigurationListener
+	if w, ok := c.watches[p]; ok {
+		for l := range w.listeners {
+			listeners = append(listeners, l)
+		}
+	}
+	c.Unlock()
+
+	for _, l := range listeners {
+		l.Process(event)
+	}
+}
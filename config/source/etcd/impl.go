@@ -0,0 +1,214 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package etcd
+
+import (
+	"context"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+import (
+	gxset "github.com/dubbogo/gost/container/set"
+	perrors "github.com/pkg/errors"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+import (
+	"xmicro/common"
+	"xmicro/common/component"
+	"xmicro/common/constant"
+	"xmicro/config"
+	"xmicro/config/parser"
+	"xmicro/logger"
+)
+
+func init() {
+	component.SetConfigCenterFactory(constant.EtcdKey, &etcdDynamicConfigurationFactory{})
+}
+
+type etcdDynamicConfigurationFactory struct {
+}
+
+// GetDynamicConfiguration Get Configuration with URL
+func (f *etcdDynamicConfigurationFactory) GetDynamicConfiguration(url *common.URL) (config.DynamicConfiguration, error) {
+	dynamicConfiguration, err := newEtcdDynamicConfiguration(url)
+	if err != nil {
+		return nil, err
+	}
+	dynamicConfiguration.SetParser(&parser.DefaultConfigurationParser{})
+	return dynamicConfiguration, nil
+}
+
+// etcdDynamicConfiguration is the implementation of DynamicConfiguration based on etcd,
+// the config of a key is stored at /{namespace}/config/{group}/{key}
+type etcdDynamicConfiguration struct {
+	url      *common.URL
+	rootPath string
+	timeout  time.Duration
+	client   *clientv3.Client
+	parser   parser.ConfigurationParser
+	// the interval before a closed watch is watched again
+	retryInterval time.Duration
+
+	// watches by path and the watcher of the client they watch with
+	sync.Mutex
+	watches map[string]*keyWatch
+	watcher clientv3.Watcher
+}
+
+func newEtcdDynamicConfiguration(url *common.URL) (*etcdDynamicConfiguration, error) {
+	timeout, err := time.ParseDuration(url.GetParam(constant.CONFIG_TIMEOUT_KET, config.DefaultConfigTimeout))
+	if err != nil {
+		return nil, perrors.WithMessagef(err, "newEtcdDynamicConfiguration(address:%+v)", url.Location)
+	}
+
+	client, err := clientv3.New(clientv3.Config{
+		Endpoints:   strings.Split(url.Location, ","),
+		DialTimeout: timeout,
+		Username:    url.Username,
+		Password:    url.Password,
+	})
+	if err != nil {
+		logger.Errorf("etcd config client start error, error message is %v", err)
+		return nil, perrors.WithMessagef(err, "newEtcdDynamicConfiguration(address:%+v)", url.Location)
+	}
+
+	return &etcdDynamicConfiguration{
+		url:      url,
+		rootPath: "/" + url.GetParam(constant.ConfigNamespaceKey, config.DefaultGroup) + "/config",
+		timeout:  timeout,
+		client:   client,
+		watches:  make(map[string]*keyWatch),
+		watcher:  client.Watcher,
+
+		retryInterval: watchRetryInterval,
+	}, nil
+}
+
+// Parser Get Parser
+func (e *etcdDynamicConfiguration) Parser() parser.ConfigurationParser {
+	return e.parser
+}
+
+// SetParser Set Parser
+func (e *etcdDynamicConfiguration) SetParser(p parser.ConfigurationParser) {
+	e.parser = p
+}
+
+// AddListener Add listener
+func (e *etcdDynamicConfiguration) AddListener(key string, listener config.ConfigurationListener, opts ...config.Option) {
+	e.addListener(key, e.path(key, opts...), listener)
+}
+
+// RemoveListener Remove listener
+func (e *etcdDynamicConfiguration) RemoveListener(key string, listener config.ConfigurationListener, opts ...config.Option) {
+	e.removeListener(e.path(key, opts...), listener)
+}
+
+// GetProperties get the config of the key in the group
+func (e *etcdDynamicConfiguration) GetProperties(key string, opts ...config.Option) (string, error) {
+	return e.GetRule(key, opts...)
+}
+
+// GetRule Get router rule
+func (e *etcdDynamicConfiguration) GetRule(key string, opts ...config.Option) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), e.timeout)
+	defer cancel()
+
+	p := e.path(key, opts...)
+	rsp, err := e.client.Get(ctx, p)
+	if err != nil {
+		return "", perrors.WithStack(err)
+	}
+	if len(rsp.Kvs) == 0 {
+		return "", perrors.Errorf("config %s not found", p)
+	}
+	return string(rsp.Kvs[0].Value), nil
+}
+
+// GetInternalProperty Get properties value by key
+func (e *etcdDynamicConfiguration) GetInternalProperty(key string, opts ...config.Option) (string, error) {
+	return e.GetProperties(key, opts...)
+}
+
+// PublishConfig will publish the config with the (key, group, value) pair
+func (e *etcdDynamicConfiguration) PublishConfig(key string, group string, value string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), e.timeout)
+	defer cancel()
+
+	_, err := e.client.Put(ctx, e.path(key, config.WithGroup(group)), value)
+	return perrors.WithStack(err)
+}
+
+// RemoveConfig will remove the config with the (key, group) pair
+func (e *etcdDynamicConfiguration) RemoveConfig(key string, group string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), e.timeout)
+	defer cancel()
+
+	_, err := e.client.Delete(ctx, e.path(key, config.WithGroup(group)))
+	return perrors.WithStack(err)
+}
+
+// GetConfigKeysByGroup will return all keys with the group
+func (e *etcdDynamicConfiguration) GetConfigKeysByGroup(group string) (*gxset.HashSet, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), e.timeout)
+	defer cancel()
+
+	prefix := e.groupPath(group) + "/"
+	result := gxset.NewSet()
+	rsp, err := e.client.Get(ctx, prefix, clientv3.WithPrefix(), clientv3.WithKeysOnly())
+	if err != nil {
+		return result, perrors.WithMessage(err, "can not find the client config")
+	}
+	for _, kv := range rsp.Kvs {
+		result.Add(strings.TrimPrefix(string(kv.Key), prefix))
+	}
+	return result, nil
+}
+
+// Destroy stops the listeners and closes the client
+func (e *etcdDynamicConfiguration) Destroy() {
+	e.Lock()
+	for p, w := range e.watches {
+		w.cancel()
+		delete(e.watches, p)
+	}
+	e.Unlock()
+
+	if err := e.client.Close(); err != nil {
+		logger.Errorf("close etcd config client error, error message is %v", err)
+	}
+}
+
+func (e *etcdDynamicConfiguration) groupPath(group string) string {
+	if len(group) == 0 {
+		group = config.DefaultGroup
+	}
+	return path.Join(e.rootPath, group)
+}
+
+func (e *etcdDynamicConfiguration) path(key string, opts ...config.Option) string {
+	tmpOpts := &config.Options{}
+	for _, opt := range opts {
+		opt(tmpOpts)
+	}
+	return path.Join(e.groupPath(tmpOpts.Group), key)
+}
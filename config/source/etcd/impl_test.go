@@ -0,0 +1,159 @@
+package etcd
+
+import (
+	"context"
+	"net/url"
+	"testing"
+	"time"
+)
+
+import (
+	"github.com/stretchr/testify/assert"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/server/v3/embed"
+)
+
+import (
+	"xmicro/common"
+	"xmicro/config"
+)
+
+func runEtcd(t *testing.T) string {
+	cfg := embed.NewConfig()
+	cfg.Dir = t.TempDir()
+	cfg.LogLevel = "error"
+
+	u, _ := url.Parse("http://127.0.0.1:0")
+	cfg.LCUrls = []url.URL{*u}
+	cfg.LPUrls = []url.URL{*u}
+
+	e, err := embed.StartEtcd(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(e.Close)
+
+	select {
+	case <-e.Server.ReadyNotify():
+	case <-time.After(10 * time.Second):
+		t.Fatal("etcd server not ready")
+	}
+
+	return e.Clients[0].Addr().String()
+}
+
+type listener struct {
+	events chan *config.ChangeEvent
+}
+
+func (l *listener) Process(e *config.ChangeEvent) {
+	l.events <- e
+}
+
+func (l *listener) next(t *testing.T) *config.ChangeEvent {
+	select {
+	case e := <-l.events:
+		return e
+	case <-time.After(5 * time.Second):
+		t.Fatal("no change event")
+		return nil
+	}
+}
+
+// until skips the change events until the one of the value
+func (l *listener) until(t *testing.T, value string) *config.ChangeEvent {
+	for {
+		if e := l.next(t); e.Value == value {
+			return e
+		}
+	}
+}
+
+func TestDynamicConfiguration(t *testing.T) {
+	u, err := common.NewURL("etcd://" + runEtcd(t))
+	assert.NoError(t, err)
+	dc, err := (&etcdDynamicConfigurationFactory{}).GetDynamicConfiguration(u)
+	assert.NoError(t, err)
+	defer dc.(*etcdDynamicConfiguration).Destroy()
+
+	_, err = dc.GetProperties("micro.yml", config.WithGroup("orders"))
+	assert.Error(t, err)
+
+	l := &listener{events: make(chan *config.ChangeEvent, 8)}
+	dc.AddListener("micro.yml", l, config.WithGroup("orders"))
+
+	assert.NoError(t, dc.PublishConfig("micro.yml", "orders", "a: 1"))
+	e := l.next(t)
+	assert.EqualValues(t, config.EventTypeAdd, e.ConfigType)
+	assert.Equal(t, "a: 1", e.Value)
+
+	assert.NoError(t, dc.PublishConfig("micro.yml", "orders", "a: 2"))
+	assert.EqualValues(t, config.EventTypeUpdate, l.next(t).ConfigType)
+
+	content, err := dc.GetProperties("micro.yml", config.WithGroup("orders"))
+	assert.NoError(t, err)
+	assert.Equal(t, "a: 2", content)
+
+	// other groups are not seen
+	assert.NoError(t, dc.PublishConfig("micro.yml", "", "b: 1"))
+	keys, err := dc.GetConfigKeysByGroup("orders")
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{"micro.yml"}, keys.Values())
+
+	assert.NoError(t, dc.RemoveConfig("micro.yml", "orders"))
+	assert.EqualValues(t, config.EventTypeDel, l.next(t).ConfigType)
+
+	dc.RemoveListener("micro.yml", l, config.WithGroup("orders"))
+	assert.NoError(t, dc.PublishConfig("micro.yml", "orders", "a: 3"))
+	select {
+	case e := <-l.events:
+		t.Fatalf("unexpected event %v", e)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func TestWatchClosed(t *testing.T) {
+	u, err := common.NewURL("etcd://" + runEtcd(t))
+	assert.NoError(t, err)
+	dc, err := (&etcdDynamicConfigurationFactory{}).GetDynamicConfiguration(u)
+	assert.NoError(t, err)
+	ec := dc.(*etcdDynamicConfiguration)
+	ec.retryInterval = 200 * time.Millisecond
+	defer ec.Destroy()
+
+	l := &listener{events: make(chan *config.ChangeEvent, 8)}
+	dc.AddListener("micro.yml", l, config.WithGroup("orders"))
+	assert.NoError(t, dc.PublishConfig("micro.yml", "orders", "a: 1"))
+	assert.Equal(t, "a: 1", l.next(t).Value)
+
+	closeWatch := func() {
+		ec.Lock()
+		old := ec.watcher
+		ec.watcher = clientv3.NewWatcher(ec.client)
+		ec.Unlock()
+		assert.NoError(t, old.Close())
+	}
+
+	// the change made while the watch is closed is seen from the last revision
+	closeWatch()
+	assert.NoError(t, dc.PublishConfig("micro.yml", "orders", "a: 2"))
+	e := l.next(t)
+	assert.EqualValues(t, config.EventTypeUpdate, e.ConfigType)
+	assert.Equal(t, "a: 2", e.Value)
+
+	// the config is read again once the revisions were compacted
+	closeWatch()
+	assert.NoError(t, dc.PublishConfig("micro.yml", "orders", "a: 3"))
+	assert.NoError(t, dc.PublishConfig("micro.yml", "orders", "a: 4"))
+	rsp, err := ec.client.Get(context.Background(), ec.path("micro.yml", config.WithGroup("orders")))
+	assert.NoError(t, err)
+	_, err = ec.client.Compact(context.Background(), rsp.Header.Revision)
+	assert.NoError(t, err)
+	// a: 3 is seen first when the watch was back before the compaction
+	e = l.until(t, "a: 4")
+	assert.EqualValues(t, config.EventTypeUpdate, e.ConfigType)
+
+	// and watched again
+	assert.NoError(t, dc.PublishConfig("micro.yml", "orders", "a: 5"))
+	assert.Equal(t, "a: 5", l.next(t).Value)
+}
@@ -0,0 +1,176 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package etcd
+
+import (
+	"context"
+	"time"
+)
+
+import (
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+import (
+	"xmicro/config"
+	"xmicro/logger"
+)
+
+// the interval before a closed watch is watched again
+const watchRetryInterval = time.Second
+
+// keyWatch watches a path for its listeners
+type keyWatch struct {
+	cancel    context.CancelFunc
+	listeners map[config.ConfigurationListener]struct{}
+}
+
+func (e *etcdDynamicConfiguration) addListener(key, p string, listener config.ConfigurationListener) {
+	e.Lock()
+	defer e.Unlock()
+
+	if w, ok := e.watches[p]; ok {
+		w.listeners[listener] = struct{}{}
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	w := &keyWatch{
+		cancel:    cancel,
+		listeners: map[config.ConfigurationListener]struct{}{listener: {}},
+	}
+	e.watches[p] = w
+
+	// watched before returning so that no change made after is missed
+	go e.watch(ctx, key, p, e.watcher.Watch(ctx, p))
+}
+
+func (e *etcdDynamicConfiguration) removeListener(p string, listener config.ConfigurationListener) {
+	e.Lock()
+	defer e.Unlock()
+
+	w, ok := e.watches[p]
+	if !ok {
+		return
+	}
+	delete(w.listeners, listener)
+	if len(w.listeners) == 0 {
+		w.cancel()
+		delete(e.watches, p)
+	}
+}
+
+// watch notifies the listeners of the changes of the path. A closed watch
+// is watched again from the last revision seen, the current config is read
+// when the revisions since were compacted.
+func (e *etcdDynamicConfiguration) watch(ctx context.Context, key, p string, wch clientv3.WatchChan) {
+	var rev int64
+	for {
+		for rsp := range wch {
+			if rsp.CompactRevision != 0 {
+				logger.Warnf("etcd : watch config %s compacted at revision %d", p, rsp.CompactRevision)
+				rev = 0
+				break
+			}
+			if err := rsp.Err(); err != nil {
+				logger.Errorf("etcd : watch config %s fail, error:%v", p, err)
+				continue
+			}
+			for _, ev := range rsp.Events {
+				e.notify(p, changeEvent(key, ev))
+			}
+			rev = rsp.Header.Revision
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(e.retryInterval):
+		}
+
+		// the changes since the revision are unknown
+		for rev == 0 {
+			if rev = e.resync(ctx, key, p); rev != 0 {
+				break
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(e.retryInterval):
+			}
+		}
+		logger.Warnf("etcd : watch config %s closed, watching from revision %d", p, rev+1)
+
+		e.Lock()
+		watcher := e.watcher
+		e.Unlock()
+		wch = watcher.Watch(ctx, p, clientv3.WithRev(rev+1))
+	}
+}
+
+// resync notifies the listeners of the current config of the path and
+// returns its revision, 0 if it can't be read
+func (e *etcdDynamicConfiguration) resync(ctx context.Context, key, p string) int64 {
+	ctx, cancel := context.WithTimeout(ctx, e.timeout)
+	defer cancel()
+
+	rsp, err := e.client.Get(ctx, p)
+	if err != nil {
+		logger.Errorf("etcd : get config %s fail, error:%v", p, err)
+		return 0
+	}
+
+	event := &config.ChangeEvent{Key: key, ConfigType: config.EventTypeDel}
+	if len(rsp.Kvs) > 0 {
+		event.ConfigType = config.EventTypeUpdate
+		event.Value = string(rsp.Kvs[0].Value)
+	}
+	e.notify(p, event)
+	return rsp.Header.Revision
+}
+
+func changeEvent(key string, ev *clientv3.Event) *config.ChangeEvent {
+	event := &config.ChangeEvent{Key: key}
+	switch {
+	case ev.Type == mvccpb.DELETE:
+		event.ConfigType = config.EventTypeDel
+	case ev.IsCreate():
+		event.ConfigType = config.EventTypeAdd
+		event.Value = string(ev.Kv.Value)
+	default:
+		event.ConfigType = config.EventTypeUpdate
+		event.Value = string(ev.Kv.Value)
+	}
+	return event
+}
+
+func (e *etcdDynamicConfiguration) notify(p string, event *config.ChangeEvent) {
+	e.Lock()
+	var listeners []config.ConfigurationListener
+	if w, ok := e.watches[p]; ok {
+		for l := range w.listeners {
+			listeners = append(listeners, l)
+		}
+	}
+	e.Unlock()
+
+	for _, l := range listeners {
+		l.Process(event)
+	}
+}
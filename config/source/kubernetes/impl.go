@@ -0,0 +1,202 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kubernetes
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+import (
+	gxset "github.com/dubbogo/gost/container/set"
+	perrors "github.com/pkg/errors"
+)
+
+import (
+	"xmicro/common"
+	"xmicro/common/component"
+	"xmicro/common/constant"
+	"xmicro/config"
+	"xmicro/config/parser"
+	"xmicro/registry/kubernetes/client"
+)
+
+func init() {
+	component.SetConfigCenterFactory(constant.KubernetesKey, &kubernetesDynamicConfigurationFactory{})
+}
+
+// newClient connects in cluster when no address is configured
+var newClient = func(host string) client.Kubernetes {
+	if len(host) == 0 {
+		return client.NewClientInCluster()
+	}
+	if !strings.Contains(host, "://") {
+		host = "https://" + host
+	}
+	return client.NewClientByHost(host)
+}
+
+type kubernetesDynamicConfigurationFactory struct {
+}
+
+// GetDynamicConfiguration Get Configuration with URL
+func (f *kubernetesDynamicConfigurationFactory) GetDynamicConfiguration(url *common.URL) (config.DynamicConfiguration, error) {
+	dynamicConfiguration, err := newKubernetesDynamicConfiguration(url)
+	if err != nil {
+		return nil, err
+	}
+	dynamicConfiguration.SetParser(&parser.DefaultConfigurationParser{})
+	return dynamicConfiguration, nil
+}
+
+// kubernetesDynamicConfiguration is the implementation of DynamicConfiguration based on
+// the config maps or the secrets of the namespace of the client, a group is an object
+// and the keys are its data entries
+type kubernetesDynamicConfiguration struct {
+	url    *common.URL
+	store  store
+	parser parser.ConfigurationParser
+
+	// watches by group
+	sync.Mutex
+	watches map[string]*groupWatch
+}
+
+func newKubernetesDynamicConfiguration(url *common.URL) (*kubernetesDynamicConfiguration, error) {
+	var host string
+	if len(url.Location) > 0 && url.Location != ":" {
+		host = strings.Split(url.Location, ",")[0]
+	}
+	c := newClient(host)
+
+	var s store
+	switch kind := url.GetParam(constant.KubernetesConfigKindKey, constant.KubernetesConfigMapKey); kind {
+	case constant.KubernetesConfigMapKey:
+		s = &configMapStore{client: c}
+	case constant.KubernetesSecretKey:
+		s = &secretStore{client: c}
+	default:
+		return nil, perrors.Errorf("unknown kubernetes config kind %s", kind)
+	}
+
+	return &kubernetesDynamicConfiguration{
+		url:     url,
+		store:   s,
+		watches: make(map[string]*groupWatch),
+	}, nil
+}
+
+// Parser Get Parser
+func (k *kubernetesDynamicConfiguration) Parser() parser.ConfigurationParser {
+	return k.parser
+}
+
+// SetParser Set Parser
+func (k *kubernetesDynamicConfiguration) SetParser(p parser.ConfigurationParser) {
+	k.parser = p
+}
+
+// AddListener Add listener
+func (k *kubernetesDynamicConfiguration) AddListener(key string, listener config.ConfigurationListener, opts ...config.Option) {
+	k.addListener(group(opts...), key, listener)
+}
+
+// RemoveListener Remove listener
+func (k *kubernetesDynamicConfiguration) RemoveListener(key string, listener config.ConfigurationListener, opts ...config.Option) {
+	k.removeListener(group(opts...), key, listener)
+}
+
+// GetProperties get the config of the key in the group
+func (k *kubernetesDynamicConfiguration) GetProperties(key string, opts ...config.Option) (string, error) {
+	return k.GetRule(key, opts...)
+}
+
+// GetRule Get router rule
+func (k *kubernetesDynamicConfiguration) GetRule(key string, opts ...config.Option) (string, error) {
+	g := group(opts...)
+	data, err := k.store.get(g)
+	if err != nil {
+		return "", perrors.WithMessagef(err, "get config %s/%s", g, key)
+	}
+	value, ok := data[key]
+	if !ok {
+		return "", perrors.Errorf("config %s/%s not found", g, key)
+	}
+	return value, nil
+}
+
+// GetInternalProperty Get properties value by key
+func (k *kubernetesDynamicConfiguration) GetInternalProperty(key string, opts ...config.Option) (string, error) {
+	return k.GetProperties(key, opts...)
+}
+
+// PublishConfig will publish the config with the (key, group, value) pair,
+// the object of the group is created when missing
+func (k *kubernetesDynamicConfiguration) PublishConfig(key string, group string, value string) error {
+	return k.store.put(groupName(group), key, value)
+}
+
+// RemoveConfig will remove the config with the (key, group) pair
+func (k *kubernetesDynamicConfiguration) RemoveConfig(key string, group string) error {
+	return k.store.remove(groupName(group), key)
+}
+
+// GetConfigKeysByGroup will return all keys with the group
+func (k *kubernetesDynamicConfiguration) GetConfigKeysByGroup(group string) (*gxset.HashSet, error) {
+	result := gxset.NewSet()
+	data, err := k.store.get(groupName(group))
+	if err != nil {
+		return result, perrors.WithMessage(err, "can not find the client config")
+	}
+	keys := make([]string, 0, len(data))
+	for key := range data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		result.Add(key)
+	}
+	return result, nil
+}
+
+// Destroy stops the listeners
+func (k *kubernetesDynamicConfiguration) Destroy() {
+	k.Lock()
+	defer k.Unlock()
+
+	for g, w := range k.watches {
+		close(w.done)
+		delete(k.watches, g)
+	}
+}
+
+func group(opts ...config.Option) string {
+	tmpOpts := &config.Options{}
+	for _, opt := range opts {
+		opt(tmpOpts)
+	}
+	return groupName(tmpOpts.Group)
+}
+
+func groupName(group string) string {
+	if len(group) == 0 {
+		return config.DefaultGroup
+	}
+	return group
+}
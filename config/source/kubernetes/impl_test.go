@@ -0,0 +1,164 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kubernetes
+
+import (
+	"testing"
+	"time"
+)
+
+import (
+	"github.com/stretchr/testify/assert"
+)
+
+import (
+	"xmicro/common"
+	"xmicro/config"
+	"xmicro/registry/kubernetes/client"
+	"xmicro/registry/kubernetes/client/mock"
+)
+
+type listener struct {
+	events chan *config.ChangeEvent
+}
+
+func (l *listener) Process(e *config.ChangeEvent) {
+	l.events <- e
+}
+
+func (l *listener) next(t *testing.T) *config.ChangeEvent {
+	select {
+	case e := <-l.events:
+		return e
+	case <-time.After(5 * time.Second):
+		t.Fatal("no change event")
+		return nil
+	}
+}
+
+func newTestConfiguration(t *testing.T, kind string) *kubernetesDynamicConfiguration {
+	c := mock.NewClient()
+	newClient = func(string) client.Kubernetes {
+		return c
+	}
+
+	u, err := common.NewURL("kubernetes://127.0.0.1:6443?kubernetes-config-kind=" + kind)
+	assert.NoError(t, err)
+	dc, err := (&kubernetesDynamicConfigurationFactory{}).GetDynamicConfiguration(u)
+	assert.NoError(t, err)
+	t.Cleanup(dc.(*kubernetesDynamicConfiguration).Destroy)
+	return dc.(*kubernetesDynamicConfiguration)
+}
+
+func TestDynamicConfiguration(t *testing.T) {
+	for _, kind := range []string{"configmap", "secret"} {
+		t.Run(kind, func(t *testing.T) {
+			dc := newTestConfiguration(t, kind)
+
+			_, err := dc.GetProperties("micro.yml", config.WithGroup("orders"))
+			assert.Error(t, err)
+
+			l := &listener{events: make(chan *config.ChangeEvent, 8)}
+			dc.AddListener("micro.yml", l, config.WithGroup("orders"))
+			// wait for the watch to open
+			time.Sleep(100 * time.Millisecond)
+
+			assert.NoError(t, dc.PublishConfig("micro.yml", "orders", "a: 1"))
+			e := l.next(t)
+			assert.EqualValues(t, config.EventTypeAdd, e.ConfigType)
+			assert.Equal(t, "micro.yml", e.Key)
+			assert.Equal(t, "a: 1", e.Value)
+
+			assert.NoError(t, dc.PublishConfig("micro.yml", "orders", "a: 2"))
+			assert.EqualValues(t, config.EventTypeUpdate, l.next(t).ConfigType)
+
+			// the other entries of the object are not seen by the listener
+			assert.NoError(t, dc.PublishConfig("other.yml", "orders", "b: 1"))
+			content, err := dc.GetProperties("micro.yml", config.WithGroup("orders"))
+			assert.NoError(t, err)
+			assert.Equal(t, "a: 2", content)
+
+			keys, err := dc.GetConfigKeysByGroup("orders")
+			assert.NoError(t, err)
+			assert.ElementsMatch(t, []interface{}{"micro.yml", "other.yml"}, keys.Values())
+
+			assert.NoError(t, dc.RemoveConfig("micro.yml", "orders"))
+			assert.EqualValues(t, config.EventTypeDel, l.next(t).ConfigType)
+
+			dc.RemoveListener("micro.yml", l, config.WithGroup("orders"))
+			assert.NoError(t, dc.PublishConfig("micro.yml", "orders", "a: 3"))
+			select {
+			case e := <-l.events:
+				t.Fatalf("unexpected event %v", e)
+			case <-time.After(200 * time.Millisecond):
+			}
+		})
+	}
+}
+
+// racingClient changes the objects of another writer before an update
+type racingClient struct {
+	*mock.Client
+	race func()
+}
+
+func (c *racingClient) run() {
+	if race := c.race; race != nil {
+		c.race = nil
+		race()
+	}
+}
+
+func (c *racingClient) UpdateConfigMap(name string, cm *client.ConfigMap) (*client.ConfigMap, error) {
+	c.run()
+	return c.Client.UpdateConfigMap(name, cm)
+}
+
+func (c *racingClient) UpdateSecret(name string, s *client.Secret) (*client.Secret, error) {
+	c.run()
+	return c.Client.UpdateSecret(name, s)
+}
+
+func TestStoreConflict(t *testing.T) {
+	c := &racingClient{Client: mock.NewClient()}
+	for kind, s := range map[string]store{
+		"configmap": &configMapStore{client: c},
+		"secret":    &secretStore{client: c},
+	} {
+		t.Run(kind, func(t *testing.T) {
+			assert.NoError(t, s.put("orders", "micro.yml", "a: 1"))
+
+			// the entry written by the other writer is kept
+			c.race = func() {
+				assert.NoError(t, s.put("orders", "other.yml", "b: 1"))
+			}
+			assert.NoError(t, s.put("orders", "micro.yml", "a: 2"))
+			data, err := s.get("orders")
+			assert.NoError(t, err)
+			assert.Equal(t, map[string]string{"micro.yml": "a: 2", "other.yml": "b: 1"}, data)
+
+			c.race = func() {
+				assert.NoError(t, s.put("orders", "other.yml", "b: 2"))
+			}
+			assert.NoError(t, s.remove("orders", "micro.yml"))
+			data, err = s.get("orders")
+			assert.NoError(t, err)
+			assert.Equal(t, map[string]string{"other.yml": "b: 2"}, data)
+		})
+	}
+}
@@ -0,0 +1,185 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kubernetes
+
+import (
+	"time"
+)
+
+import (
+	"xmicro/config"
+	"xmicro/logger"
+	"xmicro/registry/kubernetes/client/api"
+	"xmicro/registry/kubernetes/client/watch"
+)
+
+var (
+	// the delay of a watch after an error
+	retryDelay = time.Second
+	// the period the object is read again, the events of a broken
+	// watch are not lost
+	resyncPeriod = time.Minute
+)
+
+// groupWatch watches the object of a group for the listeners of its keys
+type groupWatch struct {
+	done      chan struct{}
+	listeners map[string]map[config.ConfigurationListener]struct{}
+}
+
+func (k *kubernetesDynamicConfiguration) addListener(group, key string, listener config.ConfigurationListener) {
+	k.Lock()
+	defer k.Unlock()
+
+	w, ok := k.watches[group]
+	if !ok {
+		w = &groupWatch{
+			done:      make(chan struct{}),
+			listeners: make(map[string]map[config.ConfigurationListener]struct{}),
+		}
+		k.watches[group] = w
+		go k.watch(group, w.done)
+	}
+	if w.listeners[key] == nil {
+		w.listeners[key] = make(map[config.ConfigurationListener]struct{})
+	}
+	w.listeners[key][listener] = struct{}{}
+}
+
+func (k *kubernetesDynamicConfiguration) removeListener(group, key string, listener config.ConfigurationListener) {
+	k.Lock()
+	defer k.Unlock()
+
+	w, ok := k.watches[group]
+	if !ok {
+		return
+	}
+	delete(w.listeners[key], listener)
+	if len(w.listeners[key]) == 0 {
+		delete(w.listeners, key)
+	}
+	if len(w.listeners) == 0 {
+		close(w.done)
+		delete(k.watches, group)
+	}
+}
+
+func (k *kubernetesDynamicConfiguration) watch(group string, done chan struct{}) {
+	var (
+		data   map[string]string
+		loaded bool
+	)
+	for {
+		w, err := k.store.watch()
+		if err != nil {
+			logger.Errorf("kubernetes : watch config %s fail, error:%v", group, err)
+			select {
+			case <-done:
+				return
+			case <-time.After(retryDelay):
+			}
+			continue
+		}
+
+		// the object is read once the watch is open, no change is missed
+		data, loaded = k.sync(group, data, loaded)
+		var stopped bool
+		data, stopped = k.consume(group, w, data, done)
+		w.Stop()
+		if stopped {
+			return
+		}
+	}
+}
+
+// consume applies the events of the watch until it ends or the
+// listeners are removed, it returns the latest data
+func (k *kubernetesDynamicConfiguration) consume(group string, w watch.Watch, data map[string]string, done chan struct{}) (map[string]string, bool) {
+	ticker := time.NewTicker(resyncPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return data, true
+		case <-ticker.C:
+			data, _ = k.sync(group, data, true)
+		case e, ok := <-w.ResultChan():
+			if !ok {
+				return data, false
+			}
+			if e.Type == watch.Error {
+				continue
+			}
+			name, latest, err := k.store.decode(e.Object)
+			if err != nil || name != group {
+				continue
+			}
+			if e.Type == watch.Deleted {
+				latest = nil
+			}
+			k.apply(group, data, latest)
+			data = latest
+		}
+	}
+}
+
+// sync reads the data of the object, the changes are notified once
+// the data was loaded
+func (k *kubernetesDynamicConfiguration) sync(group string, data map[string]string, loaded bool) (map[string]string, bool) {
+	latest, err := k.store.get(group)
+	if err != nil && err != api.ErrNotFound {
+		logger.Errorf("kubernetes : get config %s fail, error:%v", group, err)
+		return data, loaded
+	}
+	if loaded {
+		k.apply(group, data, latest)
+	}
+	return latest, true
+}
+
+// apply notifies the listeners of the changed entries
+func (k *kubernetesDynamicConfiguration) apply(group string, old, latest map[string]string) {
+	for key, value := range latest {
+		if prev, ok := old[key]; !ok {
+			k.notify(group, &config.ChangeEvent{Key: key, Value: value, ConfigType: config.EventTypeAdd})
+		} else if prev != value {
+			k.notify(group, &config.ChangeEvent{Key: key, Value: value, ConfigType: config.EventTypeUpdate})
+		}
+	}
+	for key := range old {
+		if _, ok := latest[key]; !ok {
+			k.notify(group, &config.ChangeEvent{Key: key, ConfigType: config.EventTypeDel})
+		}
+	}
+}
+
+func (k *kubernetesDynamicConfiguration) notify(group string, event *config.ChangeEvent) {
+	k.Lock()
+	var listeners []config.ConfigurationListener
+	if w, ok := k.watches[group]; ok {
+		for l := range w.listeners[event.Key] {
+			listeners = append(listeners, l)
+		}
+	}
+	k.Unlock()
+
+	for _, l := range listeners {
+		l.Process(event)
+	}
+}
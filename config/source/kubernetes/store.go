@@ -0,0 +1,231 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kubernetes
+
+import (
+	"encoding/json"
+)
+
+import (
+	"xmicro/registry/kubernetes/client"
+	"xmicro/registry/kubernetes/client/api"
+	"xmicro/registry/kubernetes/client/watch"
+)
+
+// store reads and writes the data of the objects holding the config
+type store interface {
+	// get returns the data of the object, ErrNotFound when it is missing
+	get(name string) (map[string]string, error)
+	// put sets the entry of the object, creating it when missing
+	put(name, key, value string) error
+	// remove deletes the entry of the object
+	remove(name, key string) error
+	// watch watches the objects of the namespace
+	watch() (watch.Watch, error)
+	// decode returns the name and the data of a watched object
+	decode(object json.RawMessage) (string, map[string]string, error)
+}
+
+// the times an update conflicting with another writer is tried
+const conflictRetries = 5
+
+type configMapStore struct {
+	client client.Kubernetes
+}
+
+func (s *configMapStore) get(name string) (map[string]string, error) {
+	cm, err := s.client.GetConfigMap(name)
+	if err != nil {
+		return nil, err
+	}
+	return cm.Data, nil
+}
+
+func (s *configMapStore) put(name, key, value string) error {
+	return retryOnConflict(func() error {
+		cm, err := s.client.GetConfigMap(name)
+		if err == api.ErrNotFound {
+			_, err = s.client.CreateConfigMap(&client.ConfigMap{
+				Metadata: &client.Meta{Name: name},
+				Data:     map[string]string{key: value},
+			})
+			return err
+		}
+		if err != nil {
+			return err
+		}
+
+		_, err = s.client.UpdateConfigMap(name, &client.ConfigMap{
+			Metadata: &client.Meta{Name: name, ResourceVersion: resourceVersion(cm.Metadata)},
+			Data:     with(cm.Data, key, &value),
+		})
+		return err
+	})
+}
+
+func (s *configMapStore) remove(name, key string) error {
+	return retryOnConflict(func() error {
+		cm, err := s.client.GetConfigMap(name)
+		if err == api.ErrNotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if _, ok := cm.Data[key]; !ok {
+			return nil
+		}
+
+		_, err = s.client.UpdateConfigMap(name, &client.ConfigMap{
+			Metadata: &client.Meta{Name: name, ResourceVersion: resourceVersion(cm.Metadata)},
+			Data:     with(cm.Data, key, nil),
+		})
+		return err
+	})
+}
+
+func (s *configMapStore) watch() (watch.Watch, error) {
+	return s.client.WatchConfigMaps(nil)
+}
+
+func (s *configMapStore) decode(object json.RawMessage) (string, map[string]string, error) {
+	var cm client.ConfigMap
+	if err := json.Unmarshal(object, &cm); err != nil || cm.Metadata == nil {
+		return "", nil, api.ErrDecode
+	}
+	return cm.Metadata.Name, cm.Data, nil
+}
+
+type secretStore struct {
+	client client.Kubernetes
+}
+
+func (s *secretStore) get(name string) (map[string]string, error) {
+	secret, err := s.client.GetSecret(name)
+	if err != nil {
+		return nil, err
+	}
+	return secretData(secret), nil
+}
+
+func (s *secretStore) put(name, key, value string) error {
+	return retryOnConflict(func() error {
+		secret, err := s.client.GetSecret(name)
+		if err == api.ErrNotFound {
+			_, err = s.client.CreateSecret(&client.Secret{
+				Metadata: &client.Meta{Name: name},
+				Data:     map[string][]byte{key: []byte(value)},
+			})
+			return err
+		}
+		if err != nil {
+			return err
+		}
+
+		_, err = s.client.UpdateSecret(name, &client.Secret{
+			Metadata: &client.Meta{Name: name, ResourceVersion: resourceVersion(secret.Metadata)},
+			Data:     toBytes(with(secretData(secret), key, &value)),
+		})
+		return err
+	})
+}
+
+func (s *secretStore) remove(name, key string) error {
+	return retryOnConflict(func() error {
+		secret, err := s.client.GetSecret(name)
+		if err == api.ErrNotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		data := secretData(secret)
+		if _, ok := data[key]; !ok {
+			return nil
+		}
+
+		_, err = s.client.UpdateSecret(name, &client.Secret{
+			Metadata: &client.Meta{Name: name, ResourceVersion: resourceVersion(secret.Metadata)},
+			Data:     toBytes(with(data, key, nil)),
+		})
+		return err
+	})
+}
+
+func (s *secretStore) watch() (watch.Watch, error) {
+	return s.client.WatchSecrets(nil)
+}
+
+func (s *secretStore) decode(object json.RawMessage) (string, map[string]string, error) {
+	var secret client.Secret
+	if err := json.Unmarshal(object, &secret); err != nil || secret.Metadata == nil {
+		return "", nil, api.ErrDecode
+	}
+	return secret.Metadata.Name, secretData(&secret), nil
+}
+
+func secretData(secret *client.Secret) map[string]string {
+	data := make(map[string]string, len(secret.Data))
+	for k, v := range secret.Data {
+		data[k] = string(v)
+	}
+	return data
+}
+
+func toBytes(data map[string]string) map[string][]byte {
+	out := make(map[string][]byte, len(data))
+	for k, v := range data {
+		out[k] = []byte(v)
+	}
+	return out
+}
+
+// retryOnConflict runs the update again while it conflicts with the change
+// of another writer, reading the object again each time
+func retryOnConflict(update func() error) error {
+	var err error
+	for i := 0; i < conflictRetries; i++ {
+		if err = update(); err != api.ErrConflict {
+			return err
+		}
+	}
+	return err
+}
+
+// resourceVersion returns the version of the object read, the update with it
+// is rejected once the object changed since
+func resourceVersion(meta *client.Meta) string {
+	if meta == nil {
+		return ""
+	}
+	return meta.ResourceVersion
+}
+
+// with copies the data with the entry set, or removed when the value is nil
+func with(data map[string]string, key string, value *string) map[string]string {
+	out := make(map[string]string, len(data)+1)
+	for k, v := range data {
+		out[k] = v
+	}
+	if value == nil {
+		delete(out, key)
+	} else {
+		out[key] = *value
+	}
+	return out
+}
@@ -123,7 +123,7 @@ func ValidateNacosClient(container nacosClientFacade, opts ...option) error {
 		configClient, err := initNacosConfigClient(nacosAddresses, timeout, url)
 		if err != nil {
 			logger.Errorf("initNacosConfigClient(addr:%+v,timeout:%v,url:%v) = err %+v",
-				nacosAddresses, timeout.String(), url, err)
+				nacosAddresses, timeout.String(), url.MaskedString(), err)
 			return perrors.WithMessagef(err, "newNacosClient(address:%+v)", url.Location)
 		}
 		container.NacosClient().SetClient(&configClient)
@@ -152,7 +152,7 @@ func newNacosClient(name string, nacosAddrs []string, timeout time.Duration, url
 	configClient, err := initNacosConfigClient(nacosAddrs, timeout, url)
 	if err != nil {
 		logger.Errorf("initNacosConfigClient(addr:%+v,timeout:%v,url:%v) = err %+v",
-			nacosAddrs, timeout.String(), url, err)
+			nacosAddrs, timeout.String(), url.MaskedString(), err)
 		return n, perrors.WithMessagef(err, "newNacosClient(address:%+v)", url.Location)
 	}
 	n.SetClient(&configClient)
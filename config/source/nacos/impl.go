@@ -89,12 +89,20 @@ func newNacosDynamicConfiguration(url *common.URL) (*nacosDynamicConfiguration,
 
 // AddListener Add listener
 func (n *nacosDynamicConfiguration) AddListener(key string, listener config.ConfigurationListener, opions ...config.Option) {
-	n.addListener(key, listener)
+	tmpOpts := &config.Options{}
+	for _, opt := range opions {
+		opt(tmpOpts)
+	}
+	n.addListener(key, n.resolvedGroup(tmpOpts.Group), listener)
 }
 
 // RemoveListener Remove listener
 func (n *nacosDynamicConfiguration) RemoveListener(key string, listener config.ConfigurationListener, opions ...config.Option) {
-	n.removeListener(key, listener)
+	tmpOpts := &config.Options{}
+	for _, opt := range opions {
+		opt(tmpOpts)
+	}
+	n.removeListener(key, n.resolvedGroup(tmpOpts.Group), listener)
 }
 
 // GetProperties nacos distinguishes configuration files based on group and dataId. defalut group = "micro" and dataId = key
@@ -18,7 +18,7 @@
 package nacos
 
 import (
-	"context"
+	"sync"
 )
 
 import (
@@ -30,35 +30,66 @@ import (
 	"xmicro/logger"
 )
 
-func callback(listener config.ConfigurationListener, _, _, dataId, data string) {
-	listener.Process(&config.ChangeEvent{Key: dataId, Value: data, ConfigType: config.EventTypeUpdate})
+// keyListeners are the listeners of a config, nacos listens to a config once
+// so its changes are fanned out to them
+type keyListeners struct {
+	sync.RWMutex
+	listeners map[config.ConfigurationListener]struct{}
 }
 
-func (n *nacosDynamicConfiguration) addListener(key string, listener config.ConfigurationListener) {
-	_, loaded := n.keyListeners.Load(key)
-	if !loaded {
-		_, cancel := context.WithCancel(context.Background())
-		err := (*n.client.Client()).ListenConfig(vo.ConfigParam{
-			DataId: key,
-			Group:  config.DefaultGroup, //TODO from option
-			OnChange: func(namespace, group, dataId, data string) {
-				go callback(listener, namespace, group, dataId, data)
-			},
-		})
-		if err != nil {
-			logger.Errorf("nacos : listen config fail, error:%v ", err)
-			return
-		}
-		newListener := make(map[config.ConfigurationListener]context.CancelFunc)
-		newListener[listener] = cancel
-		n.keyListeners.Store(key, newListener)
-	} else {
-		// TODO check goroutine alive, but this version of go_nacos_sdk is not support.
-		logger.Infof("profile:%s. this profile is already listening", key)
+func (k *keyListeners) process(dataId, data string) {
+	k.RLock()
+	listeners := make([]config.ConfigurationListener, 0, len(k.listeners))
+	for l := range k.listeners {
+		listeners = append(listeners, l)
+	}
+	k.RUnlock()
+
+	for _, l := range listeners {
+		l.Process(&config.ChangeEvent{Key: dataId, Value: data, ConfigType: config.EventTypeUpdate})
 	}
 }
 
-func (n *nacosDynamicConfiguration) removeListener(key string, listener config.ConfigurationListener) {
-	// TODO: not supported in current go_nacos_sdk version
-	logger.Warn("not supported in current go_nacos_sdk version")
+func (n *nacosDynamicConfiguration) addListener(key, group string, listener config.ConfigurationListener) {
+	kl := &keyListeners{listeners: map[config.ConfigurationListener]struct{}{listener: {}}}
+	v, loaded := n.keyListeners.LoadOrStore(group+"/"+key, kl)
+	if loaded {
+		kl = v.(*keyListeners)
+		kl.Lock()
+		kl.listeners[listener] = struct{}{}
+		kl.Unlock()
+		return
+	}
+
+	err := (*n.client.Client()).ListenConfig(vo.ConfigParam{
+		DataId: key,
+		Group:  group,
+		OnChange: func(namespace, group, dataId, data string) {
+			go kl.process(dataId, data)
+		},
+	})
+	if err != nil {
+		logger.Errorf("nacos : listen config fail, error:%v ", err)
+		n.keyListeners.Delete(group + "/" + key)
+	}
+}
+
+func (n *nacosDynamicConfiguration) removeListener(key, group string, listener config.ConfigurationListener) {
+	v, ok := n.keyListeners.Load(group + "/" + key)
+	if !ok {
+		return
+	}
+	kl := v.(*keyListeners)
+	kl.Lock()
+	delete(kl.listeners, listener)
+	empty := len(kl.listeners) == 0
+	kl.Unlock()
+	if !empty {
+		return
+	}
+
+	n.keyListeners.Delete(group + "/" + key)
+	if err := (*n.client.Client()).CancelListenConfig(vo.ConfigParam{DataId: key, Group: group}); err != nil {
+		logger.Errorf("nacos : cancel listen config fail, error:%v ", err)
+	}
 }
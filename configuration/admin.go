@@ -0,0 +1,104 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package configuration
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"time"
+)
+
+import (
+	perrors "github.com/pkg/errors"
+)
+
+import (
+	"xmicro/config/cache"
+	"xmicro/logger"
+)
+
+// the time the admin endpoint waits for its requests on stop
+const adminShutdownTimeout = 5 * time.Second
+
+// AdminConfig is the configuration of the admin endpoint, which serves the
+// effective dynamic values on /tuning and the configuration on /config
+type AdminConfig struct {
+	// the address the endpoint listens on, such as "127.0.0.1:8091". The
+	// endpoint is not authenticated, it is meant for a loopback address
+	Address string `yaml:"address" json:"address,omitempty" property:"address"`
+}
+
+// configCenterStatus is the state of the config center on /config
+type configCenterStatus struct {
+	Online bool        `json:"online"`
+	Stats  cache.Stats `json:"stats"`
+}
+
+// adminHandler serves the dynamic values of the tuner and the properties of
+// the environment, the decrypted values and the credentials are masked
+func adminHandler(t *Tuner, env *Environment) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/tuning", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, struct {
+			Values  map[string]string `json:"values"`
+			Changes []TuningChange    `json:"changes"`
+		}{t.Values(), t.Changes()})
+	})
+	mux.HandleFunc("/config", func(w http.ResponseWriter, r *http.Request) {
+		out := struct {
+			Properties   map[string]string   `json:"properties"`
+			ConfigCenter *configCenterStatus `json:"configCenter,omitempty"`
+		}{Properties: env.Dump()}
+		if c, ok := env.GetDynamicConfiguration().(cache.Cache); ok {
+			out.ConfigCenter = &configCenterStatus{Online: c.Online(), Stats: c.Stats()}
+		}
+		writeJSON(w, out)
+	})
+	return mux
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logger.Errorf("Admin: write response error %v", err)
+	}
+}
+
+// start serves the admin endpoint until the returned function is called
+func (c *AdminConfig) start(t *Tuner, env *Environment) (func() error, error) {
+	l, err := net.Listen("tcp", c.Address)
+	if err != nil {
+		return nil, perrors.WithMessagef(err, "listen admin endpoint %s", c.Address)
+	}
+
+	srv := &http.Server{Handler: adminHandler(t, env)}
+	go func() {
+		if err := srv.Serve(l); err != nil && err != http.ErrServerClosed {
+			logger.Errorf("Admin: serve %s error %v", l.Addr(), err)
+		}
+	}()
+	logger.Infof("Admin endpoint listening on %s", l.Addr())
+
+	return func() error {
+		ctx, cancel := context.WithTimeout(context.Background(), adminShutdownTimeout)
+		defer cancel()
+		return srv.Shutdown(ctx)
+	}, nil
+}
@@ -14,6 +14,10 @@ type ApplicationConfig struct {
 	Version      string `yaml:"version" json:"version,omitempty" property:"version"`
 	Owner        string `yaml:"owner" json:"owner,omitempty" property:"owner"`
 	Environment  string `yaml:"env" json:"env,omitempty" property:"env"`
+	// the zone the application runs in, routes to nodes of registries in it are preferred
+	Zone string `yaml:"zone" json:"zone,omitempty" property:"zone"`
+	// the registry domain the application registers in and looks services up in
+	Domain string `yaml:"domain" json:"domain,omitempty" property:"domain"`
 	// the metadata type. remote or local
 	MetadataType string `default:"local" yaml:"metadataType" json:"metadataType,omitempty" property:"metadataType"`
 }
@@ -10,6 +10,14 @@ type BaseConfig struct {
 	RegistryConfig     *RegistryConfig     `yaml:"registry" json:"registry,omitempty"`
 	LoggerConfig       *LoggerConfig       `yaml:"logger" json:"logger,omitempty"`
 	TraceConfig        *TraceConfig        `yaml:"trace" json:"trace,omitempty"`
+	TransportConfig    *TransportConfig    `yaml:"transport" json:"transport,omitempty"`
+	TLSConfig          *TLSConfig          `yaml:"tls" json:"tls,omitempty"`
+	EncryptConfig      *EncryptConfig      `yaml:"encrypt" json:"encrypt,omitempty"`
+	AdminConfig        *AdminConfig        `yaml:"admin" json:"admin,omitempty"`
+
+	// registries aggregated with the registry, keyed by name, the registry
+	// takes the name of its protocol
+	Registries map[string]*RegistryConfig `yaml:"registries" json:"registries,omitempty"`
 
 	//wrapper
 	Wrapper string `yaml:"wrapper" json:"wrapper,omitempty" property:"wrapper"`
@@ -0,0 +1,326 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package configuration
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+)
+
+import (
+	"github.com/magiconair/properties"
+	"github.com/mitchellh/mapstructure"
+	perrors "github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+import (
+	"xmicro/config"
+)
+
+// DefaultBindTag is the struct tag the fields are bound by
+const DefaultBindTag = "yaml"
+
+// Validator is implemented by the bound values which check themselves
+type Validator interface {
+	Validate() error
+}
+
+// BindOptions are the options of a binding
+type BindOptions struct {
+	// Tag is the struct tag the fields are bound by
+	Tag string
+	// Validate rejects the invalid values
+	Validate func(interface{}) error
+	// OnChange is called with the old and the new value
+	OnChange func(old, new interface{})
+}
+
+// BindOption sets the options of a binding
+type BindOption func(*BindOptions)
+
+// WithTag binds the fields by the struct tag
+func WithTag(tag string) BindOption {
+	return func(o *BindOptions) {
+		o.Tag = tag
+	}
+}
+
+// WithValidator rejects the values the function returns an error for
+func WithValidator(fn func(interface{}) error) BindOption {
+	return func(o *BindOptions) {
+		o.Validate = fn
+	}
+}
+
+// OnChange calls the function with the old and the new value once an
+// update is applied
+func OnChange(fn func(old, new interface{})) BindOption {
+	return func(o *BindOptions) {
+		o.OnChange = fn
+	}
+}
+
+// Binding keeps a typed value in sync with the keys under a prefix
+type Binding struct {
+	env  *Environment
+	key  string
+	typ  reflect.Type
+	opts BindOptions
+
+	sync.RWMutex
+	value  interface{}
+	closed bool
+}
+
+type bindingUpdate struct {
+	binding *Binding
+	value   interface{}
+}
+
+// Bind decodes the key into the target, a pointer to a struct, map, slice
+// or scalar. The key is either the prefix of dotted keys or holds a yaml,
+// json or properties document. The lists of maps are decoded from the tree
+// of the config file when it was parsed by a TreeParser. The target is
+// filled once, the later values are returned by Value.
+func Bind(key string, target interface{}, opts ...BindOption) (*Binding, error) {
+	return GetEnvInstance().Bind(key, target, opts...)
+}
+
+// Bind decodes the key of the environment into the target
+func (env *Environment) Bind(key string, target interface{}, opts ...BindOption) (*Binding, error) {
+	typ := reflect.TypeOf(target)
+	if typ == nil || typ.Kind() != reflect.Ptr || reflect.ValueOf(target).IsNil() {
+		return nil, perrors.Errorf("bind target of %s must be a non nil pointer", key)
+	}
+
+	options := BindOptions{Tag: DefaultBindTag}
+	for _, o := range opts {
+		o(&options)
+	}
+
+	b := &Binding{
+		env:  env,
+		key:  key,
+		typ:  typ,
+		opts: options,
+	}
+
+	env.mu.Lock()
+	defer env.mu.Unlock()
+
+	u, err := b.decode(env.view())
+	if err != nil {
+		return nil, err
+	}
+	reflect.ValueOf(target).Elem().Set(reflect.ValueOf(u.value).Elem())
+	b.value = u.value
+	env.bindings = append(env.bindings, b)
+
+	return b, nil
+}
+
+// Close stops the updates of the binding
+func (b *Binding) Close() {
+	env := b.env
+	env.mu.Lock()
+	for i, v := range env.bindings {
+		if v == b {
+			env.bindings = append(env.bindings[:i], env.bindings[i+1:]...)
+			break
+		}
+	}
+	env.mu.Unlock()
+
+	b.Lock()
+	b.closed = true
+	b.Unlock()
+}
+
+// Key returns the bound key
+func (b *Binding) Key() string {
+	return b.key
+}
+
+// Value returns the latest value, a pointer of the type of the target.
+// The value must not be modified.
+func (b *Binding) Value() interface{} {
+	b.RLock()
+	defer b.RUnlock()
+	return b.value
+}
+
+// affected reports whether one of the changes is under the key
+func (b *Binding) affected(changes []*config.ChangeEvent) bool {
+	for _, c := range changes {
+		if matchPrefix(b.key, c.Key) {
+			return true
+		}
+	}
+	return false
+}
+
+// decode decodes and validates the value of the key in the view
+func (b *Binding) decode(v view) (*bindingUpdate, error) {
+	var input interface{}
+	if values := v.nodes(b.key); len(values) > 0 || len(b.key) == 0 {
+		input = nest(values)
+	} else if value, ok := v.node(b.key); ok {
+		input = value
+		if s, ok := value.(string); ok {
+			doc, err := parseDocument(s, b.typ.Elem())
+			if err != nil {
+				return nil, perrors.WithMessagef(err, "parse %s", b.key)
+			}
+			input = doc
+		}
+	}
+
+	value := reflect.New(b.typ.Elem())
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		DecodeHook: mapstructure.ComposeDecodeHookFunc(
+			mapstructure.StringToTimeDurationHookFunc(),
+			stringToDocumentHookFunc(),
+		),
+		WeaklyTypedInput: true,
+		Result:           value.Interface(),
+		TagName:          b.opts.Tag,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if input != nil {
+		if err := decoder.Decode(input); err != nil {
+			return nil, perrors.WithMessagef(err, "decode %s", b.key)
+		}
+	}
+
+	if validator, ok := value.Interface().(Validator); ok {
+		if err := validator.Validate(); err != nil {
+			return nil, perrors.WithMessagef(err, "validate %s", b.key)
+		}
+	}
+	if b.opts.Validate != nil {
+		if err := b.opts.Validate(value.Interface()); err != nil {
+			return nil, perrors.WithMessagef(err, "validate %s", b.key)
+		}
+	}
+
+	return &bindingUpdate{binding: b, value: value.Interface()}, nil
+}
+
+// apply sets the value of the binding and calls its change handler
+func (u *bindingUpdate) apply() {
+	b := u.binding
+
+	b.Lock()
+	if b.closed {
+		b.Unlock()
+		return
+	}
+	old := b.value
+	b.value = u.value
+	b.Unlock()
+
+	if b.opts.OnChange != nil {
+		b.opts.OnChange(old, u.value)
+	}
+}
+
+// nest turns the dotted keys into nested maps, a key which is both a value
+// and a prefix is kept as the prefix
+func nest(values map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{})
+	for k, value := range values {
+		parts := strings.Split(k, ".")
+		m := out
+		for _, part := range parts[:len(parts)-1] {
+			next, ok := m[part].(map[string]interface{})
+			if !ok {
+				next = make(map[string]interface{})
+				m[part] = next
+			}
+			m = next
+		}
+		last := parts[len(parts)-1]
+		if _, ok := m[last].(map[string]interface{}); !ok {
+			m[last] = value
+		}
+	}
+	return out
+}
+
+// parseDocument parses the value for a struct, map or slice as a yaml
+// document, which json is a subset of, or as properties
+func parseDocument(value string, typ reflect.Type) (interface{}, error) {
+	if !isComposite(typ) {
+		return value, nil
+	}
+
+	var doc interface{}
+	if err := yaml.Unmarshal([]byte(value), &doc); err == nil {
+		switch doc.(type) {
+		case map[interface{}]interface{}, []interface{}, nil:
+			return doc, nil
+		}
+	}
+
+	p, err := properties.LoadString(value)
+	if err != nil {
+		return nil, err
+	}
+	values := make(map[string]interface{}, p.Len())
+	for k, v := range p.Map() {
+		values[k] = v
+	}
+	return nest(values), nil
+}
+
+// stringToDocumentHookFunc decodes the strings bound to structs, maps and
+// slices, a slice may also be a comma separated list
+func stringToDocumentHookFunc() mapstructure.DecodeHookFuncType {
+	return func(f reflect.Type, t reflect.Type, data interface{}) (interface{}, error) {
+		if f.Kind() != reflect.String || !isComposite(t) {
+			return data, nil
+		}
+		s := strings.TrimSpace(data.(string))
+		if len(s) == 0 {
+			return nil, nil
+		}
+		if t.Kind() == reflect.Slice && !strings.HasPrefix(s, "[") && !strings.HasPrefix(s, "- ") {
+			if t.Elem().Kind() == reflect.Uint8 {
+				return data, nil
+			}
+			values := strings.Split(s, ",")
+			for i := range values {
+				values[i] = strings.TrimSpace(values[i])
+			}
+			return values, nil
+		}
+		return parseDocument(s, t)
+	}
+}
+
+func isComposite(typ reflect.Type) bool {
+	switch typ.Kind() {
+	case reflect.Struct, reflect.Map, reflect.Slice, reflect.Array:
+		return true
+	}
+	return false
+}
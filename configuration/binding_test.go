@@ -0,0 +1,185 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package configuration
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+import (
+	"github.com/stretchr/testify/assert"
+)
+
+import (
+	"xmicro/config"
+	"xmicro/config/parser"
+)
+
+type testPool struct {
+	Size    int           `yaml:"size"`
+	Timeout time.Duration `yaml:"timeout"`
+	Hosts   []string      `yaml:"hosts"`
+}
+
+func (p *testPool) Validate() error {
+	if p.Size < 0 {
+		return errors.New("negative size")
+	}
+	return nil
+}
+
+type testListener struct {
+	events []*config.ChangeEvent
+}
+
+func (l *testListener) Process(e *config.ChangeEvent) {
+	l.events = append(l.events, e)
+}
+
+func newTestEnv() *Environment {
+	return &Environment{configCenterFirst: true}
+}
+
+func TestEnvironmentLayers(t *testing.T) {
+	env := newTestEnv()
+	assert.NoError(t, env.UpdateLocalConfigMap(map[string]string{"a": "local", "b": "local"}))
+	assert.NoError(t, env.ReplaceExternalConfigMap(map[string]string{"a": "center", "c": "center"}))
+	assert.NoError(t, env.ReplaceAppExternalConfigMap(map[string]string{"c": "app"}))
+
+	for k, v := range map[string]string{"a": "center", "b": "local", "c": "app"} {
+		ok, value := env.GetProperty(k)
+		assert.True(t, ok)
+		assert.Equal(t, v, value)
+	}
+
+	// removing the key of the app falls back to the config center
+	assert.NoError(t, env.ReplaceAppExternalConfigMap(nil))
+	_, value := env.GetProperty("c")
+	assert.Equal(t, "center", value)
+}
+
+func TestBind(t *testing.T) {
+	env := newTestEnv()
+	assert.NoError(t, env.UpdateLocalConfigMap(map[string]string{
+		"pool.size":    "2",
+		"pool.timeout": "1s",
+		"pool.hosts":   "a, b",
+	}))
+
+	var changes int
+	pool := &testPool{}
+	b, err := env.Bind("pool", pool, OnChange(func(old, new interface{}) {
+		changes++
+		assert.Equal(t, 2, old.(*testPool).Size)
+		assert.Equal(t, 3, new.(*testPool).Size)
+	}))
+	assert.NoError(t, err)
+	assert.Equal(t, testPool{Size: 2, Timeout: time.Second, Hosts: []string{"a", "b"}}, *pool)
+
+	l := &testListener{}
+	env.AddListener("pool", l)
+
+	// the config center overrides the local file
+	assert.NoError(t, env.ReplaceExternalConfigMap(map[string]string{"pool.size": "3", "other": "x"}))
+	assert.Equal(t, 1, changes)
+	assert.Equal(t, 3, b.Value().(*testPool).Size)
+	assert.Equal(t, time.Second, b.Value().(*testPool).Timeout)
+	assert.Len(t, l.events, 1)
+	assert.Equal(t, "2", l.events[0].OldValue)
+	assert.Equal(t, "3", l.events[0].Value)
+
+	// an invalid update keeps the previous value
+	assert.Error(t, env.ReplaceExternalConfigMap(map[string]string{"pool.size": "-1"}))
+	assert.Equal(t, 3, b.Value().(*testPool).Size)
+	_, value := env.GetProperty("pool.size")
+	assert.Equal(t, "3", value)
+	assert.Len(t, l.events, 1)
+
+	b.Close()
+	assert.NoError(t, env.ReplaceExternalConfigMap(map[string]string{"pool.size": "4"}))
+	assert.Equal(t, 3, b.Value().(*testPool).Size)
+}
+
+func TestBindDocument(t *testing.T) {
+	env := newTestEnv()
+	assert.NoError(t, env.ReplaceExternalConfigMap(map[string]string{
+		"yaml":       "size: 1\nhosts: [a]",
+		"json":       `{"size": 2, "timeout": "2s"}`,
+		"properties": "size=3\nhosts=c,d",
+		"limit":      "10",
+	}))
+
+	for key, want := range map[string]testPool{
+		"yaml":       {Size: 1, Hosts: []string{"a"}},
+		"json":       {Size: 2, Timeout: 2 * time.Second},
+		"properties": {Size: 3, Hosts: []string{"c", "d"}},
+	} {
+		pool := &testPool{}
+		_, err := env.Bind(key, pool)
+		assert.NoError(t, err, key)
+		assert.Equal(t, want, *pool, key)
+	}
+
+	var limit int
+	_, err := env.Bind("limit", &limit, WithValidator(func(v interface{}) error {
+		if *v.(*int) > 100 {
+			return errors.New("limit too high")
+		}
+		return nil
+	}))
+	assert.NoError(t, err)
+	assert.Equal(t, 10, limit)
+	assert.Error(t, env.ReplaceAppExternalConfigMap(map[string]string{"limit": "1000"}))
+	_, value := env.GetProperty("limit")
+	assert.Equal(t, "10", value)
+}
+
+func TestBindTree(t *testing.T) {
+	type routes struct {
+		Routes []map[string]interface{} `yaml:"routes"`
+	}
+
+	content := `{"server": {"routes": [{"path": "/a", "headers": {"x": "1"}}]}}`
+	p := parser.ForFormat(parser.FormatJSON)
+	values, err := p.Parse(content)
+	assert.NoError(t, err)
+	tree, err := p.(parser.TreeParser).ParseTree(content)
+	assert.NoError(t, err)
+
+	env := newTestEnv()
+	assert.NoError(t, env.ReplaceExternalConfig(values, tree))
+
+	// the lists of maps are bound from the tree of the document
+	server := &routes{}
+	b, err := env.Bind("server", server)
+	assert.NoError(t, err)
+	assert.Len(t, server.Routes, 1)
+	assert.Equal(t, "/a", server.Routes[0]["path"])
+	assert.Equal(t, map[string]interface{}{"x": "1"}, server.Routes[0]["headers"])
+
+	var list []map[string]interface{}
+	_, err = env.Bind("server.routes", &list)
+	assert.NoError(t, err)
+	assert.Equal(t, server.Routes, list)
+
+	// a value replaced since the tree was parsed is bound from the value
+	env.UpdateExternalConfigMap(map[string]string{"server.routes": "- path: /b\n"})
+	assert.Equal(t, "/b", b.Value().(*routes).Routes[0]["path"])
+}
@@ -0,0 +1,72 @@
+package configuration
+
+import (
+	"strings"
+)
+
+import (
+	"github.com/creasty/defaults"
+)
+
+import (
+	"xmicro/broker"
+	"xmicro/common/component"
+	"xmicro/common/constant"
+)
+
+// BrokerConfig is the configuration of the async messaging
+type BrokerConfig struct {
+	//option memory/nats/kafka/rabbitmq/redis
+	Protocol string `default:"memory" yaml:"protocol" json:"protocol,omitempty"`
+	// comma separated addresses
+	Address string     `yaml:"address" json:"address,omitempty"`
+	TLS     *TLSConfig `yaml:"tls" json:"tls,omitempty"`
+	// parameters of the implementation, e.g. exchange of rabbitmq
+	Params map[string]string `yaml:"params" json:"params,omitempty"`
+}
+
+// UnmarshalYAML unmarshals the BrokerConfig by @unmarshal function
+func (c *BrokerConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	if err := defaults.Set(c); err != nil {
+		return err
+	}
+	type plain BrokerConfig
+	if err := unmarshal((*plain)(c)); err != nil {
+		return err
+	}
+	return nil
+}
+
+// newBroker builds the broker from the component locator
+func (c *BrokerConfig) newBroker() (broker.Broker, error) {
+	var opts []broker.Option
+	if addrs := splitAddress(c.Address); len(addrs) > 0 {
+		opts = append(opts, broker.Addrs(addrs...))
+	}
+	if c.TLS != nil && c.TLS.Enabled {
+		config, err := c.TLS.toTLS()
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, broker.Secure(true), broker.TLSConfig(config))
+	}
+	if len(c.Params) > 0 {
+		opts = append(opts, broker.Params(c.Params))
+	}
+
+	protocol := c.Protocol
+	if protocol == "" {
+		protocol = constant.MemoryKey
+	}
+	return component.GetBrokerFactory(protocol)(opts...), nil
+}
+
+func splitAddress(address string) []string {
+	var addrs []string
+	for _, addr := range strings.Split(address, ",") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			addrs = append(addrs, addr)
+		}
+	}
+	return addrs
+}
@@ -8,7 +8,10 @@ import (
 )
 
 import (
+	"xmicro/client"
+	"xmicro/common/component"
 	"xmicro/common/constant"
+	"xmicro/config/parser"
 	"xmicro/logger"
 	"xmicro/util/yaml"
 )
@@ -27,8 +30,17 @@ type ClientConfig struct {
 	RequestTimeoutStr string `yaml:"requestTimeout" default:"5s" json:"requestTimeout,omitempty" property:"requestTimeout"`
 	RequestTimeout    time.Duration
 
+	// retries of a failed request
+	Retries int `default:"1" yaml:"retries" json:"retries,omitempty" property:"retries"`
+	// connection pool
+	PoolSize   int    `default:"100" yaml:"poolSize" json:"poolSize,omitempty" property:"poolSize"`
+	PoolTTLStr string `default:"1m" yaml:"poolTTL" json:"poolTTL,omitempty" property:"poolTTL"`
+	PoolTTL    time.Duration
+	//option roundrobin/random
+	Selector string `default:"roundrobin" yaml:"selector" json:"selector,omitempty" property:"selector"`
+
 	//async communicate
-	Producer interface{} `yaml:"producer"`
+	Producer *BrokerConfig `yaml:"producer" json:"producer,omitempty"`
 }
 
 // UnmarshalYAML unmarshals the ClientConfig by @unmarshal function
@@ -59,18 +71,33 @@ func ClientInit(confConFile string) error {
 		return perrors.Errorf("application configure(consumer) file name is nil")
 	}
 	clientConfig = &ClientConfig{}
-	fileStream, err := yaml.UnmarshalYMLConfig(confConFile, clientConfig)
+	o := newOverlay()
+	fileStream, err := o.load(confConFile, clientConfig)
 	if err != nil {
 		return perrors.Errorf("unmarshalYmlConfig error %v", perrors.WithStack(err))
 	}
 	clientConfig.fileStream = bytes.NewBuffer(fileStream)
 
+	// the local values of the environment, below the config center
+	localMap, err := yaml.Flatten(fileStream)
+	if err != nil {
+		return perrors.Errorf("yaml.Flatten(file:%s) = error:%v", confConFile, err)
+	}
+	tree, err := (&parser.YAMLParser{}).ParseTree(string(fileStream))
+	if err != nil {
+		return perrors.WithStack(err)
+	}
+	GetEnvInstance().SetResolver(o.resolver)
+	if err := GetEnvInstance().UpdateLocalConfig(localMap, tree); err != nil {
+		return perrors.WithStack(err)
+	}
+
 	if clientConfig.RequestTimeoutStr != "" {
 		if clientConfig.RequestTimeout, err = time.ParseDuration(clientConfig.RequestTimeoutStr); err != nil {
 			return perrors.WithMessagef(err, "time.ParseDuration(Request_Timeout{%#v})", clientConfig.RequestTimeoutStr)
 		}
 		if clientConfig.RequestTimeout >= time.Duration(MaxWheelTimeSpan) {
-			return perrors.WithMessagef(err, "request_timeout %s should be less than %s",
+			return perrors.Errorf("request_timeout %s should be less than %s",
 				clientConfig.RequestTimeoutStr, time.Duration(MaxWheelTimeSpan))
 		}
 	}
@@ -79,11 +106,45 @@ func ClientInit(confConFile string) error {
 			return perrors.WithMessagef(err, "time.ParseDuration(Connect_Timeout{%#v})", clientConfig.ConnectTimeoutStr)
 		}
 	}
+	if clientConfig.PoolTTLStr != "" {
+		if clientConfig.PoolTTL, err = time.ParseDuration(clientConfig.PoolTTLStr); err != nil {
+			return perrors.WithMessagef(err, "time.ParseDuration(Pool_TTL{%#v})", clientConfig.PoolTTLStr)
+		}
+	}
+	if clientConfig.Retries < 0 || clientConfig.PoolSize < 0 {
+		return perrors.Errorf("retries %d and poolSize %d should not be negative", clientConfig.Retries, clientConfig.PoolSize)
+	}
 
-	logger.Debugf("consumer config{%#v}\n", clientConfig)
+	// the document keeps the encrypted values out of the log
+	logger.Debugf("consumer config{%s}\n", fileStream)
 	return nil
 }
 
+// clientOptions returns the options of the client of the config
+func (c *ClientConfig) clientOptions() []client.Option {
+	opts := []client.Option{
+		client.Retries(c.Retries),
+		client.PoolSize(c.PoolSize),
+	}
+	if c.RequestTimeout > 0 {
+		opts = append(opts, client.RequestTimeout(c.RequestTimeout))
+	}
+	if c.ConnectTimeout > 0 {
+		opts = append(opts, client.DialTimeout(c.ConnectTimeout))
+	}
+	if c.PoolTTL > 0 {
+		opts = append(opts, client.PoolTTL(c.PoolTTL))
+	}
+	if c.Selector != "" {
+		opts = append(opts, client.Selector(component.GetSelectorFactory(c.Selector)()))
+	}
+	//prefer the routes of the local zone
+	if c.ApplicationConfig != nil && c.ApplicationConfig.Zone != "" {
+		opts = append(opts, client.Zone(c.ApplicationConfig.Zone))
+	}
+	return opts
+}
+
 func configCenterRefreshConsumer() error {
 	//fresh it
 	return nil
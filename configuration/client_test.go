@@ -0,0 +1,75 @@
+package configuration
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+import (
+	"github.com/stretchr/testify/assert"
+)
+
+import (
+	"xmicro/client"
+	_ "xmicro/transport/tcp"
+)
+
+const testClientYML = `
+application:
+  name: "test-client"
+  zone: "zone-a"
+transport:
+  protocol: "tcp"
+  timeout: "3s"
+producer:
+  protocol: "memory"
+  params:
+    exchange: "micro"
+connectTimeout: "50ms"
+requestTimeout: "2s"
+retries: 3
+poolSize: 10
+poolTTL: "30s"
+selector: "random"
+`
+
+func TestClientInit(t *testing.T) {
+	dir, err := ioutil.TempDir("", "client")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "client.yml")
+	assert.NoError(t, ioutil.WriteFile(file, []byte(testClientYML), 0644))
+	assert.NoError(t, ClientInit(file))
+
+	c := clientConfig
+	assert.Equal(t, 50*time.Millisecond, c.ConnectTimeout)
+	assert.Equal(t, 30*time.Second, c.PoolTTL)
+	assert.Equal(t, "micro", c.Producer.Params["exchange"])
+
+	tr, err := newTransport(c.BaseConfig)
+	assert.NoError(t, err)
+	assert.Equal(t, "tcp", tr.String())
+	assert.Equal(t, 3*time.Second, tr.Options().Timeout)
+
+	b, err := c.Producer.newBroker()
+	assert.NoError(t, err)
+	assert.Equal(t, "memory", b.String())
+
+	opts := client.NewOptions(c.clientOptions()...)
+	assert.Equal(t, 3, opts.CallOptions.Retries)
+	assert.Equal(t, 2*time.Second, opts.CallOptions.RequestTimeout)
+	assert.Equal(t, 50*time.Millisecond, opts.CallOptions.DialTimeout)
+	assert.Equal(t, 10, opts.PoolSize)
+	assert.Equal(t, 30*time.Second, opts.PoolTTL)
+	assert.Equal(t, "random", opts.Selector.String())
+	assert.Equal(t, "zone-a", opts.Router.Options().Zone)
+
+	// the local file is the lowest layer of the environment
+	ok, value := GetEnvInstance().GetProperty("producer.params.exchange")
+	assert.True(t, ok)
+	assert.Equal(t, "micro", value)
+}
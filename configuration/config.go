@@ -22,6 +22,8 @@ import (
 	"github.com/creasty/defaults"
 	perrors "github.com/pkg/errors"
 	"net/url"
+	"os"
+	"path/filepath"
 	"time"
 )
 
@@ -29,6 +31,9 @@ import (
 	"xmicro/common"
 	"xmicro/common/component"
 	"xmicro/common/constant"
+	"xmicro/config"
+	"xmicro/config/cache"
+	"xmicro/config/parser"
 	"xmicro/logger"
 )
 
@@ -54,6 +59,19 @@ type ConfigCenterConfig struct {
 	AppId         string `default:"micro" yaml:"appId"  json:"appId,omitempty"`
 	TimeoutStr    string `yaml:"timeout"  json:"timeout,omitempty"`
 	timeout       time.Duration
+
+	// format of the config files, yaml/json/toml/properties or a content type,
+	// by the extension of the files if empty
+	ContentType string `yaml:"contentType" json:"contentType,omitempty"`
+	// the params of the source, such as consul-datacenter or kubernetes-config-kind
+	Params map[string]string `yaml:"params" json:"params,omitempty"`
+
+	// the contents are saved to the snapshot file, which is served while the
+	// config center is unreachable. The start fails after the start timeout,
+	// or if a config file failed to load, unless failOpen is set.
+	Snapshot        string `yaml:"snapshot" json:"snapshot,omitempty"`
+	StartTimeoutStr string `default:"5s" yaml:"startTimeout" json:"startTimeout,omitempty"`
+	FailOpen        bool   `default:"true" yaml:"failOpen" json:"failOpen,omitempty"`
 }
 
 // UnmarshalYAML unmarshals the ConfigCenterConfig by @unmarshal function
@@ -76,6 +94,10 @@ func (c *ConfigCenterConfig) GetUrlMap() url.Values {
 	urlMap.Set(constant.ConfigClusterKey, c.Cluster)
 	urlMap.Set(constant.ConfigAppIdKey, c.AppId)
 	urlMap.Set(constant.ConfigLogDirKey, c.LogDir)
+	urlMap.Set(constant.CONFIG_TIMEOUT_KET, c.TimeoutStr)
+	for k, v := range c.Params {
+		urlMap.Set(k, v)
+	}
 	return urlMap
 }
 
@@ -86,8 +108,20 @@ type configCenter struct {
 // After 1.6.0 will not compatible, only baseConfig.ConfigCenterConfig.RemoteRef
 func (b *configCenter) toURL(baseConfig BaseConfig) (*common.URL, error) {
 	if len(baseConfig.ConfigCenterConfig.Address) > 0 {
-		return common.NewURL(baseConfig.ConfigCenterConfig.Address,
-			common.WithProtocol(baseConfig.ConfigCenterConfig.Protocol), common.WithParams(baseConfig.ConfigCenterConfig.GetUrlMap()))
+		opts := []common.UrlOption{
+			common.WithProtocol(baseConfig.ConfigCenterConfig.Protocol), common.WithParams(baseConfig.ConfigCenterConfig.GetUrlMap()),
+		}
+		// the credentials of the address are kept unless configured
+		if len(baseConfig.ConfigCenterConfig.Username) > 0 {
+			opts = append(opts, common.WithUsername(baseConfig.ConfigCenterConfig.Username),
+				common.WithPassword(baseConfig.ConfigCenterConfig.Password))
+		}
+		return common.NewURL(baseConfig.ConfigCenterConfig.Address, opts...)
+	}
+	// the kubernetes source connects in cluster without an address
+	if baseConfig.ConfigCenterConfig.Protocol == constant.KubernetesKey {
+		return common.NewURLWithUrlOptions(common.WithProtocol(constant.KubernetesKey),
+			common.WithParams(baseConfig.ConfigCenterConfig.GetUrlMap())), nil
 	}
 	return nil, perrors.New("baseConfig.ConfigCenterConfig.Address Empty")
 }
@@ -95,57 +129,154 @@ func (b *configCenter) toURL(baseConfig BaseConfig) (*common.URL, error) {
 // startConfigCenter will start the config center.
 // it will prepare the environment
 func (b *configCenter) startConfigCenter(baseConfig BaseConfig) error {
+	if baseConfig.ConfigCenterConfig == nil {
+		return nil
+	}
 	newUrl, err := b.toURL(baseConfig)
 	if err != nil {
 		return err
 	}
 
-	//init config center factory from service locator
-	factory := component.GetConfigCenterFactory(newUrl.Protocol)
-	dynamicConfig, err := factory.GetDynamicConfiguration(newUrl)
+	//init config center factory from service locator, the config center is
+	//served from its snapshot while it is unreachable
+	centerConfig := baseConfig.ConfigCenterConfig
+	opts, err := centerConfig.cacheOptions(baseConfig.ApplicationConfig)
 	if err != nil {
-		logger.Errorf("Get dynamic configuration error , error message is %v", err)
-		return perrors.WithStack(err)
+		return err
+	}
+	factory := component.GetConfigCenterFactory(newUrl.Protocol)
+	dynamicConfig := cache.New(func() (config.DynamicConfiguration, error) {
+		return factory.GetDynamicConfiguration(newUrl)
+	}, opts...)
+	if !dynamicConfig.Online() {
+		if !centerConfig.FailOpen {
+			dynamicConfig.Stop()
+			return perrors.Errorf("config center %s is unreachable", newUrl.Location)
+		}
+		logger.Warnf("Config center %s is unreachable, starting from snapshot", newUrl.Location)
 	}
 
 	GetEnvInstance().SetDynamicConfiguration(dynamicConfig)
+	if dynamicConfig.Parser() == nil {
+		dynamicConfig.SetParser(&parser.DefaultConfigurationParser{})
+	}
 
-	//TODO get from dynamicConfig
-	//content, err := dynamicConfig.GetProperties(baseConfig.ConfigCenterConfig.ConfigFile, config.WithGroup(baseConfig.ConfigCenterConfig.Group))
-	//if err != nil {
-	//	logger.Errorf("Get config content in dynamic configuration error , error message is %v", err)
-	//	return perrors.WithStack(err)
-	//}
-	//
-	//var appGroup string
-	//var appContent string
-	//
-	//TODO whether the application is a provider or a consumer
-	//appGroup = baseConfig.ApplicationConfig.Name
-	//if len(appGroup) != 0 {
-	//	configFile := baseConfig.ConfigCenterConfig.AppConfigFile
-	//	if len(configFile) == 0 {
-	//		configFile = baseConfig.ConfigCenterConfig.ConfigFile
-	//	}
-	//	appContent, err = dynamicConfig.GetProperties(configFile, config.WithGroup(appGroup))
-	//	if err != nil {
-	//		return perrors.WithStack(err)
-	//	}
-	//}
-	//// global config file
-	//mapContent, err := dynamicConfig.Parser().Parse(content)
-	//if err != nil {
-	//	return perrors.WithStack(err)
-	//}
-	//GetEnvInstance().UpdateExternalConfigMap(mapContent)
-	//
-	//// appGroup config file
-	//if len(appContent) != 0 {
-	//	appMapConent, err := dynamicConfig.Parser().Parse(appContent)
-	//	if err != nil {
-	//		return perrors.WithStack(err)
-	//	}
-	//	GetEnvInstance().UpdateAppExternalConfigMap(appMapConent)
-	//}
+	// global config file
+	b.loadConfigFile(dynamicConfig, centerConfig.ConfigFile, centerConfig.Group, centerConfig.ContentType,
+		GetEnvInstance().ReplaceExternalConfig)
+
+	// the config file of the application, above the global one, unless
+	// it is the global one
+	if baseConfig.ApplicationConfig != nil && len(baseConfig.ApplicationConfig.Name) != 0 {
+		configFile := centerConfig.AppConfigFile
+		if len(configFile) == 0 {
+			configFile = centerConfig.ConfigFile
+		}
+		if configFile == centerConfig.ConfigFile && baseConfig.ApplicationConfig.Name == centerConfig.Group {
+			logger.Debugf("Config file %s of group %s is the global one", configFile, centerConfig.Group)
+		} else {
+			b.loadConfigFile(dynamicConfig, configFile, baseConfig.ApplicationConfig.Name, centerConfig.ContentType,
+				GetEnvInstance().ReplaceAppExternalConfig)
+		}
+	}
+
+	if stats := dynamicConfig.Stats(); stats.Stale+stats.Missing > 0 && !centerConfig.FailOpen {
+		dynamicConfig.Stop()
+		return perrors.Errorf("%d config files of config center %s are served from snapshot and %d failed to load",
+			stats.Stale, newUrl.Location, stats.Missing)
+	}
 	return nil
 }
+
+// cacheOptions returns the options of the snapshot cache of the config center,
+// the snapshot is kept in the temp dir by default
+func (c *ConfigCenterConfig) cacheOptions(app *ApplicationConfig) ([]cache.Option, error) {
+	snapshot := c.Snapshot
+	if len(snapshot) == 0 {
+		name := c.Namespace
+		if app != nil && len(app.Name) != 0 {
+			name = app.Name
+		}
+		snapshot = filepath.Join(os.TempDir(), "xmicro", "config", c.Protocol+"-"+name+".json")
+	}
+	opts := []cache.Option{cache.WithSnapshot(snapshot)}
+
+	if len(c.StartTimeoutStr) != 0 {
+		timeout, err := time.ParseDuration(c.StartTimeoutStr)
+		if err != nil {
+			return nil, perrors.WithMessagef(err, "time.ParseDuration(startTimeout{%#v})", c.StartTimeoutStr)
+		}
+		opts = append(opts, cache.WithStartTimeout(timeout))
+	}
+	if len(c.TimeoutStr) != 0 {
+		timeout, err := time.ParseDuration(c.TimeoutStr)
+		if err != nil {
+			return nil, perrors.WithMessagef(err, "time.ParseDuration(timeout{%#v})", c.TimeoutStr)
+		}
+		opts = append(opts, cache.WithTimeout(timeout))
+	}
+	return opts, nil
+}
+
+// loadConfigFile loads the config file of the group into the environment and
+// reloads it once it changes. An unavailable config center is logged, the
+// local configuration is used until the file is published.
+func (b *configCenter) loadConfigFile(dynamicConfig config.DynamicConfiguration, file, group, contentType string,
+	replace func(map[string]string, map[string]interface{}) error) {
+	p := configParser(dynamicConfig, file, contentType)
+	load := func(content string) {
+		mapContent, err := p.Parse(content)
+		if err != nil {
+			logger.Errorf("Parse config file %s of group %s error, error message is %v", file, group, err)
+			return
+		}
+		// the tree of the documents binds the lists of maps
+		var tree map[string]interface{}
+		if tp, ok := p.(parser.TreeParser); ok {
+			if tree, err = tp.ParseTree(content); err != nil {
+				logger.Errorf("Parse config file %s of group %s error, error message is %v", file, group, err)
+				return
+			}
+		}
+		if err := replace(mapContent, tree); err != nil {
+			logger.Errorf("Config file %s of group %s rejected, error message is %v", file, group, err)
+		}
+	}
+
+	content, err := dynamicConfig.GetProperties(file, config.WithGroup(group))
+	if err != nil {
+		logger.Warnf("Get config file %s of group %s in dynamic configuration error, error message is %v", file, group, err)
+	} else {
+		load(content)
+	}
+
+	dynamicConfig.AddListener(file, &configFileListener{load: load}, config.WithGroup(group))
+}
+
+// configParser returns the parser of the content type, else of the extension
+// of the file. The parser of the config center parses the other files.
+func configParser(dynamicConfig config.DynamicConfiguration, file, contentType string) parser.ConfigurationParser {
+	if contentType != "" {
+		return parser.ForFormat(contentType)
+	}
+	if format := parser.Format(file); format != parser.FormatProperties {
+		return parser.ForFormat(format)
+	}
+	return dynamicConfig.Parser()
+}
+
+// configFileListener reloads a config file of the config center
+type configFileListener struct {
+	load func(string)
+}
+
+// Process reloads the content of the changed file
+func (l *configFileListener) Process(event *config.ChangeEvent) {
+	if event.ConfigType == config.EventTypeDel {
+		l.load("")
+		return
+	}
+	if content, ok := event.Value.(string); ok {
+		l.load(content)
+	}
+}
@@ -2,23 +2,21 @@ package configuration
 
 import (
 	"fmt"
-	"xmicro/client"
-	"xmicro/common/component"
-	"xmicro/server"
-
 	"os"
-	"strings"
 	"sync"
 )
 
 import (
+	"xmicro/client"
 	"xmicro/common/constant"
+	"xmicro/config/configurator"
 	"xmicro/logger"
 	"xmicro/logger/core"
 	"xmicro/service"
 	"xmicro/service/rpc"
 	"xmicro/trace/opentracing/jaeger"
-	"xmicro/transport/grpc"
+	// the default transport
+	_ "xmicro/transport/grpc"
 )
 
 var (
@@ -72,7 +70,20 @@ func InitServer(confFiles ...string) service.Service {
 		service.Version(serverConfig.ApplicationConfig.Version),
 		//tcp bind address to, private > public > loopback
 		service.Address(fmt.Sprintf("0.0.0.0:%d", serverConfig.Port)),
-		service.Transport(grpc.NewTransport()),
+	}
+
+	//transport and broker from the component locator
+	transport, err := newTransport(serverConfig.BaseConfig)
+	if err != nil {
+		panic("application configure(server) transport err" + err.Error())
+	}
+	options = append(options, service.Transport(transport))
+	if serverConfig.Consumer != nil {
+		broker, err := serverConfig.Consumer.newBroker()
+		if err != nil {
+			panic("application configure(server) broker err" + err.Error())
+		}
+		options = append(options, service.Broker(broker))
 	}
 
 	//trace init
@@ -96,26 +107,25 @@ func InitServer(confFiles ...string) service.Service {
 	if err != nil {
 		panic("application configure(server) registryBuilder err" + err.Error())
 	}
-	options = append(options, service.Registry(registry))
+	options = append(options, service.Registry(registry), service.AfterStop(registryBuilder.stop))
+
+	//register in the domain of the application
+	if domain := serverConfig.ApplicationConfig.Domain; domain != "" {
+		options = append(options, service.Domain(domain))
+	}
 
 	//start config center
 	if err := serverConfig.startConfigCenter(serverConfig.BaseConfig); err != nil {
 		panic("application configure(server) startConfigCenter err" + err.Error())
 	}
 
-	//wrapper handler load,all request used for
-	if serverConfig.BaseConfig.Wrapper != "" {
-		var handlerWrappers []server.HandlerWrapper
-		wrappers := strings.Split(serverConfig.BaseConfig.Wrapper, ",")
-		for _, v := range wrappers {
-			if h := component.GetServerWrapper(v); h != nil {
-				handlerWrappers = append(handlerWrappers, h)
-			}
-		}
-		if len(handlerWrappers) > 0 {
-			options = append(options, service.WrapHandler(handlerWrappers...))
-		}
+	//log level, rate limits and wrappers follow the environment, all request used for
+	tuner, tunerOptions, err := startTuner(serverConfig.BaseConfig, serverDefaults())
+	if err != nil {
+		panic("application configure(server) tuner err" + err.Error())
 	}
+	options = append(options, tunerOptions...)
+	options = append(options, service.WrapHandler(tuner.WrapHandler))
 
 	return rpc.NewApp(
 		options...,
@@ -158,9 +168,28 @@ func InitClient(confFiles ...string) service.Service {
 	options := []service.Option{
 		service.Name(clientConfig.ApplicationConfig.Name),
 		service.Version(clientConfig.ApplicationConfig.Version),
-		service.Transport(grpc.NewTransport()),
 	}
 
+	//transport and broker from the component locator
+	transport, err := newTransport(clientConfig.BaseConfig)
+	if err != nil {
+		panic("application configure(client) transport err" + err.Error())
+	}
+	options = append(options, service.Transport(transport))
+	if clientConfig.Producer != nil {
+		broker, err := clientConfig.Producer.newBroker()
+		if err != nil {
+			panic("application configure(client) broker err" + err.Error())
+		}
+		options = append(options, service.Broker(broker))
+	}
+
+	//timeouts, retries, pool and selector of the client
+	clientOptions := clientConfig.clientOptions()
+	options = append(options, func(o *service.Options) {
+		o.Client.Init(clientOptions...)
+	})
+
 	//trace init
 	if clientConfig.TraceConfig != nil {
 		closer := jaeger.NewJaegerTrace().Init(
@@ -182,25 +211,38 @@ func InitClient(confFiles ...string) service.Service {
 	if err != nil {
 		panic("application configure(server) registryBuilder err" + err.Error())
 	}
-	options = append(options, service.Registry(registry))
+	options = append(options, service.Registry(registry), service.AfterStop(registryBuilder.stop))
+
+	//lookup services in the domain of the application
+	if domain := clientConfig.ApplicationConfig.Domain; domain != "" {
+		options = append(options, service.Domain(domain))
+	}
 
 	//start config center
 	if err := clientConfig.startConfigCenter(clientConfig.BaseConfig); err != nil {
 		panic("application configure(server) startConfigCenter err" + err.Error())
 	}
 
-	//wrapper handler load,all request used for
-	if clientConfig.BaseConfig.Wrapper != "" {
-		var clientWrappers []client.Wrapper
-		wrappers := strings.Split(clientConfig.BaseConfig.Wrapper, ",")
-		for _, v := range wrappers {
-			if h := component.GetClientWrapper(v); h != nil {
-				clientWrappers = append(clientWrappers, h)
-			}
-		}
-		if len(clientWrappers) > 0 {
-			options = append(options, service.WrapClient(clientWrappers...))
-		}
+	//log level, timeout, retries, selector, rate limits and wrappers follow the environment
+	tuner, tunerOptions, err := startTuner(clientConfig.BaseConfig, clientDefaults(clientConfig))
+	if err != nil {
+		panic("application configure(client) tuner err" + err.Error())
+	}
+	options = append(options, tunerOptions...)
+	options = append(options, service.WrapClient(tuner.WrapClient))
+
+	//configurator rules of the config center applied to the lookup and the calls
+	if dynamicConfig := GetEnvInstance().GetDynamicConfiguration(); dynamicConfig != nil && clientConfig.ConfigCenterConfig != nil {
+		manager := configurator.NewManager(dynamicConfig,
+			configurator.WithGroup(clientConfig.ConfigCenterConfig.Group),
+			configurator.WithApplication(clientConfig.ApplicationConfig.Name),
+		)
+		options = append(options, func(o *service.Options) {
+			o.Client.Init(client.Lookup(manager.Lookup(o.Client.Options().Lookup)), client.WrapCall(manager.CallWrapper))
+		}, service.WrapClient(manager.Wrapper), service.AfterStop(func() error {
+			manager.Close()
+			return nil
+		}))
 	}
 
 	return rpc.NewApp(
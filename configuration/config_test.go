@@ -0,0 +1,148 @@
+package configuration
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+import (
+	"github.com/stretchr/testify/assert"
+)
+
+import (
+	"xmicro/common"
+	"xmicro/common/component"
+	"xmicro/config"
+	"xmicro/config/parser"
+)
+
+type unreachableFactory struct {
+}
+
+func (f *unreachableFactory) GetDynamicConfiguration(*common.URL) (config.DynamicConfiguration, error) {
+	return nil, errors.New("unreachable")
+}
+
+// emptyConfiguration is a config center whose reads fail
+type emptyConfiguration struct {
+	config.DynamicConfiguration
+	parser parser.ConfigurationParser
+}
+
+func (c *emptyConfiguration) Parser() parser.ConfigurationParser     { return c.parser }
+func (c *emptyConfiguration) SetParser(p parser.ConfigurationParser) { c.parser = p }
+func (c *emptyConfiguration) AddListener(string, config.ConfigurationListener, ...config.Option) {
+}
+
+func (c *emptyConfiguration) GetProperties(key string, opts ...config.Option) (string, error) {
+	return "", errors.New("read timeout")
+}
+
+// listenedConfiguration is a config center serving one file and counting
+// the listeners of its files
+type listenedConfiguration struct {
+	emptyConfiguration
+	listeners map[string]int
+}
+
+func (c *listenedConfiguration) AddListener(key string, l config.ConfigurationListener, opts ...config.Option) {
+	options := &config.Options{}
+	for _, o := range opts {
+		o(options)
+	}
+	c.listeners[options.Group+"/"+key]++
+}
+
+func (c *listenedConfiguration) GetProperties(key string, opts ...config.Option) (string, error) {
+	return "pool.size=3", nil
+}
+
+type listenedFactory struct {
+	c *listenedConfiguration
+}
+
+func (f *listenedFactory) GetDynamicConfiguration(*common.URL) (config.DynamicConfiguration, error) {
+	return f.c, nil
+}
+
+type emptyFactory struct {
+}
+
+func (f *emptyFactory) GetDynamicConfiguration(*common.URL) (config.DynamicConfiguration, error) {
+	return &emptyConfiguration{}, nil
+}
+
+func TestStartConfigCenterOffline(t *testing.T) {
+	component.SetConfigCenterFactory("unreachable", &unreachableFactory{})
+
+	snapshot := filepath.Join(t.TempDir(), "snapshot.json")
+	assert.NoError(t, ioutil.WriteFile(snapshot, []byte(`{"micro/micro.properties": "pool.size=3"}`), 0600))
+
+	newBase := func(failOpen bool) BaseConfig {
+		return BaseConfig{ConfigCenterConfig: &ConfigCenterConfig{
+			Protocol:        "unreachable",
+			Address:         "127.0.0.1:8848",
+			Group:           "micro",
+			ConfigFile:      "micro.properties",
+			Snapshot:        snapshot,
+			StartTimeoutStr: "20ms",
+			FailOpen:        failOpen,
+		}}
+	}
+
+	// fail closed
+	NewEnvInstance()
+	assert.Error(t, (&configCenter{}).startConfigCenter(newBase(false)))
+
+	// fail open starts from the snapshot
+	NewEnvInstance()
+	assert.NoError(t, (&configCenter{}).startConfigCenter(newBase(true)))
+	_, value := GetEnvInstance().GetProperty("pool.size")
+	assert.Equal(t, "3", value)
+}
+
+func TestStartConfigCenterWithoutSnapshot(t *testing.T) {
+	component.SetConfigCenterFactory("empty", &emptyFactory{})
+
+	newBase := func(failOpen bool) BaseConfig {
+		return BaseConfig{ConfigCenterConfig: &ConfigCenterConfig{
+			Protocol:   "empty",
+			Address:    "127.0.0.1:8848",
+			Group:      "micro",
+			ConfigFile: "micro.properties",
+			Snapshot:   filepath.Join(t.TempDir(), "snapshot.json"),
+			FailOpen:   failOpen,
+		}}
+	}
+
+	// fail closed rejects the config file which failed to load
+	NewEnvInstance()
+	assert.Error(t, (&configCenter{}).startConfigCenter(newBase(false)))
+
+	// fail open starts without it
+	NewEnvInstance()
+	assert.NoError(t, (&configCenter{}).startConfigCenter(newBase(true)))
+}
+
+func TestStartConfigCenterAppGroup(t *testing.T) {
+	c := &listenedConfiguration{listeners: make(map[string]int)}
+	component.SetConfigCenterFactory("listened", &listenedFactory{c: c})
+
+	// the application named after the group reads the global file once
+	NewEnvInstance()
+	assert.NoError(t, (&configCenter{}).startConfigCenter(BaseConfig{
+		ApplicationConfig: &ApplicationConfig{Name: "micro"},
+		ConfigCenterConfig: &ConfigCenterConfig{
+			Protocol:   "listened",
+			Address:    "127.0.0.1:8848",
+			Group:      "micro",
+			ConfigFile: "micro.properties",
+			Snapshot:   filepath.Join(t.TempDir(), "snapshot.json"),
+		},
+	}))
+	assert.Equal(t, map[string]int{"micro/micro.properties": 1}, c.listeners)
+	_, value := GetEnvInstance().GetProperty("pool.size")
+	assert.Equal(t, "3", value)
+}
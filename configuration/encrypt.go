@@ -0,0 +1,79 @@
+package configuration
+
+import (
+	perrors "github.com/pkg/errors"
+)
+
+import (
+	"xmicro/common/component"
+	"xmicro/common/constant"
+	"xmicro/config/encrypt"
+	"xmicro/util/yaml"
+)
+
+// the section of the encrypt config in the config file
+const encryptKey = "encrypt"
+
+// EncryptConfig selects the key provider of the ENC(...) values: file,
+// env or vault. The key is read from XMICRO_ENC_KEY if none is configured.
+type EncryptConfig struct {
+	Provider string            `yaml:"provider" json:"provider,omitempty"`
+	Params   map[string]string `yaml:"params" json:"params,omitempty"`
+}
+
+// resolver creates the resolver of the key provider
+func (c *EncryptConfig) resolver() (*encrypt.Resolver, error) {
+	provider := constant.EncryptEnvKey
+	var params map[string]string
+	if c != nil && c.Provider != "" {
+		provider = c.Provider
+		params = c.Params
+	}
+	p, err := component.GetKeyProviderFactory(provider)(params)
+	if err != nil {
+		return nil, perrors.WithMessagef(err, "key provider %s", provider)
+	}
+	return encrypt.NewResolver(p), nil
+}
+
+// newResolver creates the resolver of the encrypt section of the document,
+// the section itself is never encrypted
+func newResolver(doc map[interface{}]interface{}) (*encrypt.Resolver, error) {
+	c := &EncryptConfig{}
+	if section, ok := doc[encryptKey]; ok {
+		data, err := yaml.MarshalYML(section)
+		if err != nil {
+			return nil, err
+		}
+		if err := yaml.UnmarshalYML(data, c); err != nil {
+			return nil, perrors.WithMessage(err, "unmarshal encrypt config")
+		}
+	}
+	return c.resolver()
+}
+
+// decrypt replaces the ENC(...) strings of the document by their plain text
+func decrypt(doc interface{}, r *encrypt.Resolver) (interface{}, error) {
+	switch v := doc.(type) {
+	case string:
+		plain, _, err := r.Resolve(v)
+		return plain, err
+	case map[interface{}]interface{}:
+		for k, item := range v {
+			plain, err := decrypt(item, r)
+			if err != nil {
+				return nil, perrors.WithMessagef(err, "decrypt %v", k)
+			}
+			v[k] = plain
+		}
+	case []interface{}:
+		for i, item := range v {
+			plain, err := decrypt(item, r)
+			if err != nil {
+				return nil, err
+			}
+			v[i] = plain
+		}
+	}
+	return doc, nil
+}
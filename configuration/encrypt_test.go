@@ -0,0 +1,115 @@
+package configuration
+
+import (
+	"encoding/base64"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+import (
+	"github.com/stretchr/testify/assert"
+)
+
+import (
+	"xmicro/config/encrypt"
+	"xmicro/util/yaml"
+)
+
+func TestEncryptedConfig(t *testing.T) {
+	key := []byte("0123456789abcdef")
+	password, err := encrypt.Encrypt(key, "s3cret")
+	assert.NoError(t, err)
+	username, err := encrypt.Encrypt(key, "nacos")
+	assert.NoError(t, err)
+
+	file := filepath.Join(t.TempDir(), "app.yml")
+	assert.NoError(t, ioutil.WriteFile(file, []byte(`
+encrypt:
+  provider: "env"
+  params:
+    name: "TEST_CONFIG_KEY"
+registry:
+  protocol: "nacos"
+  address: "127.0.0.1:8848"
+  password: "`+password+`"
+`), 0644))
+
+	// the key provider reads the environment of the process
+	t.Setenv("TEST_CONFIG_KEY", base64.StdEncoding.EncodeToString(key))
+	o := &overlay{environ: []string{"XMICRO_REGISTRY_USERNAME=" + username}}
+	c := &ServerConfig{}
+	data, err := o.load(file, c)
+	assert.NoError(t, err)
+	assert.Equal(t, "s3cret", c.RegistryConfig.Password)
+	assert.Equal(t, "nacos", c.RegistryConfig.Username)
+	assert.NotContains(t, string(data), "s3cret")
+
+	// the environment decrypts the values and masks them in the dump
+	env := newTestEnv()
+	env.SetResolver(o.resolver)
+	localMap, err := yaml.Flatten(data)
+	assert.NoError(t, err)
+	assert.NoError(t, env.UpdateLocalConfigMap(localMap))
+	_, value := env.GetProperty("registry.password")
+	assert.Equal(t, "s3cret", value)
+	assert.Equal(t, encrypt.Mask, env.Dump()["registry.password"])
+	assert.Equal(t, "127.0.0.1:8848", env.Dump()["registry.address"])
+
+	// a plain value of a credential key is masked too
+	assert.NoError(t, env.ReplaceExternalConfigMap(map[string]string{
+		"registry.password":       "open",
+		"registry.username":       "nacos",
+		"metrics.auth.ApiToken":   "abc",
+		"auth.secret-access-keys": "",
+	}))
+	dump := env.Dump()
+	assert.Equal(t, encrypt.Mask, dump["registry.password"])
+	assert.Equal(t, "nacos", dump["registry.username"])
+	assert.Equal(t, encrypt.Mask, dump["metrics.auth.ApiToken"])
+	assert.Equal(t, "", dump["auth.secret-access-keys"])
+	assert.NoError(t, env.ReplaceExternalConfigMap(map[string]string{"registry.password": password}))
+	assert.Equal(t, encrypt.Mask, env.Dump()["registry.password"])
+
+	// a value which can not be decrypted is rejected
+	assert.Error(t, env.ReplaceExternalConfigMap(map[string]string{"registry.password": "ENC(AAAA)"}))
+	_, value = env.GetProperty("registry.password")
+	assert.Equal(t, "s3cret", value)
+}
+
+// blockingProvider returns the key once it is released
+type blockingProvider struct {
+	key     []byte
+	release chan struct{}
+}
+
+func (p *blockingProvider) Key() ([]byte, error) {
+	<-p.release
+	return p.key, nil
+}
+
+func TestResolveUnlocked(t *testing.T) {
+	key := []byte("0123456789abcdef")
+	password, err := encrypt.Encrypt(key, "s3cret")
+	assert.NoError(t, err)
+
+	provider := &blockingProvider{key: key, release: make(chan struct{})}
+	env := newTestEnv()
+	env.SetResolver(encrypt.NewResolver(provider))
+
+	done := make(chan error, 1)
+	go func() {
+		done <- env.ReplaceExternalConfigMap(map[string]string{"registry.password": password})
+	}()
+
+	// the environment is read and bound while the key is read
+	var pool testPool
+	_, err = env.Bind("pool", &pool)
+	assert.NoError(t, err)
+	assert.NotContains(t, env.Dump(), "registry.password")
+
+	close(provider.release)
+	assert.NoError(t, <-done)
+	_, value := env.GetProperty("registry.password")
+	assert.Equal(t, "s3cret", value)
+}
@@ -19,12 +19,19 @@ package configuration
 
 import (
 	"container/list"
+	"reflect"
 	"strings"
 	"sync"
 )
 
+import (
+	"gopkg.in/yaml.v2"
+)
+
 import (
 	"xmicro/config"
+	"xmicro/config/encrypt"
+	"xmicro/logger"
 )
 
 // Environment
@@ -33,12 +40,41 @@ import (
 // But in go, neither the dubbo.properties file or application level config center configuration will not support for the time being.
 // We just have config center configuration which can override configuration in consumer.yaml & provider.yaml.
 // But for add these features in future ,I finish the environment struct following Environment class in java.
+//
+// Values are looked up in the application level config center, then the
+// config center and then the local config file. Updates which a binding
+// rejects are not applied.
 type Environment struct {
 	configCenterFirst    bool
 	externalConfigs      sync.Map
 	externalConfigMap    sync.Map
 	appExternalConfigMap sync.Map
+	// the local config file, below the config center
+	localConfigMap       sync.Map
 	dynamicConfiguration config.DynamicConfiguration
+
+	// serializes the updates in the order they are made, it is held
+	// while the values are resolved
+	updateMu sync.Mutex
+	// guards the config maps, the listeners and the bindings
+	mu        sync.Mutex
+	listeners []*prefixListener
+	bindings  []*Binding
+
+	// decrypts the ENC(...) values, the keys of the decrypted
+	// values of each config map are masked in the dumps
+	resolver *encrypt.Resolver
+	secrets  map[*sync.Map]map[string]bool
+
+	// the parsed documents of the config maps, the lists of maps are
+	// bound from them
+	trees map[*sync.Map]map[string]interface{}
+}
+
+// prefixListener is notified of the changes of the keys under the prefix
+type prefixListener struct {
+	prefix   string
+	listener config.ConfigurationListener
 }
 
 var (
@@ -69,16 +105,58 @@ func NewEnvInstance() {
 
 // UpdateExternalConfigMap updates env externalConfigMap field
 func (env *Environment) UpdateExternalConfigMap(externalMap map[string]string) {
-	for k, v := range externalMap {
-		env.externalConfigMap.Store(k, v)
+	if err := env.update(&env.externalConfigMap, externalMap, nil, false); err != nil {
+		logger.Errorf("[environment] config center update rejected: %v", err)
 	}
 }
 
 // UpdateAppExternalConfigMap updates env appExternalConfigMap field
 func (env *Environment) UpdateAppExternalConfigMap(externalMap map[string]string) {
-	for k, v := range externalMap {
-		env.appExternalConfigMap.Store(k, v)
+	if err := env.update(&env.appExternalConfigMap, externalMap, nil, false); err != nil {
+		logger.Errorf("[environment] application config center update rejected: %v", err)
+	}
+}
+
+// ReplaceExternalConfigMap replaces the config center values, the keys
+// missing in the map are removed
+func (env *Environment) ReplaceExternalConfigMap(externalMap map[string]string) error {
+	return env.update(&env.externalConfigMap, externalMap, nil, true)
+}
+
+// ReplaceExternalConfig replaces the config center values by the values
+// of a config file and its parsed tree
+func (env *Environment) ReplaceExternalConfig(externalMap map[string]string, tree map[string]interface{}) error {
+	return env.update(&env.externalConfigMap, externalMap, tree, true)
+}
+
+// ReplaceAppExternalConfigMap replaces the application level config center values
+func (env *Environment) ReplaceAppExternalConfigMap(externalMap map[string]string) error {
+	return env.update(&env.appExternalConfigMap, externalMap, nil, true)
+}
+
+// ReplaceAppExternalConfig replaces the application level config center
+// values by the values of a config file and its parsed tree
+func (env *Environment) ReplaceAppExternalConfig(externalMap map[string]string, tree map[string]interface{}) error {
+	return env.update(&env.appExternalConfigMap, externalMap, tree, true)
+}
+
+// UpdateLocalConfigMap merges the values of a local config file
+func (env *Environment) UpdateLocalConfigMap(localMap map[string]string) error {
+	return env.update(&env.localConfigMap, localMap, nil, false)
+}
+
+// UpdateLocalConfig merges the values of a local config file and its
+// parsed tree
+func (env *Environment) UpdateLocalConfig(localMap map[string]string, tree map[string]interface{}) error {
+	return env.update(&env.localConfigMap, localMap, tree, false)
+}
+
+// stores returns the config maps in the order the values are looked up
+func (env *Environment) stores() []*sync.Map {
+	if env.configCenterFirst {
+		return []*sync.Map{&env.appExternalConfigMap, &env.externalConfigMap, &env.localConfigMap}
 	}
+	return []*sync.Map{&env.localConfigMap, &env.appExternalConfigMap, &env.externalConfigMap}
 }
 
 // Configuration puts externalConfigMap and appExternalConfigMap into list
@@ -86,8 +164,9 @@ func (env *Environment) UpdateAppExternalConfigMap(externalMap map[string]string
 func (env *Environment) Configuration() *list.List {
 	cfgList := list.New()
 	// The sequence would be: SystemConfiguration -> ExternalConfiguration -> AppExternalConfiguration -> AbstractConfig -> PropertiesConfiguration
-	cfgList.PushFront(newInmemoryConfiguration(&(env.externalConfigMap)))
-	cfgList.PushFront(newInmemoryConfiguration(&(env.appExternalConfigMap)))
+	for _, store := range env.stores() {
+		cfgList.PushBack(newInmemoryConfiguration(store))
+	}
 	return cfgList
 }
 
@@ -101,6 +180,388 @@ func (env *Environment) GetDynamicConfiguration() config.DynamicConfiguration {
 	return env.dynamicConfiguration
 }
 
+// SetResolver sets the resolver of the encrypted values of the updates
+func (env *Environment) SetResolver(r *encrypt.Resolver) {
+	env.mu.Lock()
+	env.resolver = r
+	env.mu.Unlock()
+}
+
+// the words of the keys whose values are masked in the dumps even when
+// they are not encrypted
+var credentialWords = []string{"password", "passwd", "secret", "token", "credential", "accesskey", "access-key", "privatekey", "private-key"}
+
+// isCredential reports whether the last part of the key names a credential
+func isCredential(key string) bool {
+	name := strings.ToLower(key[strings.LastIndex(key, ".")+1:])
+	for _, w := range credentialWords {
+		if strings.Contains(name, w) {
+			return true
+		}
+	}
+	return false
+}
+
+// Dump returns the values of the environment with the decrypted values
+// and the values of the credential keys masked
+func (env *Environment) Dump() map[string]string {
+	env.mu.Lock()
+	defer env.mu.Unlock()
+
+	out := make(map[string]string)
+	stores := env.stores()
+	for i := len(stores) - 1; i >= 0; i-- {
+		secrets := env.secrets[stores[i]]
+		for k, v := range copyStore(stores[i]) {
+			if secrets[k] || (v != "" && isCredential(k)) {
+				v = encrypt.Mask
+			}
+			out[k] = v
+		}
+	}
+	return out
+}
+
+// GetProperty looks the key up in the layers of the environment
+func (env *Environment) GetProperty(key string) (bool, string) {
+	for _, store := range env.stores() {
+		if v, ok := store.Load(key); ok {
+			return true, v.(string)
+		}
+	}
+	return false, ""
+}
+
+// GetProperties returns the values of the keys under the prefix, keyed
+// by the rest of the key
+func (env *Environment) GetProperties(prefix string) map[string]string {
+	return env.view().sub(prefix)
+}
+
+// AddListener notifies the listener of the changed values of the keys under
+// the prefix, an empty prefix being all keys. The events hold the old value.
+func (env *Environment) AddListener(prefix string, listener config.ConfigurationListener) {
+	env.mu.Lock()
+	env.listeners = append(env.listeners, &prefixListener{prefix: prefix, listener: listener})
+	env.mu.Unlock()
+}
+
+// RemoveListener removes the listener of the prefix
+func (env *Environment) RemoveListener(prefix string, listener config.ConfigurationListener) {
+	env.mu.Lock()
+	defer env.mu.Unlock()
+
+	for i, l := range env.listeners {
+		if l.prefix == prefix && l.listener == listener {
+			env.listeners = append(env.listeners[:i], env.listeners[i+1:]...)
+			return
+		}
+	}
+}
+
+// view copies the layers of the environment in lookup order
+func (env *Environment) view() view {
+	stores := env.stores()
+	v := make(view, len(stores))
+	for i, store := range stores {
+		v[i] = layer{values: copyStore(store), tree: env.trees[store]}
+	}
+	return v
+}
+
+func copyStore(store *sync.Map) map[string]string {
+	m := make(map[string]string)
+	store.Range(func(k, v interface{}) bool {
+		m[k.(string)] = v.(string)
+		return true
+	})
+	return m
+}
+
+// update applies the values and the tree they were parsed from, if any, to
+// the store. The bindings of the changed keys are decoded first, if one of
+// them fails nothing is applied.
+func (env *Environment) update(store *sync.Map, values map[string]string, tree map[string]interface{}, replace bool) error {
+	// the updates are applied in order, the bindings and the listeners
+	// are called after so they may update the environment
+	env.updateMu.Lock()
+	updates, changes, listeners, err := env.apply(store, values, tree, replace)
+	env.updateMu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	for _, u := range updates {
+		u.apply()
+	}
+
+	for _, e := range changes {
+		for _, l := range listeners {
+			if matchPrefix(l.prefix, e.Key) {
+				l.listener.Process(e)
+			}
+		}
+	}
+
+	return nil
+}
+
+// apply resolves the values and applies them to the store, it returns the
+// updates of the bindings and the changes for the listeners
+func (env *Environment) apply(store *sync.Map, values map[string]string, tree map[string]interface{},
+	replace bool) ([]*bindingUpdate, []*config.ChangeEvent, []*prefixListener, error) {
+	// the values are resolved before the lock, the resolver may call a
+	// secret store
+	env.mu.Lock()
+	resolver := env.resolver
+	env.mu.Unlock()
+
+	values, decrypted, err := resolver.ResolveMap(values)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	env.mu.Lock()
+	defer env.mu.Unlock()
+
+	prev := env.view()
+
+	// the view with the values applied to the layer of the store
+	next := make(view, len(prev))
+	copy(next, prev)
+	i := env.index(store)
+	next[i] = layer{values: make(map[string]string), tree: tree}
+	secrets := make(map[string]bool)
+	if !replace {
+		next[i] = layer{values: copyStore(store), tree: mergeTree(prev[i].tree, tree)}
+		for k := range env.secrets[store] {
+			secrets[k] = true
+		}
+	}
+	for k, v := range values {
+		next[i].values[k] = v
+		if decrypted[k] {
+			secrets[k] = true
+		} else {
+			delete(secrets, k)
+		}
+	}
+	changes := prev.diff(next)
+
+	// decode the bindings before anything is applied
+	var updates []*bindingUpdate
+	for _, b := range env.bindings {
+		if !b.affected(changes) {
+			continue
+		}
+		u, err := b.decode(next)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		updates = append(updates, u)
+	}
+
+	store.Range(func(k, _ interface{}) bool {
+		if _, ok := next[i].values[k.(string)]; !ok {
+			store.Delete(k)
+		}
+		return true
+	})
+	for k, v := range next[i].values {
+		store.Store(k, v)
+	}
+	env.setSecrets(store, secrets)
+	env.setTree(store, next[i].tree)
+
+	listeners := make([]*prefixListener, len(env.listeners))
+	copy(listeners, env.listeners)
+
+	return updates, changes, listeners, nil
+}
+
+func (env *Environment) setSecrets(store *sync.Map, secrets map[string]bool) {
+	if env.secrets == nil {
+		env.secrets = make(map[*sync.Map]map[string]bool)
+	}
+	env.secrets[store] = secrets
+}
+
+func (env *Environment) setTree(store *sync.Map, tree map[string]interface{}) {
+	if env.trees == nil {
+		env.trees = make(map[*sync.Map]map[string]interface{})
+	}
+	env.trees[store] = tree
+}
+
+// index returns the position of the store in the lookup order
+func (env *Environment) index(store *sync.Map) int {
+	for i, s := range env.stores() {
+		if s == store {
+			return i
+		}
+	}
+	return -1
+}
+
+// mergeTree merges the maps of the tree into a copy of the base tree
+func mergeTree(base, tree map[string]interface{}) map[string]interface{} {
+	if base == nil {
+		return tree
+	}
+	out := make(map[string]interface{}, len(base)+len(tree))
+	for k, v := range base {
+		out[k] = v
+	}
+	for k, v := range tree {
+		b, ok := out[k].(map[string]interface{})
+		m, isMap := v.(map[string]interface{})
+		if ok && isMap {
+			v = mergeTree(b, m)
+		}
+		out[k] = v
+	}
+	return out
+}
+
+// view is the layers of the environment in lookup order
+type view []layer
+
+// layer is the values of a config map and the tree they were parsed from
+type layer struct {
+	values map[string]string
+	tree   map[string]interface{}
+}
+
+func (v view) get(key string) (string, bool) {
+	for _, l := range v {
+		if value, ok := l.values[key]; ok {
+			return value, true
+		}
+	}
+	return "", false
+}
+
+// sub returns the values of the keys under the prefix by the rest of the key
+func (v view) sub(prefix string) map[string]string {
+	values := make(map[string]string)
+	for i := len(v) - 1; i >= 0; i-- {
+		for k, value := range v[i].values {
+			if len(prefix) == 0 {
+				values[k] = value
+			} else if strings.HasPrefix(k, prefix+".") {
+				values[k[len(prefix)+1:]] = value
+			}
+		}
+	}
+	return values
+}
+
+// node returns the value of the key, the list of its layer's tree if the
+// value is a list of maps kept as a yaml document
+func (v view) node(key string) (interface{}, bool) {
+	for _, l := range v {
+		if value, ok := l.values[key]; ok {
+			return l.node(key, value), true
+		}
+	}
+	return nil, false
+}
+
+// nodes returns the values of the keys under the prefix by the rest of
+// the key, the lists of maps taken from the trees
+func (v view) nodes(prefix string) map[string]interface{} {
+	values := make(map[string]interface{})
+	for i := len(v) - 1; i >= 0; i-- {
+		for k, value := range v[i].values {
+			if len(prefix) == 0 {
+				values[k] = v[i].node(k, value)
+			} else if strings.HasPrefix(k, prefix+".") {
+				values[k[len(prefix)+1:]] = v[i].node(k, value)
+			}
+		}
+	}
+	return values
+}
+
+// node returns the list of the tree at the key if the value was flattened
+// from it, else the value
+func (l layer) node(key, value string) interface{} {
+	list, ok := treeNode(l.tree, strings.Split(key, ".")).([]interface{})
+	if !ok {
+		return value
+	}
+	// the value was replaced since the tree was parsed
+	var flat interface{}
+	if err := yaml.Unmarshal([]byte(value), &flat); err != nil {
+		return value
+	}
+	if doc, err := yaml.Marshal(list); err != nil || !sameDocument(doc, flat) {
+		return value
+	}
+	return list
+}
+
+// sameDocument reports whether the yaml document decodes to the value
+func sameDocument(doc []byte, value interface{}) bool {
+	var other interface{}
+	if err := yaml.Unmarshal(doc, &other); err != nil {
+		return false
+	}
+	return reflect.DeepEqual(other, value)
+}
+
+// treeNode returns the node of the tree at the parts of a dotted key, the
+// keys of the tree may hold dots
+func treeNode(tree map[string]interface{}, parts []string) interface{} {
+	for i := len(parts); i > 0; i-- {
+		node, ok := tree[strings.Join(parts[:i], ".")]
+		if !ok {
+			continue
+		}
+		if i == len(parts) {
+			return node
+		}
+		if m, ok := node.(map[string]interface{}); ok {
+			if found := treeNode(m, parts[i:]); found != nil {
+				return found
+			}
+		}
+	}
+	return nil
+}
+
+// diff returns the events of the keys whose value changed
+func (v view) diff(next view) []*config.ChangeEvent {
+	keys := make(map[string]bool)
+	for _, layers := range []view{v, next} {
+		for _, l := range layers {
+			for k := range l.values {
+				keys[k] = true
+			}
+		}
+	}
+
+	var events []*config.ChangeEvent
+	for k := range keys {
+		old, hadOld := v.get(k)
+		cur, hasCur := next.get(k)
+		switch {
+		case !hadOld && hasCur:
+			events = append(events, &config.ChangeEvent{Key: k, Value: cur, ConfigType: config.EventTypeAdd})
+		case hadOld && !hasCur:
+			events = append(events, &config.ChangeEvent{Key: k, OldValue: old, ConfigType: config.EventTypeDel})
+		case old != cur:
+			events = append(events, &config.ChangeEvent{Key: k, Value: cur, OldValue: old, ConfigType: config.EventTypeUpdate})
+		}
+	}
+	return events
+}
+
+// matchPrefix reports whether the key is the prefix or under it
+func matchPrefix(prefix, key string) bool {
+	return len(prefix) == 0 || key == prefix || strings.HasPrefix(key, prefix+".")
+}
+
 // InmemoryConfiguration stores config in memory
 type InmemoryConfiguration struct {
 	store *sync.Map
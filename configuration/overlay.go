@@ -0,0 +1,349 @@
+package configuration
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+import (
+	perrors "github.com/pkg/errors"
+)
+
+import (
+	"xmicro/common/constant"
+	"xmicro/config/encrypt"
+	"xmicro/logger"
+	"xmicro/util/yaml"
+)
+
+// ${VAR} or ${VAR:default}
+var placeholder = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_.]*)(?::([^}]*))?\}`)
+
+// the key of the profile of the config file
+const profileKey = "application.env"
+
+// overlay loads a config file with its overrides. The values are, from
+// lowest to highest:
+//   - the config file, e.g. app.yml
+//   - the profile file of application.env, e.g. app-prod.yml
+//   - the environment, XMICRO_REGISTRY_ADDRESS for registry.address
+//   - the flags of the command line, --registry.address=127.0.0.1:8848
+//
+// ${VAR} and ${VAR:default} are replaced by the environment in the values,
+// and the ENC(...) values are decrypted once the overrides are applied.
+type overlay struct {
+	// the environment and the arguments, os.Environ and os.Args[1:] by default
+	environ []string
+	args    []string
+
+	// the resolver of the encrypted values, set by load
+	resolver *encrypt.Resolver
+}
+
+func newOverlay() *overlay {
+	return &overlay{environ: os.Environ(), args: os.Args[1:]}
+}
+
+// load loads the config file into out and returns the merged document,
+// which keeps the encrypted values
+func (o *overlay) load(file string, out interface{}) ([]byte, error) {
+	doc, err := o.read(file)
+	if err != nil {
+		return nil, err
+	}
+
+	paths := keyPaths(reflect.TypeOf(out), "")
+	env := o.envMap()
+	flags := o.flagMap()
+
+	// the profile may itself be overridden
+	profile, _ := lookup(doc, profileKey)
+	if v, ok := env[envName(profileKey)]; ok {
+		profile = v
+	}
+	if v, ok := flags[profileKey]; ok {
+		profile = v
+	}
+	if profile != "" {
+		ext := filepath.Ext(file)
+		profileFile := strings.TrimSuffix(file, ext) + "-" + profile + ext
+		if _, err := os.Stat(profileFile); err == nil {
+			profileDoc, err := o.read(profileFile)
+			if err != nil {
+				return nil, err
+			}
+			merge(doc, profileDoc)
+		} else {
+			logger.Debugf("no profile file %s", profileFile)
+		}
+	}
+
+	for _, path := range leafPaths(doc, "") {
+		paths[path] = true
+	}
+	for path := range paths {
+		if v, ok := env[envName(path)]; ok {
+			set(doc, path, scalar(v))
+		}
+	}
+	for path, v := range flags {
+		if paths[path] {
+			set(doc, path, scalar(v))
+		}
+	}
+
+	data, err := yaml.MarshalYML(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	if o.resolver, err = newResolver(doc); err != nil {
+		return nil, err
+	}
+	if _, err := decrypt(doc, o.resolver); err != nil {
+		return nil, perrors.WithMessagef(err, "decrypt %s", file)
+	}
+	plain, err := yaml.MarshalYML(doc)
+	if err != nil {
+		return nil, err
+	}
+	return data, yaml.UnmarshalYML(plain, out)
+}
+
+// read reads the file with the placeholders replaced
+func (o *overlay) read(file string) (map[interface{}]interface{}, error) {
+	data, err := yaml.LoadYMLConfig(file)
+	if err != nil {
+		return nil, perrors.Errorf("ioutil.ReadFile(file:%s) = error:%v", file, perrors.WithStack(err))
+	}
+
+	doc := make(map[interface{}]interface{})
+	if err := yaml.UnmarshalYML(data, &doc); err != nil {
+		return nil, perrors.WithMessagef(err, "unmarshal %s", file)
+	}
+	interpolate(doc, o.envMap())
+	return doc, nil
+}
+
+// interpolate replaces ${VAR} by the environment variable, or the default,
+// in the strings of the document. A string which is a single placeholder
+// is decoded as a scalar so numbers and booleans keep their type.
+func interpolate(doc interface{}, env map[string]string) interface{} {
+	switch v := doc.(type) {
+	case string:
+		if !placeholder.MatchString(v) {
+			return v
+		}
+		out := placeholder.ReplaceAllStringFunc(v, func(m string) string {
+			sub := placeholder.FindStringSubmatch(m)
+			if value, ok := env[sub[1]]; ok {
+				return value
+			}
+			if !strings.Contains(m, ":") {
+				logger.Warnf("config placeholder %s is not set", sub[1])
+			}
+			return sub[2]
+		})
+		if placeholder.FindString(v) == v {
+			return scalar(out)
+		}
+		return out
+	case map[interface{}]interface{}:
+		for k, item := range v {
+			v[k] = interpolate(item, env)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = interpolate(item, env)
+		}
+	}
+	return doc
+}
+
+func (o *overlay) envMap() map[string]string {
+	env := make(map[string]string, len(o.environ))
+	for _, kv := range o.environ {
+		if i := strings.Index(kv, "="); i > 0 {
+			env[kv[:i]] = kv[i+1:]
+		}
+	}
+	return env
+}
+
+// flagMap returns the --key=value and -key=value arguments
+func (o *overlay) flagMap() map[string]string {
+	flags := make(map[string]string)
+	for _, arg := range o.args {
+		if !strings.HasPrefix(arg, "-") {
+			continue
+		}
+		arg = strings.TrimLeft(arg, "-")
+		if i := strings.Index(arg, "="); i > 0 {
+			flags[arg[:i]] = arg[i+1:]
+		}
+	}
+	return flags
+}
+
+// envName returns the environment variable of the key, XMICRO_CONFIG_CENTER_ADDRESS
+// for configCenter.address
+func envName(path string) string {
+	var b strings.Builder
+	b.WriteString(constant.ConfEnvPrefix)
+	prev := rune(0)
+	for _, r := range path {
+		switch {
+		case r == '.' || r == '-':
+			b.WriteByte('_')
+		case unicode.IsUpper(r) && unicode.IsLower(prev):
+			b.WriteByte('_')
+			b.WriteRune(r)
+		default:
+			b.WriteRune(unicode.ToUpper(r))
+		}
+		prev = r
+	}
+	return b.String()
+}
+
+// keyPaths returns the dotted yaml paths of the fields of the type
+func keyPaths(typ reflect.Type, prefix string) map[string]bool {
+	paths := make(map[string]bool)
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	if typ.Kind() != reflect.Struct {
+		return paths
+	}
+
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		tag, ok := field.Tag.Lookup("yaml")
+		if !ok || field.PkgPath != "" {
+			continue
+		}
+		parts := strings.Split(tag, ",")
+		name := parts[0]
+		if name == "-" {
+			continue
+		}
+
+		ft := field.Type
+		for ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if len(parts) > 1 && parts[1] == "inline" {
+			for p := range keyPaths(ft, prefix) {
+				paths[p] = true
+			}
+			continue
+		}
+
+		path := name
+		if prefix != "" {
+			path = prefix + "." + name
+		}
+		if ft.Kind() == reflect.Struct {
+			for p := range keyPaths(ft, path) {
+				paths[p] = true
+			}
+			continue
+		}
+		paths[path] = true
+	}
+	return paths
+}
+
+// leafPaths returns the dotted paths of the scalars of the document
+func leafPaths(doc map[interface{}]interface{}, prefix string) []string {
+	var paths []string
+	for k, v := range doc {
+		path, ok := k.(string)
+		if !ok {
+			continue
+		}
+		if prefix != "" {
+			path = prefix + "." + path
+		}
+		switch m := v.(type) {
+		case map[interface{}]interface{}:
+			paths = append(paths, leafPaths(m, path)...)
+		case []interface{}:
+		default:
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+// lookup returns the scalar of the path
+func lookup(doc map[interface{}]interface{}, path string) (string, bool) {
+	parts := strings.Split(path, ".")
+	for i, part := range parts {
+		v, ok := doc[part]
+		if !ok {
+			return "", false
+		}
+		if i == len(parts)-1 {
+			if v == nil {
+				return "", true
+			}
+			s, ok := v.(string)
+			return s, ok
+		}
+		if doc, ok = v.(map[interface{}]interface{}); !ok {
+			return "", false
+		}
+	}
+	return "", false
+}
+
+// set sets the value of the path, creating the missing maps
+func set(doc map[interface{}]interface{}, path string, value interface{}) {
+	parts := strings.Split(path, ".")
+	for _, part := range parts[:len(parts)-1] {
+		next, ok := doc[part].(map[interface{}]interface{})
+		if !ok {
+			next = make(map[interface{}]interface{})
+			doc[part] = next
+		}
+		doc = next
+	}
+	doc[parts[len(parts)-1]] = value
+}
+
+// merge merges the maps of src into dst, the other values of src replace those of dst
+func merge(dst, src map[interface{}]interface{}) {
+	for k, v := range src {
+		if sm, ok := v.(map[interface{}]interface{}); ok {
+			if dm, ok := dst[k].(map[interface{}]interface{}); ok {
+				merge(dm, sm)
+				continue
+			}
+		}
+		dst[k] = v
+	}
+}
+
+// scalar decodes the value of the environment or a flag as a yaml scalar,
+// so numbers and booleans keep their type. Values which would not be kept
+// as written, like yes or 0644, stay strings.
+func scalar(v string) interface{} {
+	var out interface{}
+	if err := yaml.UnmarshalYML([]byte(v), &out); err != nil {
+		return v
+	}
+	switch out.(type) {
+	case map[interface{}]interface{}, []interface{}, nil:
+		return v
+	}
+	if fmt.Sprint(out) != v {
+		return v
+	}
+	return out
+}
@@ -0,0 +1,92 @@
+package configuration
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+import (
+	"github.com/stretchr/testify/assert"
+)
+
+const testServerYML = `
+port: 8090
+application:
+  name: "${APP_NAME:demo}"
+  env: "dev"
+registry:
+  protocol: "nacos"
+  address: "127.0.0.1:8848"
+  password: "${REGISTRY_PASSWORD}"
+`
+
+const testProfileYML = `
+registry:
+  address: "nacos.prod:8848"
+`
+
+func TestOverlay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "overlay")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "app.yml")
+	assert.NoError(t, ioutil.WriteFile(file, []byte(testServerYML), 0644))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "app-prod.yml"), []byte(testProfileYML), 0644))
+
+	// the file with the placeholders replaced
+	c := &ServerConfig{}
+	_, err = (&overlay{}).load(file, c)
+	assert.NoError(t, err)
+	assert.Equal(t, "demo", c.ApplicationConfig.Name)
+	assert.Equal(t, "", c.RegistryConfig.Password)
+	assert.Equal(t, "127.0.0.1:8848", c.RegistryConfig.Address)
+
+	// the profile of the environment, then the environment and the flags
+	o := &overlay{
+		environ: []string{
+			"APP_NAME=orders",
+			"REGISTRY_PASSWORD=yes",
+			"XMICRO_APPLICATION_ENV=prod",
+			"XMICRO_PORT=9000",
+			"XMICRO_REGISTRY_USERNAME=nacos",
+		},
+		args: []string{"--registry.protocol=consul", "-port=9100", "--unknown=1", "run"},
+	}
+	c = &ServerConfig{}
+	data, err := o.load(file, c)
+	assert.NoError(t, err)
+	assert.Equal(t, "orders", c.ApplicationConfig.Name)
+	assert.Equal(t, "prod", c.ApplicationConfig.Environment)
+	assert.Equal(t, "yes", c.RegistryConfig.Password)
+	assert.Equal(t, "nacos.prod:8848", c.RegistryConfig.Address)
+	assert.Equal(t, "nacos", c.RegistryConfig.Username)
+	assert.Equal(t, "consul", c.RegistryConfig.Protocol)
+	assert.Equal(t, 9100, c.Port)
+	assert.NotContains(t, string(data), "unknown")
+}
+
+func TestEnvName(t *testing.T) {
+	assert.Equal(t, "XMICRO_REGISTRY_ADDRESS", envName("registry.address"))
+	assert.Equal(t, "XMICRO_CONFIG_CENTER_APP_CONFIG_FILE", envName("configCenter.appConfigFile"))
+	assert.Equal(t, "XMICRO_REGISTRIES_NACOS_NEW_ZONE", envName("registries.nacos-new.zone"))
+}
+
+func TestInterpolate(t *testing.T) {
+	doc := map[interface{}]interface{}{
+		"port":     "${PORT:8080}",
+		"password": "${PASSWORD}",
+		"address":  "${HOST:localhost}:${PORT}",
+		"tags":     []interface{}{"${ZONE:a}", 1},
+	}
+	interpolate(doc, map[string]string{
+		"PORT":     "9000",
+		"PASSWORD": "p\"a: #s\nword",
+	})
+	assert.Equal(t, 9000, doc["port"])
+	assert.Equal(t, "p\"a: #s\nword", doc["password"])
+	assert.Equal(t, "localhost:9000", doc["address"])
+	assert.Equal(t, []interface{}{"a", 1}, doc["tags"])
+}
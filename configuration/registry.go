@@ -21,8 +21,12 @@ import (
 	perrors "github.com/pkg/errors"
 
 	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 )
 
 import (
@@ -35,6 +39,8 @@ import (
 	"xmicro/common/constant"
 	"xmicro/logger"
 	mregistry "xmicro/registry"
+	"xmicro/registry/cache"
+	"xmicro/registry/multi"
 )
 
 // RegistryConfig is the configuration of the registry center
@@ -55,6 +61,19 @@ type RegistryConfig struct {
 	Zone string `yaml:"zone" json:"zone,omitempty" property:"zone"`
 	// Affects traffic distribution among registries,
 	Params map[string]string `yaml:"params" json:"params,omitempty" property:"params"`
+	// Cache serves the services of the registry while it is unreachable
+	Cache *RegistryCacheConfig `yaml:"cache" json:"cache,omitempty" property:"cache"`
+}
+
+// RegistryCacheConfig caches the services looked up in the registry, they
+// are served stale when it fails and saved to a snapshot which is loaded
+// at boot
+type RegistryCacheConfig struct {
+	Enabled bool   `yaml:"enabled" json:"enabled,omitempty" property:"enabled"`
+	TTLStr  string `yaml:"ttl" json:"ttl,omitempty" property:"ttl"`
+	// the snapshot file, in the temp dir by default
+	Snapshot            string `yaml:"snapshot" json:"snapshot,omitempty" property:"snapshot"`
+	SnapshotIntervalStr string `yaml:"snapshotInterval" json:"snapshotInterval,omitempty" property:"snapshotInterval"`
 }
 
 // UnmarshalYAML unmarshals the RegistryConfig by @unmarshal function
@@ -92,28 +111,61 @@ func (r *RegistryConfig) getUrlMap(roleType common.RoleType) url.Values {
 }
 
 type registryBuilder struct {
+	// the caches of the built registries
+	caches []cache.Cache
 }
 
-func (r *registryBuilder) toURL(baseConfig BaseConfig) (*common.URL, error) {
-	address := baseConfig.RegistryConfig.Address
-	//address = translateRegistryConf(address, baseConfig.RegistryConfig)
+// cacheOptions returns the options of the cache of the registry, the
+// snapshot is kept in the temp dir by default
+func (c *RegistryCacheConfig) cacheOptions(name string, app *ApplicationConfig) ([]cache.Option, error) {
+	snapshot := c.Snapshot
+	if len(snapshot) == 0 {
+		if app != nil && len(app.Name) != 0 {
+			name = name + "-" + app.Name
+		}
+		snapshot = filepath.Join(os.TempDir(), "xmicro", "registry", name+".json")
+	}
+	opts := []cache.Option{cache.WithSnapshot(snapshot)}
+
+	if len(c.TTLStr) != 0 {
+		ttl, err := time.ParseDuration(c.TTLStr)
+		if err != nil {
+			return nil, perrors.WithMessagef(err, "time.ParseDuration(cache.ttl{%#v})", c.TTLStr)
+		}
+		opts = append(opts, cache.WithTTL(ttl))
+	}
+	if len(c.SnapshotIntervalStr) != 0 {
+		interval, err := time.ParseDuration(c.SnapshotIntervalStr)
+		if err != nil {
+			return nil, perrors.WithMessagef(err, "time.ParseDuration(cache.snapshotInterval{%#v})", c.SnapshotIntervalStr)
+		}
+		opts = append(opts, cache.WithSnapshotInterval(interval))
+	}
+	return opts, nil
+}
+
+func (r *registryBuilder) toURL(config *RegistryConfig) (*common.URL, error) {
+	address := config.Address
+	//address = translateRegistryConf(address, config)
 	url, err := common.NewURL(constant.RegistryProtocol+"://"+address,
-		common.WithParamsValue("simplified", strconv.FormatBool(baseConfig.RegistryConfig.Simplified)),
-		common.WithUsername(baseConfig.RegistryConfig.Username),
-		common.WithPassword(baseConfig.RegistryConfig.Password),
-		common.WithLocation(baseConfig.RegistryConfig.Address),
-		common.WithParams(baseConfig.RegistryConfig.getUrlMap(common.CONSUMER)),
+		common.WithParamsValue("simplified", strconv.FormatBool(config.Simplified)),
+		common.WithUsername(config.Username),
+		common.WithPassword(config.Password),
+		common.WithLocation(config.Address),
+		common.WithParams(config.getUrlMap(common.CONSUMER)),
 	)
 
 	if err != nil {
-		logger.Errorf("The registry id: %s url is invalid, error: %#v", baseConfig.RegistryConfig.Address, err)
+		logger.Errorf("The registry id: %s url is invalid, error: %#v", config.Address, err)
 		panic(err)
 	}
 	return url, err
 }
 
-func (r *registryBuilder) buildRegistry(baseConfig BaseConfig) (mregistry.Registry, error) {
-	newUrl, err := r.toURL(baseConfig)
+// newRegistry builds the registry of the config, cached if its cache is
+// enabled
+func (r *registryBuilder) newRegistry(name string, config *RegistryConfig, app *ApplicationConfig) (mregistry.Registry, error) {
+	newUrl, err := r.toURL(config)
 	if err != nil {
 		return nil, err
 	}
@@ -125,7 +177,70 @@ func (r *registryBuilder) buildRegistry(baseConfig BaseConfig) (mregistry.Regist
 		logger.Errorf("Get registry from configuration error , error message is %v", err)
 		return nil, perrors.WithStack(err)
 	}
-	return registry, nil
+
+	if config.Cache == nil || !config.Cache.Enabled {
+		return registry, nil
+	}
+	opts, err := config.Cache.cacheOptions(name, app)
+	if err != nil {
+		return nil, err
+	}
+	c := cache.New(registry, opts...)
+	r.caches = append(r.caches, c)
+	return c, nil
+}
+
+// stop stops the caches of the built registries, which saves their snapshots
+func (r *registryBuilder) stop() error {
+	for _, c := range r.caches {
+		c.Stop()
+	}
+	return nil
+}
+
+// buildRegistry builds the registry, several registries
+// are aggregated when the registries are configured
+func (r *registryBuilder) buildRegistry(baseConfig BaseConfig) (mregistry.Registry, error) {
+	if len(baseConfig.Registries) == 0 {
+		return r.newRegistry(baseConfig.RegistryConfig.Protocol, baseConfig.RegistryConfig, baseConfig.ApplicationConfig)
+	}
+
+	configs := make(map[string]*RegistryConfig, len(baseConfig.Registries)+1)
+	for name, config := range baseConfig.Registries {
+		configs[name] = config
+	}
+	// the registry is named after its protocol among the registries
+	if config := baseConfig.RegistryConfig; config != nil {
+		if _, ok := configs[config.Protocol]; ok {
+			return nil, perrors.Errorf("registries %s collides with the registry of protocol %s, rename it",
+				config.Protocol, config.Protocol)
+		}
+		configs[config.Protocol] = config
+	}
+
+	// build in name order so the sources keep a stable order
+	names := make([]string, 0, len(configs))
+	for name := range configs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var sources []*multi.Source
+	for _, name := range names {
+		config := configs[name]
+		registry, err := r.newRegistry(name, config, baseConfig.ApplicationConfig)
+		if err != nil {
+			return nil, err
+		}
+		sources = append(sources, &multi.Source{
+			Registry:  registry,
+			Name:      name,
+			Zone:      config.Zone,
+			Preferred: config.Preferred,
+		})
+	}
+
+	return multi.NewRegistry(sources...), nil
 }
 
 func translateRegistryConf(address string, registryConf *RegistryConfig) string {
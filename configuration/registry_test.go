@@ -0,0 +1,91 @@
+package configuration
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+import (
+	"github.com/stretchr/testify/assert"
+)
+
+import (
+	"xmicro/common"
+	"xmicro/common/component"
+	mregistry "xmicro/registry"
+	"xmicro/registry/cache"
+	"xmicro/registry/memory"
+)
+
+type memoryRegistryFactory struct {
+	urls []*common.URL
+}
+
+func (f *memoryRegistryFactory) GetRegistry(url *common.URL) (mregistry.Registry, error) {
+	f.urls = append(f.urls, url)
+	return memory.NewRegistry(), nil
+}
+
+func TestBuildRegistries(t *testing.T) {
+	factory := &memoryRegistryFactory{}
+	component.SetRegistryFactory("memoryTest", factory)
+
+	primary := &RegistryConfig{Protocol: "memoryTest", Address: "127.0.0.1:1", Zone: "a"}
+	base := BaseConfig{
+		RegistryConfig: primary,
+		Registries: map[string]*RegistryConfig{
+			"zone-b": {Protocol: "memoryTest", Address: "127.0.0.1:2", Zone: "b"},
+		},
+	}
+	r, err := (&registryBuilder{}).buildRegistry(base)
+	assert.NoError(t, err)
+	assert.NotNil(t, r)
+	assert.Len(t, factory.urls, 2)
+	assert.Equal(t, "127.0.0.1:1", factory.urls[0].Location)
+	assert.Equal(t, "127.0.0.1:2", factory.urls[1].Location)
+
+	// the registries entry named after the protocol of the registry is not overwritten
+	factory.urls = nil
+	base.Registries = map[string]*RegistryConfig{
+		"memoryTest": {Protocol: "memoryTest", Address: "127.0.0.1:2", Zone: "b"},
+	}
+	_, err = (&registryBuilder{}).buildRegistry(base)
+	assert.Error(t, err)
+	assert.Empty(t, factory.urls)
+}
+
+func TestBuildCachedRegistry(t *testing.T) {
+	component.SetRegistryFactory("memoryTest", &memoryRegistryFactory{})
+
+	snapshot := filepath.Join(t.TempDir(), "registry.json")
+	base := BaseConfig{
+		ApplicationConfig: &ApplicationConfig{Name: "greeter"},
+		RegistryConfig: &RegistryConfig{
+			Protocol: "memoryTest",
+			Address:  "127.0.0.1:1",
+			Cache:    &RegistryCacheConfig{Enabled: true, TTLStr: "1m", Snapshot: snapshot},
+		},
+	}
+	builder := &registryBuilder{}
+	r, err := builder.buildRegistry(base)
+	assert.NoError(t, err)
+	_, ok := r.(cache.Cache)
+	assert.True(t, ok)
+	assert.Len(t, builder.caches, 1)
+
+	assert.NoError(t, r.Register(&mregistry.Service{Name: "greeter", Nodes: []*mregistry.Node{{Id: "greeter-1", Address: "10.0.0.1:8080"}}}))
+	_, err = r.GetService("greeter")
+	assert.NoError(t, err)
+
+	// the caches save their snapshot once stopped
+	assert.NoError(t, builder.stop())
+	b, err := ioutil.ReadFile(snapshot)
+	assert.NoError(t, err)
+	assert.Contains(t, string(b), "10.0.0.1:8080")
+
+	// the cache options are validated
+	base.RegistryConfig.Cache.TTLStr = "a minute"
+	_, err = (&registryBuilder{}).buildRegistry(base)
+	assert.Error(t, err)
+}
@@ -5,14 +5,16 @@ import (
 	"github.com/creasty/defaults"
 	perrors "github.com/pkg/errors"
 	"xmicro/common/constant"
+	"xmicro/config/parser"
 	"xmicro/util/yaml"
 )
 
 // ServerConfig is the default configuration of service provider
 type ServerConfig struct {
 	BaseConfig `yaml:",inline"`
-	Port       int         `default:"8090" yaml:"port" json:"port,omitempty" property:"port"`
-	Consumer   interface{} `yaml:"consumer"`
+	Port       int `default:"8090" yaml:"port" json:"port,omitempty" property:"port"`
+	//async communicate
+	Consumer *BrokerConfig `yaml:"consumer" json:"consumer,omitempty"`
 }
 
 // UnmarshalYAML unmarshals the ServerConfig by @unmarshal function
@@ -43,12 +45,27 @@ func ServerInit(confProFile string) error {
 		return perrors.Errorf("application configure(provider) file name is nil")
 	}
 	serverConfig = &ServerConfig{}
-	fileStream, err := yaml.UnmarshalYMLConfig(confProFile, serverConfig)
+	o := newOverlay()
+	fileStream, err := o.load(confProFile, serverConfig)
 	if err != nil {
 		return perrors.Errorf("unmarshalYmlConfig error %v", perrors.WithStack(err))
 	}
 
 	serverConfig.fileStream = bytes.NewBuffer(fileStream)
+
+	// the local values of the environment, below the config center
+	localMap, err := yaml.Flatten(fileStream)
+	if err != nil {
+		return perrors.Errorf("yaml.Flatten(file:%s) = error:%v", confProFile, err)
+	}
+	tree, err := (&parser.YAMLParser{}).ParseTree(string(fileStream))
+	if err != nil {
+		return perrors.WithStack(err)
+	}
+	GetEnvInstance().SetResolver(o.resolver)
+	if err := GetEnvInstance().UpdateLocalConfig(localMap, tree); err != nil {
+		return perrors.WithStack(err)
+	}
 	return nil
 }
 
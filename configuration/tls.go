@@ -0,0 +1,68 @@
+package configuration
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+)
+
+import (
+	perrors "github.com/pkg/errors"
+)
+
+// TLSConfig secures the transport or the broker. Enabled without a
+// certificate, a ca or a server name, the defaults of the implementation
+// are used: the servers use a self signed certificate and the clients
+// verify the servers by the roots of the system.
+type TLSConfig struct {
+	Enabled  bool   `yaml:"enabled" json:"enabled,omitempty"`
+	CertFile string `yaml:"certFile" json:"certFile,omitempty"`
+	KeyFile  string `yaml:"keyFile" json:"keyFile,omitempty"`
+	// CAFile verifies the servers, and the clients with ClientAuth
+	CAFile string `yaml:"caFile" json:"caFile,omitempty"`
+	// ClientAuth requires the clients to present a certificate of the ca
+	ClientAuth         bool   `yaml:"clientAuth" json:"clientAuth,omitempty"`
+	ServerName         string `yaml:"serverName" json:"serverName,omitempty"`
+	InsecureSkipVerify bool   `yaml:"insecureSkipVerify" json:"insecureSkipVerify,omitempty"`
+}
+
+// toTLS returns the tls config, nil if the defaults of the implementation are used
+func (c *TLSConfig) toTLS() (*tls.Config, error) {
+	if c == nil || !c.Enabled {
+		return nil, nil
+	}
+	if c.ClientAuth && c.CAFile == "" {
+		return nil, perrors.New("tls clientAuth requires a caFile")
+	}
+	if c.CertFile == "" && c.CAFile == "" && c.ServerName == "" && !c.InsecureSkipVerify {
+		return nil, nil
+	}
+
+	config := &tls.Config{
+		ServerName:         c.ServerName,
+		InsecureSkipVerify: c.InsecureSkipVerify,
+	}
+	if c.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, perrors.WithMessagef(err, "load tls certificate %s", c.CertFile)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	if c.CAFile != "" {
+		ca, err := ioutil.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, perrors.WithMessagef(err, "read tls ca %s", c.CAFile)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, perrors.Errorf("no certificate in tls ca %s", c.CAFile)
+		}
+		config.RootCAs = pool
+		if c.ClientAuth {
+			config.ClientCAs = pool
+			config.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	}
+	return config, nil
+}
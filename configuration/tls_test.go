@@ -0,0 +1,70 @@
+package configuration
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+import (
+	"github.com/stretchr/testify/assert"
+)
+
+// writeCA writes a self signed ca certificate and returns its file
+func writeCA(t *testing.T) string {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test-ca"},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.NoError(t, err)
+
+	dir, err := ioutil.TempDir("", "tls")
+	assert.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	file := filepath.Join(dir, "ca.crt")
+	assert.NoError(t, ioutil.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644))
+	return file
+}
+
+func TestTLSConfig(t *testing.T) {
+	// enabled without files the defaults of the implementation are used
+	config, err := (&TLSConfig{Enabled: true}).toTLS()
+	assert.NoError(t, err)
+	assert.Nil(t, config)
+
+	ca := writeCA(t)
+
+	// the ca verifies the servers only
+	config, err = (&TLSConfig{Enabled: true, CAFile: ca}).toTLS()
+	assert.NoError(t, err)
+	assert.NotNil(t, config.RootCAs)
+	assert.Nil(t, config.ClientCAs)
+	assert.Equal(t, tls.NoClientCert, config.ClientAuth)
+
+	// and the clients with clientAuth
+	config, err = (&TLSConfig{Enabled: true, CAFile: ca, ClientAuth: true}).toTLS()
+	assert.NoError(t, err)
+	assert.NotNil(t, config.ClientCAs)
+	assert.Equal(t, tls.RequireAndVerifyClientCert, config.ClientAuth)
+
+	_, err = (&TLSConfig{Enabled: true, ClientAuth: true}).toTLS()
+	assert.Error(t, err)
+}
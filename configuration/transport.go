@@ -0,0 +1,72 @@
+package configuration
+
+import (
+	"time"
+)
+
+import (
+	"github.com/creasty/defaults"
+	perrors "github.com/pkg/errors"
+)
+
+import (
+	"xmicro/common/component"
+	"xmicro/common/constant"
+	"xmicro/transport"
+)
+
+// TransportConfig is the configuration of the sync communication
+type TransportConfig struct {
+	//option grpc/tcp/nats/memory
+	Protocol string `default:"grpc" yaml:"protocol" json:"protocol,omitempty"`
+	// comma separated addresses, e.g. of nats
+	Address    string `yaml:"address" json:"address,omitempty"`
+	TimeoutStr string `yaml:"timeout" json:"timeout,omitempty"`
+}
+
+// UnmarshalYAML unmarshals the TransportConfig by @unmarshal function
+func (c *TransportConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	if err := defaults.Set(c); err != nil {
+		return err
+	}
+	type plain TransportConfig
+	if err := unmarshal((*plain)(c)); err != nil {
+		return err
+	}
+	return nil
+}
+
+// newTransport builds the transport of the base config from the component
+// locator, grpc if none is configured
+func newTransport(baseConfig BaseConfig) (transport.Transport, error) {
+	c := baseConfig.TransportConfig
+	if c == nil {
+		c = &TransportConfig{}
+	}
+
+	var opts []transport.Option
+	if addrs := splitAddress(c.Address); len(addrs) > 0 {
+		opts = append(opts, transport.Addrs(addrs...))
+	}
+	if c.TimeoutStr != "" {
+		timeout, err := time.ParseDuration(c.TimeoutStr)
+		if err != nil {
+			return nil, perrors.WithMessagef(err, "time.ParseDuration(transport.timeout{%#v})", c.TimeoutStr)
+		}
+		opts = append(opts, transport.Timeout(timeout))
+	}
+	if baseConfig.TLSConfig != nil && baseConfig.TLSConfig.Enabled {
+		// without files the config is nil and the transport secures by its defaults
+		config, err := baseConfig.TLSConfig.toTLS()
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, transport.Secure(true), transport.TLSConfig(config))
+	}
+
+	protocol := c.Protocol
+	if protocol == "" {
+		protocol = constant.GrpcKey
+	}
+	return component.GetTransportFactory(protocol)(opts...), nil
+}
@@ -0,0 +1,451 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package configuration
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+import (
+	perrors "github.com/pkg/errors"
+)
+
+import (
+	"xmicro/client"
+	"xmicro/common/component"
+	"xmicro/common/constant"
+	"xmicro/logger"
+	"xmicro/logger/core"
+	"xmicro/server"
+	"xmicro/service"
+	"xmicro/util/ratelimit"
+)
+
+// the number of changes kept for the admin endpoint
+const maxTuningChanges = 100
+
+// RateLimitConfig limits the requests per second of the rateLimit wrappers,
+// a rate of 0 is unlimited
+type RateLimitConfig struct {
+	Server float64 `yaml:"server" json:"server,omitempty"`
+	Client float64 `yaml:"client" json:"client,omitempty"`
+	// the requests allowed at once, the rate by default
+	Burst int `yaml:"burst" json:"burst,omitempty"`
+}
+
+// Validate rejects the negative limits
+func (c *RateLimitConfig) Validate() error {
+	if c.Server < 0 || c.Client < 0 || c.Burst < 0 {
+		return perrors.Errorf("rate limits %+v should not be negative", *c)
+	}
+	return nil
+}
+
+// TuningChange is a change of a dynamic key applied to the service
+type TuningChange struct {
+	Key  string    `json:"key"`
+	Old  string    `json:"old"`
+	New  string    `json:"new"`
+	Time time.Time `json:"time"`
+}
+
+// Tuner applies the dynamic keys of the environment to the running service:
+// the log level, the request timeout, the retries and the selector of the
+// client, the rate limits and the enabled wrappers. An invalid value rejects
+// the update of the environment, the service keeps the previous one.
+type Tuner struct {
+	env *Environment
+	// the values of the keys which are not set
+	defaults map[string]string
+
+	sync.RWMutex
+	values   map[string]string
+	changes  []TuningChange
+	bindings []*Binding
+	// the client, its wrapped client and the call options of the dynamic
+	// keys, the options of the client are not changed while it is used
+	client      client.Client
+	wrapped     client.Client
+	callOptions map[string]client.CallOption
+	// the handler wrappers of the server
+	handlerWrappers []server.HandlerWrapper
+}
+
+// newTuner returns a tuner of the keys, the map of the keys to their defaults
+func newTuner(env *Environment, defaults map[string]string) *Tuner {
+	return &Tuner{
+		env:         env,
+		defaults:    defaults,
+		values:      make(map[string]string),
+		callOptions: make(map[string]client.CallOption),
+	}
+}
+
+// clientDefaults are the dynamic keys of a client, the timeout, the retries
+// and the selector default to the ones of the client config
+func clientDefaults(c *ClientConfig) map[string]string {
+	timeout, selector := client.DefaultRequestTimeout, constant.RoundRobinKey
+	if c.RequestTimeout > 0 {
+		timeout = c.RequestTimeout
+	}
+	if c.Selector != "" {
+		selector = c.Selector
+	}
+	return map[string]string{
+		constant.TuningLogLevelKey:       core.InfoLevel.String(),
+		constant.TuningRequestTimeoutKey: timeout.String(),
+		constant.TuningRetriesKey:        strconv.Itoa(c.Retries),
+		constant.TuningSelectorKey:       selector,
+		constant.TuningRateLimitKey:      "{}",
+		constant.TuningWrapperKey:        "",
+	}
+}
+
+// serverDefaults are the dynamic keys of a server
+func serverDefaults() map[string]string {
+	return map[string]string{
+		constant.TuningLogLevelKey:  core.InfoLevel.String(),
+		constant.TuningRateLimitKey: "{}",
+		constant.TuningWrapperKey:   "",
+	}
+}
+
+// start binds the keys and applies their values
+func (t *Tuner) start() error {
+	keys := make([]string, 0, len(t.defaults))
+	for key := range t.defaults {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		var (
+			b   *Binding
+			err error
+		)
+		key := key
+		if key == constant.TuningRateLimitKey {
+			var limits RateLimitConfig
+			b, err = t.env.Bind(key, &limits, OnChange(func(_, value interface{}) {
+				t.update(key, rateLimitString(value.(*RateLimitConfig)))
+			}))
+			if err == nil {
+				err = t.set(key, rateLimitString(&limits))
+			}
+		} else {
+			var value string
+			b, err = t.env.Bind(key, &value, WithValidator(func(v interface{}) error {
+				return validateTuning(key, *v.(*string))
+			}), OnChange(func(_, value interface{}) {
+				t.update(key, *value.(*string))
+			}))
+			if err == nil {
+				err = t.set(key, value)
+			}
+		}
+		if err != nil {
+			t.Close()
+			return perrors.WithMessagef(err, "tune %s", key)
+		}
+		t.Lock()
+		t.bindings = append(t.bindings, b)
+		t.Unlock()
+	}
+	return nil
+}
+
+// Close stops applying the changes
+func (t *Tuner) Close() {
+	t.Lock()
+	bindings := t.bindings
+	t.bindings = nil
+	t.Unlock()
+
+	for _, b := range bindings {
+		b.Close()
+	}
+}
+
+// Values returns the effective values of the dynamic keys
+func (t *Tuner) Values() map[string]string {
+	t.RLock()
+	defer t.RUnlock()
+
+	values := make(map[string]string, len(t.values))
+	for k, v := range t.values {
+		values[k] = v
+	}
+	return values
+}
+
+// Changes returns the latest changes applied, the oldest first
+func (t *Tuner) Changes() []TuningChange {
+	t.RLock()
+	defer t.RUnlock()
+
+	changes := make([]TuningChange, len(t.changes))
+	copy(changes, t.changes)
+	return changes
+}
+
+// update applies the changed value of the key
+func (t *Tuner) update(key, value string) {
+	if err := t.set(key, value); err != nil {
+		logger.Errorf("Tuning: apply %s error %v", key, err)
+	}
+}
+
+// set applies the value of the key, the default if it is empty, and records
+// the change. The calls are only given the options of the keys which are
+// set, the client keeps its configured options for the others.
+func (t *Tuner) set(key, value string) error {
+	unset := len(value) == 0
+	if unset {
+		value = t.defaults[key]
+	}
+
+	t.Lock()
+	old, loaded := t.values[key]
+	if loaded && old == value {
+		t.Unlock()
+		return nil
+	}
+	t.values[key] = value
+	switch key {
+	case constant.TuningRequestTimeoutKey, constant.TuningRetriesKey, constant.TuningSelectorKey:
+		if unset {
+			delete(t.callOptions, key)
+		} else {
+			t.callOptions[key] = tuningCallOption(key, value)
+		}
+	}
+	if loaded {
+		t.changes = append(t.changes, TuningChange{Key: key, Old: old, New: value, Time: time.Now()})
+		if len(t.changes) > maxTuningChanges {
+			t.changes = t.changes[len(t.changes)-maxTuningChanges:]
+		}
+	}
+	t.Unlock()
+
+	if loaded {
+		logger.Infof("Tuning: %s changed from %q to %q", key, old, value)
+	}
+
+	switch key {
+	case constant.TuningLogLevelKey:
+		return logger.SetLevel(core.GetLevel(value))
+	case constant.TuningRateLimitKey:
+		var limits RateLimitConfig
+		if err := json.Unmarshal([]byte(value), &limits); err != nil {
+			return err
+		}
+		ratelimit.DefaultServerLimiter.SetLimit(limits.Server, limits.Burst)
+		ratelimit.DefaultClientLimiter.SetLimit(limits.Client, limits.Burst)
+	case constant.TuningWrapperKey:
+		t.wrap(value)
+	}
+	return nil
+}
+
+// WrapClient is the client wrapper of the service, the calls go through the
+// client wrappers of the wrapper key with the timeout, the retries and the
+// selector of the dynamic keys, which the options of a call override
+func (t *Tuner) WrapClient(c client.Client) client.Client {
+	t.Lock()
+	t.client = c
+	wrappers := t.values[constant.TuningWrapperKey]
+	t.Unlock()
+
+	t.wrap(wrappers)
+
+	return &tunedClient{Client: c, tuner: t}
+}
+
+// WrapHandler is the handler wrapper of the service, the requests go through
+// the handler wrappers of the wrapper key
+func (t *Tuner) WrapHandler(fn server.HandlerFunc) server.HandlerFunc {
+	return func(ctx context.Context, req server.Request, rsp interface{}) error {
+		t.RLock()
+		wrappers := t.handlerWrappers
+		t.RUnlock()
+
+		h := fn
+		for i := len(wrappers); i > 0; i-- {
+			h = wrappers[i-1](h)
+		}
+		return h(ctx, req, rsp)
+	}
+}
+
+// wrap rebuilds the wrappers of the comma separated names
+func (t *Tuner) wrap(names string) {
+	var (
+		clientWrappers  []client.Wrapper
+		handlerWrappers []server.HandlerWrapper
+	)
+	for _, name := range strings.Split(names, ",") {
+		name = strings.TrimSpace(name)
+		if len(name) == 0 {
+			continue
+		}
+		cw, hw := component.GetClientWrapper(name), component.GetServerWrapper(name)
+		if cw == nil && hw == nil {
+			logger.Warnf("Tuning: wrapper %s is not registered", name)
+		}
+		if cw != nil {
+			clientWrappers = append(clientWrappers, cw)
+		}
+		if hw != nil {
+			handlerWrappers = append(handlerWrappers, hw)
+		}
+	}
+
+	t.Lock()
+	defer t.Unlock()
+
+	t.handlerWrappers = handlerWrappers
+	if t.client == nil {
+		return
+	}
+	// apply in reverse
+	wrapped := t.client
+	for i := len(clientWrappers); i > 0; i-- {
+		wrapped = clientWrappers[i-1](wrapped)
+	}
+	t.wrapped = wrapped
+}
+
+// current returns the wrapped client and the call options of the dynamic
+// keys followed by the ones of the call
+func (t *Tuner) current(opts []client.CallOption) (client.Client, []client.CallOption) {
+	t.RLock()
+	defer t.RUnlock()
+
+	callOpts := make([]client.CallOption, 0, len(t.callOptions)+len(opts))
+	for _, key := range []string{constant.TuningRequestTimeoutKey, constant.TuningRetriesKey, constant.TuningSelectorKey} {
+		if o, ok := t.callOptions[key]; ok {
+			callOpts = append(callOpts, o)
+		}
+	}
+	return t.wrapped, append(callOpts, opts...)
+}
+
+// tunedClient calls through the latest client wrappers of the tuner
+type tunedClient struct {
+	client.Client
+	tuner *Tuner
+}
+
+func (c *tunedClient) Call(ctx context.Context, req client.Request, rsp interface{}, opts ...client.CallOption) error {
+	wrapped, callOpts := c.tuner.current(opts)
+	return wrapped.Call(ctx, req, rsp, callOpts...)
+}
+
+func (c *tunedClient) Stream(ctx context.Context, req client.Request, opts ...client.CallOption) (client.Stream, error) {
+	wrapped, callOpts := c.tuner.current(opts)
+	return wrapped.Stream(ctx, req, callOpts...)
+}
+
+func (c *tunedClient) Publish(ctx context.Context, msg client.Message, opts ...client.PublishOption) error {
+	wrapped, _ := c.tuner.current(nil)
+	return wrapped.Publish(ctx, msg, opts...)
+}
+
+// tuningCallOption returns the call option of the validated value of the key
+func tuningCallOption(key, value string) client.CallOption {
+	switch key {
+	case constant.TuningRequestTimeoutKey:
+		d, _ := time.ParseDuration(value)
+		return client.WithRequestTimeout(d)
+	case constant.TuningRetriesKey:
+		i, _ := strconv.Atoi(value)
+		return client.WithRetries(i)
+	default:
+		return client.WithSelector(component.GetSelectorFactory(value)())
+	}
+}
+
+// validateTuning rejects the values which can not be applied, an empty
+// value restores the default
+func validateTuning(key, value string) error {
+	if len(value) == 0 {
+		return nil
+	}
+	switch key {
+	case constant.TuningLogLevelKey:
+		if core.GetLevel(value).String() != value {
+			return perrors.Errorf("unknown log level %s", value)
+		}
+	case constant.TuningRequestTimeoutKey:
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		if d <= 0 || d >= time.Duration(MaxWheelTimeSpan) {
+			return perrors.Errorf("request timeout %s should be positive and less than %s",
+				value, time.Duration(MaxWheelTimeSpan))
+		}
+	case constant.TuningRetriesKey:
+		i, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		if i < 0 {
+			return perrors.Errorf("retries %d should not be negative", i)
+		}
+	case constant.TuningSelectorKey:
+		if !component.HasSelectorFactory(value) {
+			return perrors.Errorf("unknown selector %s", value)
+		}
+	}
+	return nil
+}
+
+func rateLimitString(c *RateLimitConfig) string {
+	b, _ := json.Marshal(c)
+	return string(b)
+}
+
+// startTuner applies the dynamic keys to the service and serves the admin
+// endpoint of the config, the options stop them with the service
+func startTuner(baseConfig BaseConfig, defaults map[string]string) (*Tuner, []service.Option, error) {
+	t := newTuner(GetEnvInstance(), defaults)
+	if err := t.start(); err != nil {
+		return nil, nil, err
+	}
+	opts := []service.Option{service.AfterStop(func() error {
+		t.Close()
+		return nil
+	})}
+
+	if baseConfig.AdminConfig != nil && len(baseConfig.AdminConfig.Address) != 0 {
+		stop, err := baseConfig.AdminConfig.start(t, GetEnvInstance())
+		if err != nil {
+			t.Close()
+			return nil, nil, err
+		}
+		opts = append(opts, service.BeforeStop(stop))
+	}
+	return t, opts, nil
+}
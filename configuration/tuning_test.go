@@ -0,0 +1,262 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package configuration
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+import (
+	"github.com/stretchr/testify/assert"
+)
+
+import (
+	"xmicro/client"
+	rpcClient "xmicro/client/rpc"
+	"xmicro/common/component"
+	"xmicro/logger"
+	"xmicro/logger/core"
+	"xmicro/server"
+	"xmicro/util/ratelimit"
+)
+
+// tuningClient records the call options of the last call
+type tuningClient struct {
+	client.Client
+	opts  client.Options
+	last  client.CallOptions
+	calls int
+}
+
+func (c *tuningClient) Options() client.Options {
+	return c.opts
+}
+
+func (c *tuningClient) Call(ctx context.Context, req client.Request, rsp interface{}, opts ...client.CallOption) error {
+	c.calls++
+	c.last = c.opts.CallOptions
+	for _, o := range opts {
+		o(&c.last)
+	}
+	return nil
+}
+
+// countingWrapper counts the calls going through the client wrapper
+type countingWrapper struct {
+	client.Client
+	calls *int
+}
+
+func (w *countingWrapper) Call(ctx context.Context, req client.Request, rsp interface{}, opts ...client.CallOption) error {
+	*w.calls++
+	return w.Client.Call(ctx, req, rsp, opts...)
+}
+
+func TestTuner(t *testing.T) {
+	var wrapped, handled int
+	component.SetClientWrapper("tuningTest", func(c client.Client) client.Client {
+		return &countingWrapper{Client: c, calls: &wrapped}
+	})
+	component.SetServerWrapper("tuningTest", func(fn server.HandlerFunc) server.HandlerFunc {
+		return func(ctx context.Context, req server.Request, rsp interface{}) error {
+			handled++
+			return fn(ctx, req, rsp)
+		}
+	})
+	defer func() {
+		_ = logger.SetLevel(core.InfoLevel)
+		ratelimit.DefaultServerLimiter.SetLimit(0, 0)
+		ratelimit.DefaultClientLimiter.SetLimit(0, 0)
+	}()
+
+	env := newTestEnv()
+	assert.NoError(t, env.UpdateLocalConfigMap(map[string]string{
+		"requestTimeout": "200ms",
+		"retries":        "1",
+		"wrapper":        "tuningTest",
+	}))
+	tuner := newTuner(env, clientDefaults(&ClientConfig{Retries: 1}))
+	assert.NoError(t, tuner.start())
+	defer tuner.Close()
+
+	c := &tuningClient{opts: client.NewOptions()}
+	cl := tuner.WrapClient(c)
+	handler := tuner.WrapHandler(func(ctx context.Context, req server.Request, rsp interface{}) error {
+		return nil
+	})
+	assert.NoError(t, cl.Call(context.Background(), nil, nil))
+	assert.NoError(t, handler(context.Background(), nil, nil))
+	assert.Equal(t, 200*time.Millisecond, c.last.RequestTimeout)
+	assert.Equal(t, client.DefaultRequestTimeout, c.opts.CallOptions.RequestTimeout)
+	assert.Equal(t, 1, wrapped)
+	assert.Equal(t, 1, handled)
+
+	// the config center overrides the file and disables the wrapper
+	assert.NoError(t, env.ReplaceExternalConfigMap(map[string]string{
+		"logger.level":     "debug",
+		"requestTimeout":   "1s",
+		"retries":          "3",
+		"selector":         "random",
+		"wrapper":          "",
+		"rateLimit.server": "5",
+	}))
+	assert.Equal(t, core.DebugLevel, logger.DefaultLogger.Options().Level)
+	rate, burst := ratelimit.DefaultServerLimiter.Limit()
+	assert.Equal(t, 5.0, rate)
+	assert.Equal(t, 5, burst)
+
+	assert.NoError(t, cl.Call(context.Background(), nil, nil))
+	assert.NoError(t, handler(context.Background(), nil, nil))
+	assert.Equal(t, time.Second, c.last.RequestTimeout)
+	assert.Equal(t, 3, c.last.Retries)
+	assert.Equal(t, "random", c.last.Selector.String())
+	assert.Equal(t, 1, wrapped)
+	assert.Equal(t, 1, handled)
+	assert.Equal(t, 2, c.calls)
+
+	// the options of the call override the dynamic ones
+	assert.NoError(t, cl.Call(context.Background(), nil, nil, client.WithRetries(0)))
+	assert.Equal(t, 0, c.last.Retries)
+	assert.Equal(t, time.Second, c.last.RequestTimeout)
+
+	// the invalid values are rejected as a whole
+	assert.Error(t, env.ReplaceExternalConfigMap(map[string]string{"requestTimeout": "2s", "retries": "-1"}))
+	assert.Error(t, env.ReplaceExternalConfigMap(map[string]string{"selector": "unknown"}))
+	assert.Error(t, env.ReplaceExternalConfigMap(map[string]string{"rateLimit.client": "-5"}))
+	assert.NoError(t, cl.Call(context.Background(), nil, nil))
+	assert.Equal(t, time.Second, c.last.RequestTimeout)
+
+	// removing the overrides restores the file and the defaults
+	assert.NoError(t, env.ReplaceExternalConfigMap(nil))
+	assert.Equal(t, core.InfoLevel, logger.DefaultLogger.Options().Level)
+	assert.NoError(t, cl.Call(context.Background(), nil, nil))
+	assert.Equal(t, 200*time.Millisecond, c.last.RequestTimeout)
+	assert.Equal(t, 1, c.last.Retries)
+	// the selector of the client is used again
+	assert.Nil(t, c.last.Selector)
+	assert.Equal(t, 2, wrapped)
+
+	values := tuner.Values()
+	assert.Equal(t, "200ms", values["requestTimeout"])
+	assert.Equal(t, "tuningTest", values["wrapper"])
+	assert.Equal(t, "{}", values["rateLimit"])
+
+	changes := tuner.Changes()
+	assert.Len(t, changes, 12)
+	last := changes[len(changes)-4]
+	assert.Equal(t, TuningChange{Key: "requestTimeout", Old: "1s", New: "200ms", Time: last.Time}, last)
+
+	// the admin endpoint serves the effective values
+	rec := httptest.NewRecorder()
+	adminHandler(tuner, env).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/tuning", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var out struct {
+		Values  map[string]string `json:"values"`
+		Changes []TuningChange    `json:"changes"`
+	}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &out))
+	assert.Equal(t, values, out.Values)
+	assert.Len(t, out.Changes, 12)
+
+	rec = httptest.NewRecorder()
+	adminHandler(tuner, env).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/config", nil))
+	assert.Contains(t, rec.Body.String(), `"retries":"1"`)
+}
+
+func TestTunerClientConfig(t *testing.T) {
+	env := newTestEnv()
+	tuner := newTuner(env, clientDefaults(&ClientConfig{RequestTimeout: 10 * time.Second, Retries: 2, Selector: "random"}))
+	assert.NoError(t, tuner.start())
+	defer tuner.Close()
+
+	// the keys which are not set show the configured values
+	values := tuner.Values()
+	assert.Equal(t, "10s", values["requestTimeout"])
+	assert.Equal(t, "2", values["retries"])
+	assert.Equal(t, "random", values["selector"])
+
+	// and leave the configured options of the client to the calls
+	c := &tuningClient{opts: client.NewOptions(client.RequestTimeout(10*time.Second), client.Retries(2))}
+	cl := tuner.WrapClient(c)
+	assert.NoError(t, cl.Call(context.Background(), nil, nil))
+	assert.Equal(t, 10*time.Second, c.last.RequestTimeout)
+	assert.Equal(t, 2, c.last.Retries)
+
+	// until the key is set
+	assert.NoError(t, env.ReplaceExternalConfigMap(map[string]string{"requestTimeout": "1s"}))
+	assert.NoError(t, cl.Call(context.Background(), nil, nil))
+	assert.Equal(t, time.Second, c.last.RequestTimeout)
+	assert.NoError(t, env.ReplaceExternalConfigMap(nil))
+	assert.NoError(t, cl.Call(context.Background(), nil, nil))
+	assert.Equal(t, 10*time.Second, c.last.RequestTimeout)
+}
+
+func TestTunerConcurrentCalls(t *testing.T) {
+	defer func() {
+		_ = logger.SetLevel(core.InfoLevel)
+	}()
+
+	env := newTestEnv()
+	tuner := newTuner(env, clientDefaults(&ClientConfig{Retries: 1}))
+	assert.NoError(t, tuner.start())
+	defer tuner.Close()
+
+	// the lookup fails the calls after the options are applied
+	var timeout int64
+	errLookup := errors.New("no route")
+	c := rpcClient.NewClient(client.Lookup(func(ctx context.Context, req client.Request, opts client.CallOptions) ([]string, error) {
+		atomic.StoreInt64(&timeout, int64(opts.RequestTimeout))
+		return nil, errLookup
+	}))
+	cl := tuner.WrapClient(c)
+	req := cl.NewRequest("test", "Test.Call", map[string]string{})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				assert.Error(t, cl.Call(context.Background(), req, nil))
+				logger.Debugf("Tuning: call %d", j)
+			}
+		}()
+	}
+	for i := 1; i <= 20; i++ {
+		assert.NoError(t, env.ReplaceExternalConfigMap(map[string]string{
+			"requestTimeout": strconv.Itoa(i) + "s",
+			"retries":        strconv.Itoa(i % 3),
+			"selector":       "random",
+			"logger.level":   []string{"debug", "warn"}[i%2],
+		}))
+	}
+	wg.Wait()
+
+	assert.Error(t, cl.Call(context.Background(), req, nil))
+	assert.Equal(t, 20*time.Second, time.Duration(atomic.LoadInt64(&timeout)))
+	assert.Equal(t, client.DefaultRequestTimeout, c.Options().CallOptions.RequestTimeout)
+}
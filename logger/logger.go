@@ -33,6 +33,16 @@ func Init(opts ...core.Option) error {
 	return DefaultLogger.Init(opts...)
 }
 
+// SetLevel changes the level of the default logger, the loggers which can't
+// change it in place are initialised again
+func SetLevel(level core.Level) error {
+	if l, ok := DefaultLogger.(interface{ SetLevel(core.Level) }); ok {
+		l.SetLevel(level)
+		return nil
+	}
+	return DefaultLogger.Init(core.WithLevel(level))
+}
+
 func Fields(fields map[string]interface{}) Logger {
 	return DefaultLogger.Fields(fields)
 }
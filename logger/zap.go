@@ -8,11 +8,13 @@ import (
 	"go.uber.org/zap/zapcore"
 	"gopkg.in/natefinch/lumberjack.v2"
 	"os"
+	"sync"
 )
 
 type ZapLog struct {
 	c     *zap.Logger
 	lv    *zap.AtomicLevel
+	mu    sync.RWMutex
 	opts  core.Options
 	sugar *zap.SugaredLogger
 }
@@ -42,9 +44,11 @@ func (l *ZapLog) Sugar() *zap.SugaredLogger {
 
 // Init initialises options
 func (l *ZapLog) Init(options ...core.Option) error {
+	l.mu.Lock()
 	for _, o := range options {
 		o(&l.opts)
 	}
+	l.mu.Unlock()
 
 	var logFile string
 	// log path
@@ -59,8 +63,13 @@ func (l *ZapLog) Init(options ...core.Option) error {
 	writeSyn := getLogWriter(logFile)
 	encoder := getEncoder()
 
-	var level = loggerToZapLevel(l.opts.Level)
-	core := zapcore.NewCore(encoder, writeSyn, level)
+	// the level is shared by the cores so SetLevel changes it in place
+	if l.lv == nil {
+		lv := zap.NewAtomicLevel()
+		l.lv = &lv
+	}
+	l.lv.SetLevel(loggerToZapLevel(l.opts.Level))
+	core := zapcore.NewCore(encoder, writeSyn, l.lv)
 	l.c = zap.New(core, zap.AddCaller(), zap.AddCallerSkip(l.opts.CallerSkipCount))
 
 	//还原sugar caller
@@ -108,8 +117,18 @@ func getEncoder() zapcore.Encoder {
 	return zapcore.NewJSONEncoder(zapConf)
 }
 
+// SetLevel changes the level without building the logger again
+func (l *ZapLog) SetLevel(level core.Level) {
+	l.mu.Lock()
+	l.opts.Level = level
+	l.mu.Unlock()
+	l.lv.SetLevel(loggerToZapLevel(level))
+}
+
 // The Logger options
 func (l *ZapLog) Options() core.Options {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
 	return l.opts
 }
 
@@ -0,0 +1,334 @@
+// Package cache provides a registry decorator which caches services
+package cache
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"xmicro/logger"
+	"xmicro/logger/core"
+	"xmicro/registry"
+)
+
+var (
+	// DefaultTTL is how long services are served from the cache
+	DefaultTTL = time.Minute
+	// DefaultSnapshotInterval is how often the cache is saved
+	DefaultSnapshotInterval = time.Minute
+)
+
+// Cache is a registry which serves GetService from a cache kept
+// up to date by watches. Cached services are served stale when
+// the registry fails.
+type Cache interface {
+	registry.Registry
+	// Stats returns the cache counters
+	Stats() Stats
+	// Stop the watches and save the last snapshot
+	Stop()
+}
+
+// Stats are the counters of a cache
+type Stats struct {
+	// Hits are lookups served from the cache
+	Hits uint64
+	// Misses are lookups fetched from the registry
+	Misses uint64
+	// Stale are lookups served from an expired entry
+	// because the registry returned an error
+	Stale uint64
+}
+
+type entry struct {
+	services []*registry.Service
+	expires  time.Time
+}
+
+type cache struct {
+	registry.Registry
+	opts Options
+
+	hits, misses, stale uint64
+
+	sync.RWMutex
+	// entries keyed by domain and service name
+	entries map[string]*entry
+	// running watches keyed like the entries
+	watched map[string]registry.Watcher
+	// changed since the last snapshot
+	dirty bool
+
+	exit chan bool
+	once sync.Once
+}
+
+// New returns a cache of the registry. A snapshot which was saved
+// before is loaded, its services are served when the registry can't
+// be reached.
+func New(r registry.Registry, opts ...Option) Cache {
+	options := Options{
+		TTL:              DefaultTTL,
+		SnapshotInterval: DefaultSnapshotInterval,
+	}
+	for _, o := range opts {
+		o(&options)
+	}
+
+	c := &cache{
+		Registry: r,
+		opts:     options,
+		entries:  make(map[string]*entry),
+		watched:  make(map[string]registry.Watcher),
+		exit:     make(chan bool),
+	}
+
+	if len(options.Snapshot) > 0 {
+		if err := c.load(); err != nil && !os.IsNotExist(err) {
+			logger.Warnf("[cache] failed to load snapshot %s: %v", options.Snapshot, err)
+		}
+		go c.run()
+	}
+
+	return c
+}
+
+func key(domain, service string) string {
+	return domain + "/" + service
+}
+
+func (c *cache) get(domain, service string) ([]*registry.Service, bool, bool) {
+	c.RLock()
+	defer c.RUnlock()
+
+	e, ok := c.entries[key(domain, service)]
+	if !ok {
+		return nil, false, false
+	}
+	return copyServices(e.services), ok, time.Now().Before(e.expires)
+}
+
+func (c *cache) set(domain, service string, services []*registry.Service) {
+	c.Lock()
+	c.entries[key(domain, service)] = &entry{
+		services: copyServices(services),
+		expires:  time.Now().Add(c.opts.TTL),
+	}
+	c.dirty = true
+	c.Unlock()
+}
+
+func (c *cache) GetService(service string, opts ...registry.GetOption) ([]*registry.Service, error) {
+	var options registry.GetOptions
+	for _, o := range opts {
+		o(&options)
+	}
+	if len(options.Domain) == 0 {
+		options.Domain = registry.DefaultDomain
+	}
+
+	cached, ok, fresh := c.get(options.Domain, service)
+	if ok && fresh {
+		atomic.AddUint64(&c.hits, 1)
+		return cached, nil
+	}
+
+	atomic.AddUint64(&c.misses, 1)
+
+	services, err := c.Registry.GetService(service, opts...)
+	switch {
+	case err == registry.ErrNotFound:
+		c.Lock()
+		delete(c.entries, key(options.Domain, service))
+		c.dirty = true
+		c.Unlock()
+		return nil, err
+	case err != nil:
+		if ok {
+			atomic.AddUint64(&c.stale, 1)
+			if logger.V(core.WarnLevel, logger.DefaultLogger) {
+				logger.Warnf("[cache] serving stale %s: %v", service, err)
+			}
+			return cached, nil
+		}
+		return nil, err
+	}
+
+	c.set(options.Domain, service, services)
+	c.watch(options.Domain, service)
+
+	return services, nil
+}
+
+// watch starts a watch of the service if there's none running
+func (c *cache) watch(domain, service string) {
+	k := key(domain, service)
+
+	c.Lock()
+	defer c.Unlock()
+
+	if _, ok := c.watched[k]; ok {
+		return
+	}
+
+	select {
+	case <-c.exit:
+		return
+	default:
+	}
+
+	w, err := c.Registry.Watch(registry.WatchService(service), registry.WatchDomain(domain))
+	if err != nil {
+		logger.Errorf("[cache] failed to watch %s: %v", service, err)
+		return
+	}
+	c.watched[k] = w
+
+	go c.update(k, w)
+}
+
+func (c *cache) update(k string, w registry.Watcher) {
+	defer func() {
+		w.Stop()
+
+		c.Lock()
+		delete(c.watched, k)
+		// nothing keeps the entry current anymore
+		if e, ok := c.entries[k]; ok {
+			e.expires = time.Time{}
+		}
+		c.Unlock()
+	}()
+
+	for {
+		res, err := w.Next()
+		if err != nil {
+			return
+		}
+		if res.Service == nil {
+			continue
+		}
+
+		c.Lock()
+		if e, ok := c.entries[k]; ok {
+			e.services = apply(e.services, res)
+			e.expires = time.Now().Add(c.opts.TTL)
+			c.dirty = true
+		}
+		c.Unlock()
+	}
+}
+
+// run saves the snapshot on every interval
+func (c *cache) run() {
+	t := time.NewTicker(c.opts.SnapshotInterval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+			if err := c.save(); err != nil {
+				logger.Errorf("[cache] failed to save snapshot %s: %v", c.opts.Snapshot, err)
+			}
+		case <-c.exit:
+			return
+		}
+	}
+}
+
+// save writes the cached services to the snapshot file if they changed
+func (c *cache) save() error {
+	c.Lock()
+	if !c.dirty {
+		c.Unlock()
+		return nil
+	}
+	snap := make(map[string][]*registry.Service, len(c.entries))
+	for k, e := range c.entries {
+		snap[k] = e.services
+	}
+	b, err := json.Marshal(snap)
+	c.dirty = false
+	c.Unlock()
+
+	if err != nil {
+		return err
+	}
+
+	// write to a temp file first so a crash never leaves half a snapshot
+	dir := filepath.Dir(c.opts.Snapshot)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(dir, filepath.Base(c.opts.Snapshot)+".*")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), c.opts.Snapshot)
+}
+
+// load reads the snapshot file. The loaded entries are expired so
+// they are only served when the registry fails.
+func (c *cache) load() error {
+	b, err := ioutil.ReadFile(c.opts.Snapshot)
+	if err != nil {
+		return err
+	}
+
+	var snap map[string][]*registry.Service
+	if err := json.Unmarshal(b, &snap); err != nil {
+		return err
+	}
+
+	c.Lock()
+	for k, services := range snap {
+		c.entries[k] = &entry{services: services}
+	}
+	c.Unlock()
+
+	return nil
+}
+
+func (c *cache) Stats() Stats {
+	return Stats{
+		Hits:   atomic.LoadUint64(&c.hits),
+		Misses: atomic.LoadUint64(&c.misses),
+		Stale:  atomic.LoadUint64(&c.stale),
+	}
+}
+
+func (c *cache) Stop() {
+	c.once.Do(func() {
+		close(c.exit)
+
+		c.Lock()
+		for _, w := range c.watched {
+			w.Stop()
+		}
+		c.Unlock()
+
+		if len(c.opts.Snapshot) == 0 {
+			return
+		}
+		if err := c.save(); err != nil {
+			logger.Errorf("[cache] failed to save snapshot %s: %v", c.opts.Snapshot, err)
+		}
+	})
+}
+
+func (c *cache) String() string {
+	return "cache"
+}
@@ -0,0 +1,112 @@
+package cache
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"xmicro/registry"
+	"xmicro/registry/memory"
+)
+
+// failing fails GetService when down is set
+type failing struct {
+	registry.Registry
+	down bool
+}
+
+func (f *failing) GetService(name string, opts ...registry.GetOption) ([]*registry.Service, error) {
+	if f.down {
+		return nil, errors.New("registry down")
+	}
+	return f.Registry.GetService(name, opts...)
+}
+
+func newService(ids ...string) *registry.Service {
+	s := &registry.Service{Name: "greeter", Version: "1.0.0"}
+	for _, id := range ids {
+		s.Nodes = append(s.Nodes, &registry.Node{Id: id, Address: id + ":8080"})
+	}
+	return s
+}
+
+func TestCache(t *testing.T) {
+	r := &failing{Registry: memory.NewRegistry()}
+	if err := r.Register(newService("a")); err != nil {
+		t.Fatal(err)
+	}
+
+	c := New(r, WithTTL(50*time.Millisecond))
+	defer c.Stop()
+
+	for i := 0; i < 2; i++ {
+		services, err := c.GetService("greeter")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(services) != 1 || len(services[0].Nodes) != 1 {
+			t.Fatalf("Unexpected services %+v", services)
+		}
+	}
+	if s := c.Stats(); s.Hits != 1 || s.Misses != 1 {
+		t.Fatalf("Unexpected stats %+v", s)
+	}
+
+	// the watch adds the new node to the cache
+	if err := r.Register(newService("b")); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(30 * time.Millisecond)
+
+	services, _ := c.GetService("greeter")
+	if len(services[0].Nodes) != 2 {
+		t.Fatalf("Expected 2 nodes got %d", len(services[0].Nodes))
+	}
+
+	// expired entries are served stale while the registry is down
+	r.down = true
+	time.Sleep(60 * time.Millisecond)
+
+	services, err := c.GetService("greeter")
+	if err != nil || len(services[0].Nodes) != 2 {
+		t.Fatalf("Expected stale services got %+v %v", services, err)
+	}
+	if s := c.Stats(); s.Stale != 1 {
+		t.Fatalf("Unexpected stats %+v", s)
+	}
+
+	if _, err := c.GetService("unknown"); err == nil {
+		t.Fatal("Expected error for uncached service")
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "registry.json")
+
+	r := &failing{Registry: memory.NewRegistry()}
+	if err := r.Register(newService("a")); err != nil {
+		t.Fatal(err)
+	}
+
+	c := New(r, WithSnapshot(file))
+	if _, err := c.GetService("greeter"); err != nil {
+		t.Fatal(err)
+	}
+	c.Stop()
+
+	// boot with the registry unavailable
+	c = New(&failing{Registry: memory.NewRegistry(), down: true}, WithSnapshot(file))
+	defer c.Stop()
+
+	services, err := c.GetService("greeter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(services) != 1 || services[0].Nodes[0].Id != "a" {
+		t.Fatalf("Unexpected services %+v", services)
+	}
+	if s := c.Stats(); s.Stale != 1 {
+		t.Fatalf("Unexpected stats %+v", s)
+	}
+}
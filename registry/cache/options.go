@@ -0,0 +1,36 @@
+package cache
+
+import "time"
+
+type Options struct {
+	// TTL of the cached services, after which
+	// they are fetched from the registry again
+	TTL time.Duration
+	// Snapshot is the file the cache is saved to and loaded from
+	Snapshot string
+	// SnapshotInterval is how often the cache is saved
+	SnapshotInterval time.Duration
+}
+
+type Option func(o *Options)
+
+// WithTTL sets the cache TTL
+func WithTTL(t time.Duration) Option {
+	return func(o *Options) {
+		o.TTL = t
+	}
+}
+
+// WithSnapshot saves the cache to the file and loads it on start
+func WithSnapshot(file string) Option {
+	return func(o *Options) {
+		o.Snapshot = file
+	}
+}
+
+// WithSnapshotInterval sets how often the snapshot is written
+func WithSnapshotInterval(t time.Duration) Option {
+	return func(o *Options) {
+		o.SnapshotInterval = t
+	}
+}
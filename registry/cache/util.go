@@ -0,0 +1,97 @@
+package cache
+
+import "xmicro/registry"
+
+func copyMap(m map[string]string) map[string]string {
+	if m == nil {
+		return nil
+	}
+	c := make(map[string]string, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
+}
+
+func copyService(s *registry.Service) *registry.Service {
+	c := *s
+	c.Metadata = copyMap(s.Metadata)
+
+	c.Nodes = make([]*registry.Node, len(s.Nodes))
+	for i, n := range s.Nodes {
+		node := *n
+		node.Metadata = copyMap(n.Metadata)
+		c.Nodes[i] = &node
+	}
+
+	// endpoints are never modified so they are shared
+	c.Endpoints = make([]*registry.Endpoint, len(s.Endpoints))
+	copy(c.Endpoints, s.Endpoints)
+
+	return &c
+}
+
+func copyServices(services []*registry.Service) []*registry.Service {
+	c := make([]*registry.Service, len(services))
+	for i, s := range services {
+		c[i] = copyService(s)
+	}
+	return c
+}
+
+// apply returns the services with the nodes of the watch result
+// added or removed. A delete without nodes removes the version.
+func apply(services []*registry.Service, res *registry.Result) []*registry.Service {
+	var cur *registry.Service
+	var idx int
+	for i, s := range services {
+		if s.Version == res.Service.Version {
+			cur, idx = s, i
+			break
+		}
+	}
+
+	switch res.Action {
+	case "create", "update":
+		if cur == nil {
+			return append(services, copyService(res.Service))
+		}
+
+		s := copyService(res.Service)
+		nodes := make(map[string]bool, len(s.Nodes))
+		for _, n := range s.Nodes {
+			nodes[n.Id] = true
+		}
+		// keep the nodes which aren't part of the result
+		for _, n := range cur.Nodes {
+			if !nodes[n.Id] {
+				s.Nodes = append(s.Nodes, n)
+			}
+		}
+		services[idx] = s
+	case "delete":
+		if cur == nil {
+			return services
+		}
+
+		var nodes []*registry.Node
+		if len(res.Service.Nodes) > 0 {
+			deleted := make(map[string]bool, len(res.Service.Nodes))
+			for _, n := range res.Service.Nodes {
+				deleted[n.Id] = true
+			}
+			for _, n := range cur.Nodes {
+				if !deleted[n.Id] {
+					nodes = append(nodes, n)
+				}
+			}
+		}
+
+		if len(nodes) == 0 {
+			return append(services[:idx:idx], services[idx+1:]...)
+		}
+		cur.Nodes = nodes
+	}
+
+	return services
+}
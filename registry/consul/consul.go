@@ -0,0 +1,509 @@
+// Package consul provides a consul registry. Every node is registered as
+// a consul service instance with a ttl, http or grpc health check.
+package consul
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"net"
+	"net/http"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	consul "github.com/hashicorp/consul/api"
+)
+
+import (
+	"xmicro/common"
+	"xmicro/common/component"
+	"xmicro/common/constant"
+	"xmicro/registry"
+	mnet "xmicro/util/net"
+)
+
+func init() {
+	component.SetRegistryFactory(constant.CONSUL_KEY, &consulRegistryFactory{})
+}
+
+type consulRegistryFactory struct {
+}
+
+func (f *consulRegistryFactory) GetRegistry(url *common.URL) (registry.Registry, error) {
+	timeout := url.GetParam(constant.RegistryTimeoutKey, "5s")
+	timeDuration := constant.DefaultTimeout * time.Millisecond
+	if d, err := time.ParseDuration(timeout); err == nil {
+		timeDuration = d
+	}
+
+	config := consul.DefaultConfig()
+	config.Token = url.GetParam(constant.ACL_TOKEN, "")
+	if len(url.Username) > 0 {
+		config.HttpAuth = &consul.HttpBasicAuth{
+			Username: url.Username,
+			Password: url.Password,
+		}
+	}
+
+	opts := []registry.Option{
+		registry.Addrs(strings.Split(url.Location, ",")...),
+		registry.Timeout(timeDuration),
+		Config(config),
+		Namespace(url.GetParam(constant.CONSUL_NAMESPACE, "")),
+		Datacenter(url.GetParam(constant.CONSUL_DATACENTER, "")),
+	}
+
+	if d, err := time.ParseDuration(url.GetParam(constant.DEREGISTER_AFTER, constant.DEFAULT_DEREGISTER_TIME)); err == nil {
+		opts = append(opts, DeregisterCriticalAfter(d))
+	}
+
+	checkOpts, err := checkOptions(url)
+	if err != nil {
+		return nil, err
+	}
+	opts = append(opts, checkOpts...)
+
+	return NewRegistry(opts...), nil
+}
+
+// checkOptions returns the health check options of the url params
+func checkOptions(url *common.URL) ([]registry.Option, error) {
+	kind := url.GetParam(constant.CONSUL_CHECK, "ttl")
+	if kind == "ttl" {
+		return nil, nil
+	}
+
+	interval, err := time.ParseDuration(url.GetParam(constant.CONSUL_CHECK_INTERVAL, constant.DEFAULT_CHECK_INTERVAL))
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %v", constant.CONSUL_CHECK_INTERVAL, err)
+	}
+
+	var opts []registry.Option
+	switch kind {
+	case "http":
+		opts = append(opts, HTTPCheck(url.GetParam(constant.CONSUL_CHECK_PATH, constant.DEFAULT_CHECK_PATH), interval))
+	case "grpc":
+		opts = append(opts, GRPCCheck(interval))
+	default:
+		return nil, fmt.Errorf("unknown %s %q, use ttl, http or grpc", constant.CONSUL_CHECK, kind)
+	}
+
+	if p := url.GetParam(constant.CONSUL_CHECK_PORT, ""); p != "" {
+		port, err := strconv.Atoi(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s %q", constant.CONSUL_CHECK_PORT, p)
+		}
+		opts = append(opts, CheckPort(port))
+	}
+	return opts, nil
+}
+
+type consulRegistry struct {
+	Address []string
+	opts    registry.Options
+
+	// guards the client, created on first use
+	clientMu sync.Mutex
+	client   *consul.Client
+	config   *consul.Config
+
+	// health check of the nodes, a ttl check if nil
+	check *check
+	// port of the http or grpc check, the port of the node if 0
+	checkPort int
+	// deregister nodes which are critical for longer
+	deregister time.Duration
+
+	sync.Mutex
+	// hash of the registered nodes by id
+	register map[string]uint64
+}
+
+func newTransport(config *tls.Config) *http.Transport {
+	if config == nil {
+		config = &tls.Config{
+			InsecureSkipVerify: true,
+		}
+	}
+
+	t := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		Dial: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).Dial,
+		TLSHandshakeTimeout: 10 * time.Second,
+		TLSClientConfig:     config,
+	}
+	runtime.SetFinalizer(&t, func(tr **http.Transport) {
+		(*tr).CloseIdleConnections()
+	})
+	return t
+}
+
+func configure(c *consulRegistry, opts ...registry.Option) {
+	for _, o := range opts {
+		o(&c.opts)
+	}
+
+	// use default non pooled config
+	config := consul.DefaultNonPooledConfig()
+
+	if c.opts.Context != nil {
+		// Use the consul config passed in the options, if available
+		if co, ok := c.opts.Context.Value(configKey{}).(*consul.Config); ok {
+			config = co
+		}
+		if ns, ok := c.opts.Context.Value(namespaceKey{}).(string); ok && len(ns) > 0 {
+			config.Namespace = ns
+		}
+		if dc, ok := c.opts.Context.Value(datacenterKey{}).(string); ok && len(dc) > 0 {
+			config.Datacenter = dc
+		}
+		if ch, ok := c.opts.Context.Value(checkKey{}).(*check); ok {
+			c.check = ch
+		}
+		if d, ok := c.opts.Context.Value(deregisterKey{}).(time.Duration); ok {
+			c.deregister = d
+		}
+		if p, ok := c.opts.Context.Value(checkPortKey{}).(int); ok {
+			c.checkPort = p
+		}
+	}
+
+	// check if there are any addrs
+	var addrs []string
+
+	// iterate the options addresses
+	for _, address := range c.opts.Addrs {
+		if len(address) == 0 {
+			continue
+		}
+		// check we have a port
+		addr, port, err := net.SplitHostPort(address)
+		if ae, ok := err.(*net.AddrError); ok && ae.Err == "missing port in address" {
+			port = "8500"
+			addr = address
+			addrs = append(addrs, net.JoinHostPort(addr, port))
+		} else if err == nil {
+			addrs = append(addrs, net.JoinHostPort(addr, port))
+		}
+	}
+
+	// set the addrs
+	if len(addrs) > 0 {
+		c.Address = addrs
+		config.Address = c.Address[0]
+	}
+
+	if config.HttpClient == nil {
+		config.HttpClient = new(http.Client)
+	}
+
+	// requires secure connection?
+	if c.opts.Secure || c.opts.TLSConfig != nil {
+		config.Scheme = "https"
+		// We're going to support InsecureSkipVerify
+		config.HttpClient.Transport = newTransport(c.opts.TLSConfig)
+	}
+
+	// set timeout
+	if c.opts.Timeout > 0 {
+		config.HttpClient.Timeout = c.opts.Timeout
+	}
+
+	// set the config and remove the client
+	c.clientMu.Lock()
+	c.config = config
+	c.client = nil
+	c.clientMu.Unlock()
+
+	// setup the client
+	c.Client()
+}
+
+func (c *consulRegistry) Init(opts ...registry.Option) error {
+	configure(c, opts...)
+	return nil
+}
+
+func (c *consulRegistry) Deregister(s *registry.Service, opts ...registry.DeregisterOption) error {
+	if len(s.Nodes) == 0 {
+		return errors.New("Require at least one node")
+	}
+
+	for _, node := range s.Nodes {
+		// delete our hash and time check of the service
+		c.Lock()
+		delete(c.register, node.Id)
+		c.Unlock()
+
+		if err := c.Client().Agent().ServiceDeregister(node.Id); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *consulRegistry) Register(s *registry.Service, opts ...registry.RegisterOption) error {
+	if len(s.Nodes) == 0 {
+		return errors.New("Require at least one node")
+	}
+
+	var options registry.RegisterOptions
+	for _, o := range opts {
+		o(&options)
+	}
+
+	// the domain is kept in the service metadata
+	s = registry.WithDomain(s, options.Domain)
+
+	for _, node := range s.Nodes {
+		if err := c.registerNode(s, node, options); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *consulRegistry) registerNode(s *registry.Service, node *registry.Node, options registry.RegisterOptions) error {
+	tags, meta := encode(s, node)
+
+	// create hash of service; uint64
+	h := fnv.New64a()
+	fmt.Fprint(h, s.Name, tags, meta, node.Address, options.TTL)
+	sum := h.Sum64()
+
+	ttlCheck := c.check == nil && options.TTL > 0
+
+	// get existing hash and last checked time
+	c.Lock()
+	v, ok := c.register[node.Id]
+	c.Unlock()
+
+	// if it's already registered and matches then just pass the check
+	if ok && v == sum {
+		if !ttlCheck {
+			return nil
+		}
+		// if the err is nil we're all good, bail out
+		// if not, we don't know what the state is, so full re-register
+		if err := c.Client().Agent().PassTTL("service:"+node.Id, ""); err == nil {
+			return nil
+		}
+	}
+
+	host, pt, err := net.SplitHostPort(node.Address)
+	if err != nil {
+		return err
+	}
+	port, _ := strconv.Atoi(pt)
+
+	// the health endpoint may be served on its own port
+	checkAddress := mnet.HostPort(host, port)
+	if c.checkPort > 0 {
+		checkAddress = mnet.HostPort(host, c.checkPort)
+	}
+
+	var check *consul.AgentServiceCheck
+
+	switch {
+	case c.check != nil && c.check.grpc:
+		check = &consul.AgentServiceCheck{
+			GRPC:     checkAddress,
+			Interval: c.check.interval.String(),
+		}
+	case c.check != nil:
+		check = &consul.AgentServiceCheck{
+			HTTP:     "http://" + checkAddress + c.check.path,
+			Interval: c.check.interval.String(),
+		}
+	case ttlCheck:
+		check = &consul.AgentServiceCheck{
+			TTL: options.TTL.String(),
+		}
+	}
+
+	if check != nil && c.deregister > 0 {
+		check.DeregisterCriticalServiceAfter = c.deregister.String()
+	}
+
+	// register the service
+	asr := &consul.AgentServiceRegistration{
+		ID:        node.Id,
+		Name:      s.Name,
+		Tags:      tags,
+		Port:      port,
+		Address:   host,
+		Meta:      meta,
+		Check:     check,
+		Namespace: c.config.Namespace,
+	}
+
+	if err := c.Client().Agent().ServiceRegister(asr); err != nil {
+		return err
+	}
+
+	// save our hash and time check of the service
+	c.Lock()
+	c.register[node.Id] = sum
+	c.Unlock()
+
+	// if the TTL is 0 we don't mess with the checks
+	if !ttlCheck {
+		return nil
+	}
+
+	// pass the healthcheck
+	return c.Client().Agent().PassTTL("service:"+node.Id, "")
+}
+
+// services queries the passing nodes of a service in the domain grouped by domain and version
+func (c *consulRegistry) services(name, domain string, q *consul.QueryOptions) ([]*registry.Service, *consul.QueryMeta, error) {
+	rsp, meta, err := c.Client().Health().Service(name, "", true, q)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	serviceMap := map[string]*registry.Service{}
+
+	for _, s := range rsp {
+		if s.Service.Service != name {
+			continue
+		}
+
+		// address is service address
+		address := s.Service.Address
+
+		// use node address
+		if len(address) == 0 {
+			address = s.Node.Address
+		}
+
+		sn := decode(name, s.Service.ID, mnet.HostPort(address, s.Service.Port), s.Service.Tags, s.Service.Meta)
+		if !registry.MatchDomain(domain, registry.Domain(sn)) {
+			continue
+		}
+
+		key := registry.Domain(sn) + "/" + sn.Version
+		svc, ok := serviceMap[key]
+		if !ok {
+			serviceMap[key] = sn
+			continue
+		}
+
+		svc.Nodes = append(svc.Nodes, sn.Nodes...)
+	}
+
+	var services []*registry.Service
+	for _, service := range serviceMap {
+		services = append(services, service)
+	}
+
+	sort.Slice(services, func(i, j int) bool { return services[i].Version < services[j].Version })
+
+	return services, meta, nil
+}
+
+func (c *consulRegistry) GetService(name string, opts ...registry.GetOption) ([]*registry.Service, error) {
+	var options registry.GetOptions
+	for _, o := range opts {
+		o(&options)
+	}
+
+	services, _, err := c.services(name, options.Domain, &consul.QueryOptions{})
+	if err != nil {
+		return nil, err
+	}
+	if len(services) == 0 {
+		return nil, registry.ErrNotFound
+	}
+	return services, nil
+}
+
+func (c *consulRegistry) ListServices(opts ...registry.ListOption) ([]*registry.Service, error) {
+	var options registry.ListOptions
+	for _, o := range opts {
+		o(&options)
+	}
+
+	rsp, _, err := c.Client().Catalog().Services(&consul.QueryOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	var services []*registry.Service
+
+	for service, tags := range rsp {
+		if !matchTags(options.Domain, tags) {
+			continue
+		}
+		services = append(services, &registry.Service{Name: service})
+	}
+
+	sort.Slice(services, func(i, j int) bool { return services[i].Name < services[j].Name })
+
+	return services, nil
+}
+
+func (c *consulRegistry) Watch(opts ...registry.WatchOption) (registry.Watcher, error) {
+	return newConsulWatcher(c, opts...)
+}
+
+func (c *consulRegistry) String() string {
+	return "consul"
+}
+
+func (c *consulRegistry) Options() registry.Options {
+	return c.opts
+}
+
+func (c *consulRegistry) Client() *consul.Client {
+	c.clientMu.Lock()
+	defer c.clientMu.Unlock()
+
+	if c.client != nil {
+		return c.client
+	}
+
+	for _, addr := range c.Address {
+		// set the address
+		c.config.Address = addr
+
+		// create a new client
+		tmpClient, _ := consul.NewClient(c.config)
+
+		// test the client
+		_, err := tmpClient.Agent().Host()
+		if err != nil {
+			continue
+		}
+
+		// set the client
+		c.client = tmpClient
+		return c.client
+	}
+
+	// set the default
+	c.client, _ = consul.NewClient(c.config)
+
+	// return the client
+	return c.client
+}
+
+// NewRegistry returns a consul registry
+func NewRegistry(opts ...registry.Option) registry.Registry {
+	cr := &consulRegistry{
+		opts:     registry.Options{},
+		register: make(map[string]uint64),
+	}
+	configure(cr, opts...)
+	return cr
+}
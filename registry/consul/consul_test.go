@@ -0,0 +1,318 @@
+package consul
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	consul "github.com/hashicorp/consul/api"
+
+	"xmicro/common"
+	"xmicro/registry"
+)
+
+// agent is a single node consul stand-in serving the endpoints used by
+// the registry, with blocking queries on the catalog index
+type agent struct {
+	sync.Mutex
+	index    uint64
+	services map[string]*consul.AgentServiceRegistration
+	changed  chan bool
+}
+
+func newAgent() *agent {
+	return &agent{
+		index:    1,
+		services: make(map[string]*consul.AgentServiceRegistration),
+		changed:  make(chan bool),
+	}
+}
+
+func (a *agent) bump() {
+	a.index++
+	close(a.changed)
+	a.changed = make(chan bool)
+}
+
+// block waits for a change past the index of the query
+func (a *agent) block(r *http.Request) {
+	index, _ := strconv.ParseUint(r.URL.Query().Get("index"), 10, 64)
+
+	a.Lock()
+	if index < a.index {
+		a.Unlock()
+		return
+	}
+	changed := a.changed
+	a.Unlock()
+
+	select {
+	case <-changed:
+	case <-r.Context().Done():
+	case <-time.After(5 * time.Second):
+	}
+}
+
+func (a *agent) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.URL.Path == "/v1/agent/service/register":
+		var asr consul.AgentServiceRegistration
+		json.NewDecoder(r.Body).Decode(&asr)
+		a.Lock()
+		a.services[asr.ID] = &asr
+		a.bump()
+		a.Unlock()
+	case strings.HasPrefix(r.URL.Path, "/v1/agent/service/deregister/"):
+		a.Lock()
+		delete(a.services, strings.TrimPrefix(r.URL.Path, "/v1/agent/service/deregister/"))
+		a.bump()
+		a.Unlock()
+	case strings.HasPrefix(r.URL.Path, "/v1/agent/check/pass/"):
+	case r.URL.Path == "/v1/agent/host":
+		w.Write([]byte("{}"))
+	case r.URL.Path == "/v1/catalog/services":
+		a.block(r)
+		a.Lock()
+		rsp := make(map[string][]string)
+		// the tags of all nodes of a service are merged
+		for _, s := range a.services {
+			rsp[s.Name] = append(rsp[s.Name], s.Tags...)
+		}
+		a.write(w, rsp)
+		a.Unlock()
+	case strings.HasPrefix(r.URL.Path, "/v1/health/service/"):
+		a.block(r)
+		name := strings.TrimPrefix(r.URL.Path, "/v1/health/service/")
+		a.Lock()
+		var rsp []*consul.ServiceEntry
+		for _, s := range a.services {
+			if s.Name != name {
+				continue
+			}
+			rsp = append(rsp, &consul.ServiceEntry{
+				Node: &consul.Node{Address: "127.0.0.1"},
+				Service: &consul.AgentService{
+					ID:      s.ID,
+					Service: s.Name,
+					Tags:    s.Tags,
+					Meta:    s.Meta,
+					Address: s.Address,
+					Port:    s.Port,
+				},
+			})
+		}
+		a.write(w, rsp)
+		a.Unlock()
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (a *agent) write(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("X-Consul-Index", strconv.FormatUint(a.index, 10))
+	json.NewEncoder(w).Encode(v)
+}
+
+func newRegistry(t *testing.T) (registry.Registry, *agent) {
+	a := newAgent()
+	srv := httptest.NewServer(a)
+	t.Cleanup(srv.Close)
+	return NewRegistry(registry.Addrs(strings.TrimPrefix(srv.URL, "http://"))), a
+}
+
+func testService(id string) *registry.Service {
+	return &registry.Service{
+		Name:     "greeter",
+		Version:  "1.0.0",
+		Metadata: map[string]string{"domain": "micro"},
+		Endpoints: []*registry.Endpoint{
+			{Name: "Greeter.Hello", Metadata: map[string]string{"stream": "false"}},
+		},
+		Nodes: []*registry.Node{
+			{Id: id, Address: "10.0.0.1:8080", Metadata: map[string]string{"protocol": "rpc", "micro.mu/zone": "a"}},
+		},
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	r, a := newRegistry(t)
+
+	if err := r.Register(testService("greeter-1"), registry.RegisterTTL(10*time.Second)); err != nil {
+		t.Fatal(err)
+	}
+
+	a.Lock()
+	asr := a.services["greeter-1"]
+	a.Unlock()
+	if asr == nil || asr.Check == nil || asr.Check.TTL != "10s" {
+		t.Fatalf("Expected a ttl check got %+v", asr)
+	}
+
+	services, err := r.GetService("greeter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(services) != 1 || len(services[0].Nodes) != 1 {
+		t.Fatalf("Unexpected services %+v", services)
+	}
+
+	s := services[0]
+	node := s.Nodes[0]
+	if s.Version != "1.0.0" || s.Metadata["domain"] != "micro" || len(s.Endpoints) != 1 || s.Endpoints[0].Name != "Greeter.Hello" {
+		t.Fatalf("Unexpected service %+v", s)
+	}
+	if node.Address != "10.0.0.1:8080" || node.Metadata["protocol"] != "rpc" || node.Metadata["micro.mu/zone"] != "a" {
+		t.Fatalf("Unexpected node %+v", node)
+	}
+
+	if err := r.Deregister(testService("greeter-1")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.GetService("greeter"); err != registry.ErrNotFound {
+		t.Fatalf("Expected not found got %v", err)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	a := newAgent()
+	srv := httptest.NewServer(a)
+	defer srv.Close()
+
+	for _, tc := range []struct {
+		params string
+		http   string
+		grpc   string
+	}{
+		{params: "consul-check=http", http: "http://10.0.0.1:8080/health"},
+		{params: "consul-check=http&consul-check-path=/ready&consul-check-port=9090", http: "http://10.0.0.1:9090/ready"},
+		{params: "consul-check=grpc&consul-check-port=9090&consul-check-interval=5s", grpc: "10.0.0.1:9090"},
+	} {
+		u, err := common.NewURL(srv.URL + "?" + tc.params)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r, err := (&consulRegistryFactory{}).GetRegistry(u)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := r.Register(testService("greeter-1")); err != nil {
+			t.Fatal(err)
+		}
+
+		a.Lock()
+		check := a.services["greeter-1"].Check
+		a.Unlock()
+		if check == nil || check.HTTP != tc.http || check.GRPC != tc.grpc {
+			t.Fatalf("Unexpected check of %s %+v", tc.params, check)
+		}
+	}
+
+	u, _ := common.NewURL(srv.URL + "?consul-check=tcp")
+	if _, err := (&consulRegistryFactory{}).GetRegistry(u); err == nil {
+		t.Fatal("Expected an unknown check error")
+	}
+}
+
+func TestClientConcurrent(t *testing.T) {
+	r, _ := newRegistry(t)
+	c := r.(*consulRegistry)
+	c.client = nil
+
+	// the client is created once by the concurrent callers
+	var wg sync.WaitGroup
+	clients := make([]*consul.Client, 8)
+	for i := range clients {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			clients[i] = c.Client()
+		}(i)
+	}
+	wg.Wait()
+
+	for _, client := range clients {
+		if client != clients[0] {
+			t.Fatal("Expected the same client")
+		}
+	}
+}
+
+func TestWatcher(t *testing.T) {
+	r, _ := newRegistry(t)
+
+	w, err := r.Watch()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Stop()
+
+	next := func(action, id string) {
+		res, err := w.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Action != action || res.Service.Nodes[0].Id != id {
+			t.Fatalf("Expected %s of %s got %s %+v", action, id, res.Action, res.Service.Nodes[0])
+		}
+	}
+
+	if err := r.Register(testService("greeter-1")); err != nil {
+		t.Fatal(err)
+	}
+	next("create", "greeter-1")
+
+	svc := testService("greeter-1")
+	svc.Nodes[0].Metadata["weight"] = "10"
+	if err := r.Register(svc); err != nil {
+		t.Fatal(err)
+	}
+	next("update", "greeter-1")
+
+	if err := r.Deregister(svc); err != nil {
+		t.Fatal(err)
+	}
+	next("delete", "greeter-1")
+}
+
+func TestDomain(t *testing.T) {
+	r, _ := newRegistry(t)
+
+	if err := r.Register(testService("greeter-1")); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Register(testService("greeter-2"), registry.RegisterDomain("staging")); err != nil {
+		t.Fatal(err)
+	}
+
+	services, err := r.GetService("greeter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(services) != 1 || services[0].Nodes[0].Id != "greeter-1" {
+		t.Fatalf("Expected the node of the default domain got %+v", services)
+	}
+
+	services, err = r.GetService("greeter", registry.GetDomain(registry.WildcardDomain))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(services) != 2 {
+		t.Fatalf("Expected a service per domain got %d", len(services))
+	}
+
+	list, err := r.ListServices(registry.ListDomain("staging"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 {
+		t.Fatalf("Expected the service in staging got %+v", list)
+	}
+	if list, _ := r.ListServices(registry.ListDomain("dev")); len(list) != 0 {
+		t.Fatalf("Expected no services in dev got %+v", list)
+	}
+}
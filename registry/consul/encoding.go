@@ -0,0 +1,111 @@
+package consul
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+
+	"xmicro/registry"
+)
+
+const (
+	// tags carrying what consul meta can't hold
+	endpointTag = "e-"
+	metadataTag = "m-"
+	serviceTag  = "s-"
+
+	versionMeta = "version"
+)
+
+var (
+	// valid consul meta keys
+	metaKeyRe = regexp.MustCompile("^[A-Za-z0-9_-]{1,128}$")
+)
+
+// encode maps the node of a service to consul tags and meta
+func encode(s *registry.Service, node *registry.Node) ([]string, map[string]string) {
+	var tags []string
+	meta := make(map[string]string, len(node.Metadata)+1)
+
+	for k, v := range node.Metadata {
+		if metaKeyRe.MatchString(k) && k != versionMeta {
+			meta[k] = v
+			continue
+		}
+		tags = append(tags, metadataTag+k+"="+v)
+	}
+	meta[versionMeta] = s.Version
+
+	for k, v := range s.Metadata {
+		tags = append(tags, serviceTag+k+"="+v)
+	}
+
+	for _, e := range s.Endpoints {
+		if b, err := json.Marshal(e); err == nil {
+			tags = append(tags, endpointTag+string(b))
+		}
+	}
+
+	return tags, meta
+}
+
+// decode rebuilds the service with a single node from consul tags and meta
+func decode(name, id, address string, tags []string, meta map[string]string) *registry.Service {
+	s := &registry.Service{
+		Name:     name,
+		Version:  meta[versionMeta],
+		Metadata: make(map[string]string),
+	}
+
+	node := &registry.Node{
+		Id:       id,
+		Address:  address,
+		Metadata: make(map[string]string, len(meta)),
+	}
+
+	for k, v := range meta {
+		if k != versionMeta {
+			node.Metadata[k] = v
+		}
+	}
+
+	for _, tag := range tags {
+		switch {
+		case strings.HasPrefix(tag, endpointTag):
+			var e *registry.Endpoint
+			if err := json.Unmarshal([]byte(tag[len(endpointTag):]), &e); err == nil {
+				s.Endpoints = append(s.Endpoints, e)
+			}
+		case strings.HasPrefix(tag, metadataTag):
+			if kv := strings.SplitN(tag[len(metadataTag):], "=", 2); len(kv) == 2 {
+				node.Metadata[kv[0]] = kv[1]
+			}
+		case strings.HasPrefix(tag, serviceTag):
+			if kv := strings.SplitN(tag[len(serviceTag):], "=", 2); len(kv) == 2 {
+				s.Metadata[kv[0]] = kv[1]
+			}
+		}
+	}
+
+	s.Nodes = []*registry.Node{node}
+	return s
+}
+
+// matchTags reports whether a service with the catalog tags has nodes in the domain
+func matchTags(domain string, tags []string) bool {
+	prefix := serviceTag + registry.DomainKey + "="
+
+	var tagged bool
+	for _, tag := range tags {
+		if !strings.HasPrefix(tag, prefix) {
+			continue
+		}
+		tagged = true
+		if registry.MatchDomain(domain, tag[len(prefix):]) {
+			return true
+		}
+	}
+
+	// services registered without a domain are in the default one
+	return !tagged && registry.MatchDomain(domain, registry.DefaultDomain)
+}
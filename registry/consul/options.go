@@ -0,0 +1,71 @@
+package consul
+
+import (
+	"context"
+	"time"
+
+	consul "github.com/hashicorp/consul/api"
+
+	"xmicro/registry"
+)
+
+type configKey struct{}
+type namespaceKey struct{}
+type datacenterKey struct{}
+type checkKey struct{}
+type deregisterKey struct{}
+type checkPortKey struct{}
+
+// check describes the health check registered with every node
+type check struct {
+	// http path of the health endpoint, empty for grpc
+	path     string
+	grpc     bool
+	interval time.Duration
+}
+
+func setRegistryOption(k, v interface{}) registry.Option {
+	return func(o *registry.Options) {
+		if o.Context == nil {
+			o.Context = context.Background()
+		}
+		o.Context = context.WithValue(o.Context, k, v)
+	}
+}
+
+// Config sets the consul client config
+func Config(c *consul.Config) registry.Option {
+	return setRegistryOption(configKey{}, c)
+}
+
+// Namespace scopes the registry to a consul namespace (Enterprise only)
+func Namespace(ns string) registry.Option {
+	return setRegistryOption(namespaceKey{}, ns)
+}
+
+// Datacenter queries services of the datacenter instead of the agent's one
+func Datacenter(dc string) registry.Option {
+	return setRegistryOption(datacenterKey{}, dc)
+}
+
+// HTTPCheck registers an http check calling the path on the node address.
+// Nodes use a ttl check refreshed on registration by default.
+func HTTPCheck(path string, interval time.Duration) registry.Option {
+	return setRegistryOption(checkKey{}, &check{path: path, interval: interval})
+}
+
+// GRPCCheck registers a check calling the grpc health service of the node
+func GRPCCheck(interval time.Duration) registry.Option {
+	return setRegistryOption(checkKey{}, &check{grpc: true, interval: interval})
+}
+
+// CheckPort points the http and grpc checks at the port instead of the
+// port of the node, e.g. when the health endpoint is served apart
+func CheckPort(port int) registry.Option {
+	return setRegistryOption(checkPortKey{}, port)
+}
+
+// DeregisterCriticalAfter removes nodes which fail their check for the duration
+func DeregisterCriticalAfter(d time.Duration) registry.Option {
+	return setRegistryOption(deregisterKey{}, d)
+}
@@ -0,0 +1,231 @@
+package consul
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	consul "github.com/hashicorp/consul/api"
+
+	"xmicro/logger"
+	"xmicro/registry"
+)
+
+var (
+	// delay before a failed blocking query is retried
+	retryDelay = time.Second
+)
+
+// consulWatcher runs a blocking query per watched service and
+// turns the changes of its passing nodes into registry results
+type consulWatcher struct {
+	r      *consulRegistry
+	wo     registry.WatchOptions
+	next   chan *registry.Result
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	sync.Mutex
+	// the last seen nodes by service name and node id
+	nodes map[string]map[string]*registry.Service
+	// stops the query of a service
+	watchers map[string]context.CancelFunc
+}
+
+func newConsulWatcher(cr *consulRegistry, opts ...registry.WatchOption) (registry.Watcher, error) {
+	var wo registry.WatchOptions
+	for _, o := range opts {
+		o(&wo)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	cw := &consulWatcher{
+		r:        cr,
+		wo:       wo,
+		next:     make(chan *registry.Result, 10),
+		ctx:      ctx,
+		cancel:   cancel,
+		nodes:    make(map[string]map[string]*registry.Service),
+		watchers: make(map[string]context.CancelFunc),
+	}
+
+	if len(wo.Service) > 0 {
+		go cw.watchService(ctx, wo.Service)
+	} else {
+		go cw.watchServices()
+	}
+
+	return cw, nil
+}
+
+// wait blocks for the retry delay, returns false when the context is done
+func wait(ctx context.Context) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(retryDelay):
+		return true
+	}
+}
+
+// nextIndex returns the wait index of the next blocking query
+func nextIndex(index, last uint64) uint64 {
+	// the index went backwards, start over
+	if last < index {
+		return 0
+	}
+	return last
+}
+
+func (cw *consulWatcher) watchService(ctx context.Context, name string) {
+	var index uint64
+
+	for {
+		q := &consul.QueryOptions{WaitIndex: index}
+
+		services, meta, err := cw.r.services(name, cw.wo.Domain, q.WithContext(ctx))
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			logger.Errorf("[consul] watch of service %s failed: %v", name, err)
+			if !wait(ctx) {
+				return
+			}
+			continue
+		}
+
+		index = nextIndex(index, meta.LastIndex)
+		cw.update(ctx, name, services)
+	}
+}
+
+// watchServices follows the catalog and watches every service in it
+func (cw *consulWatcher) watchServices() {
+	var index uint64
+
+	for {
+		q := &consul.QueryOptions{WaitIndex: index}
+
+		rsp, meta, err := cw.r.Client().Catalog().Services(q.WithContext(cw.ctx))
+		if cw.ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			logger.Errorf("[consul] watch of services failed: %v", err)
+			if !wait(cw.ctx) {
+				return
+			}
+			continue
+		}
+
+		index = nextIndex(index, meta.LastIndex)
+
+		var removed []string
+
+		cw.Lock()
+		for name := range rsp {
+			if _, ok := cw.watchers[name]; ok {
+				continue
+			}
+			ctx, cancel := context.WithCancel(cw.ctx)
+			cw.watchers[name] = cancel
+			go cw.watchService(ctx, name)
+		}
+		for name, cancel := range cw.watchers {
+			if _, ok := rsp[name]; ok {
+				continue
+			}
+			cancel()
+			delete(cw.watchers, name)
+			removed = append(removed, name)
+		}
+		cw.Unlock()
+
+		// the nodes of a deregistered service are gone
+		for _, name := range removed {
+			cw.update(cw.ctx, name, nil)
+		}
+	}
+}
+
+// update diffs the nodes of the service against the last seen ones
+func (cw *consulWatcher) update(ctx context.Context, name string, services []*registry.Service) {
+	cur := make(map[string]*registry.Service)
+	for _, s := range services {
+		for _, node := range s.Nodes {
+			cur[node.Id] = &registry.Service{
+				Name:      s.Name,
+				Version:   s.Version,
+				Metadata:  s.Metadata,
+				Endpoints: s.Endpoints,
+				Nodes:     []*registry.Node{node},
+			}
+		}
+	}
+
+	cw.Lock()
+	// the query was stopped while waiting
+	if ctx.Err() != nil {
+		cw.Unlock()
+		return
+	}
+	prev := cw.nodes[name]
+	if len(cur) > 0 {
+		cw.nodes[name] = cur
+	} else {
+		delete(cw.nodes, name)
+	}
+	cw.Unlock()
+
+	var results []*registry.Result
+
+	for _, id := range sortedKeys(cur) {
+		p, ok := prev[id]
+		switch {
+		case !ok:
+			results = append(results, &registry.Result{Action: "create", Service: cur[id]})
+		case !reflect.DeepEqual(p, cur[id]):
+			results = append(results, &registry.Result{Action: "update", Service: cur[id]})
+		}
+	}
+
+	for _, id := range sortedKeys(prev) {
+		if _, ok := cur[id]; !ok {
+			results = append(results, &registry.Result{Action: "delete", Service: prev[id]})
+		}
+	}
+
+	for _, r := range results {
+		select {
+		case cw.next <- r:
+		case <-cw.ctx.Done():
+			return
+		}
+	}
+}
+
+func sortedKeys(m map[string]*registry.Service) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (cw *consulWatcher) Next() (*registry.Result, error) {
+	select {
+	case r := <-cw.next:
+		return r, nil
+	case <-cw.ctx.Done():
+		return nil, registry.ErrWatcherStopped
+	}
+}
+
+func (cw *consulWatcher) Stop() {
+	cw.cancel()
+}
@@ -0,0 +1,236 @@
+// Package debounce provides a registry watcher which coalesces bursts of
+// results. The results of a burst are applied to the known nodes and only
+// the difference to the state last sent is emitted, a result per node.
+package debounce
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"xmicro/registry"
+)
+
+var (
+	// DefaultWindow is how long to wait for more results of a burst
+	DefaultWindow = 100 * time.Millisecond
+	// DefaultMaxDelay is the longest a burst is held back
+	DefaultMaxDelay = time.Second
+)
+
+type watcher struct {
+	w    registry.Watcher
+	opts Options
+
+	next chan *registry.Result
+	exit chan bool
+	once sync.Once
+
+	// closed with the error of the wrapped watcher
+	failed chan bool
+	err    error
+}
+
+// NewWatcher wraps the watcher. Every result sent holds a service with a
+// single node and its version, creates and updates are sent before deletes
+// so a service being redeployed keeps nodes to route to.
+func NewWatcher(w registry.Watcher, opts ...Option) registry.Watcher {
+	options := Options{
+		Window:   DefaultWindow,
+		MaxDelay: DefaultMaxDelay,
+	}
+	for _, o := range opts {
+		o(&options)
+	}
+
+	dw := &watcher{
+		w:      w,
+		opts:   options,
+		next:   make(chan *registry.Result),
+		exit:   make(chan bool),
+		failed: make(chan bool),
+	}
+
+	go dw.run()
+
+	return dw
+}
+
+// nodeKey identifies a node of a service in a domain, a
+// node changing its version is an update of the node
+func nodeKey(s *registry.Service, node *registry.Node) string {
+	return serviceKey(s) + node.Id
+}
+
+// serviceKey is the prefix of the node keys of the service
+func serviceKey(s *registry.Service) string {
+	return registry.Domain(s) + "/" + s.Name + "/"
+}
+
+// apply updates the state of the nodes by the result
+func apply(state map[string]*registry.Service, r *registry.Result) {
+	if r.Service == nil {
+		return
+	}
+
+	switch r.Action {
+	case "create", "update":
+		for _, node := range r.Service.Nodes {
+			svc := *r.Service
+			svc.Nodes = []*registry.Node{node}
+			state[nodeKey(r.Service, node)] = &svc
+		}
+	case "delete":
+		for _, node := range r.Service.Nodes {
+			delete(state, nodeKey(r.Service, node))
+		}
+
+		// without nodes the service, or the version, is gone
+		if len(r.Service.Nodes) > 0 {
+			return
+		}
+		prefix := serviceKey(r.Service)
+		for k, svc := range state {
+			if !strings.HasPrefix(k, prefix) {
+				continue
+			}
+			if len(r.Service.Version) == 0 || svc.Version == r.Service.Version {
+				delete(state, k)
+			}
+		}
+	}
+}
+
+// diff returns the results from the previous to the current state
+func diff(prev, cur map[string]*registry.Service) []*registry.Result {
+	var created, updated, deleted []*registry.Result
+
+	for _, k := range keys(cur) {
+		p, ok := prev[k]
+		switch {
+		case !ok:
+			created = append(created, &registry.Result{Action: "create", Service: cur[k]})
+		case !reflect.DeepEqual(p, cur[k]):
+			updated = append(updated, &registry.Result{Action: "update", Service: cur[k]})
+		}
+	}
+
+	for _, k := range keys(prev) {
+		if _, ok := cur[k]; !ok {
+			deleted = append(deleted, &registry.Result{Action: "delete", Service: prev[k]})
+		}
+	}
+
+	return append(append(created, updated...), deleted...)
+}
+
+func keys(m map[string]*registry.Service) []string {
+	k := make([]string, 0, len(m))
+	for key := range m {
+		k = append(k, key)
+	}
+	sort.Strings(k)
+	return k
+}
+
+func (w *watcher) run() {
+	results := make(chan *registry.Result)
+	errs := make(chan error, 1)
+
+	go func() {
+		for {
+			r, err := w.w.Next()
+			if err != nil {
+				errs <- err
+				return
+			}
+			select {
+			case results <- r:
+			case <-w.exit:
+				return
+			}
+		}
+	}()
+
+	// sent is the state the results were sent for,
+	// state has the results of the burst applied
+	sent := make(map[string]*registry.Service)
+	state := make(map[string]*registry.Service)
+
+	window := time.NewTimer(w.opts.Window)
+	window.Stop()
+	var deadline <-chan time.Time
+
+	flush := func() bool {
+		deadline = nil
+		for _, r := range diff(sent, state) {
+			select {
+			case w.next <- r:
+			case <-w.exit:
+				return false
+			}
+		}
+		sent = make(map[string]*registry.Service, len(state))
+		for k, v := range state {
+			sent[k] = v
+		}
+		return true
+	}
+
+	for {
+		select {
+		case r := <-results:
+			apply(state, r)
+			if !window.Stop() {
+				select {
+				case <-window.C:
+				default:
+				}
+			}
+			window.Reset(w.opts.Window)
+			if deadline == nil {
+				deadline = time.After(w.opts.MaxDelay)
+			}
+		case <-window.C:
+			if !flush() {
+				return
+			}
+		case <-deadline:
+			window.Stop()
+			if !flush() {
+				return
+			}
+		case err := <-errs:
+			window.Stop()
+			if !flush() {
+				return
+			}
+			w.err = err
+			close(w.failed)
+			return
+		case <-w.exit:
+			window.Stop()
+			return
+		}
+	}
+}
+
+func (w *watcher) Next() (*registry.Result, error) {
+	select {
+	case r := <-w.next:
+		return r, nil
+	case <-w.failed:
+		return nil, w.err
+	case <-w.exit:
+		return nil, registry.ErrWatcherStopped
+	}
+}
+
+func (w *watcher) Stop() {
+	w.once.Do(func() {
+		close(w.exit)
+		w.w.Stop()
+	})
+}
@@ -0,0 +1,129 @@
+package debounce
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"xmicro/registry"
+)
+
+type testWatcher struct {
+	results chan *registry.Result
+	exit    chan bool
+}
+
+func newTestWatcher() *testWatcher {
+	return &testWatcher{
+		results: make(chan *registry.Result),
+		exit:    make(chan bool),
+	}
+}
+
+func (t *testWatcher) Next() (*registry.Result, error) {
+	select {
+	case r, ok := <-t.results:
+		if !ok {
+			return nil, errors.New("closed")
+		}
+		return r, nil
+	case <-t.exit:
+		return nil, registry.ErrWatcherStopped
+	}
+}
+
+func (t *testWatcher) Stop() {
+	close(t.exit)
+}
+
+func result(action, version string, ids ...string) *registry.Result {
+	s := &registry.Service{Name: "greeter", Version: version}
+	for _, id := range ids {
+		s.Nodes = append(s.Nodes, &registry.Node{Id: id, Address: id + ":8080"})
+	}
+	return &registry.Result{Action: action, Service: s}
+}
+
+func next(t *testing.T, w registry.Watcher) *registry.Result {
+	type res struct {
+		r   *registry.Result
+		err error
+	}
+	ch := make(chan res, 1)
+	go func() {
+		r, err := w.Next()
+		ch <- res{r, err}
+	}()
+	select {
+	case r := <-ch:
+		if r.err != nil {
+			t.Fatal(r.err)
+		}
+		return r.r
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for a result")
+	}
+	return nil
+}
+
+func TestWatcher(t *testing.T) {
+	tw := newTestWatcher()
+	w := NewWatcher(tw, WithWindow(20*time.Millisecond))
+	defer w.Stop()
+
+	// a burst creating a node which is gone again and a node updated twice
+	for _, r := range []*registry.Result{
+		result("create", "1.0.0", "a", "b"),
+		result("update", "1.0.0", "a"),
+		result("delete", "1.0.0", "b"),
+		result("create", "1.0.0", "c"),
+	} {
+		tw.results <- r
+	}
+
+	expect := func(action, version, id string) {
+		r := next(t, w)
+		if r.Action != action || r.Service.Version != version || len(r.Service.Nodes) != 1 || r.Service.Nodes[0].Id != id {
+			t.Fatalf("Expected %s of %s %s got %s %+v", action, id, version, r.Action, r.Service)
+		}
+	}
+
+	expect("create", "1.0.0", "a")
+	expect("create", "1.0.0", "c")
+
+	// a node changing its version is updated
+	tw.results <- result("update", "1.0.1", "c")
+	expect("update", "1.0.1", "c")
+
+	// a redeploy of a new version, creates are sent before deletes
+	for _, r := range []*registry.Result{
+		result("create", "1.1.0", "d"),
+		result("delete", "1.0.0"),
+	} {
+		tw.results <- r
+	}
+
+	expect("create", "1.1.0", "d")
+	expect("delete", "1.0.0", "a")
+
+	// results without a change are dropped
+	tw.results <- result("update", "1.1.0", "d")
+	tw.results <- result("delete", "1.1.0", "e")
+	close(tw.results)
+
+	if _, err := w.Next(); err == nil || err.Error() != "closed" {
+		t.Fatalf("Expected the error of the watcher got %v", err)
+	}
+}
+
+func TestMaxDelay(t *testing.T) {
+	tw := newTestWatcher()
+	w := NewWatcher(tw, WithWindow(time.Hour), WithMaxDelay(20*time.Millisecond))
+	defer w.Stop()
+
+	tw.results <- result("create", "1.0.0", "a")
+
+	if r := next(t, w); r.Action != "create" {
+		t.Fatalf("Expected create got %s", r.Action)
+	}
+}
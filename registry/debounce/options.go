@@ -0,0 +1,28 @@
+package debounce
+
+import "time"
+
+type Options struct {
+	// Window is how long the watcher waits for more
+	// results before the burst is flushed
+	Window time.Duration
+	// MaxDelay bounds how long a burst which doesn't
+	// settle is held back
+	MaxDelay time.Duration
+}
+
+type Option func(o *Options)
+
+// WithWindow sets the debounce window
+func WithWindow(d time.Duration) Option {
+	return func(o *Options) {
+		o.Window = d
+	}
+}
+
+// WithMaxDelay sets the longest a result is held back
+func WithMaxDelay(d time.Duration) Option {
+	return func(o *Options) {
+		o.MaxDelay = d
+	}
+}
@@ -0,0 +1,59 @@
+package registry
+
+// DomainKey is the service metadata holding the domain of the service.
+// Registries without a native notion of domains keep it with the service
+// and set it on the services they return.
+const DomainKey = "domain"
+
+// Domain returns the domain of the service from its metadata or else the
+// metadata of its first node. Services without one are in the default domain.
+func Domain(s *Service) string {
+	if d := s.Metadata[DomainKey]; len(d) > 0 {
+		return d
+	}
+	if len(s.Nodes) > 0 && s.Nodes[0] != nil {
+		if d := s.Nodes[0].Metadata[DomainKey]; len(d) > 0 {
+			return d
+		}
+	}
+	return DefaultDomain
+}
+
+// MatchDomain reports whether the domain is in scope of the requested one.
+// An empty request is the default domain, the wildcard matches any domain.
+func MatchDomain(requested, domain string) bool {
+	if len(requested) == 0 {
+		requested = DefaultDomain
+	}
+	if len(domain) == 0 {
+		domain = DefaultDomain
+	}
+	return requested == WildcardDomain || requested == domain
+}
+
+// WithDomain returns a copy of the service with the domain set in its
+// metadata, an empty domain being the default one
+func WithDomain(s *Service, domain string) *Service {
+	if len(domain) == 0 {
+		domain = DefaultDomain
+	}
+
+	svc := *s
+	svc.Metadata = make(map[string]string, len(s.Metadata)+1)
+	for k, v := range s.Metadata {
+		svc.Metadata[k] = v
+	}
+	svc.Metadata[DomainKey] = domain
+	return &svc
+}
+
+// FilterDomain returns the services in scope of the requested domain
+func FilterDomain(services []*Service, domain string) []*Service {
+	var list []*Service
+	for _, s := range services {
+		if MatchDomain(domain, Domain(s)) {
+			list = append(list, s)
+		}
+	}
+	return list
+}
@@ -0,0 +1,561 @@
+// Package etcd provides an etcd v3 registry. Services are stored as json
+// under /micro/registry/{domain}/{service}/{node} and nodes are bound to
+// a lease derived from the register ttl.
+package etcd
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"hash/fnv"
+	"net"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+import (
+	"xmicro/common"
+	"xmicro/common/component"
+	"xmicro/common/constant"
+	"xmicro/logger"
+	"xmicro/logger/core"
+	"xmicro/registry"
+)
+
+var (
+	prefix = "/micro/registry/"
+)
+
+func init() {
+	component.SetRegistryFactory(constant.EtcdKey, &etcdRegistryFactory{})
+}
+
+type etcdRegistryFactory struct {
+}
+
+func (f *etcdRegistryFactory) GetRegistry(url *common.URL) (registry.Registry, error) {
+	timeout := url.GetParam(constant.RegistryTimeoutKey, "5s")
+	timeDuration := constant.DefaultTimeout * time.Millisecond
+	if d, err := time.ParseDuration(timeout); err == nil {
+		timeDuration = d
+	}
+
+	opts := []registry.Option{
+		registry.Addrs(strings.Split(url.Location, ",")...),
+		registry.Timeout(timeDuration),
+	}
+	if len(url.Username) > 0 {
+		opts = append(opts, Auth(url.Username, url.Password))
+	}
+
+	e := newRegistry()
+	if err := configure(e, opts...); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+type etcdRegistry struct {
+	client  *clientv3.Client
+	options registry.Options
+
+	sync.RWMutex
+	// hash and lease of the registered nodes by domain/service/node key
+	register map[string]uint64
+	leases   map[string]clientv3.LeaseID
+}
+
+func newRegistry() *etcdRegistry {
+	return &etcdRegistry{
+		options:  registry.Options{},
+		register: make(map[string]uint64),
+		leases:   make(map[string]clientv3.LeaseID),
+	}
+}
+
+// NewRegistry returns an etcd registry, the client errors are logged
+func NewRegistry(opts ...registry.Option) registry.Registry {
+	e := newRegistry()
+	if err := configure(e, opts...); err != nil {
+		logger.Errorf("[etcd] failed to create registry: %v", err)
+	}
+	return e
+}
+
+func configure(e *etcdRegistry, opts ...registry.Option) error {
+	config := clientv3.Config{
+		Endpoints: []string{"127.0.0.1:2379"},
+	}
+
+	for _, o := range opts {
+		o(&e.options)
+	}
+
+	if e.options.Timeout == 0 {
+		e.options.Timeout = 5 * time.Second
+	}
+	config.DialTimeout = e.options.Timeout
+
+	if e.options.Secure || e.options.TLSConfig != nil {
+		tlsConfig := e.options.TLSConfig
+		if tlsConfig == nil {
+			tlsConfig = &tls.Config{
+				InsecureSkipVerify: true,
+			}
+		}
+		config.TLS = tlsConfig
+	}
+
+	if e.options.Context != nil {
+		if u, ok := e.options.Context.Value(authKey{}).(*authCreds); ok {
+			config.Username = u.Username
+			config.Password = u.Password
+		}
+	}
+
+	var cAddrs []string
+	for _, address := range e.options.Addrs {
+		if len(address) == 0 {
+			continue
+		}
+		addr, port, err := net.SplitHostPort(address)
+		if ae, ok := err.(*net.AddrError); ok && ae.Err == "missing port in address" {
+			port = "2379"
+			addr = address
+			cAddrs = append(cAddrs, net.JoinHostPort(addr, port))
+		} else if err == nil {
+			cAddrs = append(cAddrs, net.JoinHostPort(addr, port))
+		}
+	}
+
+	// if we got addrs then we'll update
+	if len(cAddrs) > 0 {
+		config.Endpoints = cAddrs
+	}
+
+	cli, err := clientv3.New(config)
+	if err != nil {
+		return err
+	}
+
+	if e.client != nil {
+		e.client.Close()
+	}
+	e.client = cli
+	return nil
+}
+
+func encode(s *registry.Service) string {
+	b, _ := json.Marshal(s)
+	return string(b)
+}
+
+func decode(ds []byte) *registry.Service {
+	var s *registry.Service
+	json.Unmarshal(ds, &s)
+	return s
+}
+
+func nodePath(domain, s, id string) string {
+	service := strings.Replace(s, "/", "-", -1)
+	node := strings.Replace(id, "/", "-", -1)
+	return path.Join(prefix, domain, service, node)
+}
+
+func servicePath(domain, s string) string {
+	return path.Join(prefix, domain, strings.Replace(s, "/", "-", -1)) + "/"
+}
+
+func domainPath(domain string) string {
+	return path.Join(prefix, domain) + "/"
+}
+
+func hash(s *registry.Service) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(encode(s)))
+	return h.Sum64()
+}
+
+func (e *etcdRegistry) Init(opts ...registry.Option) error {
+	return configure(e, opts...)
+}
+
+func (e *etcdRegistry) Options() registry.Options {
+	return e.options
+}
+
+func (e *etcdRegistry) registerNode(s *registry.Service, node *registry.Node, opts ...registry.RegisterOption) error {
+	if len(s.Nodes) == 0 {
+		return errors.New("Require at least one node")
+	}
+
+	options := registry.RegisterOptions{
+		Domain: registry.DefaultDomain,
+	}
+	for _, o := range opts {
+		o(&options)
+	}
+	if len(options.Domain) == 0 {
+		options.Domain = registry.DefaultDomain
+	}
+
+	key := nodePath(options.Domain, s.Name, node.Id)
+
+	// check existing lease cache
+	e.RLock()
+	leaseID, ok := e.leases[key]
+	e.RUnlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), e.options.Timeout)
+	defer cancel()
+
+	if !ok {
+		// missing lease, check if the key exists
+		rsp, err := e.client.Get(ctx, key, clientv3.WithSerializable())
+		if err != nil {
+			return err
+		}
+
+		// get the existing lease
+		for _, kv := range rsp.Kvs {
+			if kv.Lease > 0 {
+				leaseID = clientv3.LeaseID(kv.Lease)
+
+				// decode the existing node
+				srv := decode(kv.Value)
+				if srv == nil || len(srv.Nodes) == 0 {
+					continue
+				}
+
+				// create hash of service; uint64
+				h := hash(srv)
+
+				// save the info
+				e.Lock()
+				e.leases[key] = leaseID
+				e.register[key] = h
+				e.Unlock()
+
+				break
+			}
+		}
+	}
+
+	var leaseNotFound bool
+
+	// renew the lease if it exists
+	if leaseID > 0 {
+		if logger.V(core.TraceLevel, logger.DefaultLogger) {
+			logger.Tracef("Renewing existing lease for %s %d", s.Name, leaseID)
+		}
+		if _, err := e.client.KeepAliveOnce(ctx, leaseID); err != nil {
+			if err != rpctypes.ErrLeaseNotFound {
+				return err
+			}
+
+			if logger.V(core.TraceLevel, logger.DefaultLogger) {
+				logger.Tracef("Lease not found for %s %d", s.Name, leaseID)
+			}
+			// lease not found do register
+			leaseNotFound = true
+		}
+	}
+
+	// the service with only this node
+	service := &registry.Service{
+		Name:      s.Name,
+		Version:   s.Version,
+		Metadata:  s.Metadata,
+		Endpoints: s.Endpoints,
+		Nodes:     []*registry.Node{node},
+	}
+
+	// create hash of service; uint64
+	h := hash(service)
+
+	// get existing hash for the service node
+	e.RLock()
+	v, ok := e.register[key]
+	e.RUnlock()
+
+	// the service is unchanged, skip registering
+	if ok && v == h && !leaseNotFound {
+		if logger.V(core.TraceLevel, logger.DefaultLogger) {
+			logger.Tracef("Service %s node %s unchanged skipping registration", s.Name, node.Id)
+		}
+		return nil
+	}
+
+	var lgr *clientv3.LeaseGrantResponse
+	if options.TTL.Seconds() > 0 {
+		// get a lease used to expire keys since we have a ttl
+		var err error
+		lgr, err = e.client.Grant(ctx, int64(options.TTL.Seconds()))
+		if err != nil {
+			return err
+		}
+	}
+
+	if logger.V(core.TraceLevel, logger.DefaultLogger) {
+		logger.Tracef("Registering %s id %s with lease %v and leaseID %v and ttl %v", service.Name, node.Id, lgr, leaseID, options.TTL)
+	}
+
+	// create an entry for the node
+	var err error
+	if lgr != nil {
+		_, err = e.client.Put(ctx, key, encode(service), clientv3.WithLease(lgr.ID))
+	} else {
+		_, err = e.client.Put(ctx, key, encode(service))
+	}
+	if err != nil {
+		return err
+	}
+
+	e.Lock()
+	// save our hash of the service
+	e.register[key] = h
+	// save our leaseID of the service
+	if lgr != nil {
+		e.leases[key] = lgr.ID
+	} else {
+		delete(e.leases, key)
+	}
+	e.Unlock()
+
+	return nil
+}
+
+func (e *etcdRegistry) Deregister(s *registry.Service, opts ...registry.DeregisterOption) error {
+	if len(s.Nodes) == 0 {
+		return errors.New("Require at least one node")
+	}
+
+	options := registry.DeregisterOptions{
+		Domain: registry.DefaultDomain,
+	}
+	for _, o := range opts {
+		o(&options)
+	}
+	if len(options.Domain) == 0 {
+		options.Domain = registry.DefaultDomain
+	}
+
+	for _, node := range s.Nodes {
+		key := nodePath(options.Domain, s.Name, node.Id)
+
+		e.Lock()
+		// delete our hash of the service
+		delete(e.register, key)
+		// delete our lease of the service
+		delete(e.leases, key)
+		e.Unlock()
+
+		ctx, cancel := context.WithTimeout(context.Background(), e.options.Timeout)
+
+		if logger.V(core.TraceLevel, logger.DefaultLogger) {
+			logger.Tracef("Deregistering %s id %s", s.Name, node.Id)
+		}
+		_, err := e.client.Delete(ctx, key)
+		cancel()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (e *etcdRegistry) Register(s *registry.Service, opts ...registry.RegisterOption) error {
+	if len(s.Nodes) == 0 {
+		return errors.New("Require at least one node")
+	}
+
+	var gerr error
+
+	// register each node individually
+	for _, node := range s.Nodes {
+		if err := e.registerNode(s, node, opts...); err != nil {
+			gerr = err
+		}
+	}
+
+	return gerr
+}
+
+func (e *etcdRegistry) GetService(name string, opts ...registry.GetOption) ([]*registry.Service, error) {
+	options := registry.GetOptions{
+		Domain: registry.DefaultDomain,
+	}
+	for _, o := range opts {
+		o(&options)
+	}
+	if len(options.Domain) == 0 {
+		options.Domain = registry.DefaultDomain
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), e.options.Timeout)
+	defer cancel()
+
+	var kvs []*keyValue
+
+	if options.Domain == registry.WildcardDomain {
+		rsp, err := e.client.Get(ctx, prefix, clientv3.WithPrefix(), clientv3.WithSerializable())
+		if err != nil {
+			return nil, err
+		}
+		// filter the services of other names
+		for _, kv := range rsp.Kvs {
+			if domain, service, ok := parseKey(string(kv.Key)); ok && service == strings.Replace(name, "/", "-", -1) {
+				kvs = append(kvs, &keyValue{domain: domain, value: kv.Value})
+			}
+		}
+	} else {
+		rsp, err := e.client.Get(ctx, servicePath(options.Domain, name), clientv3.WithPrefix(), clientv3.WithSerializable())
+		if err != nil {
+			return nil, err
+		}
+		for _, kv := range rsp.Kvs {
+			kvs = append(kvs, &keyValue{domain: options.Domain, value: kv.Value})
+		}
+	}
+
+	if len(kvs) == 0 {
+		return nil, registry.ErrNotFound
+	}
+
+	serviceMap := map[string]*registry.Service{}
+
+	for _, kv := range kvs {
+		sn := decode(kv.value)
+		if sn == nil {
+			continue
+		}
+
+		// versions are kept apart per domain
+		key := kv.domain + "/" + sn.Version
+
+		s, ok := serviceMap[key]
+		if !ok {
+			s = &registry.Service{
+				Name:      sn.Name,
+				Version:   sn.Version,
+				Metadata:  withDomain(sn.Metadata, kv.domain),
+				Endpoints: sn.Endpoints,
+			}
+			serviceMap[key] = s
+		}
+
+		s.Nodes = append(s.Nodes, sn.Nodes...)
+	}
+
+	services := make([]*registry.Service, 0, len(serviceMap))
+	for _, service := range serviceMap {
+		services = append(services, service)
+	}
+
+	return services, nil
+}
+
+func (e *etcdRegistry) ListServices(opts ...registry.ListOption) ([]*registry.Service, error) {
+	options := registry.ListOptions{
+		Domain: registry.DefaultDomain,
+	}
+	for _, o := range opts {
+		o(&options)
+	}
+	if len(options.Domain) == 0 {
+		options.Domain = registry.DefaultDomain
+	}
+
+	key := domainPath(options.Domain)
+	if options.Domain == registry.WildcardDomain {
+		key = prefix
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), e.options.Timeout)
+	defer cancel()
+
+	rsp, err := e.client.Get(ctx, key, clientv3.WithPrefix(), clientv3.WithSerializable())
+	if err != nil {
+		return nil, err
+	}
+
+	versions := make(map[string]*registry.Service)
+
+	for _, n := range rsp.Kvs {
+		domain, _, ok := parseKey(string(n.Key))
+		if !ok {
+			continue
+		}
+
+		sn := decode(n.Value)
+		if sn == nil {
+			continue
+		}
+
+		k := domain + "/" + sn.Name + "/" + sn.Version
+
+		v, ok := versions[k]
+		if !ok {
+			v = &registry.Service{
+				Name:      sn.Name,
+				Version:   sn.Version,
+				Metadata:  withDomain(sn.Metadata, domain),
+				Endpoints: sn.Endpoints,
+			}
+			versions[k] = v
+		}
+
+		v.Nodes = append(v.Nodes, sn.Nodes...)
+	}
+
+	services := make([]*registry.Service, 0, len(versions))
+	for _, service := range versions {
+		services = append(services, service)
+	}
+
+	// sort the services
+	sort.Slice(services, func(i, j int) bool { return services[i].Name < services[j].Name })
+
+	return services, nil
+}
+
+func (e *etcdRegistry) Watch(opts ...registry.WatchOption) (registry.Watcher, error) {
+	return newEtcdWatcher(e, opts...)
+}
+
+func (e *etcdRegistry) String() string {
+	return "etcd"
+}
+
+type keyValue struct {
+	domain string
+	value  []byte
+}
+
+// parseKey splits a node key into its domain and service
+func parseKey(key string) (domain, service string, ok bool) {
+	parts := strings.Split(strings.TrimPrefix(key, prefix), "/")
+	if len(parts) != 3 {
+		return "", "", false
+	}
+	return parts[0], parts[1], true
+}
+
+// withDomain copies the metadata and sets the domain
+// so it can be passed to watchers and callers
+func withDomain(md map[string]string, domain string) map[string]string {
+	cp := make(map[string]string, len(md)+1)
+	for k, v := range md {
+		cp[k] = v
+	}
+	cp["domain"] = domain
+	return cp
+}
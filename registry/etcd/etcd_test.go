@@ -0,0 +1,148 @@
+package etcd
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"go.etcd.io/etcd/server/v3/embed"
+
+	"xmicro/registry"
+)
+
+func runEtcd(t *testing.T) string {
+	cfg := embed.NewConfig()
+	cfg.Dir = t.TempDir()
+	cfg.LogLevel = "error"
+
+	u, _ := url.Parse("http://127.0.0.1:0")
+	cfg.LCUrls = []url.URL{*u}
+	cfg.LPUrls = []url.URL{*u}
+
+	e, err := embed.StartEtcd(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(e.Close)
+
+	select {
+	case <-e.Server.ReadyNotify():
+	case <-time.After(10 * time.Second):
+		t.Fatal("etcd server not ready")
+	}
+
+	return e.Clients[0].Addr().String()
+}
+
+func testService(id, version string) *registry.Service {
+	return &registry.Service{
+		Name:    "greeter",
+		Version: version,
+		Nodes: []*registry.Node{
+			{Id: id, Address: "10.0.0.1:8080", Metadata: map[string]string{"protocol": "rpc"}},
+		},
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry(registry.Addrs(runEtcd(t)))
+
+	if err := r.Register(testService("greeter-1", "1.0.0"), registry.RegisterTTL(10*time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Register(testService("greeter-2", "1.0.0")); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Register(testService("greeter-3", "1.0.0"), registry.RegisterDomain("staging")); err != nil {
+		t.Fatal(err)
+	}
+
+	services, err := r.GetService("greeter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(services) != 1 || len(services[0].Nodes) != 2 {
+		t.Fatalf("Expected one service with 2 nodes got %+v", services)
+	}
+	if services[0].Metadata["domain"] != registry.DefaultDomain {
+		t.Fatalf("Expected domain %s got %s", registry.DefaultDomain, services[0].Metadata["domain"])
+	}
+
+	services, err = r.GetService("greeter", registry.GetDomain(registry.WildcardDomain))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(services) != 2 {
+		t.Fatalf("Expected a service per domain got %d", len(services))
+	}
+
+	list, err := r.ListServices(registry.ListDomain("staging"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 || list[0].Name != "greeter" {
+		t.Fatalf("Unexpected services %+v", list)
+	}
+
+	if err := r.Deregister(testService("greeter-1", "1.0.0")); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Deregister(testService("greeter-2", "1.0.0")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.GetService("greeter"); err != registry.ErrNotFound {
+		t.Fatalf("Expected not found got %v", err)
+	}
+}
+
+func TestLease(t *testing.T) {
+	r := NewRegistry(registry.Addrs(runEtcd(t)))
+
+	if err := r.Register(testService("greeter-1", "1.0.0"), registry.RegisterTTL(time.Second)); err != nil {
+		t.Fatal(err)
+	}
+
+	// the node expires unless it's registered again
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		if _, err := r.GetService("greeter"); err == registry.ErrNotFound {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the node to expire with its lease")
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+func TestWatcher(t *testing.T) {
+	r := NewRegistry(registry.Addrs(runEtcd(t)))
+
+	w, err := r.Watch(registry.WatchService("greeter"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Stop()
+
+	svc := testService("greeter-1", "1.0.0")
+	if err := r.Register(svc); err != nil {
+		t.Fatal(err)
+	}
+	svc.Nodes[0].Metadata["weight"] = "10"
+	if err := r.Register(svc); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Deregister(svc); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, action := range []string{"create", "update", "delete"} {
+		res, err := w.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Action != action || res.Service.Name != "greeter" || res.Service.Nodes[0].Id != "greeter-1" {
+			t.Fatalf("Expected %s of greeter-1 got %s %+v", action, res.Action, res.Service)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package etcd
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+
+	"xmicro/registry"
+)
+
+type etcdWatcher struct {
+	stop chan bool
+	once sync.Once
+	w    clientv3.WatchChan
+	// service to filter when watching all domains
+	service string
+	// results of the last watch response not returned yet
+	results []*registry.Result
+}
+
+func newEtcdWatcher(r *etcdRegistry, opts ...registry.WatchOption) (registry.Watcher, error) {
+	wo := registry.WatchOptions{
+		Domain: registry.DefaultDomain,
+	}
+	for _, o := range opts {
+		o(&wo)
+	}
+	if len(wo.Domain) == 0 {
+		wo.Domain = registry.DefaultDomain
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stop := make(chan bool, 1)
+
+	go func() {
+		<-stop
+		cancel()
+	}()
+
+	ew := &etcdWatcher{
+		stop: stop,
+	}
+
+	var watchPath string
+
+	switch {
+	case wo.Domain == registry.WildcardDomain:
+		// service keys of all domains can't be matched by a prefix
+		watchPath = prefix
+		ew.service = strings.Replace(wo.Service, "/", "-", -1)
+	case len(wo.Service) > 0:
+		watchPath = servicePath(wo.Domain, wo.Service)
+	default:
+		watchPath = domainPath(wo.Domain)
+	}
+
+	ew.w = r.client.Watch(ctx, watchPath, clientv3.WithPrefix(), clientv3.WithPrevKV())
+
+	return ew, nil
+}
+
+func (ew *etcdWatcher) Next() (*registry.Result, error) {
+	for {
+		if len(ew.results) > 0 {
+			r := ew.results[0]
+			ew.results = ew.results[1:]
+			return r, nil
+		}
+
+		wresp, ok := <-ew.w
+		if !ok {
+			return nil, registry.ErrWatcherStopped
+		}
+		if wresp.Err() != nil {
+			return nil, wresp.Err()
+		}
+		if wresp.Canceled {
+			return nil, errors.New("could not get next")
+		}
+
+		for _, ev := range wresp.Events {
+			if r := ew.result(ev); r != nil {
+				ew.results = append(ew.results, r)
+			}
+		}
+	}
+}
+
+// result converts an etcd event into a registry result
+func (ew *etcdWatcher) result(ev *clientv3.Event) *registry.Result {
+	domain, service, ok := parseKey(string(ev.Kv.Key))
+	if !ok {
+		return nil
+	}
+	if len(ew.service) > 0 && ew.service != service {
+		return nil
+	}
+
+	var action string
+	var svc *registry.Service
+
+	switch ev.Type {
+	case clientv3.EventTypePut:
+		if ev.IsCreate() {
+			action = "create"
+		} else if ev.IsModify() {
+			action = "update"
+		}
+		svc = decode(ev.Kv.Value)
+	case clientv3.EventTypeDelete:
+		action = "delete"
+
+		// get service from prevKv
+		if ev.PrevKv != nil {
+			svc = decode(ev.PrevKv.Value)
+		}
+	}
+
+	if svc == nil {
+		return nil
+	}
+
+	svc.Metadata = withDomain(svc.Metadata, domain)
+
+	return &registry.Result{
+		Action:  action,
+		Service: svc,
+	}
+}
+
+func (ew *etcdWatcher) Stop() {
+	ew.once.Do(func() {
+		close(ew.stop)
+	})
+}
@@ -0,0 +1,320 @@
+// Package file provides a static registry read from a yaml file, for
+// local development without any infrastructure. The file is reloaded
+// when it changes and the watchers are sent the changed nodes.
+//
+//	services:
+//	- name: greeter
+//	  version: 1.0.0
+//	  endpoints:
+//	  - name: Greeter.Hello
+//	  nodes:
+//	  - id: greeter-1
+//	    address: 127.0.0.1:8080
+package file
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+	"gopkg.in/yaml.v2"
+)
+
+import (
+	"xmicro/common"
+	"xmicro/common/component"
+	"xmicro/common/constant"
+	"xmicro/logger"
+	"xmicro/registry"
+)
+
+var (
+	// DefaultPath of the services file
+	DefaultPath = "registry.yml"
+
+	errEmpty = errors.New("file is empty")
+)
+
+func init() {
+	component.SetRegistryFactory(constant.FILE_KEY, &fileRegistryFactory{})
+}
+
+type fileRegistryFactory struct {
+}
+
+// GetRegistry reads the file at the registry address or the file-path param
+func (f *fileRegistryFactory) GetRegistry(url *common.URL) (registry.Registry, error) {
+	path := url.GetParam(constant.FILE_PATH_KEY, url.Location)
+	r := newRegistry()
+	if err := configure(r, Path(path)); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// services is the layout of the file
+type services struct {
+	Services []*registry.Service `yaml:"services"`
+}
+
+type fileRegistry struct {
+	opts registry.Options
+	path string
+
+	sync.RWMutex
+	// single node services by node id
+	nodes    map[string]*registry.Service
+	watchers map[*fileWatcher]bool
+	fsw      *fsnotify.Watcher
+}
+
+func newRegistry() *fileRegistry {
+	return &fileRegistry{
+		nodes:    make(map[string]*registry.Service),
+		watchers: make(map[*fileWatcher]bool),
+	}
+}
+
+// NewRegistry returns a registry of the services in the file
+func NewRegistry(opts ...registry.Option) registry.Registry {
+	r := newRegistry()
+	if err := configure(r, opts...); err != nil {
+		logger.Errorf("[file] failed to load registry %s: %v", r.path, err)
+	}
+	return r
+}
+
+func configure(r *fileRegistry, opts ...registry.Option) error {
+	for _, o := range opts {
+		o(&r.opts)
+	}
+
+	path := DefaultPath
+	if r.opts.Context != nil {
+		if p, ok := r.opts.Context.Value(pathKey{}).(string); ok && len(p) > 0 {
+			path = p
+		}
+	}
+
+	if r.fsw != nil && path == r.path {
+		return nil
+	}
+	r.path = path
+
+	if err := r.load(); err != nil {
+		return err
+	}
+	return r.watch()
+}
+
+// read parses the file into single node services by node id
+func (r *fileRegistry) read() (map[string]*registry.Service, error) {
+	b, err := ioutil.ReadFile(r.path)
+	if err != nil {
+		return nil, err
+	}
+
+	// a truncated file is most likely still being written
+	if len(b) == 0 {
+		return nil, errEmpty
+	}
+
+	var f services
+	if err := yaml.Unmarshal(b, &f); err != nil {
+		return nil, err
+	}
+
+	nodes := make(map[string]*registry.Service)
+	for _, s := range f.Services {
+		for _, n := range s.Nodes {
+			if len(n.Id) == 0 {
+				n.Id = s.Name + "-" + n.Address
+			}
+			svc := *s
+			svc.Nodes = []*registry.Node{n}
+			nodes[n.Id] = &svc
+		}
+	}
+	return nodes, nil
+}
+
+// load reads the file and sends the changes to the watchers
+func (r *fileRegistry) load() error {
+	nodes, err := r.read()
+	if err != nil {
+		return err
+	}
+
+	r.Lock()
+	prev := r.nodes
+	r.nodes = nodes
+	results := diff(prev, nodes)
+	watchers := make([]*fileWatcher, 0, len(r.watchers))
+	for w := range r.watchers {
+		watchers = append(watchers, w)
+	}
+	r.Unlock()
+
+	for _, w := range watchers {
+		for _, res := range results {
+			w.send(res)
+		}
+	}
+	return nil
+}
+
+// watch reloads the file on changes. The directory is watched
+// as editors often replace the file instead of writing it.
+func (r *fileRegistry) watch() error {
+	if r.fsw != nil {
+		r.fsw.Close()
+	}
+
+	fsw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	if err := fsw.Add(filepath.Dir(r.path)); err != nil {
+		fsw.Close()
+		return err
+	}
+	r.fsw = fsw
+
+	name := filepath.Clean(r.path)
+
+	go func() {
+		for {
+			select {
+			case event, ok := <-fsw.Events:
+				if !ok {
+					return
+				}
+				if filepath.Clean(event.Name) != name || event.Op&(fsnotify.Write|fsnotify.Create) == 0 {
+					continue
+				}
+				if err := r.load(); err != nil && err != errEmpty {
+					logger.Warnf("[file] failed to reload registry %s: %v", r.path, err)
+				}
+			case err, ok := <-fsw.Errors:
+				if !ok {
+					return
+				}
+				logger.Warnf("[file] watch of %s failed: %v", r.path, err)
+			}
+		}
+	}()
+
+	return nil
+}
+
+func (r *fileRegistry) Init(opts ...registry.Option) error {
+	return configure(r, opts...)
+}
+
+func (r *fileRegistry) Options() registry.Options {
+	return r.opts
+}
+
+// Register is a no-op, the services are only defined by the file
+func (r *fileRegistry) Register(s *registry.Service, opts ...registry.RegisterOption) error {
+	if len(s.Nodes) == 0 {
+		return errors.New("you must register at least one node")
+	}
+	return nil
+}
+
+// Deregister is a no-op, the services are only defined by the file
+func (r *fileRegistry) Deregister(s *registry.Service, opts ...registry.DeregisterOption) error {
+	return nil
+}
+
+func (r *fileRegistry) GetService(name string, opts ...registry.GetOption) ([]*registry.Service, error) {
+	var options registry.GetOptions
+	for _, o := range opts {
+		o(&options)
+	}
+
+	r.RLock()
+	defer r.RUnlock()
+
+	// svcs mapped by domain and version
+	svcs := make(map[string]*registry.Service)
+	var keys []string
+
+	for _, s := range r.nodes {
+		if s.Name != name || !registry.MatchDomain(options.Domain, registry.Domain(s)) {
+			continue
+		}
+		key := registry.Domain(s) + "/" + s.Version
+		vs, ok := svcs[key]
+		if !ok {
+			svc := *s
+			svcs[key] = &svc
+			keys = append(keys, key)
+			continue
+		}
+		vs.Nodes = append(vs.Nodes, s.Nodes...)
+	}
+
+	if len(svcs) == 0 {
+		return nil, registry.ErrNotFound
+	}
+
+	sort.Strings(keys)
+	list := make([]*registry.Service, 0, len(keys))
+	for _, v := range keys {
+		sort.Slice(svcs[v].Nodes, func(i, j int) bool {
+			return svcs[v].Nodes[i].Id < svcs[v].Nodes[j].Id
+		})
+		list = append(list, svcs[v])
+	}
+	return list, nil
+}
+
+func (r *fileRegistry) ListServices(opts ...registry.ListOption) ([]*registry.Service, error) {
+	var options registry.ListOptions
+	for _, o := range opts {
+		o(&options)
+	}
+
+	r.RLock()
+	defer r.RUnlock()
+
+	names := make(map[string]bool)
+	var list []*registry.Service
+	for _, s := range r.nodes {
+		if names[s.Name] || !registry.MatchDomain(options.Domain, registry.Domain(s)) {
+			continue
+		}
+		names[s.Name] = true
+		list = append(list, &registry.Service{Name: s.Name})
+	}
+	return list, nil
+}
+
+func (r *fileRegistry) Watch(opts ...registry.WatchOption) (registry.Watcher, error) {
+	var wo registry.WatchOptions
+	for _, o := range opts {
+		o(&wo)
+	}
+
+	w := &fileWatcher{
+		r:    r,
+		wo:   wo,
+		next: make(chan *registry.Result, 32),
+		exit: make(chan bool),
+	}
+
+	r.Lock()
+	r.watchers[w] = true
+	r.Unlock()
+
+	return w, nil
+}
+
+func (r *fileRegistry) String() string {
+	return "file"
+}
@@ -0,0 +1,117 @@
+package file
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"xmicro/registry"
+)
+
+const (
+	testFile = `
+services:
+- name: greeter
+  version: 1.0.0
+  nodes:
+  - id: greeter-1
+    address: 127.0.0.1:8080
+  - id: greeter-2
+    address: 127.0.0.1:8081
+`
+
+	testUpdate = `
+services:
+- name: greeter
+  version: 1.0.0
+  nodes:
+  - id: greeter-1
+    address: 127.0.0.1:9090
+`
+)
+
+func TestRegistry(t *testing.T) {
+	dir, err := ioutil.TempDir("", "registry")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "registry.yml")
+	if err := ioutil.WriteFile(path, []byte(testFile), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	r := NewRegistry(Path(path))
+
+	services, err := r.GetService("greeter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(services) != 1 || len(services[0].Nodes) != 2 {
+		t.Fatalf("expected 1 service with 2 nodes, got %+v", services)
+	}
+	if services[0].Nodes[0].Address != "127.0.0.1:8080" {
+		t.Fatalf("unexpected node %+v", services[0].Nodes[0])
+	}
+
+	if _, err := r.GetService("missing"); err != registry.ErrNotFound {
+		t.Fatalf("expected not found, got %v", err)
+	}
+
+	w, err := r.Watch(registry.WatchService("greeter"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Stop()
+
+	if err := ioutil.WriteFile(path, []byte(testUpdate), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]string{
+		"greeter-1": "update",
+		"greeter-2": "delete",
+	}
+	for len(expected) > 0 {
+		res, err := next(w)
+		if err != nil {
+			t.Fatal(err)
+		}
+		id := res.Service.Nodes[0].Id
+		// a write may be seen as several events
+		if expected[id] != res.Action {
+			continue
+		}
+		delete(expected, id)
+	}
+
+	services, err = r.GetService("greeter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(services[0].Nodes) != 1 || services[0].Nodes[0].Address != "127.0.0.1:9090" {
+		t.Fatalf("expected reloaded node, got %+v", services[0].Nodes)
+	}
+}
+
+func next(w registry.Watcher) (*registry.Result, error) {
+	type result struct {
+		res *registry.Result
+		err error
+	}
+	ch := make(chan result, 1)
+	go func() {
+		res, err := w.Next()
+		ch <- result{res, err}
+	}()
+	select {
+	case r := <-ch:
+		return r.res, r.err
+	case <-time.After(5 * time.Second):
+		w.Stop()
+		return nil, registry.ErrWatcherStopped
+	}
+}
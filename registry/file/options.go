@@ -0,0 +1,19 @@
+package file
+
+import (
+	"context"
+
+	"xmicro/registry"
+)
+
+type pathKey struct{}
+
+// Path sets the yaml file the services are read from
+func Path(p string) registry.Option {
+	return func(o *registry.Options) {
+		if o.Context == nil {
+			o.Context = context.Background()
+		}
+		o.Context = context.WithValue(o.Context, pathKey{}, p)
+	}
+}
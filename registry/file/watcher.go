@@ -0,0 +1,78 @@
+package file
+
+import (
+	"reflect"
+	"sort"
+	"sync"
+
+	"xmicro/registry"
+)
+
+type fileWatcher struct {
+	r    *fileRegistry
+	wo   registry.WatchOptions
+	next chan *registry.Result
+	exit chan bool
+	once sync.Once
+}
+
+// send queues the result if the watcher is interested in it
+func (w *fileWatcher) send(res *registry.Result) {
+	if (len(w.wo.Service) > 0 && res.Service.Name != w.wo.Service) || !registry.MatchDomain(w.wo.Domain, registry.Domain(res.Service)) {
+		return
+	}
+	select {
+	case w.next <- res:
+	case <-w.exit:
+	}
+}
+
+func (w *fileWatcher) Next() (*registry.Result, error) {
+	select {
+	case r := <-w.next:
+		return r, nil
+	case <-w.exit:
+		return nil, registry.ErrWatcherStopped
+	}
+}
+
+func (w *fileWatcher) Stop() {
+	w.once.Do(func() {
+		close(w.exit)
+
+		w.r.Lock()
+		delete(w.r.watchers, w)
+		w.r.Unlock()
+	})
+}
+
+// diff returns the results between the single node services
+func diff(prev, cur map[string]*registry.Service) []*registry.Result {
+	var results []*registry.Result
+
+	for _, id := range keys(cur) {
+		p, ok := prev[id]
+		switch {
+		case !ok:
+			results = append(results, &registry.Result{Action: "create", Service: cur[id]})
+		case !reflect.DeepEqual(p, cur[id]):
+			results = append(results, &registry.Result{Action: "update", Service: cur[id]})
+		}
+	}
+	for _, id := range keys(prev) {
+		if _, ok := cur[id]; !ok {
+			results = append(results, &registry.Result{Action: "delete", Service: prev[id]})
+		}
+	}
+
+	return results
+}
+
+func keys(m map[string]*registry.Service) []string {
+	k := make([]string, 0, len(m))
+	for id := range m {
+		k = append(k, id)
+	}
+	sort.Strings(k)
+	return k
+}
@@ -19,6 +19,8 @@ type Request struct {
 	method    string
 	host      string
 	namespace string
+	// api path of the resource group, /api/v1 for the core group
+	apiPath string
 
 	resource     string
 	resourceName *string
@@ -72,6 +74,13 @@ func (r *Request) Namespace(s string) *Request {
 	return r
 }
 
+// Group sets the api group and version of the resource,
+// such as "discovery.k8s.io/v1" for endpoint slices
+func (r *Request) Group(gv string) *Request {
+	r.apiPath = "/apis/" + gv
+	return r
+}
+
 // Resource is the type of resource the operation is
 // for, such as "services", "endpoints" or "pods"
 func (r *Request) Resource(s string) *Request {
@@ -122,7 +131,7 @@ func (r *Request) SetHeader(key, value string) *Request {
 
 // request builds the http.Request from the options
 func (r *Request) request() (*http.Request, error) {
-	url := fmt.Sprintf("%s/api/v1/namespaces/%s/%s/", r.host, r.namespace, r.resource)
+	url := fmt.Sprintf("%s%s/namespaces/%s/%s/", r.host, r.apiPath, r.namespace, r.resource)
 
 	// append resourceName if it is present
 	if r.resourceName != nil {
@@ -205,6 +214,7 @@ func NewRequest(opts *Options) *Request {
 		client:    opts.Client,
 		namespace: opts.Namespace,
 		host:      opts.Host,
+		apiPath:   "/api/v1",
 	}
 
 	if opts.BearerToken != nil {
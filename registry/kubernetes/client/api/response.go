@@ -12,6 +12,7 @@ import (
 // Errors ...
 var (
 	ErrNotFound = errors.New("K8s: not found")
+	ErrConflict = errors.New("K8s: conflict")
 	ErrDecode   = errors.New("K8s: error decoding")
 	ErrOther    = errors.New("K8s: error")
 )
@@ -82,6 +83,13 @@ func newResponse(res *http.Response, err error) *Response {
 		return r
 	}
 
+	// the object was changed or created by another writer
+	if r.res.StatusCode == http.StatusConflict {
+		r.res.Body.Close()
+		r.err = ErrConflict
+		return r
+	}
+
 	log.Errorf("K8s: request failed with code %v", r.res.StatusCode)
 
 	b, err := ioutil.ReadAll(r.res.Body)
@@ -16,6 +16,9 @@ import (
 var (
 	serviceAccountPath = "/var/run/secrets/kubernetes.io/serviceaccount"
 
+	// api group of the endpoint slices
+	discoveryGroup = "discovery.k8s.io/v1"
+
 	ErrReadNamespace = errors.New("Could not read namespace from service account secret")
 )
 
@@ -43,6 +46,96 @@ func (c *client) WatchPods(labels map[string]string) (watch.Watch, error) {
 	return api.NewRequest(c.opts).Get().Resource("pods").Params(&api.Params{LabelSelector: labels}).Watch()
 }
 
+// ListServices ...
+func (c *client) ListServices(labels map[string]string) (*ServiceList, error) {
+	var services ServiceList
+	err := api.NewRequest(c.opts).Get().Resource("services").Params(&api.Params{LabelSelector: labels}).Do().Into(&services)
+	return &services, err
+}
+
+// WatchServices ...
+func (c *client) WatchServices(labels map[string]string) (watch.Watch, error) {
+	return api.NewRequest(c.opts).Get().Resource("services").Params(&api.Params{LabelSelector: labels}).Watch()
+}
+
+// ListEndpointSlices ...
+func (c *client) ListEndpointSlices(labels map[string]string) (*EndpointSliceList, error) {
+	var slices EndpointSliceList
+	err := api.NewRequest(c.opts).Get().Group(discoveryGroup).Resource("endpointslices").Params(&api.Params{LabelSelector: labels}).Do().Into(&slices)
+	return &slices, err
+}
+
+// WatchEndpointSlices ...
+func (c *client) WatchEndpointSlices(labels map[string]string) (watch.Watch, error) {
+	return api.NewRequest(c.opts).Get().Group(discoveryGroup).Resource("endpointslices").Params(&api.Params{LabelSelector: labels}).Watch()
+}
+
+// GetConfigMap ...
+func (c *client) GetConfigMap(name string) (*ConfigMap, error) {
+	var configMap ConfigMap
+	err := api.NewRequest(c.opts).Get().Resource("configmaps").Name(name).Do().Into(&configMap)
+	return &configMap, err
+}
+
+// CreateConfigMap ...
+func (c *client) CreateConfigMap(cm *ConfigMap) (*ConfigMap, error) {
+	var configMap ConfigMap
+	err := api.NewRequest(c.opts).Post().SetHeader("Content-Type", "application/json").Resource("configmaps").Body(cm).Do().Into(&configMap)
+	return &configMap, err
+}
+
+// UpdateConfigMap replaces the config map
+func (c *client) UpdateConfigMap(name string, cm *ConfigMap) (*ConfigMap, error) {
+	var configMap ConfigMap
+	err := api.NewRequest(c.opts).Put().SetHeader("Content-Type", "application/json").Resource("configmaps").Name(name).Body(cm).Do().Into(&configMap)
+	return &configMap, err
+}
+
+// DeleteConfigMap ...
+func (c *client) DeleteConfigMap(name string) error {
+	// the status of the deletion is read to release the connection
+	var status interface{}
+	return api.NewRequest(c.opts).Delete().Resource("configmaps").Name(name).Do().Into(&status)
+}
+
+// WatchConfigMaps ...
+func (c *client) WatchConfigMaps(labels map[string]string) (watch.Watch, error) {
+	return api.NewRequest(c.opts).Get().Resource("configmaps").Params(&api.Params{LabelSelector: labels}).Watch()
+}
+
+// GetSecret ...
+func (c *client) GetSecret(name string) (*Secret, error) {
+	var secret Secret
+	err := api.NewRequest(c.opts).Get().Resource("secrets").Name(name).Do().Into(&secret)
+	return &secret, err
+}
+
+// CreateSecret ...
+func (c *client) CreateSecret(s *Secret) (*Secret, error) {
+	var secret Secret
+	err := api.NewRequest(c.opts).Post().SetHeader("Content-Type", "application/json").Resource("secrets").Body(s).Do().Into(&secret)
+	return &secret, err
+}
+
+// UpdateSecret replaces the secret
+func (c *client) UpdateSecret(name string, s *Secret) (*Secret, error) {
+	var secret Secret
+	err := api.NewRequest(c.opts).Put().SetHeader("Content-Type", "application/json").Resource("secrets").Name(name).Body(s).Do().Into(&secret)
+	return &secret, err
+}
+
+// DeleteSecret ...
+func (c *client) DeleteSecret(name string) error {
+	// the status of the deletion is read to release the connection
+	var status interface{}
+	return api.NewRequest(c.opts).Delete().Resource("secrets").Name(name).Do().Into(&status)
+}
+
+// WatchSecrets ...
+func (c *client) WatchSecrets(labels map[string]string) (watch.Watch, error) {
+	return api.NewRequest(c.opts).Get().Resource("secrets").Params(&api.Params{LabelSelector: labels}).Watch()
+}
+
 func detectNamespace() (string, error) {
 	nsPath := path.Join(serviceAccountPath, "namespace")
 
@@ -7,6 +7,20 @@ type Kubernetes interface {
 	ListPods(labels map[string]string) (*PodList, error)
 	UpdatePod(podName string, pod *Pod) (*Pod, error)
 	WatchPods(labels map[string]string) (watch.Watch, error)
+	ListServices(labels map[string]string) (*ServiceList, error)
+	WatchServices(labels map[string]string) (watch.Watch, error)
+	ListEndpointSlices(labels map[string]string) (*EndpointSliceList, error)
+	WatchEndpointSlices(labels map[string]string) (watch.Watch, error)
+	GetConfigMap(name string) (*ConfigMap, error)
+	CreateConfigMap(configMap *ConfigMap) (*ConfigMap, error)
+	UpdateConfigMap(name string, configMap *ConfigMap) (*ConfigMap, error)
+	DeleteConfigMap(name string) error
+	WatchConfigMaps(labels map[string]string) (watch.Watch, error)
+	GetSecret(name string) (*Secret, error)
+	CreateSecret(secret *Secret) (*Secret, error)
+	UpdateSecret(name string, secret *Secret) (*Secret, error)
+	DeleteSecret(name string) error
+	WatchSecrets(labels map[string]string) (watch.Watch, error)
 }
 
 // PodList ...
@@ -25,6 +39,9 @@ type Meta struct {
 	Name        string             `json:"name,omitempty"`
 	Labels      map[string]*string `json:"labels,omitempty"`
 	Annotations map[string]*string `json:"annotations,omitempty"`
+	// the version of the object read, an update with it fails with a
+	// conflict once the object changed since
+	ResourceVersion string `json:"resourceVersion,omitempty"`
 }
 
 // Status ...
@@ -32,3 +49,70 @@ type Status struct {
 	PodIP string `json:"podIP"`
 	Phase string `json:"phase"`
 }
+
+// ServiceList ...
+type ServiceList struct {
+	Items []Service `json:"items"`
+}
+
+// Service is a kubernetes service
+type Service struct {
+	Metadata *Meta `json:"metadata"`
+}
+
+// EndpointSliceList ...
+type EndpointSliceList struct {
+	Items []EndpointSlice `json:"items"`
+}
+
+// EndpointSlice holds a subset of the endpoints of a service
+type EndpointSlice struct {
+	Metadata    *Meta          `json:"metadata"`
+	AddressType string         `json:"addressType"`
+	Endpoints   []Endpoint     `json:"endpoints"`
+	Ports       []EndpointPort `json:"ports"`
+}
+
+// Endpoint is a single backend of an endpoint slice
+type Endpoint struct {
+	Addresses  []string           `json:"addresses"`
+	Conditions EndpointConditions `json:"conditions"`
+	TargetRef  *ObjectReference   `json:"targetRef,omitempty"`
+	NodeName   *string            `json:"nodeName,omitempty"`
+	Zone       *string            `json:"zone,omitempty"`
+}
+
+// EndpointConditions ...
+type EndpointConditions struct {
+	// nil means ready
+	Ready       *bool `json:"ready,omitempty"`
+	Terminating *bool `json:"terminating,omitempty"`
+}
+
+// EndpointPort ...
+type EndpointPort struct {
+	Name     *string `json:"name,omitempty"`
+	Port     *int32  `json:"port,omitempty"`
+	Protocol *string `json:"protocol,omitempty"`
+}
+
+// ObjectReference ...
+type ObjectReference struct {
+	Kind      string `json:"kind"`
+	Name      string `json:"name"`
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// ConfigMap holds the config entries of an application
+type ConfigMap struct {
+	Metadata *Meta             `json:"metadata"`
+	Data     map[string]string `json:"data,omitempty"`
+}
+
+// Secret holds the sensitive config entries, the values are base64
+// encoded on the wire
+type Secret struct {
+	Metadata *Meta             `json:"metadata"`
+	Type     string            `json:"type,omitempty"`
+	Data     map[string][]byte `json:"data,omitempty"`
+}
@@ -2,6 +2,7 @@ package mock
 
 import (
 	"encoding/json"
+	"strconv"
 	"sync"
 
 	"xmicro/registry/kubernetes/client"
@@ -9,12 +10,33 @@ import (
 	"xmicro/registry/kubernetes/client/watch"
 )
 
+// kinds of the watched resources
+const (
+	kindPods           = "pods"
+	kindServices       = "services"
+	kindEndpointSlices = "endpointslices"
+	kindConfigMaps     = "configmaps"
+	kindSecrets        = "secrets"
+)
+
+// event of a resource kind
+type event struct {
+	kind string
+	watch.Event
+}
+
 // Client ...
 type Client struct {
 	sync.Mutex
-	Pods     map[string]*client.Pod
-	events   chan watch.Event
-	watchers []*mockWatcher
+	Pods           map[string]*client.Pod
+	Services       map[string]*client.Service
+	EndpointSlices map[string]*client.EndpointSlice
+	ConfigMaps     map[string]*client.ConfigMap
+	Secrets        map[string]*client.Secret
+	events         chan event
+	watchers       []*mockWatcher
+	// the last resource version of the config maps and secrets
+	version int
 }
 
 // UpdatePod ...
@@ -28,10 +50,10 @@ func (m *Client) UpdatePod(podName string, pod *client.Pod) (*client.Pod, error)
 
 	pstr, _ := json.Marshal(p)
 
-	m.events <- watch.Event{
+	m.events <- event{kindPods, watch.Event{
 		Type:   watch.Modified,
 		Object: json.RawMessage(pstr),
-	}
+	}}
 
 	return nil, nil
 }
@@ -52,20 +74,274 @@ func (m *Client) ListPods(labels map[string]string) (*client.PodList, error) {
 
 // WatchPods ...
 func (m *Client) WatchPods(labels map[string]string) (watch.Watch, error) {
+	return m.watch(kindPods), nil
+}
+
+// ListServices ...
+func (m *Client) ListServices(labels map[string]string) (*client.ServiceList, error) {
+	m.Lock()
+	defer m.Unlock()
+
+	var services []client.Service
+	for _, v := range m.Services {
+		if labelFilterMatch(v.Metadata.Labels, labels) {
+			services = append(services, *v)
+		}
+	}
+	return &client.ServiceList{
+		Items: services,
+	}, nil
+}
+
+// WatchServices ...
+func (m *Client) WatchServices(labels map[string]string) (watch.Watch, error) {
+	return m.watch(kindServices), nil
+}
+
+// ListEndpointSlices ...
+func (m *Client) ListEndpointSlices(labels map[string]string) (*client.EndpointSliceList, error) {
+	m.Lock()
+	defer m.Unlock()
+
+	var slices []client.EndpointSlice
+	for _, v := range m.EndpointSlices {
+		if labelFilterMatch(v.Metadata.Labels, labels) {
+			slices = append(slices, *v)
+		}
+	}
+	return &client.EndpointSliceList{
+		Items: slices,
+	}, nil
+}
+
+// WatchEndpointSlices ...
+func (m *Client) WatchEndpointSlices(labels map[string]string) (watch.Watch, error) {
+	return m.watch(kindEndpointSlices), nil
+}
+
+// UpdateService adds or replaces a service and notifies the watchers
+func (m *Client) UpdateService(s *client.Service) {
+	m.Lock()
+	_, ok := m.Services[s.Metadata.Name]
+	m.Services[s.Metadata.Name] = s
+	m.Unlock()
+
+	m.send(kindServices, eventType(ok), s)
+}
+
+// DeleteService removes a service and notifies the watchers
+func (m *Client) DeleteService(name string) {
+	m.Lock()
+	s, ok := m.Services[name]
+	delete(m.Services, name)
+	m.Unlock()
+
+	if ok {
+		m.send(kindServices, watch.Deleted, s)
+	}
+}
+
+// UpdateEndpointSlice adds or replaces a slice and notifies the watchers
+func (m *Client) UpdateEndpointSlice(s *client.EndpointSlice) {
+	m.Lock()
+	_, ok := m.EndpointSlices[s.Metadata.Name]
+	m.EndpointSlices[s.Metadata.Name] = s
+	m.Unlock()
+
+	m.send(kindEndpointSlices, eventType(ok), s)
+}
+
+// DeleteEndpointSlice removes a slice and notifies the watchers
+func (m *Client) DeleteEndpointSlice(name string) {
+	m.Lock()
+	s, ok := m.EndpointSlices[name]
+	delete(m.EndpointSlices, name)
+	m.Unlock()
+
+	if ok {
+		m.send(kindEndpointSlices, watch.Deleted, s)
+	}
+}
+
+// GetConfigMap ...
+func (m *Client) GetConfigMap(name string) (*client.ConfigMap, error) {
+	m.Lock()
+	defer m.Unlock()
+
+	cm, ok := m.ConfigMaps[name]
+	if !ok {
+		return nil, api.ErrNotFound
+	}
+	return cm, nil
+}
+
+// CreateConfigMap ...
+func (m *Client) CreateConfigMap(cm *client.ConfigMap) (*client.ConfigMap, error) {
+	m.Lock()
+	if _, ok := m.ConfigMaps[cm.Metadata.Name]; ok {
+		m.Unlock()
+		return nil, api.ErrConflict
+	}
+	cm.Metadata.ResourceVersion = m.nextVersion()
+	m.ConfigMaps[cm.Metadata.Name] = cm
+	m.Unlock()
+
+	m.send(kindConfigMaps, watch.Added, cm)
+	return cm, nil
+}
+
+// UpdateConfigMap ...
+func (m *Client) UpdateConfigMap(name string, cm *client.ConfigMap) (*client.ConfigMap, error) {
+	m.Lock()
+	old, ok := m.ConfigMaps[name]
+	if !ok {
+		m.Unlock()
+		return nil, api.ErrNotFound
+	}
+	if v := cm.Metadata.ResourceVersion; v != "" && v != old.Metadata.ResourceVersion {
+		m.Unlock()
+		return nil, api.ErrConflict
+	}
+	cm.Metadata.ResourceVersion = m.nextVersion()
+	m.ConfigMaps[name] = cm
+	m.Unlock()
+
+	m.send(kindConfigMaps, watch.Modified, cm)
+	return cm, nil
+}
+
+// DeleteConfigMap ...
+func (m *Client) DeleteConfigMap(name string) error {
+	m.Lock()
+	cm, ok := m.ConfigMaps[name]
+	delete(m.ConfigMaps, name)
+	m.Unlock()
+
+	if !ok {
+		return api.ErrNotFound
+	}
+	m.send(kindConfigMaps, watch.Deleted, cm)
+	return nil
+}
+
+// WatchConfigMaps ...
+func (m *Client) WatchConfigMaps(labels map[string]string) (watch.Watch, error) {
+	return m.watch(kindConfigMaps), nil
+}
+
+// GetSecret ...
+func (m *Client) GetSecret(name string) (*client.Secret, error) {
+	m.Lock()
+	defer m.Unlock()
+
+	s, ok := m.Secrets[name]
+	if !ok {
+		return nil, api.ErrNotFound
+	}
+	return s, nil
+}
+
+// CreateSecret ...
+func (m *Client) CreateSecret(s *client.Secret) (*client.Secret, error) {
+	m.Lock()
+	if _, ok := m.Secrets[s.Metadata.Name]; ok {
+		m.Unlock()
+		return nil, api.ErrConflict
+	}
+	s.Metadata.ResourceVersion = m.nextVersion()
+	m.Secrets[s.Metadata.Name] = s
+	m.Unlock()
+
+	m.send(kindSecrets, watch.Added, s)
+	return s, nil
+}
+
+// UpdateSecret ...
+func (m *Client) UpdateSecret(name string, s *client.Secret) (*client.Secret, error) {
+	m.Lock()
+	old, ok := m.Secrets[name]
+	if !ok {
+		m.Unlock()
+		return nil, api.ErrNotFound
+	}
+	if v := s.Metadata.ResourceVersion; v != "" && v != old.Metadata.ResourceVersion {
+		m.Unlock()
+		return nil, api.ErrConflict
+	}
+	s.Metadata.ResourceVersion = m.nextVersion()
+	m.Secrets[name] = s
+	m.Unlock()
+
+	m.send(kindSecrets, watch.Modified, s)
+	return s, nil
+}
+
+// DeleteSecret ...
+func (m *Client) DeleteSecret(name string) error {
+	m.Lock()
+	s, ok := m.Secrets[name]
+	delete(m.Secrets, name)
+	m.Unlock()
+
+	if !ok {
+		return api.ErrNotFound
+	}
+	m.send(kindSecrets, watch.Deleted, s)
+	return nil
+}
+
+// WatchSecrets ...
+func (m *Client) WatchSecrets(labels map[string]string) (watch.Watch, error) {
+	return m.watch(kindSecrets), nil
+}
+
+// nextVersion returns a new resource version, called with the lock held
+func (m *Client) nextVersion() string {
+	m.version++
+	return strconv.Itoa(m.version)
+}
+
+func eventType(exists bool) watch.EventType {
+	if exists {
+		return watch.Modified
+	}
+	return watch.Added
+}
+
+func (m *Client) send(kind string, t watch.EventType, obj interface{}) {
+	b, _ := json.Marshal(obj)
+
+	m.events <- event{kind, watch.Event{
+		Type:   t,
+		Object: json.RawMessage(b),
+	}}
+}
+
+// watch adds a watcher of the resource kind
+func (m *Client) watch(kind string) *mockWatcher {
 	w := &mockWatcher{
+		kind:    kind,
 		results: make(chan watch.Event),
 		stop:    make(chan bool),
 	}
 
-	i := len(m.watchers) // length of watchers is current index
+	m.Lock()
 	m.watchers = append(m.watchers, w)
+	m.Unlock()
 
 	go func() {
 		<-w.stop
-		m.watchers = append(m.watchers[:i], m.watchers[i+1:]...)
+		m.Lock()
+		for i, v := range m.watchers {
+			if v == w {
+				m.watchers = append(m.watchers[:i], m.watchers[i+1:]...)
+				break
+			}
+		}
+		m.Unlock()
 	}()
 
-	return w, nil
+	return w
 }
 
 // newClient ...
@@ -76,15 +352,26 @@ func newClient() client.Kubernetes {
 // NewClient ...
 func NewClient() *Client {
 	c := &Client{
-		Pods:   make(map[string]*client.Pod),
-		events: make(chan watch.Event),
+		Pods:           make(map[string]*client.Pod),
+		Services:       make(map[string]*client.Service),
+		EndpointSlices: make(map[string]*client.EndpointSlice),
+		ConfigMaps:     make(map[string]*client.ConfigMap),
+		Secrets:        make(map[string]*client.Secret),
+		events:         make(chan event),
 	}
 
-	// broadcast events to watchers
+	// broadcast events to the watchers of the kind
 	go func() {
 		for e := range c.events {
-			for _, w := range c.watchers {
-				w.results <- e
+			c.Lock()
+			watchers := make([]*mockWatcher, len(c.watchers))
+			copy(watchers, c.watchers)
+			c.Unlock()
+
+			for _, w := range watchers {
+				if w.kind == e.kind {
+					w.send(e.Event)
+				}
 			}
 		}
 	}()
@@ -98,10 +385,10 @@ func Teardown(c *Client) {
 	for _, p := range c.Pods {
 		pstr, _ := json.Marshal(p)
 
-		c.events <- watch.Event{
+		c.events <- event{kindPods, watch.Event{
 			Type:   watch.Deleted,
 			Object: json.RawMessage(pstr),
-		}
+		}}
 	}
 
 	c.Pods = make(map[string]*client.Pod)
@@ -6,6 +6,7 @@ import (
 )
 
 type mockWatcher struct {
+	kind    string
 	results chan watch.Event
 	stop    chan bool
 }
@@ -22,7 +23,14 @@ func (w *mockWatcher) Stop() {
 		return
 	default:
 		close(w.stop)
-		close(w.results)
+	}
+}
+
+// send delivers the event unless the watcher was stopped
+func (w *mockWatcher) send(e watch.Event) {
+	select {
+	case w.results <- e:
+	case <-w.stop:
 	}
 }
 
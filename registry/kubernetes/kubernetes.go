@@ -10,10 +10,41 @@ import (
 	"strings"
 	"time"
 
+	"xmicro/common"
+	"xmicro/common/component"
+	"xmicro/common/constant"
 	"xmicro/registry"
 	"xmicro/registry/kubernetes/client"
 )
 
+func init() {
+	component.SetRegistryFactory(constant.KubernetesKey, &kubernetesRegistryFactory{})
+}
+
+type kubernetesRegistryFactory struct {
+}
+
+// GetRegistry connects in cluster when no address is configured
+func (f *kubernetesRegistryFactory) GetRegistry(url *common.URL) (registry.Registry, error) {
+	timeout := url.GetParam(constant.RegistryTimeoutKey, "1s")
+	timeDuration := constant.DefaultTimeout * time.Millisecond
+	if d, err := time.ParseDuration(timeout); err == nil {
+		timeDuration = d
+	}
+
+	opts := []registry.Option{
+		registry.Timeout(timeDuration),
+	}
+	if len(url.Location) > 0 && url.Location != ":" {
+		opts = append(opts, registry.Addrs(url.Location))
+	}
+	if url.GetParam(constant.KubernetesModeKey, "") == constant.KubernetesEndpointSlicesKey {
+		opts = append(opts, EndpointSlices())
+	}
+
+	return NewRegistry(opts...), nil
+}
+
 type kregistry struct {
 	client  client.Kubernetes
 	timeout time.Duration
@@ -106,12 +137,17 @@ func (c *kregistry) Register(s *registry.Service, opts ...registry.RegisterOptio
 		return errors.New("you must register at least one node")
 	}
 
+	var options registry.RegisterOptions
+	for _, o := range opts {
+		o(&options)
+	}
+
 	// TODO: grab podname from somewhere better than this.
 	podName := os.Getenv("HOSTNAME")
 	svcName := s.Name
 
-	// encode micro service
-	b, err := json.Marshal(s)
+	// encode micro service with its domain
+	b, err := json.Marshal(registry.WithDomain(s, options.Domain))
 	if err != nil {
 		return err
 	}
@@ -169,6 +205,11 @@ func (c *kregistry) Deregister(s *registry.Service, opts ...registry.DeregisterO
 // GetService will get all the pods with the given service selector,
 // and build services from the annotations.
 func (c *kregistry) GetService(name string, opts ...registry.GetOption) ([]*registry.Service, error) {
+	var options registry.GetOptions
+	for _, o := range opts {
+		o(&options)
+	}
+
 	pods, err := c.client.ListPods(map[string]string{
 		svcSelectorPrefix + serviceName(name): svcSelectorValue,
 	})
@@ -180,7 +221,7 @@ func (c *kregistry) GetService(name string, opts ...registry.GetOption) ([]*regi
 		return nil, registry.ErrNotFound
 	}
 
-	// svcs mapped by version
+	// svcs mapped by domain and version
 	svcs := make(map[string]*registry.Service)
 
 	// loop through items
@@ -200,17 +241,25 @@ func (c *kregistry) GetService(name string, opts ...registry.GetOption) ([]*regi
 		if err != nil {
 			return nil, fmt.Errorf("could not unmarshal service '%s' from pod annotation", name)
 		}
+		if !registry.MatchDomain(options.Domain, registry.Domain(&svc)) {
+			continue
+		}
 
 		// merge up pod service & ip with versioned service.
-		vs, ok := svcs[svc.Version]
+		key := registry.Domain(&svc) + "/" + svc.Version
+		vs, ok := svcs[key]
 		if !ok {
-			svcs[svc.Version] = &svc
+			svcs[key] = &svc
 			continue
 		}
 
 		vs.Nodes = append(vs.Nodes, svc.Nodes...)
 	}
 
+	if len(svcs) == 0 {
+		return nil, registry.ErrNotFound
+	}
+
 	list := make([]*registry.Service, 0, len(svcs))
 	for _, val := range svcs {
 		list = append(list, val)
@@ -220,6 +269,11 @@ func (c *kregistry) GetService(name string, opts ...registry.GetOption) ([]*regi
 
 // ListServices will list all the service names
 func (c *kregistry) ListServices(opts ...registry.ListOption) ([]*registry.Service, error) {
+	var options registry.ListOptions
+	for _, o := range opts {
+		o(&options)
+	}
+
 	pods, err := c.client.ListPods(podSelector)
 	if err != nil {
 		return nil, err
@@ -243,6 +297,9 @@ func (c *kregistry) ListServices(opts ...registry.ListOption) ([]*registry.Servi
 			if err := json.Unmarshal([]byte(*v), &svc); err != nil {
 				continue
 			}
+			if !registry.MatchDomain(options.Domain, registry.Domain(&svc)) {
+				continue
+			}
 			svcs[svc.Name] = true
 		}
 	}
@@ -269,5 +326,11 @@ func NewRegistry(opts ...registry.Option) registry.Registry {
 		options: registry.Options{},
 	}
 	configure(k, opts...)
+
+	if k.options.Context != nil {
+		if ok, _ := k.options.Context.Value(endpointSlicesKey{}).(bool); ok {
+			return &sliceRegistry{kregistry: k}
+		}
+	}
 	return k
 }
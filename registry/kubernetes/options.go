@@ -0,0 +1,21 @@
+package kubernetes
+
+import (
+	"context"
+
+	"xmicro/registry"
+)
+
+type endpointSlicesKey struct{}
+
+// EndpointSlices discovers services from kubernetes Services and their
+// EndpointSlices instead of pod annotations. Nodes are registered by
+// kubernetes itself, so Register and Deregister do nothing.
+func EndpointSlices() registry.Option {
+	return func(o *registry.Options) {
+		if o.Context == nil {
+			o.Context = context.Background()
+		}
+		o.Context = context.WithValue(o.Context, endpointSlicesKey{}, true)
+	}
+}
@@ -0,0 +1,201 @@
+package kubernetes
+
+import (
+	"encoding/json"
+	"net"
+	"strconv"
+	"strings"
+
+	log "xmicro/logger"
+	"xmicro/registry"
+	"xmicro/registry/kubernetes/client"
+)
+
+var (
+	// label set on endpoint slices with the name of their service
+	labelServiceName = "kubernetes.io/service-name"
+
+	// name of the endpoint slice port used for the nodes,
+	// the first port is used if there's none with the name
+	slicePortName = "micro"
+)
+
+// sliceRegistry discovers services from kubernetes Services labeled like
+// the pods of the annotation mode. The serialised micro service without
+// nodes is read from the annotation of the Service, the nodes are the
+// ready endpoints of its EndpointSlices.
+type sliceRegistry struct {
+	*kregistry
+}
+
+// Register is a no-op, the endpoints are managed by kubernetes
+func (s *sliceRegistry) Register(*registry.Service, ...registry.RegisterOption) error {
+	return nil
+}
+
+// Deregister is a no-op, the endpoints are managed by kubernetes
+func (s *sliceRegistry) Deregister(*registry.Service, ...registry.DeregisterOption) error {
+	return nil
+}
+
+// GetService builds the service from the annotation of the kubernetes
+// Service and the ready endpoints of its slices
+func (s *sliceRegistry) GetService(name string, opts ...registry.GetOption) ([]*registry.Service, error) {
+	var options registry.GetOptions
+	for _, o := range opts {
+		o(&options)
+	}
+
+	services, err := s.client.ListServices(map[string]string{
+		svcSelectorPrefix + serviceName(name): svcSelectorValue,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// svcs mapped by domain and version
+	svcs := make(map[string]*registry.Service)
+
+	for _, ks := range services.Items {
+		svc, ok := decodeService(&ks)
+		if !ok || svc.Name != name || !registry.MatchDomain(options.Domain, registry.Domain(svc)) {
+			continue
+		}
+
+		slices, err := s.client.ListEndpointSlices(map[string]string{
+			labelServiceName: ks.Metadata.Name,
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, slice := range slices.Items {
+			svc.Nodes = append(svc.Nodes, sliceNodes(&slice)...)
+		}
+
+		key := registry.Domain(svc) + "/" + svc.Version
+		vs, ok := svcs[key]
+		if !ok {
+			svcs[key] = svc
+			continue
+		}
+		vs.Nodes = append(vs.Nodes, svc.Nodes...)
+	}
+
+	if len(svcs) == 0 {
+		return nil, registry.ErrNotFound
+	}
+
+	list := make([]*registry.Service, 0, len(svcs))
+	for _, val := range svcs {
+		list = append(list, val)
+	}
+	return list, nil
+}
+
+// ListServices will list all the service names
+func (s *sliceRegistry) ListServices(opts ...registry.ListOption) ([]*registry.Service, error) {
+	var options registry.ListOptions
+	for _, o := range opts {
+		o(&options)
+	}
+
+	services, err := s.client.ListServices(podSelector)
+	if err != nil {
+		return nil, err
+	}
+
+	// svcs mapped by name
+	svcs := make(map[string]bool)
+
+	for _, ks := range services.Items {
+		if svc, ok := decodeService(&ks); ok && registry.MatchDomain(options.Domain, registry.Domain(svc)) {
+			svcs[svc.Name] = true
+		}
+	}
+
+	var list []*registry.Service
+	for val := range svcs {
+		list = append(list, &registry.Service{Name: val})
+	}
+	return list, nil
+}
+
+// Watch returns a watcher of the services and their endpoint slices
+func (s *sliceRegistry) Watch(opts ...registry.WatchOption) (registry.Watcher, error) {
+	return newSliceWatcher(s, opts...)
+}
+
+// decodeService returns the micro service serialised in the
+// annotation of the kubernetes Service
+func decodeService(ks *client.Service) (*registry.Service, bool) {
+	if ks.Metadata == nil {
+		return nil, false
+	}
+
+	for k, v := range ks.Metadata.Annotations {
+		if !strings.HasPrefix(k, annotationServiceKeyPrefix) || v == nil {
+			continue
+		}
+
+		var svc registry.Service
+		if err := json.Unmarshal([]byte(*v), &svc); err != nil {
+			log.Errorf("K8s: could not unmarshal service annotation of %s: %v", ks.Metadata.Name, err)
+			return nil, false
+		}
+		svc.Nodes = nil
+		return &svc, true
+	}
+
+	return nil, false
+}
+
+// sliceNodes returns the ready endpoints of the slice as nodes
+func sliceNodes(slice *client.EndpointSlice) []*registry.Node {
+	var port *int32
+	for _, p := range slice.Ports {
+		if p.Port == nil {
+			continue
+		}
+		if port == nil || (p.Name != nil && *p.Name == slicePortName) {
+			port = p.Port
+		}
+	}
+	if port == nil {
+		return nil
+	}
+
+	var nodes []*registry.Node
+
+	for _, ep := range slice.Endpoints {
+		// an unknown condition is interpreted as ready
+		if ep.Conditions.Ready != nil && !*ep.Conditions.Ready {
+			continue
+		}
+		if len(ep.Addresses) == 0 {
+			continue
+		}
+
+		address := net.JoinHostPort(ep.Addresses[0], strconv.Itoa(int(*port)))
+
+		id := address
+		if ep.TargetRef != nil && len(ep.TargetRef.Name) > 0 {
+			id = ep.TargetRef.Name
+		}
+
+		metadata := make(map[string]string)
+		if ep.Zone != nil {
+			metadata["zone"] = *ep.Zone
+		}
+		if ep.NodeName != nil {
+			metadata["node"] = *ep.NodeName
+		}
+
+		nodes = append(nodes, &registry.Node{
+			Id:       id,
+			Address:  address,
+			Metadata: metadata,
+		})
+	}
+
+	return nodes
+}
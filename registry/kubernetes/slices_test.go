@@ -0,0 +1,132 @@
+package kubernetes
+
+import (
+	"encoding/json"
+	"testing"
+
+	"xmicro/registry"
+	"xmicro/registry/kubernetes/client"
+	"xmicro/registry/kubernetes/client/mock"
+)
+
+func str(s string) *string { return &s }
+
+func newSliceRegistry() (*sliceRegistry, *mock.Client) {
+	c := mock.NewClient()
+	return &sliceRegistry{kregistry: &kregistry{client: c}}, c
+}
+
+func newK8sService(name, version string) *client.Service {
+	b, _ := json.Marshal(&registry.Service{
+		Name:      name,
+		Version:   version,
+		Endpoints: []*registry.Endpoint{{Name: "Greeter.Hello"}},
+	})
+
+	return &client.Service{
+		Metadata: &client.Meta{
+			Name: "greeter",
+			Labels: map[string]*string{
+				labelTypeKey:                          &labelTypeValueService,
+				svcSelectorPrefix + serviceName(name): &svcSelectorValue,
+			},
+			Annotations: map[string]*string{
+				annotationServiceKeyPrefix + serviceName(name): str(string(b)),
+			},
+		},
+	}
+}
+
+func newSlice(name string, ready map[string]bool) *client.EndpointSlice {
+	port := int32(8080)
+	slice := &client.EndpointSlice{
+		Metadata: &client.Meta{
+			Name:   name,
+			Labels: map[string]*string{labelServiceName: str("greeter")},
+		},
+		AddressType: "IPv4",
+		Ports:       []client.EndpointPort{{Name: str("micro"), Port: &port}},
+	}
+	for ip, ok := range ready {
+		ok := ok
+		slice.Endpoints = append(slice.Endpoints, client.Endpoint{
+			Addresses:  []string{ip},
+			Conditions: client.EndpointConditions{Ready: &ok},
+			TargetRef:  &client.ObjectReference{Kind: "Pod", Name: "pod-" + ip},
+		})
+	}
+	return slice
+}
+
+func TestSliceGetService(t *testing.T) {
+	r, c := newSliceRegistry()
+	c.Services["greeter"] = newK8sService("go.micro.greeter", "1.0.0")
+	c.EndpointSlices["greeter-abc"] = newSlice("greeter-abc", map[string]bool{"10.0.0.1": true, "10.0.0.2": false})
+
+	services, err := r.GetService("go.micro.greeter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(services) != 1 || len(services[0].Endpoints) != 1 {
+		t.Fatalf("Unexpected services %+v", services)
+	}
+	// only the ready endpoint is a node
+	nodes := services[0].Nodes
+	if len(nodes) != 1 || nodes[0].Id != "pod-10.0.0.1" || nodes[0].Address != "10.0.0.1:8080" {
+		t.Fatalf("Unexpected nodes %+v", nodes)
+	}
+
+	list, err := r.ListServices()
+	if err != nil || len(list) != 1 || list[0].Name != "go.micro.greeter" {
+		t.Fatalf("Unexpected list %+v %v", list, err)
+	}
+
+	if _, err := r.GetService("unknown"); err != registry.ErrNotFound {
+		t.Fatalf("Expected not found got %v", err)
+	}
+}
+
+func TestSliceWatcher(t *testing.T) {
+	r, c := newSliceRegistry()
+	c.Services["greeter"] = newK8sService("go.micro.greeter", "1.0.0")
+
+	w, err := r.Watch()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Stop()
+
+	next := func(action string, ids ...string) {
+		t.Helper()
+		res, err := w.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Action != action || len(res.Service.Nodes) != len(ids) {
+			t.Fatalf("Expected %s of %v got %s %+v", action, ids, res.Action, res.Service.Nodes)
+		}
+		for i, id := range ids {
+			if res.Service.Nodes[i].Id != id {
+				t.Fatalf("Expected %s got %s", id, res.Service.Nodes[i].Id)
+			}
+		}
+	}
+
+	c.UpdateEndpointSlice(newSlice("greeter-abc", map[string]bool{"10.0.0.1": true}))
+	next("update", "pod-10.0.0.1")
+
+	// the endpoint turns unready
+	c.UpdateEndpointSlice(newSlice("greeter-abc", map[string]bool{"10.0.0.1": false}))
+	next("delete", "pod-10.0.0.1")
+
+	c.UpdateEndpointSlice(newSlice("greeter-abc", map[string]bool{"10.0.0.1": true}))
+	next("update", "pod-10.0.0.1")
+
+	// a new version of the service replaces the nodes
+	c.UpdateService(newK8sService("go.micro.greeter", "2.0.0"))
+	next("delete", "pod-10.0.0.1")
+	next("create", "pod-10.0.0.1")
+
+	c.DeleteService("greeter")
+	next("delete", "pod-10.0.0.1")
+}
@@ -0,0 +1,283 @@
+package kubernetes
+
+import (
+	"encoding/json"
+	"reflect"
+	"sync"
+
+	log "xmicro/logger"
+	"xmicro/registry"
+	"xmicro/registry/kubernetes/client"
+	"xmicro/registry/kubernetes/client/watch"
+)
+
+// sliceWatcher watches the kubernetes services and their endpoint
+// slices and sends the changed nodes as results
+type sliceWatcher struct {
+	registry *sliceRegistry
+	wo       registry.WatchOptions
+	services watch.Watch
+	slices   watch.Watch
+	next     chan *registry.Result
+	exit     chan bool
+	once     sync.Once
+
+	// micro services by kubernetes service name
+	svcs map[string]*registry.Service
+	// kubernetes service name of the slices
+	owners map[string]string
+	// ready nodes by slice name
+	nodes map[string][]*registry.Node
+}
+
+func newSliceWatcher(s *sliceRegistry, opts ...registry.WatchOption) (registry.Watcher, error) {
+	var wo registry.WatchOptions
+	for _, o := range opts {
+		o(&wo)
+	}
+
+	selector := podSelector
+	if len(wo.Service) > 0 {
+		selector = map[string]string{
+			svcSelectorPrefix + serviceName(wo.Service): svcSelectorValue,
+		}
+	}
+
+	services, err := s.client.WatchServices(selector)
+	if err != nil {
+		return nil, err
+	}
+	slices, err := s.client.WatchEndpointSlices(nil)
+	if err != nil {
+		services.Stop()
+		return nil, err
+	}
+
+	w := &sliceWatcher{
+		registry: s,
+		wo:       wo,
+		services: services,
+		slices:   slices,
+		next:     make(chan *registry.Result),
+		exit:     make(chan bool),
+		svcs:     make(map[string]*registry.Service),
+		owners:   make(map[string]string),
+		nodes:    make(map[string][]*registry.Node),
+	}
+
+	// build the cache, but dont emit changes
+	if err := w.load(selector); err != nil {
+		w.Stop()
+		return nil, err
+	}
+
+	go w.run()
+
+	return w, nil
+}
+
+func (w *sliceWatcher) load(selector map[string]string) error {
+	services, err := w.registry.client.ListServices(selector)
+	if err != nil {
+		return err
+	}
+	for _, ks := range services.Items {
+		if svc, ok := w.decode(&ks); ok {
+			w.svcs[ks.Metadata.Name] = svc
+		}
+	}
+
+	slices, err := w.registry.client.ListEndpointSlices(nil)
+	if err != nil {
+		return err
+	}
+	for _, slice := range slices.Items {
+		w.setSlice(&slice)
+	}
+
+	return nil
+}
+
+func (w *sliceWatcher) run() {
+	defer w.Stop()
+
+	for {
+		var results []*registry.Result
+
+		select {
+		case ev, ok := <-w.services.ResultChan():
+			if !ok {
+				return
+			}
+			results = w.handleService(ev)
+		case ev, ok := <-w.slices.ResultChan():
+			if !ok {
+				return
+			}
+			results = w.handleSlice(ev)
+		case <-w.exit:
+			return
+		}
+
+		for _, r := range results {
+			select {
+			case w.next <- r:
+			case <-w.exit:
+				return
+			}
+		}
+	}
+}
+
+// decode returns the micro service of the kubernetes service if watched
+func (w *sliceWatcher) decode(ks *client.Service) (*registry.Service, bool) {
+	svc, ok := decodeService(ks)
+	if !ok || (len(w.wo.Service) > 0 && svc.Name != w.wo.Service) || !registry.MatchDomain(w.wo.Domain, registry.Domain(svc)) {
+		return nil, false
+	}
+	return svc, true
+}
+
+// setSlice records the nodes of the slice and returns the previous ones
+func (w *sliceWatcher) setSlice(slice *client.EndpointSlice) []*registry.Node {
+	name := slice.Metadata.Name
+	prev := w.nodes[name]
+
+	w.nodes[name] = sliceNodes(slice)
+	if owner := slice.Metadata.Labels[labelServiceName]; owner != nil {
+		w.owners[name] = *owner
+	}
+
+	return prev
+}
+
+// serviceNodes returns the nodes of all slices of the kubernetes service
+func (w *sliceWatcher) serviceNodes(owner string) []*registry.Node {
+	var nodes []*registry.Node
+	for slice, o := range w.owners {
+		if o == owner {
+			nodes = append(nodes, w.nodes[slice]...)
+		}
+	}
+	return nodes
+}
+
+func result(action string, svc *registry.Service, nodes []*registry.Node) *registry.Result {
+	s := *svc
+	s.Nodes = nodes
+	return &registry.Result{Action: action, Service: &s}
+}
+
+func (w *sliceWatcher) handleService(ev watch.Event) []*registry.Result {
+	var ks client.Service
+	if err := json.Unmarshal(ev.Object, &ks); err != nil || ks.Metadata == nil {
+		log.Error("K8s Watcher: Couldnt unmarshal event object from service")
+		return nil
+	}
+
+	name := ks.Metadata.Name
+	prev := w.svcs[name]
+	nodes := w.serviceNodes(name)
+
+	var results []*registry.Result
+
+	svc, ok := w.decode(&ks)
+	if ev.Type == watch.Deleted || !ok {
+		delete(w.svcs, name)
+		if prev != nil && len(nodes) > 0 {
+			results = append(results, result("delete", prev, nodes))
+		}
+		return results
+	}
+
+	w.svcs[name] = svc
+	if len(nodes) == 0 {
+		return nil
+	}
+
+	switch {
+	case prev == nil:
+		results = append(results, result("create", svc, nodes))
+	case prev.Version != svc.Version:
+		results = append(results, result("delete", prev, nodes), result("create", svc, nodes))
+	case !reflect.DeepEqual(prev, svc):
+		results = append(results, result("update", svc, nodes))
+	}
+
+	return results
+}
+
+func (w *sliceWatcher) handleSlice(ev watch.Event) []*registry.Result {
+	var slice client.EndpointSlice
+	if err := json.Unmarshal(ev.Object, &slice); err != nil || slice.Metadata == nil {
+		log.Error("K8s Watcher: Couldnt unmarshal event object from endpoint slice")
+		return nil
+	}
+
+	var prev, cur []*registry.Node
+	var owner string
+
+	if ev.Type == watch.Deleted {
+		prev = w.nodes[slice.Metadata.Name]
+		owner = w.owners[slice.Metadata.Name]
+		delete(w.nodes, slice.Metadata.Name)
+		delete(w.owners, slice.Metadata.Name)
+	} else {
+		prev = w.setSlice(&slice)
+		cur = w.nodes[slice.Metadata.Name]
+		owner = w.owners[slice.Metadata.Name]
+	}
+
+	svc, ok := w.svcs[owner]
+	if !ok {
+		return nil
+	}
+
+	before := make(map[string]*registry.Node, len(prev))
+	for _, n := range prev {
+		before[n.Id] = n
+	}
+
+	var changed []*registry.Node
+	for _, n := range cur {
+		if p, ok := before[n.Id]; !ok || !reflect.DeepEqual(p, n) {
+			changed = append(changed, n)
+		}
+		delete(before, n.Id)
+	}
+
+	var results []*registry.Result
+	if len(changed) > 0 {
+		results = append(results, result("update", svc, changed))
+	}
+	if len(before) > 0 {
+		var removed []*registry.Node
+		for _, n := range prev {
+			if _, ok := before[n.Id]; ok {
+				removed = append(removed, n)
+			}
+		}
+		results = append(results, result("delete", svc, removed))
+	}
+
+	return results
+}
+
+// Next will block until a new result comes in
+func (w *sliceWatcher) Next() (*registry.Result, error) {
+	select {
+	case r := <-w.next:
+		return r, nil
+	case <-w.exit:
+		return nil, registry.ErrWatcherStopped
+	}
+}
+
+// Stop will cancel the watches
+func (w *sliceWatcher) Stop() {
+	w.once.Do(func() {
+		close(w.exit)
+		w.services.Stop()
+		w.slices.Stop()
+	})
+}
@@ -16,6 +16,8 @@ type k8sWatcher struct {
 	registry *kregistry
 	watcher  watch.Watch
 	next     chan *registry.Result
+	// domain of the watched services
+	domain string
 
 	sync.RWMutex
 	pods map[string]*client.Pod
@@ -91,7 +93,7 @@ func (k *k8sWatcher) buildPodResults(pod *client.Pod, cache *client.Pod) []*regi
 
 			// unmarshal service notation from annotation value
 			err := json.Unmarshal([]byte(*av), &rslt.Service)
-			if err != nil {
+			if err != nil || !registry.MatchDomain(k.domain, registry.Domain(rslt.Service)) {
 				continue
 			}
 
@@ -115,7 +117,7 @@ func (k *k8sWatcher) buildPodResults(pod *client.Pod, cache *client.Pod) []*regi
 			rslt := &registry.Result{Action: "delete"}
 			// unmarshal service notation from annotation value
 			err := json.Unmarshal([]byte(*av), &rslt.Service)
-			if err != nil {
+			if err != nil || !registry.MatchDomain(k.domain, registry.Domain(rslt.Service)) {
 				continue
 			}
 
@@ -228,6 +230,7 @@ func newWatcher(kr *kregistry, opts ...registry.WatchOption) (registry.Watcher,
 		registry: kr,
 		watcher:  watcher,
 		next:     make(chan *registry.Result),
+		domain:   wo.Domain,
 		pods:     make(map[string]*client.Pod),
 	}
 
@@ -0,0 +1,52 @@
+package mdns
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+
+	"xmicro/registry"
+)
+
+// max length of a txt record string
+var txtLength = 255
+
+// encode serialises the service of a single node into txt record strings
+func encode(s *registry.Service, node *registry.Node) ([]string, error) {
+	b, err := json.Marshal(&registry.Service{
+		Name:      s.Name,
+		Version:   s.Version,
+		Metadata:  s.Metadata,
+		Endpoints: s.Endpoints,
+		Nodes:     []*registry.Node{node},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	str := base64.StdEncoding.EncodeToString(b)
+
+	var txt []string
+	for len(str) > txtLength {
+		txt = append(txt, str[:txtLength])
+		str = str[txtLength:]
+	}
+	return append(txt, str), nil
+}
+
+// decode returns the service of a single node from txt record strings
+func decode(txt []string) (*registry.Service, error) {
+	b, err := base64.StdEncoding.DecodeString(strings.Join(txt, ""))
+	if err != nil {
+		return nil, err
+	}
+
+	var s registry.Service
+	if err := json.Unmarshal(b, &s); err != nil {
+		return nil, err
+	}
+	if len(s.Nodes) != 1 {
+		return nil, errInvalidRecord
+	}
+	return &s, nil
+}
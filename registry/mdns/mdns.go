@@ -0,0 +1,315 @@
+// Package mdns provides a multicast dns registry for local development.
+// Every node is announced as an instance of the _micro._tcp service with
+// the serialised service in its txt record, so processes on the same
+// network find each other without any infrastructure.
+package mdns
+
+import (
+	"errors"
+	"net"
+	"regexp"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/mdns"
+	"github.com/miekg/dns"
+)
+
+import (
+	"xmicro/common"
+	"xmicro/common/component"
+	"xmicro/common/constant"
+	"xmicro/logger"
+	"xmicro/registry"
+)
+
+var (
+	// DefaultTimeout of a query
+	DefaultTimeout = 500 * time.Millisecond
+	// DefaultWatchInterval is how often watchers query for changes
+	DefaultWatchInterval = 5 * time.Second
+
+	// mdns service all nodes are instances of
+	mdnsService = "_micro._tcp"
+	mdnsDomain  = "local"
+
+	errInvalidRecord = errors.New("invalid mdns record")
+
+	// characters which aren't valid in a dns label
+	labelRe = regexp.MustCompile("[^-A-Za-z0-9]")
+)
+
+func init() {
+	component.SetRegistryFactory(constant.MdnsKey, &mdnsRegistryFactory{})
+}
+
+type mdnsRegistryFactory struct {
+}
+
+func (f *mdnsRegistryFactory) GetRegistry(url *common.URL) (registry.Registry, error) {
+	timeout := url.GetParam(constant.RegistryTimeoutKey, DefaultTimeout.String())
+	timeDuration := DefaultTimeout
+	if d, err := time.ParseDuration(timeout); err == nil {
+		timeDuration = d
+	}
+	return NewRegistry(registry.Timeout(timeDuration)), nil
+}
+
+type mdnsRegistry struct {
+	opts     registry.Options
+	interval time.Duration
+
+	sync.Mutex
+	// announced nodes by node id
+	zone   *zone
+	server *mdns.Server
+}
+
+// zone answers the queries with the records of all registered nodes
+type zone struct {
+	sync.RWMutex
+	services map[string]*mdns.MDNSService
+}
+
+func (z *zone) Records(q dns.Question) []dns.RR {
+	z.RLock()
+	defer z.RUnlock()
+
+	var rr []dns.RR
+	for _, s := range z.services {
+		rr = append(rr, s.Records(q)...)
+	}
+	return rr
+}
+
+// NewRegistry returns a new mdns registry
+func NewRegistry(opts ...registry.Option) registry.Registry {
+	m := &mdnsRegistry{
+		zone: &zone{services: make(map[string]*mdns.MDNSService)},
+	}
+	configure(m, opts...)
+	return m
+}
+
+func configure(m *mdnsRegistry, opts ...registry.Option) {
+	for _, o := range opts {
+		o(&m.opts)
+	}
+
+	if m.opts.Timeout == 0 {
+		m.opts.Timeout = DefaultTimeout
+	}
+
+	m.interval = DefaultWatchInterval
+	if m.opts.Context != nil {
+		if d, ok := m.opts.Context.Value(intervalKey{}).(time.Duration); ok && d > 0 {
+			m.interval = d
+		}
+	}
+}
+
+func (m *mdnsRegistry) Init(opts ...registry.Option) error {
+	configure(m, opts...)
+	return nil
+}
+
+func (m *mdnsRegistry) Options() registry.Options {
+	return m.opts
+}
+
+// instance returns the dns label of the node
+func instance(node *registry.Node) string {
+	return labelRe.ReplaceAllString(node.Id, "-")
+}
+
+func (m *mdnsRegistry) Register(s *registry.Service, opts ...registry.RegisterOption) error {
+	if len(s.Nodes) == 0 {
+		return errors.New("you must register at least one node")
+	}
+
+	var options registry.RegisterOptions
+	for _, o := range opts {
+		o(&options)
+	}
+
+	// the domain is kept in the service metadata
+	s = registry.WithDomain(s, options.Domain)
+
+	m.Lock()
+	defer m.Unlock()
+
+	for _, node := range s.Nodes {
+		host, pt, err := net.SplitHostPort(node.Address)
+		if err != nil {
+			return err
+		}
+		port, err := strconv.Atoi(pt)
+		if err != nil {
+			return err
+		}
+
+		var ips []net.IP
+		if ip := net.ParseIP(host); ip != nil && !ip.IsUnspecified() {
+			ips = []net.IP{ip}
+		}
+
+		txt, err := encode(s, node)
+		if err != nil {
+			return err
+		}
+
+		name := instance(node)
+		service, err := mdns.NewMDNSService(name, mdnsService, "", name+"."+mdnsDomain+".", port, ips, txt)
+		if err != nil {
+			return err
+		}
+
+		m.zone.Lock()
+		m.zone.services[node.Id] = service
+		m.zone.Unlock()
+	}
+
+	if m.server != nil {
+		return nil
+	}
+
+	server, err := mdns.NewServer(&mdns.Config{Zone: m.zone})
+	if err != nil {
+		return err
+	}
+	m.server = server
+	return nil
+}
+
+func (m *mdnsRegistry) Deregister(s *registry.Service, opts ...registry.DeregisterOption) error {
+	m.Lock()
+	defer m.Unlock()
+
+	m.zone.Lock()
+	for _, node := range s.Nodes {
+		delete(m.zone.services, node.Id)
+	}
+	empty := len(m.zone.services) == 0
+	m.zone.Unlock()
+
+	// stop answering once nothing is registered
+	if empty && m.server != nil {
+		m.server.Shutdown()
+		m.server = nil
+	}
+	return nil
+}
+
+// query returns the services of all nodes on the network by node id
+func (m *mdnsRegistry) query() (map[string]*registry.Service, error) {
+	entries := make(chan *mdns.ServiceEntry, 32)
+
+	// the entries are still written to while the query runs,
+	// so they are only read once it finished
+	var received []*mdns.ServiceEntry
+	done := make(chan bool)
+	go func() {
+		defer close(done)
+		for e := range entries {
+			received = append(received, e)
+		}
+	}()
+
+	params := mdns.DefaultParams(mdnsService)
+	params.Domain = mdnsDomain
+	params.Timeout = m.opts.Timeout
+	params.Entries = entries
+
+	err := mdns.Query(params)
+	close(entries)
+	<-done
+
+	if err != nil {
+		return nil, err
+	}
+
+	nodes := make(map[string]*registry.Service)
+	for _, e := range received {
+		s, err := decode(e.InfoFields)
+		if err != nil {
+			logger.Debugf("[mdns] ignoring record %s: %v", e.Name, err)
+			continue
+		}
+		nodes[s.Nodes[0].Id] = s
+	}
+	return nodes, nil
+}
+
+func (m *mdnsRegistry) GetService(name string, opts ...registry.GetOption) ([]*registry.Service, error) {
+	var options registry.GetOptions
+	for _, o := range opts {
+		o(&options)
+	}
+
+	nodes, err := m.query()
+	if err != nil {
+		return nil, err
+	}
+
+	// svcs mapped by domain and version
+	svcs := make(map[string]*registry.Service)
+	var keys []string
+
+	for _, s := range nodes {
+		if s.Name != name || !registry.MatchDomain(options.Domain, registry.Domain(s)) {
+			continue
+		}
+		key := registry.Domain(s) + "/" + s.Version
+		vs, ok := svcs[key]
+		if !ok {
+			svcs[key] = s
+			keys = append(keys, key)
+			continue
+		}
+		vs.Nodes = append(vs.Nodes, s.Nodes...)
+	}
+
+	if len(svcs) == 0 {
+		return nil, registry.ErrNotFound
+	}
+
+	sort.Strings(keys)
+	list := make([]*registry.Service, 0, len(keys))
+	for _, v := range keys {
+		list = append(list, svcs[v])
+	}
+	return list, nil
+}
+
+func (m *mdnsRegistry) ListServices(opts ...registry.ListOption) ([]*registry.Service, error) {
+	var options registry.ListOptions
+	for _, o := range opts {
+		o(&options)
+	}
+
+	nodes, err := m.query()
+	if err != nil {
+		return nil, err
+	}
+
+	names := make(map[string]bool)
+	var list []*registry.Service
+	for _, s := range nodes {
+		if names[s.Name] || !registry.MatchDomain(options.Domain, registry.Domain(s)) {
+			continue
+		}
+		names[s.Name] = true
+		list = append(list, &registry.Service{Name: s.Name})
+	}
+	return list, nil
+}
+
+func (m *mdnsRegistry) Watch(opts ...registry.WatchOption) (registry.Watcher, error) {
+	return newWatcher(m, opts...)
+}
+
+func (m *mdnsRegistry) String() string {
+	return "mdns"
+}
@@ -0,0 +1,63 @@
+package mdns
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"xmicro/registry"
+)
+
+func testService() *registry.Service {
+	return &registry.Service{
+		Name:      "greeter",
+		Version:   "1.0.0",
+		Metadata:  map[string]string{"domain": "micro"},
+		Endpoints: []*registry.Endpoint{{Name: "Greeter." + strings.Repeat("Hello", 100)}},
+		Nodes: []*registry.Node{
+			{Id: "greeter-1", Address: "127.0.0.1:8080", Metadata: map[string]string{"protocol": "grpc"}},
+		},
+	}
+}
+
+func TestEncoding(t *testing.T) {
+	s := testService()
+
+	txt, err := encode(s, s.Nodes[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range txt {
+		if len(v) > txtLength {
+			t.Fatalf("txt string of %d bytes", len(v))
+		}
+	}
+
+	out, err := decode(txt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(out, s) {
+		t.Fatalf("Expected %+v got %+v", s, out)
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry(registry.Timeout(200 * time.Millisecond))
+
+	if err := r.Register(testService()); err != nil {
+		t.Skipf("mdns unavailable: %v", err)
+	}
+	defer r.Deregister(testService())
+
+	services, err := r.GetService("greeter")
+	if err == registry.ErrNotFound {
+		t.Skip("no multicast on this network")
+	} else if err != nil {
+		t.Fatal(err)
+	}
+	if len(services) != 1 || services[0].Nodes[0].Id != "greeter-1" {
+		t.Fatalf("Unexpected services %+v", services)
+	}
+}
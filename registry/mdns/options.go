@@ -0,0 +1,24 @@
+package mdns
+
+import (
+	"context"
+	"time"
+
+	"xmicro/registry"
+)
+
+type intervalKey struct{}
+
+func setRegistryOption(k, v interface{}) registry.Option {
+	return func(o *registry.Options) {
+		if o.Context == nil {
+			o.Context = context.Background()
+		}
+		o.Context = context.WithValue(o.Context, k, v)
+	}
+}
+
+// WatchInterval sets how often watchers query the network for changes
+func WatchInterval(d time.Duration) registry.Option {
+	return setRegistryOption(intervalKey{}, d)
+}
@@ -0,0 +1,114 @@
+package mdns
+
+import (
+	"reflect"
+	"sync"
+	"time"
+
+	"xmicro/logger"
+	"xmicro/registry"
+)
+
+// mdnsWatcher queries the network on an interval and sends the
+// differences to the previous query as results
+type mdnsWatcher struct {
+	m    *mdnsRegistry
+	wo   registry.WatchOptions
+	next chan *registry.Result
+	exit chan bool
+	once sync.Once
+}
+
+func newWatcher(m *mdnsRegistry, opts ...registry.WatchOption) (registry.Watcher, error) {
+	var wo registry.WatchOptions
+	for _, o := range opts {
+		o(&wo)
+	}
+
+	w := &mdnsWatcher{
+		m:    m,
+		wo:   wo,
+		next: make(chan *registry.Result),
+		exit: make(chan bool),
+	}
+
+	go w.run()
+
+	return w, nil
+}
+
+func (w *mdnsWatcher) run() {
+	t := time.NewTicker(w.m.interval)
+	defer t.Stop()
+
+	prev := make(map[string]*registry.Service)
+
+	for {
+		cur, err := w.m.query()
+		if err != nil {
+			logger.Warnf("[mdns] watch query failed: %v", err)
+			cur = prev
+		}
+
+		for id, s := range cur {
+			if (len(w.wo.Service) > 0 && s.Name != w.wo.Service) || !registry.MatchDomain(w.wo.Domain, registry.Domain(s)) {
+				delete(cur, id)
+			}
+		}
+
+		if !w.diff(prev, cur) {
+			return
+		}
+		prev = cur
+
+		select {
+		case <-t.C:
+		case <-w.exit:
+			return
+		}
+	}
+}
+
+// diff sends the results between the nodes, returns false when stopped
+func (w *mdnsWatcher) diff(prev, cur map[string]*registry.Service) bool {
+	var results []*registry.Result
+
+	for id, s := range cur {
+		p, ok := prev[id]
+		switch {
+		case !ok:
+			results = append(results, &registry.Result{Action: "create", Service: s})
+		case !reflect.DeepEqual(p, s):
+			results = append(results, &registry.Result{Action: "update", Service: s})
+		}
+	}
+	for id, s := range prev {
+		if _, ok := cur[id]; !ok {
+			results = append(results, &registry.Result{Action: "delete", Service: s})
+		}
+	}
+
+	for _, r := range results {
+		select {
+		case w.next <- r:
+		case <-w.exit:
+			return false
+		}
+	}
+	return true
+}
+
+func (w *mdnsWatcher) Next() (*registry.Result, error) {
+	select {
+	case r := <-w.next:
+		return r, nil
+	case <-w.exit:
+		return nil, registry.ErrWatcherStopped
+	}
+}
+
+func (w *mdnsWatcher) Stop() {
+	w.once.Do(func() {
+		close(w.exit)
+	})
+}
@@ -432,9 +432,9 @@ func (m *Registry) ListServices(opts ...registry.ListOption) ([]*registry.Servic
 	// serialize the result, each version counts as an individual service
 	var result []*registry.Service
 
-	for domain, service := range services {
+	for _, service := range services {
 		for _, version := range service {
-			result = append(result, recordToService(version, domain))
+			result = append(result, recordToService(version, options.Domain))
 		}
 	}
 
@@ -0,0 +1,222 @@
+// Package multi aggregates several registries into one
+package multi
+
+import (
+	"sort"
+	"strconv"
+	"sync"
+
+	"xmicro/logger"
+	"xmicro/registry"
+)
+
+// Source is one of the aggregated registries
+type Source struct {
+	registry.Registry
+	// Name the nodes are tagged with
+	Name string
+	// Zone the registry belongs to
+	Zone string
+	// Preferred registries win when a node is found in several
+	Preferred bool
+}
+
+type multiRegistry struct {
+	// sources ordered by preference
+	sources []*Source
+}
+
+// NewRegistry returns a registry which registers services to all the
+// sources and merges what they return. Nodes are de-duplicated by id
+// and tagged with the name, zone and preference of their source.
+func NewRegistry(sources ...*Source) registry.Registry {
+	s := make([]*Source, len(sources))
+	copy(s, sources)
+
+	// the preferred sources come first, the rest keep their order
+	sort.SliceStable(s, func(i, j int) bool {
+		return s[i].Preferred && !s[j].Preferred
+	})
+
+	return &multiRegistry{sources: s}
+}
+
+func (m *multiRegistry) Init(opts ...registry.Option) error {
+	for _, s := range m.sources {
+		if err := s.Init(opts...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *multiRegistry) Options() registry.Options {
+	if len(m.sources) == 0 {
+		return registry.Options{}
+	}
+	return m.sources[0].Options()
+}
+
+// Register registers to every source, the first error is returned
+// after all of them were tried
+func (m *multiRegistry) Register(s *registry.Service, opts ...registry.RegisterOption) error {
+	var gerr error
+	for _, src := range m.sources {
+		if err := src.Register(s, opts...); err != nil {
+			logger.Errorf("[multi] register %s to %s failed: %v", s.Name, src.Name, err)
+			if gerr == nil {
+				gerr = err
+			}
+		}
+	}
+	return gerr
+}
+
+func (m *multiRegistry) Deregister(s *registry.Service, opts ...registry.DeregisterOption) error {
+	var gerr error
+	for _, src := range m.sources {
+		if err := src.Deregister(s, opts...); err != nil {
+			logger.Errorf("[multi] deregister %s from %s failed: %v", s.Name, src.Name, err)
+			if gerr == nil {
+				gerr = err
+			}
+		}
+	}
+	return gerr
+}
+
+// query calls fn on every source concurrently and returns the
+// results in source order. An error is only returned when all fail.
+func (m *multiRegistry) query(fn func(*Source) ([]*registry.Service, error)) ([][]*registry.Service, error) {
+	results := make([][]*registry.Service, len(m.sources))
+	errs := make([]error, len(m.sources))
+
+	var wg sync.WaitGroup
+	for i, src := range m.sources {
+		wg.Add(1)
+		go func(i int, src *Source) {
+			defer wg.Done()
+			results[i], errs[i] = fn(src)
+		}(i, src)
+	}
+	wg.Wait()
+
+	var gerr error
+	var ok bool
+	for i, err := range errs {
+		switch {
+		case err == nil:
+			ok = true
+		case err == registry.ErrNotFound:
+		default:
+			logger.Warnf("[multi] query of %s failed: %v", m.sources[i].Name, err)
+			if gerr == nil {
+				gerr = err
+			}
+		}
+	}
+
+	if !ok {
+		if gerr == nil {
+			gerr = registry.ErrNotFound
+		}
+		return nil, gerr
+	}
+	return results, nil
+}
+
+func (m *multiRegistry) GetService(name string, opts ...registry.GetOption) ([]*registry.Service, error) {
+	results, err := m.query(func(s *Source) ([]*registry.Service, error) {
+		return s.GetService(name, opts...)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	services := m.merge(results)
+	if len(services) == 0 {
+		return nil, registry.ErrNotFound
+	}
+	return services, nil
+}
+
+func (m *multiRegistry) ListServices(opts ...registry.ListOption) ([]*registry.Service, error) {
+	results, err := m.query(func(s *Source) ([]*registry.Service, error) {
+		return s.ListServices(opts...)
+	})
+	if err == registry.ErrNotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return m.merge(results), nil
+}
+
+// merge combines the services of the sources by domain, name and version.
+// A node found in several sources is kept from the most preferred one.
+func (m *multiRegistry) merge(results [][]*registry.Service) []*registry.Service {
+	var services []*registry.Service
+	index := make(map[string]*registry.Service)
+	seen := make(map[string]bool)
+
+	for i, res := range results {
+		src := m.sources[i]
+
+		for _, s := range res {
+			k := serviceKey(s)
+
+			merged, ok := index[k]
+			if !ok {
+				merged = &registry.Service{
+					Name:      s.Name,
+					Version:   s.Version,
+					Metadata:  s.Metadata,
+					Endpoints: s.Endpoints,
+				}
+				index[k] = merged
+				services = append(services, merged)
+			}
+
+			for _, n := range s.Nodes {
+				if seen[k+"/"+n.Id] {
+					continue
+				}
+				seen[k+"/"+n.Id] = true
+				merged.Nodes = append(merged.Nodes, src.tag(n))
+			}
+		}
+	}
+
+	return services
+}
+
+func (m *multiRegistry) Watch(opts ...registry.WatchOption) (registry.Watcher, error) {
+	return newWatcher(m, opts...)
+}
+
+func (m *multiRegistry) String() string {
+	return "multi"
+}
+
+// tag returns a copy of the node tagged with the source
+func (s *Source) tag(n *registry.Node) *registry.Node {
+	md := make(map[string]string, len(n.Metadata)+3)
+	for k, v := range n.Metadata {
+		md[k] = v
+	}
+	md[registry.SourceKey] = s.Name
+	md[registry.PreferredKey] = strconv.FormatBool(s.Preferred)
+	if len(s.Zone) > 0 {
+		md[registry.ZoneKey] = s.Zone
+	}
+
+	return &registry.Node{
+		Id:       n.Id,
+		Address:  n.Address,
+		Metadata: md,
+	}
+}
+
+func serviceKey(s *registry.Service) string {
+	return registry.Domain(s) + "/" + s.Name + "/" + s.Version
+}
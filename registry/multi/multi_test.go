@@ -0,0 +1,97 @@
+package multi
+
+import (
+	"testing"
+
+	"xmicro/registry"
+	"xmicro/registry/memory"
+)
+
+func newService(ids ...string) *registry.Service {
+	s := &registry.Service{Name: "greeter", Version: "1.0.0"}
+	for _, id := range ids {
+		s.Nodes = append(s.Nodes, &registry.Node{Id: id, Address: id + ":8080"})
+	}
+	return s
+}
+
+func TestGetService(t *testing.T) {
+	old, next := memory.NewRegistry(), memory.NewRegistry()
+	old.Register(newService("a", "b"))
+	next.Register(newService("b", "c"))
+
+	m := NewRegistry(
+		&Source{Registry: old, Name: "old", Zone: "hz"},
+		&Source{Registry: next, Name: "next", Zone: "sh", Preferred: true},
+	)
+
+	services, err := m.GetService("greeter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(services) != 1 || len(services[0].Nodes) != 3 {
+		t.Fatalf("Expected 1 service with 3 nodes got %+v", services)
+	}
+
+	sources := map[string]string{}
+	for _, n := range services[0].Nodes {
+		sources[n.Id] = n.Metadata[registry.SourceKey]
+	}
+	// b is in both and kept from the preferred registry
+	if sources["a"] != "old" || sources["b"] != "next" || sources["c"] != "next" {
+		t.Fatalf("Unexpected sources %v", sources)
+	}
+
+	list, err := m.ListServices()
+	if err != nil || len(list) != 1 {
+		t.Fatalf("Expected 1 service got %+v %v", list, err)
+	}
+
+	if _, err := m.GetService("unknown"); err != registry.ErrNotFound {
+		t.Fatalf("Expected not found got %v", err)
+	}
+}
+
+func TestWatch(t *testing.T) {
+	old, next := memory.NewRegistry(), memory.NewRegistry()
+
+	m := NewRegistry(
+		&Source{Registry: old, Name: "old"},
+		&Source{Registry: next, Name: "next"},
+	)
+
+	w, err := m.Watch(registry.WatchDomain(registry.DefaultDomain))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Stop()
+
+	next.Register(newService("a"))
+	expect(t, w, "create", "a", "next")
+
+	old.Register(newService("a"))
+	expect(t, w, "create", "a", "old")
+
+	// a is still in the other registry so it's only updated
+	old.Deregister(newService("a"))
+	expect(t, w, "update", "a", "next")
+
+	next.Deregister(newService("a"))
+	expect(t, w, "delete", "a", "next")
+}
+
+func expect(t *testing.T, w registry.Watcher, action, id, source string) {
+	t.Helper()
+
+	res, err := w.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Action != action || len(res.Service.Nodes) != 1 {
+		t.Fatalf("Expected %s of %s got %s %+v", action, id, res.Action, res.Service.Nodes)
+	}
+	n := res.Service.Nodes[0]
+	if n.Id != id || n.Metadata[registry.SourceKey] != source {
+		t.Fatalf("Expected %s from %s got %+v", id, source, n)
+	}
+}
@@ -0,0 +1,204 @@
+package multi
+
+import (
+	"sync"
+
+	"xmicro/logger"
+	"xmicro/registry"
+)
+
+type event struct {
+	src int
+	res *registry.Result
+	err error
+}
+
+// watcher merges the results of the source watchers. A node is only
+// deleted once no source has it anymore.
+type watcher struct {
+	m        *multiRegistry
+	watchers []registry.Watcher
+	events   chan *event
+	exit     chan bool
+	once     sync.Once
+
+	// running source watchers
+	running int
+	// queued results to return
+	queue []*registry.Result
+	// nodes by service key and node id, by source index
+	nodes map[string]map[string]map[int]*registry.Node
+}
+
+func newWatcher(m *multiRegistry, opts ...registry.WatchOption) (registry.Watcher, error) {
+	w := &watcher{
+		m:      m,
+		events: make(chan *event),
+		exit:   make(chan bool),
+		nodes:  make(map[string]map[string]map[int]*registry.Node),
+	}
+
+	var gerr error
+	for i, src := range m.sources {
+		sw, err := src.Watch(opts...)
+		if err != nil {
+			logger.Errorf("[multi] watch of %s failed: %v", src.Name, err)
+			gerr = err
+			continue
+		}
+		w.watchers = append(w.watchers, sw)
+		w.running++
+		go w.run(i, sw)
+	}
+
+	if w.running == 0 && gerr != nil {
+		return nil, gerr
+	}
+
+	return w, nil
+}
+
+func (w *watcher) run(i int, sw registry.Watcher) {
+	for {
+		res, err := sw.Next()
+
+		select {
+		case w.events <- &event{src: i, res: res, err: err}:
+		case <-w.exit:
+			return
+		}
+
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (w *watcher) Next() (*registry.Result, error) {
+	for len(w.queue) == 0 {
+		select {
+		case ev := <-w.events:
+			if ev.err != nil {
+				w.running--
+				logger.Errorf("[multi] watch of %s stopped: %v", w.m.sources[ev.src].Name, ev.err)
+				if w.running == 0 {
+					return nil, ev.err
+				}
+				continue
+			}
+			if ev.res == nil || ev.res.Service == nil {
+				continue
+			}
+			w.queue = w.apply(ev.src, ev.res)
+		case <-w.exit:
+			return nil, registry.ErrWatcherStopped
+		}
+	}
+
+	res := w.queue[0]
+	w.queue = w.queue[1:]
+	return res, nil
+}
+
+// best returns the node of the most preferred source
+func (w *watcher) best(sources map[int]*registry.Node) *registry.Node {
+	idx := -1
+	for i := range sources {
+		if idx < 0 || i < idx {
+			idx = i
+		}
+	}
+	return w.m.sources[idx].tag(sources[idx])
+}
+
+// apply records the result of the source and returns the merged results
+func (w *watcher) apply(src int, res *registry.Result) []*registry.Result {
+	k := serviceKey(res.Service)
+
+	nodes, ok := w.nodes[k]
+	if !ok {
+		nodes = make(map[string]map[int]*registry.Node)
+		w.nodes[k] = nodes
+	}
+
+	// result with the nodes replaced
+	result := func(action string, n []*registry.Node) *registry.Result {
+		s := *res.Service
+		s.Nodes = n
+		return &registry.Result{Action: action, Service: &s}
+	}
+
+	switch res.Action {
+	case "create", "update":
+		var changed []*registry.Node
+		for _, n := range res.Service.Nodes {
+			if nodes[n.Id] == nil {
+				nodes[n.Id] = make(map[int]*registry.Node)
+			}
+			nodes[n.Id][src] = n
+			changed = append(changed, w.best(nodes[n.Id]))
+		}
+		return []*registry.Result{result(res.Action, changed)}
+	case "delete":
+		ids := make([]string, 0, len(res.Service.Nodes))
+		for _, n := range res.Service.Nodes {
+			ids = append(ids, n.Id)
+		}
+		// a delete without nodes removes all of the nodes of the source
+		if len(ids) == 0 {
+			for id, sources := range nodes {
+				if _, ok := sources[src]; ok {
+					ids = append(ids, id)
+				}
+			}
+		}
+
+		var deleted, remaining []*registry.Node
+		for _, id := range ids {
+			sources, ok := nodes[id]
+			if !ok {
+				continue
+			}
+			n, ok := sources[src]
+			if !ok {
+				continue
+			}
+			delete(sources, src)
+
+			if len(sources) == 0 {
+				delete(nodes, id)
+				deleted = append(deleted, w.m.sources[src].tag(n))
+			} else {
+				remaining = append(remaining, w.best(sources))
+			}
+		}
+
+		if len(nodes) == 0 {
+			delete(w.nodes, k)
+			// nothing left of the service, pass the wipe on
+			if len(res.Service.Nodes) == 0 {
+				return []*registry.Result{result("delete", nil)}
+			}
+		}
+
+		var results []*registry.Result
+		if len(deleted) > 0 {
+			results = append(results, result("delete", deleted))
+		}
+		if len(remaining) > 0 {
+			results = append(results, result("update", remaining))
+		}
+		return results
+	}
+
+	return []*registry.Result{res}
+}
+
+func (w *watcher) Stop() {
+	w.once.Do(func() {
+		close(w.exit)
+		for _, sw := range w.watchers {
+			sw.Stop()
+		}
+	})
+}
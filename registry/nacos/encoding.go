@@ -0,0 +1,138 @@
+package nacos
+
+import (
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/nacos-group/nacos-sdk-go/model"
+
+	"xmicro/registry"
+	mnet "xmicro/util/net"
+)
+
+var (
+	// instance metadata holding the service version
+	versionKey = "version"
+	// instance metadata holding the json encoded endpoints
+	endpointsKey = "endpoints"
+	// prefix of the instance metadata holding the service metadata
+	serviceMetadataPrefix = "service."
+	// node metadata set from the weight of the instance
+	weightMetadataKey = "weight"
+	// node metadata set from the cluster of the instance
+	clusterMetadataKey = "cluster"
+	// separator of the group and the service name returned by nacos
+	groupSeparator = "@@"
+)
+
+// encodeMetadata returns the nacos instance metadata of the node
+func encodeMetadata(s *registry.Service, node *registry.Node) (map[string]string, error) {
+	md := make(map[string]string, len(node.Metadata)+len(s.Metadata)+2)
+	for k, v := range node.Metadata {
+		md[k] = v
+	}
+	for k, v := range s.Metadata {
+		md[serviceMetadataPrefix+k] = v
+	}
+	md[versionKey] = s.Version
+
+	if len(s.Endpoints) > 0 {
+		b, err := json.Marshal(s.Endpoints)
+		if err != nil {
+			return nil, err
+		}
+		md[endpointsKey] = string(b)
+	}
+
+	return md, nil
+}
+
+// instance is the part of a nacos instance the services are built from
+type instance struct {
+	id       string
+	ip       string
+	port     uint64
+	weight   float64
+	cluster  string
+	metadata map[string]string
+}
+
+func fromInstance(i model.Instance) instance {
+	return instance{i.InstanceId, i.Ip, i.Port, i.Weight, i.ClusterName, i.Metadata}
+}
+
+func fromSubscribeService(i model.SubscribeService) instance {
+	return instance{i.InstanceId, i.Ip, i.Port, i.Weight, i.ClusterName, i.Metadata}
+}
+
+// decodeInstances groups the instances into a service per domain and version
+func decodeInstances(name string, instances []instance) []*registry.Service {
+	name = serviceName(name)
+
+	// services mapped by domain and version
+	svcs := make(map[string]*registry.Service)
+	var keys []string
+
+	for _, i := range instances {
+		node := &registry.Node{
+			Id:       i.id,
+			Address:  mnet.HostPort(i.ip, i.port),
+			Metadata: make(map[string]string, len(i.metadata)+2),
+		}
+		if len(node.Id) == 0 {
+			node.Id = node.Address
+		}
+
+		svcMetadata := make(map[string]string)
+
+		for k, v := range i.metadata {
+			switch {
+			case k == versionKey || k == endpointsKey:
+			case strings.HasPrefix(k, serviceMetadataPrefix):
+				svcMetadata[strings.TrimPrefix(k, serviceMetadataPrefix)] = v
+			default:
+				node.Metadata[k] = v
+			}
+		}
+		node.Metadata[weightMetadataKey] = strconv.FormatFloat(i.weight, 'f', -1, 64)
+		if len(i.cluster) > 0 {
+			node.Metadata[clusterMetadataKey] = i.cluster
+		}
+
+		version := i.metadata[versionKey]
+		key := version + "/" + svcMetadata[registry.DomainKey]
+
+		svc, ok := svcs[key]
+		if !ok {
+			svc = &registry.Service{
+				Name:     name,
+				Version:  version,
+				Metadata: svcMetadata,
+			}
+			if e := i.metadata[endpointsKey]; len(e) > 0 {
+				json.Unmarshal([]byte(e), &svc.Endpoints)
+			}
+			svcs[key] = svc
+			keys = append(keys, key)
+		}
+		svc.Nodes = append(svc.Nodes, node)
+	}
+
+	sort.Strings(keys)
+
+	services := make([]*registry.Service, 0, len(keys))
+	for _, k := range keys {
+		services = append(services, svcs[k])
+	}
+	return services
+}
+
+// serviceName strips the group nacos prefixes the service names with
+func serviceName(name string) string {
+	if i := strings.Index(name, groupSeparator); i >= 0 {
+		return name[i+len(groupSeparator):]
+	}
+	return name
+}
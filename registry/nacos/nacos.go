@@ -22,12 +22,16 @@ import (
 	mconstant "xmicro/common/constant"
 	mlogger "xmicro/logger"
 	"xmicro/registry"
-	mnet "xmicro/util/net"
 )
 
 type nacosRegistry struct {
 	namingClient naming_client.INamingClient
 	opts         registry.Options
+
+	// group of the services
+	group string
+	// cluster the nodes are registered in
+	cluster string
 }
 
 // set nacos logger
@@ -46,15 +50,17 @@ func (f *nacosRegistryFactory) GetRegistry(url *common.URL) (registry.Registry,
 	if d, err := time.ParseDuration(timeout); err == nil {
 		timeDuration = d
 	}
-	return NewRegistry(registry.Addrs(url.Location), registry.Timeout(timeDuration)), nil
+	return NewRegistry(
+		registry.Addrs(url.Location),
+		registry.Timeout(timeDuration),
+		Namespace(url.GetParam(mconstant.NacosNamespaceId, "")),
+		Group(url.GetParam(mconstant.GroupKey, "")),
+		Cluster(url.GetParam(mconstant.NacosClusterKey, "")),
+	), nil
 }
 
-func getNodeIpPort(s *registry.Service) (host string, port int, err error) {
-	if len(s.Nodes) == 0 {
-		return "", 0, errors.New("you must deregister at least one node")
-	}
-	node := s.Nodes[0]
-	host, pt, err := net.SplitHostPort(node.Address)
+func splitHostPort(address string) (host string, port int, err error) {
+	host, pt, err := net.SplitHostPort(address)
 	if err != nil {
 		return "", 0, err
 	}
@@ -70,13 +76,22 @@ func configure(c *nacosRegistry, opts ...registry.Option) error {
 	for _, o := range opts {
 		o(&c.opts)
 	}
+	clientConfig := constant.ClientConfig{}
 	if c.opts.Context != nil {
-		if client, ok := c.opts.Context.Value("naming_client").(naming_client.INamingClient); ok {
+		if g, ok := c.opts.Context.Value(groupKey{}).(string); ok {
+			c.group = g
+		}
+		if cl, ok := c.opts.Context.Value(clusterKey{}).(string); ok {
+			c.cluster = cl
+		}
+		if ns, ok := c.opts.Context.Value(namespaceKey{}).(string); ok {
+			clientConfig.NamespaceId = ns
+		}
+		if client, ok := c.opts.Context.Value(namingClientKey{}).(naming_client.INamingClient); ok {
 			c.namingClient = client
 			return nil
 		}
 	}
-	clientConfig := constant.ClientConfig{}
 	serverConfigs := make([]constant.ServerConfig, 0)
 	contextPath := "/nacos"
 	// iterate the options addresses
@@ -121,102 +136,126 @@ func (c *nacosRegistry) Init(opts ...registry.Option) error {
 	return configure(c, opts...)
 }
 
+// Deregister deregisters every node of the service
 func (c *nacosRegistry) Deregister(s *registry.Service, opts ...registry.DeregisterOption) error {
+	if len(s.Nodes) == 0 {
+		return errors.New("you must deregister at least one node")
+	}
+
 	var options registry.DeregisterOptions
 	for _, o := range opts {
 		o(&options)
 	}
-	withContext := false
-	param := vo.DeregisterInstanceParam{}
-	if options.Context != nil {
-		if p, ok := options.Context.Value("deregister_instance_param").(vo.DeregisterInstanceParam); ok {
-			param = p
-			withContext = ok
-		}
-	}
-	if !withContext {
-		host, port, err := getNodeIpPort(s)
+
+	var gerr error
+	for _, node := range s.Nodes {
+		host, port, err := splitHostPort(node.Address)
 		if err != nil {
 			return err
 		}
-		param.Ip = host
-		param.Port = uint64(port)
-		param.ServiceName = s.Name
-	}
 
-	_, err := c.namingClient.DeregisterInstance(param)
-	return err
+		_, err = c.namingClient.DeregisterInstance(vo.DeregisterInstanceParam{
+			Ip:          host,
+			Port:        uint64(port),
+			Cluster:     c.cluster,
+			ServiceName: s.Name,
+			GroupName:   c.group,
+			Ephemeral:   true,
+		})
+		if err != nil && gerr == nil {
+			gerr = err
+		}
+	}
+	return gerr
 }
 
+// Register registers every node of the service as a nacos instance. The
+// version, endpoints and service metadata are kept in the instance metadata.
 func (c *nacosRegistry) Register(s *registry.Service, opts ...registry.RegisterOption) error {
+	if len(s.Nodes) == 0 {
+		return errors.New("you must register at least one node")
+	}
+
 	var options registry.RegisterOptions
 	for _, o := range opts {
 		o(&options)
 	}
-	withContext := false
-	param := vo.RegisterInstanceParam{}
+
+	weight := 1.0
 	if options.Context != nil {
-		if p, ok := options.Context.Value("register_instance_param").(vo.RegisterInstanceParam); ok {
-			param = p
-			withContext = ok
+		if w, ok := options.Context.Value(weightKey{}).(float64); ok && w > 0 {
+			weight = w
 		}
 	}
-	if !withContext {
-		host, port, err := getNodeIpPort(s)
+
+	// the domain is kept in the service metadata
+	s = registry.WithDomain(s, options.Domain)
+
+	for _, node := range s.Nodes {
+		host, port, err := splitHostPort(node.Address)
+		if err != nil {
+			return err
+		}
+
+		md, err := encodeMetadata(s, node)
+		if err != nil {
+			return err
+		}
+
+		_, err = c.namingClient.RegisterInstance(vo.RegisterInstanceParam{
+			Ip:          host,
+			Port:        uint64(port),
+			Weight:      weight,
+			Enable:      true,
+			Healthy:     true,
+			Metadata:    md,
+			ClusterName: c.cluster,
+			ServiceName: s.Name,
+			GroupName:   c.group,
+			Ephemeral:   true,
+		})
 		if err != nil {
 			return err
 		}
-		s.Nodes[0].Metadata["version"] = s.Version
-		param.Ip = host
-		param.Port = uint64(port)
-		param.Metadata = s.Nodes[0].Metadata
-		param.ServiceName = s.Name
-		param.Enable = true
-		param.Healthy = true
-		param.Weight = 1.0
-		param.Ephemeral = true
 	}
-	_, err := c.namingClient.RegisterInstance(param)
-	return err
+	return nil
 }
 
+// GetService returns a service per domain and version with all of its
+// enabled and healthy instances in the domain as nodes
 func (c *nacosRegistry) GetService(name string, opts ...registry.GetOption) ([]*registry.Service, error) {
 	var options registry.GetOptions
 	for _, o := range opts {
 		o(&options)
 	}
-	withContext := false
-	param := vo.GetServiceParam{}
+
+	param := vo.GetServiceParam{
+		ServiceName: name,
+		GroupName:   c.group,
+	}
 	if options.Context != nil {
-		if p, ok := options.Context.Value("select_instances_param").(vo.GetServiceParam); ok {
-			param = p
-			withContext = ok
+		if cl, ok := options.Context.Value(clustersKey{}).([]string); ok {
+			param.Clusters = cl
 		}
 	}
-	if !withContext {
-		param.ServiceName = name
-	}
+
 	service, err := c.namingClient.GetService(param)
 	if err != nil {
 		return nil, err
 	}
-	services := make([]*registry.Service, 0)
-	for _, v := range service.Hosts {
-		nodes := make([]*registry.Node, 0)
-		nodes = append(nodes, &registry.Node{
-			Id:       v.InstanceId,
-			Address:  mnet.HostPort(v.Ip, v.Port),
-			Metadata: v.Metadata,
-		})
-		s := registry.Service{
-			Name:     v.ServiceName,
-			Version:  v.Metadata["version"],
-			Metadata: v.Metadata,
-			Nodes:    nodes,
+
+	instances := make([]instance, 0, len(service.Hosts))
+	for _, h := range service.Hosts {
+		if !h.Enable || !h.Healthy || h.Weight <= 0 {
+			continue
 		}
-		services = append(services, &s)
+		instances = append(instances, fromInstance(h))
 	}
 
+	services := registry.FilterDomain(decodeInstances(name, instances), options.Domain)
+	if len(services) == 0 {
+		return nil, registry.ErrNotFound
+	}
 	return services, nil
 }
 
@@ -225,31 +264,46 @@ func (c *nacosRegistry) ListServices(opts ...registry.ListOption) ([]*registry.S
 	for _, o := range opts {
 		o(&options)
 	}
-	withContext := false
-	param := vo.GetAllServiceInfoParam{}
-	if options.Context != nil {
-		if p, ok := options.Context.Value("get_all_service_info_param").(vo.GetAllServiceInfoParam); ok {
-			param = p
-			withContext = ok
-		}
+
+	names, err := c.serviceNames()
+	if err != nil {
+		return nil, err
 	}
-	if !withContext {
-		services, err := c.namingClient.GetAllServicesInfo(param)
-		if err != nil {
-			return nil, err
+
+	var registryServices []*registry.Service
+	for _, v := range names {
+		name := serviceName(v)
+		// the domains are only known from the instances
+		if options.Domain != registry.WildcardDomain {
+			if _, err := c.GetService(name, registry.GetDomain(options.Domain)); err != nil {
+				continue
+			}
 		}
-		param.PageNo = 1
-		param.PageSize = uint32(services.Count)
+		registryServices = append(registryServices, &registry.Service{Name: name})
+	}
+	return registryServices, nil
+}
+
+// serviceNames returns the names of all services in the group
+func (c *nacosRegistry) serviceNames() ([]string, error) {
+	param := vo.GetAllServiceInfoParam{
+		GroupName: c.group,
 	}
 	services, err := c.namingClient.GetAllServicesInfo(param)
 	if err != nil {
 		return nil, err
 	}
-	var registryServices []*registry.Service
-	for _, v := range services.Doms {
-		registryServices = append(registryServices, &registry.Service{Name: v})
+	if services.Count <= int64(len(services.Doms)) {
+		return services.Doms, nil
 	}
-	return registryServices, nil
+
+	param.PageNo = 1
+	param.PageSize = uint32(services.Count)
+	services, err = c.namingClient.GetAllServicesInfo(param)
+	if err != nil {
+		return nil, err
+	}
+	return services.Doms, nil
 }
 
 func (c *nacosRegistry) Watch(opts ...registry.WatchOption) (registry.Watcher, error) {
@@ -0,0 +1,166 @@
+package nacos
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/nacos-group/nacos-sdk-go/clients/naming_client"
+	"github.com/nacos-group/nacos-sdk-go/model"
+	"github.com/nacos-group/nacos-sdk-go/vo"
+
+	"xmicro/registry"
+)
+
+// fakeClient keeps the registered instances in memory
+type fakeClient struct {
+	naming_client.INamingClient
+
+	sync.Mutex
+	instances map[string]model.Instance
+	groups    map[string]string
+}
+
+func newFakeClient() *fakeClient {
+	return &fakeClient{
+		instances: make(map[string]model.Instance),
+		groups:    make(map[string]string),
+	}
+}
+
+func (f *fakeClient) RegisterInstance(p vo.RegisterInstanceParam) (bool, error) {
+	f.Lock()
+	defer f.Unlock()
+
+	id := fmt.Sprintf("%s#%d#%s#%s", p.Ip, p.Port, p.ClusterName, p.ServiceName)
+	f.instances[id] = model.Instance{
+		InstanceId:  id,
+		Ip:          p.Ip,
+		Port:        p.Port,
+		Weight:      p.Weight,
+		Metadata:    p.Metadata,
+		ClusterName: p.ClusterName,
+		ServiceName: p.GroupName + groupSeparator + p.ServiceName,
+		Enable:      p.Enable,
+		Healthy:     p.Healthy,
+	}
+	f.groups[id] = p.GroupName
+	return true, nil
+}
+
+func (f *fakeClient) DeregisterInstance(p vo.DeregisterInstanceParam) (bool, error) {
+	f.Lock()
+	defer f.Unlock()
+
+	delete(f.instances, fmt.Sprintf("%s#%d#%s#%s", p.Ip, p.Port, p.Cluster, p.ServiceName))
+	return true, nil
+}
+
+func (f *fakeClient) GetService(p vo.GetServiceParam) (model.Service, error) {
+	f.Lock()
+	defer f.Unlock()
+
+	var s model.Service
+	for id, i := range f.instances {
+		if i.ServiceName == p.GroupName+groupSeparator+p.ServiceName && f.groups[id] == p.GroupName {
+			s.Hosts = append(s.Hosts, i)
+		}
+	}
+	return s, nil
+}
+
+func TestRegistry(t *testing.T) {
+	c := newFakeClient()
+	r := NewRegistry(NamingClient(c), Group("orders"), Cluster("hz"))
+
+	s := &registry.Service{
+		Name:      "greeter",
+		Version:   "1.0.0",
+		Metadata:  map[string]string{"owner": "team"},
+		Endpoints: []*registry.Endpoint{{Name: "Greeter.Hello"}},
+		Nodes: []*registry.Node{
+			{Id: "1", Address: "10.0.0.1:8080", Metadata: map[string]string{"protocol": "grpc"}},
+			{Id: "2", Address: "10.0.0.2:8080", Metadata: map[string]string{"protocol": "grpc"}},
+		},
+	}
+
+	if err := r.Register(s, Weight(2)); err != nil {
+		t.Fatal(err)
+	}
+
+	services, err := r.GetService("greeter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(services) != 1 {
+		t.Fatalf("Expected 1 service got %d", len(services))
+	}
+
+	svc := services[0]
+	if svc.Name != "greeter" || svc.Version != "1.0.0" || svc.Metadata["owner"] != "team" {
+		t.Fatalf("Unexpected service %+v", svc)
+	}
+	if len(svc.Endpoints) != 1 || svc.Endpoints[0].Name != "Greeter.Hello" {
+		t.Fatalf("Unexpected endpoints %+v", svc.Endpoints)
+	}
+	if len(svc.Nodes) != 2 {
+		t.Fatalf("Expected 2 nodes got %d", len(svc.Nodes))
+	}
+	for _, n := range svc.Nodes {
+		if n.Metadata["protocol"] != "grpc" || n.Metadata["weight"] != "2" || n.Metadata["cluster"] != "hz" {
+			t.Fatalf("Unexpected node metadata %v", n.Metadata)
+		}
+		if _, ok := n.Metadata["version"]; ok {
+			t.Fatalf("Unexpected version in node metadata %v", n.Metadata)
+		}
+	}
+
+	if err := r.Deregister(s); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.GetService("greeter"); err != registry.ErrNotFound {
+		t.Fatalf("Expected not found got %v", err)
+	}
+}
+
+func TestDomain(t *testing.T) {
+	r := NewRegistry(NamingClient(newFakeClient()))
+
+	service := func(address string) *registry.Service {
+		return &registry.Service{
+			Name:    "greeter",
+			Version: "1.0.0",
+			Nodes:   []*registry.Node{{Id: address, Address: address}},
+		}
+	}
+
+	if err := r.Register(service("10.0.0.1:8080")); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Register(service("10.0.0.2:8080"), registry.RegisterDomain("staging")); err != nil {
+		t.Fatal(err)
+	}
+
+	services, err := r.GetService("greeter", registry.GetDomain("staging"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(services) != 1 || len(services[0].Nodes) != 1 || services[0].Nodes[0].Address != "10.0.0.2:8080" {
+		t.Fatalf("Expected the node in staging got %+v", services)
+	}
+	if registry.Domain(services[0]) != "staging" {
+		t.Fatalf("Expected domain staging got %s", registry.Domain(services[0]))
+	}
+
+	services, err = r.GetService("greeter", registry.GetDomain(registry.WildcardDomain))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(services) != 2 {
+		t.Fatalf("Expected a service per domain got %d", len(services))
+	}
+
+	if _, err := r.GetService("greeter", registry.GetDomain("dev")); err != registry.ErrNotFound {
+		t.Fatalf("Expected not found got %v", err)
+	}
+}
@@ -0,0 +1,75 @@
+package nacos
+
+import (
+	"context"
+
+	"github.com/nacos-group/nacos-sdk-go/clients/naming_client"
+
+	"xmicro/registry"
+)
+
+type namingClientKey struct{}
+type namespaceKey struct{}
+type groupKey struct{}
+type clusterKey struct{}
+type weightKey struct{}
+type clustersKey struct{}
+
+func setRegistryOption(k, v interface{}) registry.Option {
+	return func(o *registry.Options) {
+		if o.Context == nil {
+			o.Context = context.Background()
+		}
+		o.Context = context.WithValue(o.Context, k, v)
+	}
+}
+
+// NamingClient sets the nacos naming client instead of creating one
+func NamingClient(c naming_client.INamingClient) registry.Option {
+	return setRegistryOption(namingClientKey{}, c)
+}
+
+// Namespace sets the id of the nacos namespace, public if empty
+func Namespace(id string) registry.Option {
+	return setRegistryOption(namespaceKey{}, id)
+}
+
+// Group sets the nacos group of the services, DEFAULT_GROUP if empty
+func Group(name string) registry.Option {
+	return setRegistryOption(groupKey{}, name)
+}
+
+// Cluster sets the nacos cluster the nodes are registered in, DEFAULT if empty
+func Cluster(name string) registry.Option {
+	return setRegistryOption(clusterKey{}, name)
+}
+
+// Weight sets the weight of the registered nodes, 1 by default
+func Weight(w float64) registry.RegisterOption {
+	return func(o *registry.RegisterOptions) {
+		if o.Context == nil {
+			o.Context = context.Background()
+		}
+		o.Context = context.WithValue(o.Context, weightKey{}, w)
+	}
+}
+
+// GetClusters only returns the nodes of the clusters
+func GetClusters(names ...string) registry.GetOption {
+	return func(o *registry.GetOptions) {
+		if o.Context == nil {
+			o.Context = context.Background()
+		}
+		o.Context = context.WithValue(o.Context, clustersKey{}, names)
+	}
+}
+
+// WatchClusters only watches the nodes of the clusters
+func WatchClusters(names ...string) registry.WatchOption {
+	return func(o *registry.WatchOptions) {
+		if o.Context == nil {
+			o.Context = context.Background()
+		}
+		o.Context = context.WithValue(o.Context, clustersKey{}, names)
+	}
+}
@@ -1,14 +1,14 @@
 package nacos
 
 import (
-	reflect "reflect"
+	"reflect"
 	"sync"
 
 	"github.com/nacos-group/nacos-sdk-go/model"
 	"github.com/nacos-group/nacos-sdk-go/vo"
 
+	"xmicro/logger"
 	"xmicro/registry"
-	mnet "xmicro/util/net"
 )
 
 type nacosWatcher struct {
@@ -19,10 +19,9 @@ type nacosWatcher struct {
 	exit chan bool
 
 	sync.RWMutex
-	services      map[string][]*registry.Service
-	cacheServices map[string][]model.SubscribeService
-	param         *vo.SubscribeParam
-	Doms          []string
+	// last known nodes by service name and node id
+	nodes  map[string]map[string]*registry.Service
+	params []*vo.SubscribeParam
 }
 
 func NewNacosWatcher(nr *nacosRegistry, opts ...registry.WatchOption) (registry.Watcher, error) {
@@ -31,126 +30,99 @@ func NewNacosWatcher(nr *nacosRegistry, opts ...registry.WatchOption) (registry.
 		o(&wo)
 	}
 	nw := nacosWatcher{
-		nr:            nr,
-		wo:            wo,
-		exit:          make(chan bool),
-		next:          make(chan *registry.Result, 10),
-		services:      make(map[string][]*registry.Service),
-		cacheServices: make(map[string][]model.SubscribeService),
-		param:         new(vo.SubscribeParam),
-		Doms:          make([]string, 0),
+		nr:    nr,
+		wo:    wo,
+		exit:  make(chan bool),
+		next:  make(chan *registry.Result, 10),
+		nodes: make(map[string]map[string]*registry.Service),
 	}
-	withContext := false
+
+	var clusters []string
 	if wo.Context != nil {
-		if p, ok := wo.Context.Value("subscribe_param").(vo.SubscribeParam); ok {
-			nw.param = &p
-			withContext = ok
-			nw.param.SubscribeCallback = nw.callBackHandle
-			go nr.namingClient.Subscribe(nw.param)
+		if cl, ok := wo.Context.Value(clustersKey{}).([]string); ok {
+			clusters = cl
 		}
 	}
-	if !withContext {
-		param := vo.GetAllServiceInfoParam{}
-		services, err := nr.namingClient.GetAllServicesInfo(param)
-		if err != nil {
-			return nil, err
-		}
-		param.PageNo = 1
-		param.PageSize = uint32(services.Count)
-		services, err = nr.namingClient.GetAllServicesInfo(param)
-		if err != nil {
+
+	names := []string{wo.Service}
+	if len(wo.Service) == 0 {
+		var err error
+		if names, err = nr.serviceNames(); err != nil {
 			return nil, err
 		}
-		nw.Doms = services.Doms
-		for _, v := range nw.Doms {
-			param := &vo.SubscribeParam{
-				ServiceName:       v,
-				SubscribeCallback: nw.callBackHandle,
-			}
-			go nr.namingClient.Subscribe(param)
+	}
+
+	for _, v := range names {
+		name := serviceName(v)
+		param := &vo.SubscribeParam{
+			ServiceName: name,
+			Clusters:    clusters,
+			GroupName:   nr.group,
+			SubscribeCallback: func(services []model.SubscribeService, err error) {
+				nw.callBackHandle(name, services, err)
+			},
 		}
+		nw.params = append(nw.params, param)
+		go nr.namingClient.Subscribe(param)
 	}
 
 	return &nw, nil
 }
 
-func (nw *nacosWatcher) callBackHandle(services []model.SubscribeService, err error) {
+// callBackHandle diffs the instances of the service against the
+// last known ones and sends a result per changed node
+func (nw *nacosWatcher) callBackHandle(name string, services []model.SubscribeService, err error) {
 	if err != nil {
-		//logger.Error("nacos watcher call back handle error:%v", err)
+		logger.Errorf("nacos watcher call back handle error: %v", err)
 		return
 	}
-	serviceName := services[0].ServiceName
-
-	if nw.cacheServices[serviceName] == nil {
 
-		nw.Lock()
-		nw.cacheServices[serviceName] = services
-		nw.Unlock()
-
-		for _, v := range services {
-			nw.next <- &registry.Result{Action: "create", Service: buildRegistryService(&v)}
-			return
-		}
-	} else {
-		for _, subscribeService := range services {
-			create := true
-			for _, cacheService := range nw.cacheServices[serviceName] {
-				if subscribeService.InstanceId == cacheService.InstanceId {
-					if !reflect.DeepEqual(subscribeService, cacheService) {
-						//update instance
-						nw.next <- &registry.Result{Action: "update", Service: buildRegistryService(&subscribeService)}
-						return
-					}
-					create = false
-				}
-			}
-			//new instance
-			if create {
-
-				nw.next <- &registry.Result{Action: "create", Service: buildRegistryService(&subscribeService)}
-
-				nw.Lock()
-				nw.cacheServices[serviceName] = append(nw.cacheServices[serviceName], subscribeService)
-				nw.Unlock()
-				return
-			}
+	instances := make([]instance, 0, len(services))
+	for _, s := range services {
+		if !s.Enable || !s.Valid {
+			continue
 		}
+		instances = append(instances, fromSubscribeService(s))
+	}
 
-		for index, cacheService := range nw.cacheServices[serviceName] {
-			del := true
-			for _, subscribeService := range services {
-				if subscribeService.InstanceId == cacheService.InstanceId {
-					del = false
-				}
-			}
-			if del {
-				nw.next <- &registry.Result{Action: "delete", Service: buildRegistryService(&cacheService)}
-
-				nw.Lock()
-				nw.cacheServices[serviceName][index] = model.SubscribeService{}
-				nw.Unlock()
-
-				return
-			}
+	// a single node service per node id
+	cur := make(map[string]*registry.Service)
+	for _, svc := range registry.FilterDomain(decodeInstances(name, instances), nw.wo.Domain) {
+		for _, node := range svc.Nodes {
+			s := *svc
+			s.Nodes = []*registry.Node{node}
+			cur[node.Id] = &s
 		}
 	}
 
-}
+	nw.Lock()
+	prev := nw.nodes[name]
+	nw.nodes[name] = cur
+	nw.Unlock()
+
+	var results []*registry.Result
+	for id, s := range cur {
+		p, ok := prev[id]
+		switch {
+		case !ok:
+			results = append(results, &registry.Result{Action: "create", Service: s})
+		case !reflect.DeepEqual(p, s):
+			results = append(results, &registry.Result{Action: "update", Service: s})
+		}
+	}
+	for id, s := range prev {
+		if _, ok := cur[id]; !ok {
+			results = append(results, &registry.Result{Action: "delete", Service: s})
+		}
+	}
 
-func buildRegistryService(v *model.SubscribeService) (s *registry.Service) {
-	nodes := make([]*registry.Node, 0)
-	nodes = append(nodes, &registry.Node{
-		Id:       v.InstanceId,
-		Address:  mnet.HostPort(v.Ip, v.Port),
-		Metadata: v.Metadata,
-	})
-	s = &registry.Service{
-		Name:     v.ServiceName,
-		Version:  "latest",
-		Metadata: v.Metadata,
-		Nodes:    nodes,
+	for _, r := range results {
+		select {
+		case nw.next <- r:
+		case <-nw.exit:
+			return
+		}
 	}
-	return
 }
 
 func (nw *nacosWatcher) Next() (r *registry.Result, err error) {
@@ -163,9 +135,6 @@ func (nw *nacosWatcher) Next() (r *registry.Result, err error) {
 		}
 		return r, nil
 	}
-	// NOTE: This is a dead code path: e.g. it will never be reached
-	// as we return in all previous code paths never leading to this return
-	return nil, registry.ErrWatcherStopped
 }
 
 func (nw *nacosWatcher) Stop() {
@@ -174,16 +143,8 @@ func (nw *nacosWatcher) Stop() {
 		return
 	default:
 		close(nw.exit)
-		if len(nw.Doms) > 0 {
-			for _, v := range nw.Doms {
-				param := &vo.SubscribeParam{
-					ServiceName:       v,
-					SubscribeCallback: nw.callBackHandle,
-				}
-				nw.nr.namingClient.Unsubscribe(param)
-			}
-		} else {
-			nw.nr.namingClient.Unsubscribe(nw.param)
+		for _, param := range nw.params {
+			nw.nr.namingClient.Unsubscribe(param)
 		}
 	}
 }
@@ -13,6 +13,16 @@ const (
 	DefaultDomain = "micro"
 )
 
+// node metadata set by registries aggregating other registries
+const (
+	// SourceKey is the name of the registry the node was found in
+	SourceKey = "registry"
+	// ZoneKey is the zone of the registry the node was found in
+	ZoneKey = "registry.zone"
+	// PreferredKey is "true" when the registry is preferred
+	PreferredKey = "registry.preferred"
+)
+
 var (
 	// Not found error when GetService is called
 	ErrNotFound = errors.New("service not found")
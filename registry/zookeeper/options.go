@@ -0,0 +1,24 @@
+package zookeeper
+
+import (
+	"context"
+
+	"xmicro/registry"
+)
+
+type authKey struct{}
+
+type authCreds struct {
+	Username string
+	Password string
+}
+
+// Auth adds digest credentials to the zookeeper session
+func Auth(username, password string) registry.Option {
+	return func(o *registry.Options) {
+		if o.Context == nil {
+			o.Context = context.Background()
+		}
+		o.Context = context.WithValue(o.Context, authKey{}, &authCreds{Username: username, Password: password})
+	}
+}
@@ -0,0 +1,144 @@
+package zookeeper
+
+import (
+	"net"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+
+	"xmicro/common"
+	"xmicro/common/constant"
+	"xmicro/registry"
+)
+
+var (
+	// root of the service directory
+	prefix = "/xmicro"
+
+	// prefix of the service metadata url params
+	serviceParamPrefix = "service."
+	// url param of the node id
+	idParam = "id"
+	// side of the registered urls
+	providerSide = "provider"
+)
+
+// reserved url params which are not node metadata
+var reserved = map[string]bool{
+	idParam:               true,
+	constant.InterfaceKey: true,
+	constant.VersionKey:   true,
+	constant.METHODS_KEY:  true,
+	constant.CategoryKey:  true,
+	constant.SIDE_KEY:     true,
+	constant.PROTOCOL_KEY: true,
+}
+
+func servicePath(name string) string {
+	return path.Join(prefix, strings.Replace(name, "/", "-", -1))
+}
+
+func providersPath(name string) string {
+	return path.Join(servicePath(name), constant.PROVIDERS_CATEGORY)
+}
+
+func nodePath(s *registry.Service, node *registry.Node) (string, error) {
+	u, err := toURL(s, node)
+	if err != nil {
+		return "", err
+	}
+	return path.Join(providersPath(s.Name), url.QueryEscape(u.String())), nil
+}
+
+// toURL maps a node of the service to a provider url in the form of
+// {protocol}://{ip}:{port}/{service}?version=..&methods=..&{metadata}
+func toURL(s *registry.Service, node *registry.Node) (*common.URL, error) {
+	host, port, err := net.SplitHostPort(node.Address)
+	if err != nil {
+		return nil, err
+	}
+
+	protocol := node.Metadata["protocol"]
+	if len(protocol) == 0 {
+		protocol = "rpc"
+	}
+
+	var methods []string
+	for _, e := range s.Endpoints {
+		methods = append(methods, e.Name)
+	}
+	sort.Strings(methods)
+
+	opts := []common.UrlOption{
+		common.WithParams(url.Values{}),
+		common.WithProtocol(protocol),
+		common.WithIp(host),
+		common.WithPort(port),
+		common.WithPath(s.Name),
+		common.WithParamsValue(idParam, node.Id),
+		common.WithParamsValue(constant.InterfaceKey, s.Name),
+		common.WithParamsValue(constant.VersionKey, s.Version),
+		common.WithParamsValue(constant.CategoryKey, constant.PROVIDERS_CATEGORY),
+		common.WithParamsValue(constant.SIDE_KEY, providerSide),
+	}
+	if len(methods) > 0 {
+		opts = append(opts, common.WithParamsValue(constant.METHODS_KEY, strings.Join(methods, ",")))
+	}
+	for k, v := range node.Metadata {
+		if !reserved[k] {
+			opts = append(opts, common.WithParamsValue(k, v))
+		}
+	}
+	for k, v := range s.Metadata {
+		opts = append(opts, common.WithParamsValue(serviceParamPrefix+k, v))
+	}
+
+	return common.NewURLWithUrlOptions(opts...), nil
+}
+
+// toService decodes the child name of a providers node
+func toService(child string) (*registry.Service, error) {
+	raw, err := url.QueryUnescape(child)
+	if err != nil {
+		return nil, err
+	}
+
+	u, err := common.NewURL(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &registry.Service{
+		Name:     u.GetParam(constant.InterfaceKey, strings.TrimPrefix(u.Path, "/")),
+		Version:  u.GetParam(constant.VersionKey, ""),
+		Metadata: make(map[string]string),
+	}
+
+	node := &registry.Node{
+		Id:       u.GetParam(idParam, u.Location),
+		Address:  u.Location,
+		Metadata: map[string]string{"protocol": u.Protocol},
+	}
+
+	for k, v := range u.GetParams() {
+		if len(v) == 0 {
+			continue
+		}
+		switch {
+		case strings.HasPrefix(k, serviceParamPrefix):
+			s.Metadata[strings.TrimPrefix(k, serviceParamPrefix)] = v[0]
+		case !reserved[k]:
+			node.Metadata[k] = v[0]
+		}
+	}
+
+	if methods := u.GetParam(constant.METHODS_KEY, ""); len(methods) > 0 {
+		for _, m := range strings.Split(methods, ",") {
+			s.Endpoints = append(s.Endpoints, &registry.Endpoint{Name: m})
+		}
+	}
+
+	s.Nodes = []*registry.Node{node}
+	return s, nil
+}
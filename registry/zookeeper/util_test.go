@@ -0,0 +1,60 @@
+package zookeeper
+
+import (
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"xmicro/common"
+	"xmicro/registry"
+)
+
+func TestProviderURL(t *testing.T) {
+	s := &registry.Service{
+		Name:     "greeter",
+		Version:  "1.0.0",
+		Metadata: map[string]string{"domain": "micro"},
+		Endpoints: []*registry.Endpoint{
+			{Name: "Greeter.Hello"},
+			{Name: "Greeter.Bye"},
+		},
+		Nodes: []*registry.Node{
+			{Id: "greeter-1", Address: "10.0.0.1:8080", Metadata: map[string]string{"protocol": "grpc", "weight": "10"}},
+		},
+	}
+
+	p, err := nodePath(s, s.Nodes[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(p, "/xmicro/greeter/providers/") {
+		t.Fatalf("Unexpected path %s", p)
+	}
+
+	child := p[strings.LastIndex(p, "/")+1:]
+
+	// the child is a dubbo style provider url
+	raw, _ := url.QueryUnescape(child)
+	u, err := common.NewURL(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Protocol != "grpc" || u.Location != "10.0.0.1:8080" || u.GetParam("interface", "") != "greeter" || u.GetParam("side", "") != "provider" {
+		t.Fatalf("Unexpected url %s", raw)
+	}
+
+	out, err := toService(child)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.Name != s.Name || out.Version != s.Version || !reflect.DeepEqual(out.Metadata, s.Metadata) {
+		t.Fatalf("Unexpected service %+v", out)
+	}
+	if !reflect.DeepEqual(out.Nodes[0], s.Nodes[0]) {
+		t.Fatalf("Expected node %+v got %+v", s.Nodes[0], out.Nodes[0])
+	}
+	if len(out.Endpoints) != 2 || out.Endpoints[0].Name != "Greeter.Bye" {
+		t.Fatalf("Unexpected endpoints %+v", out.Endpoints)
+	}
+}
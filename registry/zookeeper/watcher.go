@@ -0,0 +1,202 @@
+package zookeeper
+
+import (
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-zookeeper/zk"
+
+	"xmicro/logger"
+	"xmicro/registry"
+)
+
+var (
+	// delay before a failed watch is set again
+	retryDelay = time.Second
+)
+
+// zookeeperWatcher sets child watches on the providers of the
+// services and turns the changed children into registry results
+type zookeeperWatcher struct {
+	z    *zookeeperRegistry
+	wo   registry.WatchOptions
+	next chan *registry.Result
+	exit chan bool
+	once sync.Once
+
+	sync.Mutex
+	// services with a running watch
+	watching map[string]bool
+}
+
+func newZookeeperWatcher(z *zookeeperRegistry, opts ...registry.WatchOption) (registry.Watcher, error) {
+	var wo registry.WatchOptions
+	for _, o := range opts {
+		o(&wo)
+	}
+
+	zw := &zookeeperWatcher{
+		z:        z,
+		wo:       wo,
+		next:     make(chan *registry.Result, 10),
+		exit:     make(chan bool),
+		watching: make(map[string]bool),
+	}
+
+	if len(wo.Service) > 0 {
+		go zw.watchService(wo.Service)
+	} else {
+		go zw.watchServices()
+	}
+
+	return zw, nil
+}
+
+// wait blocks for the retry delay, returns false when stopped
+func (zw *zookeeperWatcher) wait() bool {
+	select {
+	case <-zw.exit:
+		return false
+	case <-time.After(retryDelay):
+		return true
+	}
+}
+
+// children returns the children of the path and a watch on them. The
+// watch fires on creation when the path doesn't exist yet.
+func (zw *zookeeperWatcher) children(p string) ([]string, <-chan zk.Event, error) {
+	children, _, ev, err := zw.z.client.ChildrenW(p)
+	if err != zk.ErrNoNode {
+		return children, ev, err
+	}
+
+	ok, _, ev, err := zw.z.client.ExistsW(p)
+	if err != nil {
+		return nil, nil, err
+	}
+	// created in between, look again
+	if ok {
+		return zw.children(p)
+	}
+	return nil, ev, nil
+}
+
+func (zw *zookeeperWatcher) watchServices() {
+	for {
+		children, ev, err := zw.children(prefix)
+		if err != nil {
+			logger.Errorf("[zookeeper] watch of services failed: %v", err)
+			if !zw.wait() {
+				return
+			}
+			continue
+		}
+
+		zw.Lock()
+		for _, name := range children {
+			if zw.watching[name] {
+				continue
+			}
+			zw.watching[name] = true
+			go zw.watchService(name)
+		}
+		zw.Unlock()
+
+		select {
+		case <-ev:
+		case <-zw.exit:
+			return
+		}
+	}
+}
+
+func (zw *zookeeperWatcher) watchService(name string) {
+	prev := make(map[string]*registry.Service)
+
+	for {
+		children, ev, err := zw.children(providersPath(name))
+		if err != nil {
+			logger.Errorf("[zookeeper] watch of service %s failed: %v", name, err)
+			if !zw.wait() {
+				return
+			}
+			continue
+		}
+
+		cur := make(map[string]*registry.Service, len(children))
+		for _, child := range children {
+			s, err := toService(child)
+			if err != nil || !registry.MatchDomain(zw.wo.Domain, registry.Domain(s)) {
+				continue
+			}
+			cur[s.Nodes[0].Id] = s
+		}
+
+		if !zw.diff(prev, cur) {
+			return
+		}
+		prev = cur
+
+		select {
+		case <-ev:
+		case <-zw.exit:
+			return
+		}
+	}
+}
+
+// diff sends the results between the nodes, returns false when stopped
+func (zw *zookeeperWatcher) diff(prev, cur map[string]*registry.Service) bool {
+	var results []*registry.Result
+
+	for _, id := range sortedKeys(cur) {
+		p, ok := prev[id]
+		switch {
+		case !ok:
+			results = append(results, &registry.Result{Action: "create", Service: cur[id]})
+		case !reflect.DeepEqual(p, cur[id]):
+			results = append(results, &registry.Result{Action: "update", Service: cur[id]})
+		}
+	}
+
+	for _, id := range sortedKeys(prev) {
+		if _, ok := cur[id]; !ok {
+			results = append(results, &registry.Result{Action: "delete", Service: prev[id]})
+		}
+	}
+
+	for _, r := range results {
+		select {
+		case zw.next <- r:
+		case <-zw.exit:
+			return false
+		}
+	}
+	return true
+}
+
+func sortedKeys(m map[string]*registry.Service) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (zw *zookeeperWatcher) Next() (*registry.Result, error) {
+	select {
+	case r := <-zw.next:
+		return r, nil
+	case <-zw.exit:
+		return nil, registry.ErrWatcherStopped
+	}
+}
+
+func (zw *zookeeperWatcher) Stop() {
+	zw.once.Do(func() {
+		close(zw.exit)
+	})
+}
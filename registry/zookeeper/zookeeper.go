@@ -0,0 +1,399 @@
+// Package zookeeper provides a zookeeper registry. Nodes are written as
+// ephemeral znodes named after their encoded provider url under
+// /xmicro/{service}/providers, the layout of the dubbo service directory.
+package zookeeper
+
+import (
+	"errors"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-zookeeper/zk"
+)
+
+import (
+	"xmicro/common"
+	"xmicro/common/component"
+	"xmicro/common/constant"
+	"xmicro/logger"
+	"xmicro/registry"
+)
+
+func init() {
+	component.SetRegistryFactory(constant.ZOOKEEPER_KEY, &zookeeperRegistryFactory{})
+}
+
+type zookeeperRegistryFactory struct {
+}
+
+func (f *zookeeperRegistryFactory) GetRegistry(url *common.URL) (registry.Registry, error) {
+	timeout := url.GetParam(constant.RegistryTimeoutKey, "10s")
+	timeDuration := constant.DefaultTimeout * time.Millisecond
+	if d, err := time.ParseDuration(timeout); err == nil {
+		timeDuration = d
+	}
+
+	opts := []registry.Option{
+		registry.Addrs(strings.Split(url.Location, ",")...),
+		registry.Timeout(timeDuration),
+	}
+	if len(url.Username) > 0 {
+		opts = append(opts, Auth(url.Username, url.Password))
+	}
+
+	z := newRegistry()
+	if err := configure(z, opts...); err != nil {
+		return nil, err
+	}
+	return z, nil
+}
+
+// conn is the part of the zookeeper connection used by the registry
+type conn interface {
+	AddAuth(scheme string, auth []byte) error
+	Create(path string, data []byte, flags int32, acl []zk.ACL) (string, error)
+	Delete(path string, version int32) error
+	Children(path string) ([]string, *zk.Stat, error)
+	ChildrenW(path string) ([]string, *zk.Stat, <-chan zk.Event, error)
+	ExistsW(path string) (bool, *zk.Stat, <-chan zk.Event, error)
+	Close()
+}
+
+// connect opens the connection calling back with its session events
+var connect = func(servers []string, timeout time.Duration, callback zk.EventCallback) (conn, error) {
+	c, _, err := zk.Connect(servers, timeout, zk.WithLogger(zkLogger{}), zk.WithEventCallback(callback))
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+type zookeeperRegistry struct {
+	client  conn
+	options registry.Options
+
+	sync.Mutex
+	// registered nodes by id, written again when the session expired
+	register map[string]*registration
+	// the session expired since the nodes were written
+	expired bool
+}
+
+type registration struct {
+	path    string
+	service *registry.Service
+}
+
+// zkLogger writes the zookeeper client logs to the logger
+type zkLogger struct{}
+
+func (zkLogger) Printf(format string, args ...interface{}) {
+	logger.Debugf("[zookeeper] "+format, args...)
+}
+
+func newRegistry() *zookeeperRegistry {
+	return &zookeeperRegistry{
+		register: make(map[string]*registration),
+	}
+}
+
+func configure(z *zookeeperRegistry, opts ...registry.Option) error {
+	for _, o := range opts {
+		o(&z.options)
+	}
+
+	if z.options.Timeout == 0 {
+		z.options.Timeout = 10 * time.Second
+	}
+
+	var cAddrs []string
+	for _, address := range z.options.Addrs {
+		if len(address) == 0 {
+			continue
+		}
+		addr, port, err := net.SplitHostPort(address)
+		if ae, ok := err.(*net.AddrError); ok && ae.Err == "missing port in address" {
+			cAddrs = append(cAddrs, net.JoinHostPort(address, "2181"))
+		} else if err == nil {
+			cAddrs = append(cAddrs, net.JoinHostPort(addr, port))
+		}
+	}
+	if len(cAddrs) == 0 {
+		cAddrs = []string{"127.0.0.1:2181"}
+	}
+
+	c, err := connect(cAddrs, z.options.Timeout, z.event)
+	if err != nil {
+		return err
+	}
+
+	if z.options.Context != nil {
+		if u, ok := z.options.Context.Value(authKey{}).(*authCreds); ok {
+			if err := c.AddAuth("digest", []byte(u.Username+":"+u.Password)); err != nil {
+				c.Close()
+				return err
+			}
+		}
+	}
+
+	if z.client != nil {
+		z.client.Close()
+	}
+	z.client = c
+	return nil
+}
+
+// event writes the nodes again once a new session replaced an expired one
+func (z *zookeeperRegistry) event(ev zk.Event) {
+	if ev.Type != zk.EventSession {
+		return
+	}
+
+	z.Lock()
+	defer z.Unlock()
+
+	switch ev.State {
+	case zk.StateExpired:
+		z.expired = true
+	case zk.StateHasSession:
+		if !z.expired {
+			return
+		}
+		z.expired = false
+		// the callback runs on the connection loop
+		go z.reregister()
+	}
+}
+
+func (z *zookeeperRegistry) reregister() {
+	z.Lock()
+	var regs []*registration
+	for _, r := range z.register {
+		regs = append(regs, r)
+	}
+	z.Unlock()
+
+	for _, r := range regs {
+		logger.Infof("[zookeeper] session expired, registering %s again", r.path)
+		if err := z.create(r.path); err != nil {
+			logger.Errorf("[zookeeper] failed to register %s: %v", r.path, err)
+		}
+	}
+}
+
+// mkdirs creates the persistent parents of the path
+func (z *zookeeperRegistry) mkdirs(p string) error {
+	var cur string
+	for _, part := range strings.Split(strings.Trim(p, "/"), "/") {
+		cur += "/" + part
+		_, err := z.client.Create(cur, nil, 0, zk.WorldACL(zk.PermAll))
+		if err != nil && err != zk.ErrNodeExists {
+			return err
+		}
+	}
+	return nil
+}
+
+// create writes the ephemeral node of the path
+func (z *zookeeperRegistry) create(p string) error {
+	if err := z.mkdirs(p[:strings.LastIndex(p, "/")]); err != nil {
+		return err
+	}
+	_, err := z.client.Create(p, nil, zk.FlagEphemeral, zk.WorldACL(zk.PermAll))
+	if err == zk.ErrNodeExists {
+		return nil
+	}
+	return err
+}
+
+func (z *zookeeperRegistry) Init(opts ...registry.Option) error {
+	return configure(z, opts...)
+}
+
+func (z *zookeeperRegistry) Options() registry.Options {
+	return z.options
+}
+
+func (z *zookeeperRegistry) Register(s *registry.Service, opts ...registry.RegisterOption) error {
+	if len(s.Nodes) == 0 {
+		return errors.New("Require at least one node")
+	}
+
+	var options registry.RegisterOptions
+	for _, o := range opts {
+		o(&options)
+	}
+
+	// the domain is kept in the service metadata
+	s = registry.WithDomain(s, options.Domain)
+
+	for _, node := range s.Nodes {
+		p, err := nodePath(s, node)
+		if err != nil {
+			return err
+		}
+
+		z.Lock()
+		prev, ok := z.register[node.Id]
+		z.Unlock()
+
+		// the url changed, remove the stale node
+		if ok && prev.path != p {
+			if err := z.client.Delete(prev.path, -1); err != nil && err != zk.ErrNoNode {
+				return err
+			}
+		}
+
+		if err := z.create(p); err != nil {
+			return err
+		}
+
+		z.Lock()
+		z.register[node.Id] = &registration{path: p, service: s}
+		z.Unlock()
+	}
+
+	return nil
+}
+
+func (z *zookeeperRegistry) Deregister(s *registry.Service, opts ...registry.DeregisterOption) error {
+	if len(s.Nodes) == 0 {
+		return errors.New("Require at least one node")
+	}
+
+	var options registry.DeregisterOptions
+	for _, o := range opts {
+		o(&options)
+	}
+
+	s = registry.WithDomain(s, options.Domain)
+
+	for _, node := range s.Nodes {
+		z.Lock()
+		reg, ok := z.register[node.Id]
+		delete(z.register, node.Id)
+		z.Unlock()
+
+		var p string
+		if ok {
+			p = reg.path
+		} else {
+			var err error
+			if p, err = nodePath(s, node); err != nil {
+				return err
+			}
+		}
+
+		if err := z.client.Delete(p, -1); err != nil && err != zk.ErrNoNode {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// nodes returns the services with a single node of the providers
+func (z *zookeeperRegistry) nodes(name string) ([]*registry.Service, error) {
+	children, _, err := z.client.Children(providersPath(name))
+	if err == zk.ErrNoNode {
+		return nil, registry.ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	var services []*registry.Service
+	for _, child := range children {
+		s, err := toService(child)
+		if err != nil {
+			logger.Warnf("[zookeeper] skipping provider %s: %v", child, err)
+			continue
+		}
+		services = append(services, s)
+	}
+	return services, nil
+}
+
+func (z *zookeeperRegistry) GetService(name string, opts ...registry.GetOption) ([]*registry.Service, error) {
+	var options registry.GetOptions
+	for _, o := range opts {
+		o(&options)
+	}
+
+	nodes, err := z.nodes(name)
+	if err != nil {
+		return nil, err
+	}
+
+	// services by domain and version
+	serviceMap := make(map[string]*registry.Service)
+
+	for _, sn := range registry.FilterDomain(nodes, options.Domain) {
+		key := registry.Domain(sn) + "/" + sn.Version
+		s, ok := serviceMap[key]
+		if !ok {
+			serviceMap[key] = sn
+			continue
+		}
+		s.Nodes = append(s.Nodes, sn.Nodes...)
+	}
+
+	if len(serviceMap) == 0 {
+		return nil, registry.ErrNotFound
+	}
+
+	services := make([]*registry.Service, 0, len(serviceMap))
+	for _, s := range serviceMap {
+		services = append(services, s)
+	}
+	sort.Slice(services, func(i, j int) bool { return services[i].Version < services[j].Version })
+
+	return services, nil
+}
+
+func (z *zookeeperRegistry) ListServices(opts ...registry.ListOption) ([]*registry.Service, error) {
+	var options registry.ListOptions
+	for _, o := range opts {
+		o(&options)
+	}
+
+	children, _, err := z.client.Children(prefix)
+	if err == zk.ErrNoNode {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(children)
+
+	services := make([]*registry.Service, 0, len(children))
+	for _, name := range children {
+		// the domains are only known from the providers
+		if options.Domain != registry.WildcardDomain {
+			if _, err := z.GetService(name, registry.GetDomain(options.Domain)); err != nil {
+				continue
+			}
+		}
+		services = append(services, &registry.Service{Name: name})
+	}
+	return services, nil
+}
+
+func (z *zookeeperRegistry) Watch(opts ...registry.WatchOption) (registry.Watcher, error) {
+	return newZookeeperWatcher(z, opts...)
+}
+
+func (z *zookeeperRegistry) String() string {
+	return "zookeeper"
+}
+
+// NewRegistry returns a zookeeper registry, the connection errors are logged
+func NewRegistry(opts ...registry.Option) registry.Registry {
+	z := newRegistry()
+	if err := configure(z, opts...); err != nil {
+		logger.Errorf("[zookeeper] failed to create registry: %v", err)
+	}
+	return z
+}
@@ -0,0 +1,247 @@
+package zookeeper
+
+import (
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-zookeeper/zk"
+
+	"xmicro/registry"
+)
+
+// fakeServer keeps the znodes of the fake connections, the ephemeral ones
+// by the connection which created them
+type fakeServer struct {
+	sync.Mutex
+	nodes map[string]*fakeConn
+}
+
+// fakeConn is a connection to the fake server whose session events are
+// sent on the callback of the registry
+type fakeConn struct {
+	server   *fakeServer
+	callback zk.EventCallback
+	events   chan zk.Event
+}
+
+func newFakeServer(t *testing.T) *fakeServer {
+	f := &fakeServer{nodes: make(map[string]*fakeConn)}
+	dial := connect
+	connect = func(servers []string, timeout time.Duration, callback zk.EventCallback) (conn, error) {
+		c := &fakeConn{server: f, callback: callback, events: make(chan zk.Event)}
+		// the callback runs on the connection loop
+		go func() {
+			for ev := range c.events {
+				c.callback(ev)
+			}
+		}()
+		return c, nil
+	}
+	t.Cleanup(func() {
+		connect = dial
+	})
+	return f
+}
+
+func (f *fakeServer) exists(p string) bool {
+	f.Lock()
+	defer f.Unlock()
+	_, ok := f.nodes[p]
+	return ok
+}
+
+// expire removes the ephemeral nodes of the session and sends the
+// expiry and the new session to the connection
+func (c *fakeConn) expire() {
+	c.server.Lock()
+	for p, owner := range c.server.nodes {
+		if owner == c {
+			delete(c.server.nodes, p)
+		}
+	}
+	c.server.Unlock()
+
+	c.events <- zk.Event{Type: zk.EventSession, State: zk.StateDisconnected}
+	c.events <- zk.Event{Type: zk.EventSession, State: zk.StateExpired}
+	c.events <- zk.Event{Type: zk.EventSession, State: zk.StateHasSession}
+}
+
+func (c *fakeConn) AddAuth(scheme string, auth []byte) error {
+	return nil
+}
+
+func (c *fakeConn) Create(p string, data []byte, flags int32, acl []zk.ACL) (string, error) {
+	c.server.Lock()
+	defer c.server.Unlock()
+
+	if _, ok := c.server.nodes[p]; ok {
+		return "", zk.ErrNodeExists
+	}
+	if parent := path.Dir(p); parent != "/" {
+		if _, ok := c.server.nodes[parent]; !ok {
+			return "", zk.ErrNoNode
+		}
+	}
+	var owner *fakeConn
+	if flags&zk.FlagEphemeral != 0 {
+		owner = c
+	}
+	c.server.nodes[p] = owner
+	return p, nil
+}
+
+func (c *fakeConn) Delete(p string, version int32) error {
+	c.server.Lock()
+	defer c.server.Unlock()
+
+	if _, ok := c.server.nodes[p]; !ok {
+		return zk.ErrNoNode
+	}
+	delete(c.server.nodes, p)
+	return nil
+}
+
+func (c *fakeConn) Children(p string) ([]string, *zk.Stat, error) {
+	c.server.Lock()
+	defer c.server.Unlock()
+
+	if _, ok := c.server.nodes[p]; !ok {
+		return nil, nil, zk.ErrNoNode
+	}
+	var children []string
+	for child := range c.server.nodes {
+		if path.Dir(child) == p {
+			children = append(children, path.Base(child))
+		}
+	}
+	sort.Strings(children)
+	return children, &zk.Stat{}, nil
+}
+
+func (c *fakeConn) ChildrenW(p string) ([]string, *zk.Stat, <-chan zk.Event, error) {
+	children, stat, err := c.Children(p)
+	return children, stat, make(chan zk.Event), err
+}
+
+func (c *fakeConn) ExistsW(p string) (bool, *zk.Stat, <-chan zk.Event, error) {
+	return c.server.exists(p), &zk.Stat{}, make(chan zk.Event), nil
+}
+
+func (c *fakeConn) Close() {}
+
+func testService(id string) *registry.Service {
+	return &registry.Service{
+		Name:    "greeter",
+		Version: "1.0.0",
+		Nodes: []*registry.Node{
+			{Id: id, Address: "10.0.0.1:8080", Metadata: map[string]string{"protocol": "rpc"}},
+		},
+	}
+}
+
+// registered returns the path of the node written by the registry
+func registered(z *zookeeperRegistry, id string) string {
+	z.Lock()
+	defer z.Unlock()
+	return z.register[id].path
+}
+
+// eventually waits for the condition to hold
+func eventually(t *testing.T, cond func() bool, msg string) {
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal(msg)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	newFakeServer(t)
+	r := NewRegistry()
+
+	if err := r.Register(testService("greeter-1")); err != nil {
+		t.Fatal(err)
+	}
+
+	services, err := r.GetService("greeter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(services) != 1 || len(services[0].Nodes) != 1 || services[0].Nodes[0].Address != "10.0.0.1:8080" {
+		t.Fatalf("Unexpected services %+v", services)
+	}
+
+	list, err := r.ListServices()
+	if err != nil || len(list) != 1 || list[0].Name != "greeter" {
+		t.Fatalf("Unexpected services %+v %v", list, err)
+	}
+
+	if err := r.Deregister(testService("greeter-1")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.GetService("greeter"); err != registry.ErrNotFound {
+		t.Fatalf("Expected not found got %v", err)
+	}
+}
+
+func TestSessionExpired(t *testing.T) {
+	f := newFakeServer(t)
+	z := NewRegistry().(*zookeeperRegistry)
+
+	s := testService("greeter-1")
+	if err := z.Register(s); err != nil {
+		t.Fatal(err)
+	}
+	p := registered(z, "greeter-1")
+	if !f.exists(p) {
+		t.Fatalf("Expected the node %s", p)
+	}
+
+	// the node removed with the session is written again on the new one
+	z.client.(*fakeConn).expire()
+	eventually(t, func() bool { return f.exists(p) }, "Expected the node registered again")
+
+	// a new session without expiry doesn't register again
+	if err := z.Deregister(s); err != nil {
+		t.Fatal(err)
+	}
+	z.client.(*fakeConn).events <- zk.Event{Type: zk.EventSession, State: zk.StateHasSession}
+	time.Sleep(50 * time.Millisecond)
+	if f.exists(p) {
+		t.Fatalf("Unexpected node %s", p)
+	}
+}
+
+func TestDeregisterUnknown(t *testing.T) {
+	f := newFakeServer(t)
+
+	// the node written by another registry, e.g. before a restart
+	s := testService("greeter-1")
+	z := NewRegistry().(*zookeeperRegistry)
+	if err := z.Register(s); err != nil {
+		t.Fatal(err)
+	}
+	p := registered(z, "greeter-1")
+
+	// is removed by its path
+	if err := NewRegistry().Deregister(s); err != nil {
+		t.Fatal(err)
+	}
+	if f.exists(p) {
+		t.Fatalf("Expected the node %s removed", p)
+	}
+	if !strings.HasPrefix(p, providersPath("greeter")) {
+		t.Fatalf("Unexpected node path %s", p)
+	}
+
+	// a missing node is not an error
+	if err := NewRegistry().Deregister(s); err != nil {
+		t.Fatal(err)
+	}
+}
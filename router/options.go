@@ -23,6 +23,10 @@ type Options struct {
 	Context context.Context
 	// Cache routes
 	Cache bool
+	// Zone of the router, routes to nodes in it are preferred
+	Zone string
+	// Domain to lookup the services in, all domains if blank
+	Domain string
 }
 
 // Id sets Router Id
@@ -60,6 +64,20 @@ func Registry(r registry.Registry) Option {
 	}
 }
 
+// Zone sets the zone of the router
+func Zone(z string) Option {
+	return func(o *Options) {
+		o.Zone = z
+	}
+}
+
+// Domain sets the registry domain the services are looked up in
+func Domain(d string) Option {
+	return func(o *Options) {
+		o.Domain = d
+	}
+}
+
 // Cache the routes
 func Cache() Option {
 	return func(o *Options) {
@@ -16,6 +16,8 @@ type LookupOptions struct {
 	Router string
 	// Link to query
 	Link string
+	// Domain to lookup the service in, the domain of the router if empty
+	Domain string
 }
 
 // LookupAddress sets service to query
@@ -53,6 +55,13 @@ func LookupLink(link string) LookupOption {
 	}
 }
 
+// LookupDomain sets the registry domain to query
+func LookupDomain(d string) LookupOption {
+	return func(o *LookupOptions) {
+		o.Domain = d
+	}
+}
+
 // NewLookup creates new query and returns it
 func NewLookup(opts ...LookupOption) LookupOptions {
 	// default options
@@ -72,7 +81,7 @@ func NewLookup(opts ...LookupOption) LookupOptions {
 }
 
 // isMatch checks if the route matches given query options
-func isMatch(route Route, address, gateway, network, rtr, link string) bool {
+func isMatch(route Route, address, gateway, network, rtr, link, domain string) bool {
 	// matches the values provided
 	match := func(a, b string) bool {
 		if a == "*" || b == "*" || a == b {
@@ -94,6 +103,7 @@ func isMatch(route Route, address, gateway, network, rtr, link string) bool {
 		{rtr, route.Router},
 		{address, route.Address},
 		{link, route.Link},
+		{domain, route.Domain},
 	}
 
 	for _, v := range values {
@@ -113,12 +123,16 @@ func Filter(routes []Route, opts LookupOptions) []Route {
 	network := opts.Network
 	rtr := opts.Router
 	link := opts.Link
+	domain := opts.Domain
+	if len(domain) == 0 {
+		domain = "*"
+	}
 
 	// routeMap stores the routes we're going to advertise
 	routeMap := make(map[string][]Route)
 
 	for _, route := range routes {
-		if isMatch(route, address, gateway, network, rtr, link) {
+		if isMatch(route, address, gateway, network, rtr, link, domain) {
 			// add matchihg route to the routeMap
 			routeKey := route.Service + "@" + route.Network
 			routeMap[routeKey] = append(routeMap[routeKey], route)
@@ -9,6 +9,7 @@ import (
 
 	"xmicro/logger"
 	"xmicro/registry"
+	"xmicro/registry/debounce"
 	"xmicro/router"
 )
 
@@ -89,18 +90,26 @@ func (r *rtr) Table() router.Table {
 	return r.table
 }
 
+// getDomain returns the domain the registry returned the service from,
+// the routes of the service are created in the network of the domain
 func getDomain(srv *registry.Service) string {
-	// check the service metadata for domain
-	// TODO: domain as Domain field in registry?
-	if srv.Metadata != nil && len(srv.Metadata["domain"]) > 0 {
-		return srv.Metadata["domain"]
-	} else if len(srv.Nodes) > 0 && srv.Nodes[0].Metadata != nil {
-		return srv.Nodes[0].Metadata["domain"]
+	return registry.Domain(srv)
+}
+
+// lookupDomain returns the domain of the query, the domain of the router
+// unless the query sets one
+func (r *rtr) lookupDomain(q router.LookupOptions) string {
+	if len(q.Domain) > 0 {
+		return q.Domain
 	}
 
-	// otherwise return wildcard
-	// TODO: return GlobalDomain or PublicDomain
-	return registry.DefaultDomain
+	r.RLock()
+	defer r.RUnlock()
+
+	if len(r.options.Domain) > 0 {
+		return r.options.Domain
+	}
+	return registry.WildcardDomain
 }
 
 // manageRoute applies action on a given route
@@ -125,8 +134,9 @@ func (r *rtr) manageRoute(route router.Route, action string) error {
 	return nil
 }
 
-// createRoutes turns a service into a list routes basically converting nodes to routes
-func (r *rtr) createRoutes(service *registry.Service, network string) []router.Route {
+// createRoutes turns a service into a list routes basically converting nodes to routes,
+// the routes are in the network named after the domain of the service
+func (r *rtr) createRoutes(service *registry.Service, domain string) []router.Route {
 	var routes []router.Route
 
 	for _, node := range service.Nodes {
@@ -134,10 +144,11 @@ func (r *rtr) createRoutes(service *registry.Service, network string) []router.R
 			Service:  service.Name,
 			Address:  node.Address,
 			Gateway:  "",
-			Network:  network,
+			Network:  domain,
+			Domain:   domain,
 			Router:   r.options.Id,
 			Link:     router.DefaultLink,
-			Metric:   router.DefaultMetric,
+			Metric:   r.metric(node),
 			Metadata: node.Metadata,
 		})
 	}
@@ -145,6 +156,22 @@ func (r *rtr) createRoutes(service *registry.Service, network string) []router.R
 	return routes
 }
 
+// metric returns the cost of a route to the node. Nodes found in a
+// registry which isn't preferred or is in another zone cost more.
+func (r *rtr) metric(node *registry.Node) int64 {
+	metric := router.DefaultMetric
+	if node.Metadata == nil {
+		return metric
+	}
+	if _, ok := node.Metadata[registry.SourceKey]; ok && node.Metadata[registry.PreferredKey] != "true" {
+		metric += 2
+	}
+	if zone, ok := node.Metadata[registry.ZoneKey]; ok && len(r.options.Zone) > 0 && zone != r.options.Zone {
+		metric++
+	}
+	return metric
+}
+
 // manageServiceRoutes applies action to all routes of the service.
 // It returns error of the action fails with error.
 func (r *rtr) manageRoutes(service *registry.Service, action, network string) error {
@@ -210,15 +237,17 @@ func (r *rtr) loadRoutes(reg registry.Registry) error {
 
 		// otherwise get all the service info
 
-		// get the service to retrieve all its info
-		srvs, err := reg.GetService(service.Name, registry.GetDomain(domain))
+		// get the service to retrieve all its info, listed services
+		// without nodes don't tell their domain so all are fetched
+		srvs, err := reg.GetService(service.Name, registry.GetDomain(registry.WildcardDomain))
 		if err != nil {
-			logger.Tracef("Failed to get service %s domain: %s", service.Name, domain)
+			logger.Tracef("Failed to get service %s domain: %s", service.Name, registry.WildcardDomain)
 			continue
 		}
 
 		// manage the routes for all returned services
 		for _, srv := range srvs {
+			domain := getDomain(srv)
 			routes := r.createRoutes(srv, domain)
 
 			if len(routes) > 0 {
@@ -266,6 +295,9 @@ func (r *rtr) Close() error {
 func (r *rtr) Lookup(service string, opts ...router.LookupOption) ([]router.Route, error) {
 	q := router.NewLookup(opts...)
 
+	domain := r.lookupDomain(q)
+	q.Domain = domain
+
 	// if we find the routes filter and return them
 	routes, err := r.table.Read(router.ReadService(service))
 	if err == nil {
@@ -277,9 +309,9 @@ func (r *rtr) Lookup(service string, opts ...router.LookupOption) ([]router.Rout
 	}
 
 	// lookup the route
-	logger.Tracef("Fetching route for %s domain: %v", service, registry.WildcardDomain)
+	logger.Tracef("Fetching route for %s domain: %v", service, domain)
 
-	services, err := r.options.Registry.GetService(service, registry.GetDomain(registry.WildcardDomain))
+	services, err := r.options.Registry.GetService(service, registry.GetDomain(domain))
 	if err == registry.ErrNotFound {
 		logger.Tracef("Failed to find route for %s", service)
 		return nil, router.ErrRouteNotFound
@@ -461,6 +493,9 @@ func (r *rtr) start() error {
 					continue
 				}
 
+				// bursts of results are coalesced into the changed nodes
+				w = debounce.NewWatcher(w)
+
 				// watchRegistry calls stop when it's done
 				if err := r.watchRegistry(w); err != nil {
 					if logger.V(core.DebugLevel, logger.DefaultLogger) {
@@ -0,0 +1,134 @@
+package registry
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	"xmicro/registry"
+	"xmicro/registry/memory"
+	"xmicro/router"
+)
+
+// newTestRegistry returns a registry with a greeter node in the default
+// domain and one in the staging domain
+func newTestRegistry(t *testing.T) registry.Registry {
+	reg := memory.NewRegistry()
+	for domain, address := range map[string]string{
+		registry.DefaultDomain: "10.0.0.1:8080",
+		"staging":              "10.0.0.2:8080",
+	} {
+		s := &registry.Service{
+			Name:    "greeter",
+			Version: "1.0.0",
+			Nodes:   []*registry.Node{{Id: "greeter-" + domain, Address: address}},
+		}
+		if err := reg.Register(s, registry.RegisterDomain(domain)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return reg
+}
+
+// addresses returns the sorted addresses and networks of the routes
+func addresses(routes []router.Route) []string {
+	var out []string
+	for _, r := range routes {
+		out = append(out, r.Network+"/"+r.Address)
+	}
+	sort.Strings(out)
+	return out
+}
+
+func TestLookupDomain(t *testing.T) {
+	reg := newTestRegistry(t)
+
+	for _, tc := range []struct {
+		name   string
+		router []router.Option
+		lookup []router.LookupOption
+		want   []string
+	}{
+		{
+			name:   "router domain",
+			router: []router.Option{router.Domain(registry.DefaultDomain)},
+			want:   []string{registry.DefaultDomain + "/10.0.0.1:8080"},
+		},
+		{
+			name:   "lookup domain",
+			router: []router.Option{router.Domain(registry.DefaultDomain)},
+			lookup: []router.LookupOption{router.LookupDomain("staging")},
+			want:   []string{"staging/10.0.0.2:8080"},
+		},
+		{
+			name: "wildcard",
+			want: []string{registry.DefaultDomain + "/10.0.0.1:8080", "staging/10.0.0.2:8080"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r := NewRouter(append(tc.router, router.Registry(reg))...)
+			defer r.Close()
+
+			routes, err := r.Lookup("greeter", tc.lookup...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := addresses(routes); !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("Expected routes %v got %v", tc.want, got)
+			}
+		})
+	}
+
+	r := NewRouter(router.Registry(reg))
+	defer r.Close()
+	if _, err := r.Lookup("greeter", router.LookupDomain("unknown")); err != router.ErrRouteNotFound {
+		t.Fatalf("Expected route not found got %v", err)
+	}
+	if _, err := r.Lookup("unknown"); err != router.ErrRouteNotFound {
+		t.Fatalf("Expected route not found got %v", err)
+	}
+
+	// the network of the query is filtered by along with the domain
+	routes, err := r.Lookup("greeter", router.LookupNetwork("staging"), router.LookupDomain(registry.WildcardDomain))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := addresses(routes), []string{"staging/10.0.0.2:8080"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("Expected routes %v got %v", want, got)
+	}
+	if _, err := r.Lookup("greeter", router.LookupNetwork("staging"), router.LookupDomain(registry.DefaultDomain)); err != router.ErrRouteNotFound {
+		t.Fatalf("Expected route not found got %v", err)
+	}
+}
+
+func TestLoadRoutes(t *testing.T) {
+	reg := newTestRegistry(t)
+	r := NewRouter(router.Registry(reg)).(*rtr)
+	defer r.Close()
+
+	// the routes of every domain are loaded in the network of the domain
+	if err := r.loadRoutes(reg); err != nil {
+		t.Fatal(err)
+	}
+	routes, err := r.table.Read(router.ReadService("greeter"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := addresses(routes)
+	want := []string{registry.DefaultDomain + "/10.0.0.1:8080", "staging/10.0.0.2:8080"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Expected routes %v got %v", want, got)
+	}
+
+	// the cached routes are read by domain
+	routes, err = r.Lookup("greeter", router.LookupDomain("staging"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := addresses(routes); len(got) != 1 || got[0] != "staging/10.0.0.2:8080" {
+		t.Fatalf("Expected the staging route got %v", got)
+	}
+	if _, err := r.Lookup("greeter", router.LookupDomain("unknown")); err != router.ErrRouteNotFound {
+		t.Fatalf("Expected route not found got %v", err)
+	}
+}
@@ -74,6 +74,8 @@ type Route struct {
 	Gateway string
 	// Network is network address
 	Network string
+	// Domain is the registry domain of the service
+	Domain string
 	// Router is router id
 	Router string
 	// Link is network link
@@ -0,0 +1,141 @@
+// Package dedupe provides a subscriber wrapper for idempotent consumers.
+// Messages redelivered by at-least-once brokers are skipped once a
+// previous delivery has been handled successfully.
+package dedupe
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"xmicro/logger"
+	"xmicro/server"
+	"xmicro/store"
+	"xmicro/store/memory"
+)
+
+// ErrInProgress is returned for a message another delivery is handling,
+// so the broker redelivers it
+var ErrInProgress = errors.New("dedupe: message is being handled")
+
+// errHandled means the message was handled before
+var errHandled = errors.New("dedupe: message was handled")
+
+// the value of a record claimed by the delivery handling the message
+const claimValue = "in-progress"
+
+// NewSubscriberWrapper returns a server.SubscriberWrapper which skips
+// messages already processed. A delivery claims the message for the claim
+// TTL before handling it, the claim is released if the handler fails and
+// recorded as processed once it succeeds. Records default to an in-memory
+// store, use the redis store to share them between nodes.
+func NewSubscriberWrapper(opts ...Option) server.SubscriberWrapper {
+	options := Options{
+		Header:   DefaultHeader,
+		TTL:      DefaultTTL,
+		ClaimTTL: DefaultClaimTTL,
+		Table:    DefaultTable,
+	}
+
+	for _, o := range opts {
+		o(&options)
+	}
+
+	if options.Store == nil {
+		options.Store = memory.NewStore()
+	}
+
+	if options.Key == nil {
+		options.Key = headerKey(options.Header)
+	}
+
+	st := options.Store
+
+	return func(fn server.SubscriberFunc) server.SubscriberFunc {
+		return func(ctx context.Context, msg server.Message) error {
+			id := options.Key(ctx, msg)
+			if len(id) == 0 {
+				return fn(ctx, msg)
+			}
+
+			key := msg.Topic() + "/" + id
+
+			claimed, err := claim(st, key, options)
+			switch err {
+			case nil:
+			case errHandled:
+				logger.Debugf("dedupe: skipping duplicate message %s", key)
+				return nil
+			case ErrInProgress:
+				return ErrInProgress
+			default:
+				// rather handle twice than drop the message
+				logger.Errorf("dedupe: failed to claim record %s: %v", key, err)
+			}
+
+			if err := fn(ctx, msg); err != nil {
+				// let a redelivery handle the message
+				if claimed {
+					if derr := st.Delete(key, store.DeleteFrom("", options.Table)); derr != nil {
+						logger.Errorf("dedupe: failed to release record %s: %v", key, derr)
+					}
+				}
+				return err
+			}
+
+			if err := st.Write(&store.Record{
+				Key:    key,
+				Value:  []byte(time.Now().Format(time.RFC3339)),
+				Expiry: options.TTL,
+			}, store.WriteTo("", options.Table)); err != nil {
+				logger.Errorf("dedupe: failed to write record %s: %v", key, err)
+			}
+
+			return nil
+		}
+	}
+}
+
+// claim records the message as being handled until the claim TTL. The
+// stores which can't create a record atomically are only read, so
+// concurrent deliveries may both be handled.
+func claim(st store.Store, key string, options Options) (bool, error) {
+	c, ok := st.(store.Creator)
+	if !ok {
+		_, err := st.Read(key, store.ReadFrom("", options.Table))
+		switch err {
+		case nil:
+			return false, errHandled
+		case store.ErrNotFound:
+			return false, nil
+		}
+		return false, err
+	}
+
+	err := c.Create(&store.Record{
+		Key:    key,
+		Value:  []byte(claimValue),
+		Expiry: options.ClaimTTL,
+	}, store.WriteTo("", options.Table))
+	if err != store.ErrExists {
+		return err == nil, err
+	}
+
+	recs, err := st.Read(key, store.ReadFrom("", options.Table))
+	switch {
+	case err == store.ErrNotFound:
+		// the claim was released meanwhile
+		return false, ErrInProgress
+	case err != nil:
+		return false, err
+	case len(recs) > 0 && string(recs[0].Value) == claimValue:
+		return false, ErrInProgress
+	}
+	return false, errHandled
+}
+
+func headerKey(header string) KeyFunc {
+	return func(ctx context.Context, msg server.Message) string {
+		return msg.Header()[header]
+	}
+}
@@ -0,0 +1,106 @@
+package dedupe
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"xmicro/codec"
+	"xmicro/server"
+	"xmicro/store/memory"
+)
+
+type testMessage struct {
+	header map[string]string
+}
+
+func (m *testMessage) Topic() string             { return "test" }
+func (m *testMessage) Payload() interface{}      { return nil }
+func (m *testMessage) ContentType() string       { return "application/json" }
+func (m *testMessage) Header() map[string]string { return m.header }
+func (m *testMessage) Body() []byte              { return nil }
+func (m *testMessage) Codec() codec.Reader       { return nil }
+
+func TestSubscriberWrapper(t *testing.T) {
+	var calls int
+	var fail bool
+
+	fn := NewSubscriberWrapper(Store(memory.NewStore()))(func(ctx context.Context, msg server.Message) error {
+		calls++
+		if fail {
+			return errors.New("failed")
+		}
+		return nil
+	})
+
+	msg := &testMessage{header: map[string]string{"Micro-Id": "1"}}
+
+	// a failed delivery is not recorded
+	fail = true
+	if err := fn(context.Background(), msg); err == nil {
+		t.Fatal("Expected handler error")
+	}
+
+	fail = false
+	for i := 0; i < 3; i++ {
+		if err := fn(context.Background(), msg); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+	}
+
+	if calls != 2 {
+		t.Fatalf("Expected 2 handler calls got %d", calls)
+	}
+
+	// messages without an id are always handled
+	if err := fn(context.Background(), &testMessage{header: map[string]string{}}); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if calls != 3 {
+		t.Fatalf("Expected 3 handler calls got %d", calls)
+	}
+}
+
+func TestSubscriberWrapperConcurrent(t *testing.T) {
+	started := make(chan bool)
+	release := make(chan error)
+
+	fn := NewSubscriberWrapper(Store(memory.NewStore()), ClaimTTL(time.Second))(func(ctx context.Context, msg server.Message) error {
+		started <- true
+		return <-release
+	})
+
+	msg := &testMessage{header: map[string]string{"Micro-Id": "1"}}
+	run := func() chan error {
+		done := make(chan error, 1)
+		go func() {
+			done <- fn(context.Background(), msg)
+		}()
+		<-started
+		return done
+	}
+
+	// a redelivery is refused while the first delivery handles the message
+	done := run()
+	if err := fn(context.Background(), msg); err != ErrInProgress {
+		t.Fatalf("Expected in progress error got %v", err)
+	}
+
+	// the claim is released once the handler fails
+	release <- errors.New("failed")
+	if err := <-done; err == nil {
+		t.Fatal("Expected handler error")
+	}
+
+	done = run()
+	release <- nil
+	if err := <-done; err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	// the handled message is skipped
+	if err := fn(context.Background(), msg); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+}
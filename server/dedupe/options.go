@@ -0,0 +1,84 @@
+package dedupe
+
+import (
+	"context"
+	"time"
+
+	"xmicro/server"
+	"xmicro/store"
+)
+
+var (
+	// DefaultHeader carries the message id set by the publisher
+	DefaultHeader = "Micro-Id"
+	// DefaultTTL is how long a processed message is remembered
+	DefaultTTL = time.Hour * 24
+	// DefaultClaimTTL is how long a message being handled is claimed
+	DefaultClaimTTL = time.Minute
+	// DefaultTable the dedupe records are kept in
+	DefaultTable = "dedupe"
+)
+
+// KeyFunc returns the dedupe key of a message. An empty key
+// means the message can't be deduplicated and is always handled.
+type KeyFunc func(ctx context.Context, msg server.Message) string
+
+type Options struct {
+	// Store keeping the dedupe records
+	Store store.Store
+	// Header the message id is read from
+	Header string
+	// TTL of a dedupe record
+	TTL time.Duration
+	// ClaimTTL of the record of a message being handled, longer than
+	// the handler takes
+	ClaimTTL time.Duration
+	// Table the dedupe records are kept in
+	Table string
+	// Key overrides how the dedupe key is built
+	Key KeyFunc
+}
+
+type Option func(*Options)
+
+// Store sets the store keeping the dedupe records
+func Store(s store.Store) Option {
+	return func(o *Options) {
+		o.Store = s
+	}
+}
+
+// Header sets the header the message id is read from
+func Header(h string) Option {
+	return func(o *Options) {
+		o.Header = h
+	}
+}
+
+// TTL sets how long a processed message is remembered
+func TTL(d time.Duration) Option {
+	return func(o *Options) {
+		o.TTL = d
+	}
+}
+
+// ClaimTTL sets how long a message being handled is claimed
+func ClaimTTL(d time.Duration) Option {
+	return func(o *Options) {
+		o.ClaimTTL = d
+	}
+}
+
+// Table sets the table the dedupe records are kept in
+func Table(t string) Option {
+	return func(o *Options) {
+		o.Table = t
+	}
+}
+
+// Key sets the function building the dedupe key of a message
+func Key(fn KeyFunc) Option {
+	return func(o *Options) {
+		o.Key = fn
+	}
+}
@@ -17,7 +17,19 @@ type SubscriberOptions struct {
 	AutoAck  bool
 	Queue    string
 	Internal bool
-	Context  context.Context
+	// MaxConcurrency is the number of workers processing events
+	// of the subscription. Zero or one processes events serially
+	// on the broker's receive loop.
+	MaxConcurrency int
+	// QueueSize is the number of events buffered ahead of the
+	// workers. Once the queue is full the broker is blocked until
+	// a worker frees a slot. Defaults to MaxConcurrency.
+	QueueSize int
+	// OrderingKey is the message header used to preserve ordering.
+	// Events carrying the same value are handled by the same worker
+	// in the order they were received.
+	OrderingKey string
+	Context     context.Context
 }
 
 // EndpointMetadata is a Handler option that allows metadata to be added to
@@ -78,3 +90,27 @@ func SubscriberContext(ctx context.Context) SubscriberOption {
 		o.Context = ctx
 	}
 }
+
+// SubscriberConcurrency sets the number of workers processing events
+// for the subscriber concurrently
+func SubscriberConcurrency(n int) SubscriberOption {
+	return func(o *SubscriberOptions) {
+		o.MaxConcurrency = n
+	}
+}
+
+// SubscriberQueueSize sets the number of events buffered ahead of the
+// subscriber workers before the broker is blocked
+func SubscriberQueueSize(n int) SubscriberOption {
+	return func(o *SubscriberOptions) {
+		o.QueueSize = n
+	}
+}
+
+// SubscriberOrderingKey sets the message header used to keep events
+// with the same key in order when processed concurrently
+func SubscriberOrderingKey(header string) SubscriberOption {
+	return func(o *SubscriberOptions) {
+		o.OrderingKey = header
+	}
+}
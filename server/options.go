@@ -48,6 +48,10 @@ type Options struct {
 	// The router for requests
 	Router Router
 
+	// BrokerRequests subscribes the server to its own name on the
+	// broker so requests can be served over the broker as well
+	BrokerRequests bool
+
 	// TLSConfig specifies tls.Config for secure serving
 	TLSConfig *tls.Config
 
@@ -117,6 +121,12 @@ func Namespace(n string) Option {
 	}
 }
 
+// Domain sets the registry domain the server registers in, the
+// namespace of the handlers is the domain of the service
+func Domain(d string) Option {
+	return Namespace(d)
+}
+
 // Unique server id
 func Id(id string) Option {
 	return func(o *Options) {
@@ -251,6 +261,14 @@ func WithRouter(r Router) Option {
 	}
 }
 
+// BrokerRequests serves requests published to the service name on the broker.
+// Replies are published to the topic set in the Micro-Reply-To header.
+func BrokerRequests(b bool) Option {
+	return func(o *Options) {
+		o.BrokerRequests = b
+	}
+}
+
 // Wait tells the server to wait for requests to finish before exiting
 // If `wg` is nil, server only wait for completion of rpc handler.
 // For user need finer grained control, pass a concrete `wg` here, server will
@@ -0,0 +1,174 @@
+package rpc
+
+import (
+	"errors"
+	"hash/fnv"
+	"runtime/debug"
+	"sync"
+
+	"xmicro/broker"
+	"xmicro/logger"
+	"xmicro/server"
+)
+
+var errDispatcherStopped = errors.New("subscriber dispatcher stopped")
+
+// dispatcher hands broker events of a subscription to a bounded pool of
+// workers. The broker handler blocks while the queue is full which holds
+// back the broker receive loop until a worker is free. The brokers which
+// deliver ahead of the acks are bounded by the capacity of the dispatcher
+// through broker.MaxInFlight, the RabbitMQ prefetch and the JetStream max
+// ack pending. Kafka fetches into a bounded channel which fills while the
+// claim loop is blocked. Redis and core NATS push without acks, blocking
+// the receive loop is the only backpressure they have.
+type dispatcher struct {
+	handler broker.Handler
+	opts    server.SubscriberOptions
+
+	// shared queue for events without an ordering key
+	queue chan broker.Event
+	// per worker queues for events with an ordering key
+	keyed []chan broker.Event
+
+	// the events queued or being processed at most
+	capacity int
+
+	once sync.Once
+	exit chan bool
+	wg   *waitGroup
+}
+
+func newDispatcher(h broker.Handler, opts server.SubscriberOptions, gg *sync.WaitGroup) *dispatcher {
+	size := opts.QueueSize
+	if size <= 0 {
+		size = opts.MaxConcurrency
+	}
+
+	// keyed queues share the buffer between workers
+	ksize := size / opts.MaxConcurrency
+	if ksize == 0 {
+		ksize = 1
+	}
+
+	d := &dispatcher{
+		handler: h,
+		opts:    opts,
+		queue:   make(chan broker.Event, size),
+		keyed:   make([]chan broker.Event, opts.MaxConcurrency),
+		exit:    make(chan bool),
+		wg:      &waitGroup{gg: gg},
+
+		capacity: size + opts.MaxConcurrency*(ksize+1),
+	}
+
+	for i := range d.keyed {
+		d.keyed[i] = make(chan broker.Event, ksize)
+	}
+
+	d.wg.Add(len(d.keyed))
+	for i := range d.keyed {
+		go d.work(d.keyed[i])
+	}
+
+	return d
+}
+
+// Handle is the broker.Handler queueing the event for the workers
+func (d *dispatcher) Handle(e broker.Event) error {
+	queue := d.queue
+
+	if key := d.opts.OrderingKey; len(key) > 0 {
+		if msg := e.Message(); msg != nil {
+			if v, ok := msg.Header[key]; ok {
+				h := fnv.New32a()
+				h.Write([]byte(v))
+				queue = d.keyed[h.Sum32()%uint32(len(d.keyed))]
+			}
+		}
+	}
+
+	select {
+	case <-d.exit:
+		return errDispatcherStopped
+	default:
+	}
+
+	select {
+	case queue <- e:
+		return nil
+	case <-d.exit:
+		return errDispatcherStopped
+	}
+}
+
+func (d *dispatcher) work(keyed chan broker.Event) {
+	defer d.wg.Done()
+
+	for {
+		select {
+		case e := <-keyed:
+			d.process(e)
+		case e := <-d.queue:
+			d.process(e)
+		case <-d.exit:
+			// finish what was accepted before stopping
+			for {
+				select {
+				case e := <-keyed:
+					d.process(e)
+				case e := <-d.queue:
+					d.process(e)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (d *dispatcher) process(e broker.Event) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Error("panic recovered: ", r)
+			logger.Error(string(debug.Stack()))
+		}
+	}()
+
+	if err := d.handler(e); err != nil {
+		logger.Errorf("subscriber %s error: %v", e.Topic(), err)
+		// the event is left unacked when the subscriber acks itself or the
+		// broker can't redeliver it, Kafka then doesn't commit past it
+		if n, ok := e.(broker.Nacker); ok && d.opts.AutoAck {
+			if err := n.Nack(); err != nil {
+				logger.Errorf("subscriber %s nack error: %v", e.Topic(), err)
+			}
+		}
+		return
+	}
+
+	if d.opts.AutoAck {
+		if err := e.Ack(); err != nil {
+			logger.Errorf("subscriber %s ack error: %v", e.Topic(), err)
+		}
+	}
+}
+
+// Stop stops accepting events and waits for queued events to be processed
+func (d *dispatcher) Stop() {
+	d.once.Do(func() {
+		close(d.exit)
+	})
+	d.wg.Wait()
+}
+
+// poolSubscriber stops the dispatcher once the broker subscription is closed
+type poolSubscriber struct {
+	broker.Subscriber
+	d *dispatcher
+}
+
+func (p *poolSubscriber) Unsubscribe() error {
+	err := p.Subscriber.Unsubscribe()
+	p.d.Stop()
+	return err
+}
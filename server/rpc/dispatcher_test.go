@@ -0,0 +1,155 @@
+package rpc
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"xmicro/broker"
+	"xmicro/server"
+)
+
+type testEvent struct {
+	msg    *broker.Message
+	acked  int32
+	nacked int32
+}
+
+func (e *testEvent) Topic() string            { return "test" }
+func (e *testEvent) Message() *broker.Message { return e.msg }
+func (e *testEvent) Ack() error               { atomic.StoreInt32(&e.acked, 1); return nil }
+func (e *testEvent) Nack() error              { atomic.StoreInt32(&e.nacked, 1); return nil }
+func (e *testEvent) Error() error             { return nil }
+
+func TestDispatcherConcurrency(t *testing.T) {
+	var running, peak int32
+	release := make(chan bool)
+
+	h := func(e broker.Event) error {
+		n := atomic.AddInt32(&running, 1)
+		for {
+			p := atomic.LoadInt32(&peak)
+			if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+				break
+			}
+		}
+		<-release
+		atomic.AddInt32(&running, -1)
+		return nil
+	}
+
+	opts := server.NewSubscriberOptions(server.SubscriberConcurrency(4))
+	d := newDispatcher(h, opts, nil)
+
+	var events []*testEvent
+	for i := 0; i < 4; i++ {
+		e := &testEvent{msg: &broker.Message{Header: map[string]string{}}}
+		events = append(events, e)
+		if err := d.Handle(e); err != nil {
+			t.Fatalf("Unexpected handle error %v", err)
+		}
+	}
+
+	// wait for all workers to pick up an event
+	deadline := time.Now().Add(time.Second)
+	for atomic.LoadInt32(&running) < 4 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+
+	close(release)
+	d.Stop()
+
+	if p := atomic.LoadInt32(&peak); p != 4 {
+		t.Fatalf("Expected 4 concurrent handlers got %d", p)
+	}
+
+	for i, e := range events {
+		if atomic.LoadInt32(&e.acked) != 1 {
+			t.Fatalf("Expected event %d to be acked", i)
+		}
+	}
+
+	if err := d.Handle(&testEvent{msg: &broker.Message{}}); err != errDispatcherStopped {
+		t.Fatalf("Expected stopped error got %v", err)
+	}
+}
+
+func TestDispatcherOrdering(t *testing.T) {
+	var mtx sync.Mutex
+	seen := make(map[string][]int)
+
+	h := func(e broker.Event) error {
+		hdr := e.Message().Header
+		var n int
+		fmt.Sscanf(hdr["Seq"], "%d", &n)
+		mtx.Lock()
+		seen[hdr["Key"]] = append(seen[hdr["Key"]], n)
+		mtx.Unlock()
+		return nil
+	}
+
+	opts := server.NewSubscriberOptions(
+		server.SubscriberConcurrency(8),
+		server.SubscriberQueueSize(16),
+		server.SubscriberOrderingKey("Key"),
+	)
+	d := newDispatcher(h, opts, nil)
+
+	keys := []string{"a", "b", "c"}
+	count := 100
+
+	for i := 0; i < count; i++ {
+		for _, k := range keys {
+			e := &testEvent{msg: &broker.Message{Header: map[string]string{
+				"Key": k,
+				"Seq": fmt.Sprintf("%d", i),
+			}}}
+			if err := d.Handle(e); err != nil {
+				t.Fatalf("Unexpected handle error %v", err)
+			}
+		}
+	}
+
+	d.Stop()
+
+	for _, k := range keys {
+		if len(seen[k]) != count {
+			t.Fatalf("Expected %d events for key %s got %d", count, k, len(seen[k]))
+		}
+		for i, n := range seen[k] {
+			if n != i {
+				t.Fatalf("Key %s out of order at %d: got %d", k, i, n)
+			}
+		}
+	}
+}
+
+func TestDispatcherError(t *testing.T) {
+	h := func(e broker.Event) error {
+		if e.Message().Header["fail"] == "true" {
+			return fmt.Errorf("handler error")
+		}
+		return nil
+	}
+
+	opts := server.NewSubscriberOptions(server.SubscriberConcurrency(1))
+	d := newDispatcher(h, opts, nil)
+
+	failed := &testEvent{msg: &broker.Message{Header: map[string]string{"fail": "true"}}}
+	handled := &testEvent{msg: &broker.Message{Header: map[string]string{}}}
+	for _, e := range []*testEvent{failed, handled} {
+		if err := d.Handle(e); err != nil {
+			t.Fatalf("Unexpected handle error %v", err)
+		}
+	}
+	d.Stop()
+
+	if atomic.LoadInt32(&failed.acked) != 0 || atomic.LoadInt32(&failed.nacked) != 1 {
+		t.Fatal("Expected the failed event to be nacked")
+	}
+	if atomic.LoadInt32(&handled.acked) != 1 || atomic.LoadInt32(&handled.nacked) != 0 {
+		t.Fatal("Expected the handled event to be acked")
+	}
+}
@@ -23,6 +23,7 @@ import (
 	"xmicro/transport"
 	"xmicro/util/addr"
 	"xmicro/util/backoff"
+	"xmicro/util/cloudevents"
 	mnet "xmicro/util/net"
 	"xmicro/util/socket"
 )
@@ -74,8 +75,8 @@ func newServer(opts ...server.Option) server.Server {
 	}
 }
 
-// HandleEvent handles inbound messages to the service directly
-// TODO: handle requests from an event. We won't send a response.
+// HandleEvent handles inbound messages to the service directly.
+// Requests are served and the response published to the reply topic.
 func (s *rpcServer) HandleEvent(e broker.Event) error {
 	// formatting horrible cruft
 	msg := e.Message()
@@ -85,6 +86,23 @@ func (s *rpcServer) HandleEvent(e broker.Event) error {
 		msg.Header = make(map[string]string)
 	}
 
+	// unwrap cloudevents in either content mode
+	msg, err := cloudevents.Decode(msg)
+	if err != nil {
+		return err
+	}
+
+	// Micro-Service means a request
+	// Micro-Topic means a message
+	if len(msg.Header["Micro-Topic"]) == 0 && len(getHeader("Micro-Service", msg.Header)) > 0 {
+		return s.serveEvent(msg)
+	}
+
+	// events from foreign publishers only carry the broker topic
+	if len(msg.Header["Micro-Topic"]) == 0 {
+		msg.Header["Micro-Topic"] = e.Topic()
+	}
+
 	// get codec
 	ct := msg.Header["Content-Type"]
 
@@ -109,10 +127,6 @@ func (s *rpcServer) HandleEvent(e broker.Event) error {
 	// create context
 	ctx := metadata.NewContext(context.Background(), hdr)
 
-	// TODO: inspect message header
-	// Micro-Service means a request
-	// Micro-Topic means a message
-
 	rpcMsg := &rpcMessage{
 		topic:       msg.Header["Micro-Topic"],
 		contentType: ct,
@@ -142,6 +156,138 @@ func (s *rpcServer) HandleEvent(e broker.Event) error {
 	return r.ProcessMessage(ctx, rpcMsg)
 }
 
+// serveEvent serves a request received over the broker. The response
+// is published to the topic in the Micro-Reply-To header if one is set.
+func (s *rpcServer) serveEvent(msg *broker.Message) error {
+	// the correlation id ties the response to the waiting call
+	id := msg.Header["Micro-Correlation-Id"]
+	replyTo := msg.Header["Micro-Reply-To"]
+
+	tmsg := &transport.Message{
+		Header: msg.Header,
+		Body:   msg.Body,
+	}
+
+	// we use this Timeout header to set a server deadline
+	to := msg.Header["Timeout"]
+	// we use this Content-Type header to identify the codec needed
+	ct := msg.Header["Content-Type"]
+
+	// if there's no content type default it
+	if len(ct) == 0 {
+		msg.Header["Content-Type"] = DefaultContentType
+		ct = DefaultContentType
+	}
+
+	// setup old protocol
+	cf := setupProtocol(tmsg)
+
+	// no legacy codec needed
+	if cf == nil {
+		var err error
+		if cf, err = s.newCodec(ct); err != nil {
+			return err
+		}
+	}
+
+	// copy the message headers
+	hdr := make(map[string]string, len(msg.Header))
+	for k, v := range msg.Header {
+		hdr[k] = v
+	}
+
+	// create new context with the metadata
+	ctx := metadata.NewContext(context.Background(), hdr)
+
+	// set the timeout from the header if we have it
+	if len(to) > 0 {
+		if n, err := strconv.ParseUint(to, 10, 64); err == nil {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, time.Duration(n))
+			defer cancel()
+		}
+	}
+
+	// the pseudo socket collects the response written by the handler
+	psock := socket.New(id)
+	defer psock.Close()
+
+	// load the socket with the request
+	psock.Accept(tmsg)
+
+	rcodec := newRpcCodec(tmsg, psock, cf)
+
+	request := &rpcRequest{
+		service:     getHeader("Micro-Service", msg.Header),
+		method:      getHeader("Micro-Method", msg.Header),
+		endpoint:    getHeader("Micro-Endpoint", msg.Header),
+		contentType: ct,
+		codec:       rcodec,
+		header:      msg.Header,
+		body:        msg.Body,
+		socket:      psock,
+	}
+
+	response := &rpcResponse{
+		header: make(map[string]string),
+		socket: psock,
+		codec:  rcodec,
+	}
+
+	// set router
+	r := server.Router(s.router)
+
+	// if not nil use the router specified
+	if s.opts.Router != nil {
+		// create a wrapped function
+		handler := func(ctx context.Context, req server.Request, rsp interface{}) error {
+			return s.opts.Router.ServeRequest(ctx, req, rsp.(server.Response))
+		}
+
+		// execute the wrapper for it
+		for i := len(s.opts.HdlrWrappers); i > 0; i-- {
+			handler = s.opts.HdlrWrappers[i-1](handler)
+		}
+
+		// set the router
+		r = rpcRouter{h: handler}
+	}
+
+	// serve the actual request using the request router
+	if err := r.ServeRequest(ctx, request, response); err != nil {
+		// write an error response
+		if werr := rcodec.Write(&codec.Message{
+			Header: msg.Header,
+			Error:  err.Error(),
+			Type:   codec.Error,
+		}, nil); werr != nil {
+			logger.Debugf("rpc: unable to write error response: %v", werr)
+		}
+	}
+
+	// nobody is waiting for a response
+	if len(replyTo) == 0 {
+		return nil
+	}
+
+	// take the response written by the handler off the socket
+	psock.Close()
+	var rsp transport.Message
+	if err := psock.Process(&rsp); err != nil {
+		return err
+	}
+
+	if rsp.Header == nil {
+		rsp.Header = make(map[string]string)
+	}
+	rsp.Header["Micro-Correlation-Id"] = id
+
+	return s.Options().Broker.Publish(replyTo, &broker.Message{
+		Header: rsp.Header,
+		Body:   rsp.Body,
+	})
+}
+
 // ServeConn serves a single connection
 func (s *rpcServer) ServeConn(sock transport.Socket) {
 	// streams are multiplexed on Micro-Stream or Micro-Id header
@@ -681,10 +827,17 @@ func (s *rpcServer) Register() error {
 	// set what we're advertising
 	s.opts.Advertise = addr
 
-	// router can exchange messages
-	if s.opts.Router != nil {
+	// router can exchange messages and requests may arrive over the broker
+	if s.opts.Router != nil || s.opts.BrokerRequests {
+		var opts []broker.SubscribeOption
+
+		// share requests between the nodes of the service
+		if s.opts.BrokerRequests {
+			opts = append(opts, broker.Queue(config.Name))
+		}
+
 		// subscribe to the topic with own name
-		sub, err := s.opts.Broker.Subscribe(config.Name, s.HandleEvent)
+		sub, err := s.opts.Broker.Subscribe(config.Name, s.HandleEvent, opts...)
 		if err != nil {
 			return err
 		}
@@ -704,10 +857,26 @@ func (s *rpcServer) Register() error {
 			opts = append(opts, broker.SubscribeContext(cx))
 		}
 
-		sub, err := config.Broker.Subscribe(sb.Topic(), s.HandleEvent, opts...)
+		handler := s.HandleEvent
+
+		// hand events to a worker pool which acks them itself once processed
+		var d *dispatcher
+		if sb.Options().MaxConcurrency > 1 {
+			d = newDispatcher(s.HandleEvent, sb.Options(), s.wg)
+			handler = d.Handle
+			opts = append(opts, broker.DisableAutoAck(), broker.MaxInFlight(d.capacity))
+		}
+
+		sub, err := config.Broker.Subscribe(sb.Topic(), handler, opts...)
 		if err != nil {
+			if d != nil {
+				d.Stop()
+			}
 			return err
 		}
+		if d != nil {
+			sub = &poolSubscriber{Subscriber: sub, d: d}
+		}
 		if logger.V(core.InfoLevel, logger.DefaultLogger) {
 			logger.Infof("Subscribing to topic: %s", sub.Topic())
 		}
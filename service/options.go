@@ -10,6 +10,7 @@ import (
 	"xmicro/client"
 	rpcClient "xmicro/client/rpc"
 	"xmicro/registry"
+	"xmicro/router"
 	"xmicro/server"
 	rpcServer "xmicro/server/rpc"
 	"xmicro/transport"
@@ -151,6 +152,14 @@ func Version(v string) Option {
 	}
 }
 
+// Domain of the registry the app registers in and looks services up in
+func Domain(d string) Option {
+	return func(o *Options) {
+		o.Server.Init(server.Domain(d))
+		o.Client.Options().Router.Init(router.Domain(d))
+	}
+}
+
 // Metadata associated with the app
 func Metadata(md map[string]string) Option {
 	return func(o *Options) {
@@ -0,0 +1,280 @@
+// Package memory is an in-memory store implementation
+package memory
+
+import (
+	"context"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"xmicro/store"
+)
+
+var (
+	// DefaultDatabase is the namespace used when no database is set
+	DefaultDatabase = "micro"
+	// DefaultTable is used when no table is set
+	DefaultTable = "micro"
+)
+
+type record struct {
+	value     []byte
+	metadata  map[string]interface{}
+	expiresAt time.Time
+}
+
+type memoryStore struct {
+	sync.RWMutex
+	options store.Options
+	records map[string]*record
+	// last time expired records were dropped
+	swept time.Time
+}
+
+// NewStore returns a memory store
+func NewStore(opts ...store.Option) store.Store {
+	s := &memoryStore{
+		options: store.Options{
+			Database: DefaultDatabase,
+			Table:    DefaultTable,
+			Context:  context.Background(),
+		},
+		records: make(map[string]*record),
+	}
+	for _, o := range opts {
+		o(&s.options)
+	}
+	return s
+}
+
+func (m *memoryStore) prefix(database, table string) string {
+	if len(database) == 0 {
+		database = m.options.Database
+	}
+	if len(table) == 0 {
+		table = m.options.Table
+	}
+	return path.Join(database, table) + "/"
+}
+
+func (m *memoryStore) get(key string) (*store.Record, bool) {
+	r, ok := m.records[key]
+	if !ok {
+		return nil, false
+	}
+
+	var expiry time.Duration
+
+	if !r.expiresAt.IsZero() {
+		expiry = time.Until(r.expiresAt)
+		if expiry <= 0 {
+			return nil, false
+		}
+	}
+
+	rec := &store.Record{
+		Value:    make([]byte, len(r.value)),
+		Metadata: make(map[string]interface{}, len(r.metadata)),
+		Expiry:   expiry,
+	}
+	copy(rec.Value, r.value)
+	for k, v := range r.metadata {
+		rec.Metadata[k] = v
+	}
+
+	return rec, true
+}
+
+// keys returns the unexpired keys under the prefix in order
+func (m *memoryStore) keys(prefix string) []string {
+	now := time.Now()
+
+	var keys []string
+	for k, r := range m.records {
+		if !strings.HasPrefix(k, prefix) {
+			continue
+		}
+		if !r.expiresAt.IsZero() && now.After(r.expiresAt) {
+			continue
+		}
+		keys = append(keys, strings.TrimPrefix(k, prefix))
+	}
+
+	sort.Strings(keys)
+	return keys
+}
+
+func (m *memoryStore) Init(opts ...store.Option) error {
+	m.Lock()
+	defer m.Unlock()
+
+	for _, o := range opts {
+		o(&m.options)
+	}
+	return nil
+}
+
+func (m *memoryStore) Options() store.Options {
+	return m.options
+}
+
+func (m *memoryStore) Read(key string, opts ...store.ReadOption) ([]*store.Record, error) {
+	var options store.ReadOptions
+	for _, o := range opts {
+		o(&options)
+	}
+
+	m.RLock()
+	defer m.RUnlock()
+
+	prefix := m.prefix(options.Database, options.Table)
+
+	var keys []string
+
+	switch {
+	case options.Prefix:
+		for _, k := range m.keys(prefix) {
+			if strings.HasPrefix(k, key) {
+				keys = append(keys, k)
+			}
+		}
+	case options.Suffix:
+		for _, k := range m.keys(prefix) {
+			if strings.HasSuffix(k, key) {
+				keys = append(keys, k)
+			}
+		}
+	default:
+		keys = []string{key}
+	}
+
+	keys = paginate(keys, options.Limit, options.Offset)
+
+	var records []*store.Record
+	for _, k := range keys {
+		r, ok := m.get(prefix + k)
+		if !ok {
+			continue
+		}
+		r.Key = k
+		records = append(records, r)
+	}
+
+	if len(records) == 0 && !options.Prefix && !options.Suffix {
+		return nil, store.ErrNotFound
+	}
+
+	return records, nil
+}
+
+func (m *memoryStore) Write(r *store.Record, opts ...store.WriteOption) error {
+	return m.write(r, false, opts...)
+}
+
+// Create writes the record unless an unexpired record has its key
+func (m *memoryStore) Create(r *store.Record, opts ...store.WriteOption) error {
+	return m.write(r, true, opts...)
+}
+
+func (m *memoryStore) write(r *store.Record, create bool, opts ...store.WriteOption) error {
+	var options store.WriteOptions
+	for _, o := range opts {
+		o(&options)
+	}
+
+	rec := &record{
+		value:    make([]byte, len(r.Value)),
+		metadata: make(map[string]interface{}, len(r.Metadata)),
+	}
+	copy(rec.value, r.Value)
+	for k, v := range r.Metadata {
+		rec.metadata[k] = v
+	}
+	if r.Expiry > 0 {
+		rec.expiresAt = time.Now().Add(r.Expiry)
+	}
+
+	m.Lock()
+	defer m.Unlock()
+
+	key := m.prefix(options.Database, options.Table) + r.Key
+	if _, ok := m.get(key); ok && create {
+		return store.ErrExists
+	}
+	m.records[key] = rec
+	m.expire()
+
+	return nil
+}
+
+// expire drops expired records at most once a minute,
+// called with the lock held
+func (m *memoryStore) expire() {
+	now := time.Now()
+	if now.Sub(m.swept) < time.Minute {
+		return
+	}
+	m.swept = now
+
+	for k, r := range m.records {
+		if !r.expiresAt.IsZero() && now.After(r.expiresAt) {
+			delete(m.records, k)
+		}
+	}
+}
+
+func (m *memoryStore) Delete(key string, opts ...store.DeleteOption) error {
+	var options store.DeleteOptions
+	for _, o := range opts {
+		o(&options)
+	}
+
+	m.Lock()
+	delete(m.records, m.prefix(options.Database, options.Table)+key)
+	m.Unlock()
+
+	return nil
+}
+
+func (m *memoryStore) List(opts ...store.ListOption) ([]string, error) {
+	var options store.ListOptions
+	for _, o := range opts {
+		o(&options)
+	}
+
+	m.RLock()
+	defer m.RUnlock()
+
+	var keys []string
+	for _, k := range m.keys(m.prefix(options.Database, options.Table)) {
+		if !strings.HasPrefix(k, options.Prefix) || !strings.HasSuffix(k, options.Suffix) {
+			continue
+		}
+		keys = append(keys, k)
+	}
+
+	return paginate(keys, options.Limit, options.Offset), nil
+}
+
+func (m *memoryStore) Close() error {
+	return nil
+}
+
+func (m *memoryStore) String() string {
+	return "memory"
+}
+
+func paginate(keys []string, limit, offset uint) []string {
+	if offset > 0 {
+		if offset >= uint(len(keys)) {
+			return nil
+		}
+		keys = keys[offset:]
+	}
+	if limit > 0 && limit < uint(len(keys)) {
+		keys = keys[:limit]
+	}
+	return keys
+}
@@ -0,0 +1,264 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/go-redis/redis/v8"
+	"xmicro/store"
+)
+
+var (
+	// DefaultDatabase is the namespace used when no database is set
+	DefaultDatabase = "micro"
+	// DefaultTable is used when no table is set
+	DefaultTable = "micro"
+	// DefaultAddress of the redis server
+	DefaultAddress = "127.0.0.1:6379"
+)
+
+type redisStore struct {
+	options store.Options
+	client  *redis.Client
+}
+
+// value is the encoded form of a record in redis
+type value struct {
+	Value    []byte                 `json:"value"`
+	Metadata map[string]interface{} `json:"metadata,omitempty"`
+}
+
+// NewStore returns a store.Store backed by redis. The first node is used as
+// the server address and may be a redis:// url.
+func NewStore(opts ...store.Option) store.Store {
+	s := &redisStore{
+		options: store.Options{
+			Database: DefaultDatabase,
+			Table:    DefaultTable,
+			Context:  context.Background(),
+		},
+	}
+	for _, o := range opts {
+		o(&s.options)
+	}
+	s.configure()
+	return s
+}
+
+func (r *redisStore) configure() {
+	addr := DefaultAddress
+	if len(r.options.Nodes) > 0 && len(r.options.Nodes[0]) > 0 {
+		addr = r.options.Nodes[0]
+	}
+
+	opts, err := redis.ParseURL(addr)
+	if err != nil {
+		opts = &redis.Options{Addr: addr}
+	}
+
+	if r.client != nil {
+		r.client.Close()
+	}
+	r.client = NewClient(&Options{Options: opts})
+}
+
+func (r *redisStore) prefix(database, table string) string {
+	if len(database) == 0 {
+		database = r.options.Database
+	}
+	if len(table) == 0 {
+		table = r.options.Table
+	}
+	return path.Join(database, table) + "/"
+}
+
+// scan returns the keys under the prefix matching the pattern in order
+func (r *redisStore) scan(prefix, match string) ([]string, error) {
+	ctx := r.options.Context
+
+	var keys []string
+	var cursor uint64
+
+	for {
+		res, next, err := r.client.Scan(ctx, cursor, prefix+match, 100).Result()
+		if err != nil {
+			return nil, err
+		}
+		for _, k := range res {
+			keys = append(keys, strings.TrimPrefix(k, prefix))
+		}
+		if next == 0 {
+			break
+		}
+		cursor = next
+	}
+
+	sort.Strings(keys)
+	return keys, nil
+}
+
+func (r *redisStore) Init(opts ...store.Option) error {
+	for _, o := range opts {
+		o(&r.options)
+	}
+	r.configure()
+	return r.client.Ping(r.options.Context).Err()
+}
+
+func (r *redisStore) Options() store.Options {
+	return r.options
+}
+
+func (r *redisStore) Read(key string, opts ...store.ReadOption) ([]*store.Record, error) {
+	var options store.ReadOptions
+	for _, o := range opts {
+		o(&options)
+	}
+
+	prefix := r.prefix(options.Database, options.Table)
+
+	keys := []string{key}
+
+	var err error
+	switch {
+	case options.Prefix:
+		keys, err = r.scan(prefix, escape(key)+"*")
+	case options.Suffix:
+		keys, err = r.scan(prefix, "*"+escape(key))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	keys = paginate(keys, options.Limit, options.Offset)
+
+	var records []*store.Record
+	for _, k := range keys {
+		b, err := r.client.Get(r.options.Context, prefix+k).Bytes()
+		if err == redis.Nil {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		var v value
+		if err := json.Unmarshal(b, &v); err != nil {
+			return nil, err
+		}
+
+		rec := &store.Record{
+			Key:      k,
+			Value:    v.Value,
+			Metadata: v.Metadata,
+		}
+
+		if ttl, err := r.client.TTL(r.options.Context, prefix+k).Result(); err == nil && ttl > 0 {
+			rec.Expiry = ttl
+		}
+
+		records = append(records, rec)
+	}
+
+	if len(records) == 0 && !options.Prefix && !options.Suffix {
+		return nil, store.ErrNotFound
+	}
+
+	return records, nil
+}
+
+func (r *redisStore) Write(rec *store.Record, opts ...store.WriteOption) error {
+	key, b, err := r.encode(rec, opts...)
+	if err != nil {
+		return err
+	}
+
+	return r.client.Set(r.options.Context, key, b, rec.Expiry).Err()
+}
+
+// Create writes the record with SET NX
+func (r *redisStore) Create(rec *store.Record, opts ...store.WriteOption) error {
+	key, b, err := r.encode(rec, opts...)
+	if err != nil {
+		return err
+	}
+
+	ok, err := r.client.SetNX(r.options.Context, key, b, rec.Expiry).Result()
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return store.ErrExists
+	}
+	return nil
+}
+
+// encode returns the redis key and value of the record
+func (r *redisStore) encode(rec *store.Record, opts ...store.WriteOption) (string, []byte, error) {
+	var options store.WriteOptions
+	for _, o := range opts {
+		o(&options)
+	}
+
+	b, err := json.Marshal(&value{
+		Value:    rec.Value,
+		Metadata: rec.Metadata,
+	})
+	if err != nil {
+		return "", nil, err
+	}
+
+	return r.prefix(options.Database, options.Table) + rec.Key, b, nil
+}
+
+func (r *redisStore) Delete(key string, opts ...store.DeleteOption) error {
+	var options store.DeleteOptions
+	for _, o := range opts {
+		o(&options)
+	}
+
+	return r.client.Del(r.options.Context, r.prefix(options.Database, options.Table)+key).Err()
+}
+
+func (r *redisStore) List(opts ...store.ListOption) ([]string, error) {
+	var options store.ListOptions
+	for _, o := range opts {
+		o(&options)
+	}
+
+	keys, err := r.scan(r.prefix(options.Database, options.Table), escape(options.Prefix)+"*"+escape(options.Suffix))
+	if err != nil {
+		return nil, err
+	}
+
+	return paginate(keys, options.Limit, options.Offset), nil
+}
+
+func (r *redisStore) Close() error {
+	return r.client.Close()
+}
+
+func (r *redisStore) String() string {
+	return "redis"
+}
+
+// escape quotes the glob characters of a scan pattern
+func escape(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, "*", `\*`, "?", `\?`, "[", `\[`, "]", `\]`)
+	return r.Replace(s)
+}
+
+func paginate(keys []string, limit, offset uint) []string {
+	if offset > 0 {
+		if offset >= uint(len(keys)) {
+			return nil
+		}
+		keys = keys[offset:]
+	}
+	if limit > 0 && limit < uint(len(keys)) {
+		keys = keys[:limit]
+	}
+	return keys
+}
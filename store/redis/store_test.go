@@ -0,0 +1,270 @@
+package redis
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"xmicro/store"
+)
+
+// fakeRedis serves the commands of the store from memory
+type fakeRedis struct {
+	sync.Mutex
+	l       net.Listener
+	values  map[string]string
+	expires map[string]time.Time
+}
+
+func newFakeRedis(t *testing.T) *fakeRedis {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &fakeRedis{l: l, values: make(map[string]string), expires: make(map[string]time.Time)}
+	go f.serve()
+	return f
+}
+
+func (f *fakeRedis) serve() {
+	for {
+		conn, err := f.l.Accept()
+		if err != nil {
+			return
+		}
+		go f.handle(conn)
+	}
+}
+
+func (f *fakeRedis) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+		if _, err := io.WriteString(conn, f.do(args)); err != nil {
+			return
+		}
+	}
+}
+
+// readCommand reads an array of bulk strings
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+	if err != nil {
+		return nil, err
+	}
+	args := make([]string, n)
+	for i := range args {
+		if line, err = r.ReadString('\n'); err != nil {
+			return nil, err
+		}
+		size, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+		if err != nil {
+			return nil, err
+		}
+		b := make([]byte, size+2)
+		if _, err := io.ReadFull(r, b); err != nil {
+			return nil, err
+		}
+		args[i] = string(b[:size])
+	}
+	return args, nil
+}
+
+func bulk(s string) string {
+	return fmt.Sprintf("$%d\r\n%s\r\n", len(s), s)
+}
+
+// get returns the unexpired value of the key, called with the lock held
+func (f *fakeRedis) get(key string) (string, bool) {
+	if at, ok := f.expires[key]; ok && time.Now().After(at) {
+		delete(f.values, key)
+		delete(f.expires, key)
+	}
+	v, ok := f.values[key]
+	return v, ok
+}
+
+func (f *fakeRedis) do(args []string) string {
+	f.Lock()
+	defer f.Unlock()
+
+	switch strings.ToLower(args[0]) {
+	case "ping":
+		return "+PONG\r\n"
+	case "get":
+		v, ok := f.get(args[1])
+		if !ok {
+			return "$-1\r\n"
+		}
+		return bulk(v)
+	case "set", "setnx":
+		key, nx := args[1], strings.ToLower(args[0]) == "setnx"
+		var ttl time.Duration
+		for i := 3; i < len(args); i++ {
+			switch strings.ToLower(args[i]) {
+			case "nx":
+				nx = true
+			case "ex", "px":
+				n, _ := strconv.Atoi(args[i+1])
+				ttl = time.Duration(n) * time.Millisecond
+				if strings.ToLower(args[i]) == "ex" {
+					ttl = time.Duration(n) * time.Second
+				}
+				i++
+			}
+		}
+		if _, ok := f.get(key); ok && nx {
+			if args[0] == "setnx" {
+				return ":0\r\n"
+			}
+			return "$-1\r\n"
+		}
+		f.values[key] = args[2]
+		delete(f.expires, key)
+		if ttl > 0 {
+			f.expires[key] = time.Now().Add(ttl)
+		}
+		if args[0] == "setnx" {
+			return ":1\r\n"
+		}
+		return "+OK\r\n"
+	case "del":
+		n := 0
+		for _, key := range args[1:] {
+			if _, ok := f.get(key); ok {
+				delete(f.values, key)
+				delete(f.expires, key)
+				n++
+			}
+		}
+		return fmt.Sprintf(":%d\r\n", n)
+	case "ttl":
+		if _, ok := f.get(args[1]); !ok {
+			return ":-2\r\n"
+		}
+		at, ok := f.expires[args[1]]
+		if !ok {
+			return ":-1\r\n"
+		}
+		return fmt.Sprintf(":%d\r\n", int(time.Until(at).Seconds()+0.5))
+	case "scan":
+		var keys []string
+		for key := range f.values {
+			if _, ok := f.get(key); !ok {
+				continue
+			}
+			if ok, _ := path.Match(args[3], key); ok {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+		out := fmt.Sprintf("*2\r\n%s*%d\r\n", bulk("0"), len(keys))
+		for _, key := range keys {
+			out += bulk(key)
+		}
+		return out
+	}
+	return "-ERR unknown command '" + args[0] + "'\r\n"
+}
+
+func TestStore(t *testing.T) {
+	f := newFakeRedis(t)
+	defer f.l.Close()
+
+	s := NewStore(store.Nodes(f.l.Addr().String()))
+	if err := s.Init(); err != nil {
+		t.Fatalf("Unexpected init error %v", err)
+	}
+	defer s.Close()
+
+	if err := s.Write(&store.Record{Key: "a/1", Value: []byte("one"), Expiry: time.Minute}); err != nil {
+		t.Fatalf("Unexpected write error %v", err)
+	}
+	if err := s.Write(&store.Record{Key: "a/2", Value: []byte("two")}, store.WriteTo("", "other")); err != nil {
+		t.Fatalf("Unexpected write error %v", err)
+	}
+
+	recs, err := s.Read("a/1")
+	if err != nil {
+		t.Fatalf("Unexpected read error %v", err)
+	}
+	if len(recs) != 1 || string(recs[0].Value) != "one" || recs[0].Expiry != time.Minute {
+		t.Fatalf("Unexpected records %+v", recs[0])
+	}
+	if _, err := s.Read("a/2"); err != store.ErrNotFound {
+		t.Fatalf("Expected not found got %v", err)
+	}
+
+	keys, err := s.List(store.ListFrom("", "other"), store.ListPrefix("a/"))
+	if err != nil || len(keys) != 1 || keys[0] != "a/2" {
+		t.Fatalf("Unexpected keys %v %v", keys, err)
+	}
+
+	if err := s.Delete("a/1"); err != nil {
+		t.Fatalf("Unexpected delete error %v", err)
+	}
+	if _, err := s.Read("a/1"); err != store.ErrNotFound {
+		t.Fatalf("Expected not found got %v", err)
+	}
+}
+
+func TestStoreCreate(t *testing.T) {
+	f := newFakeRedis(t)
+	defer f.l.Close()
+
+	s := NewStore(store.Nodes(f.l.Addr().String()))
+	defer s.Close()
+	c := s.(store.Creator)
+
+	// only one of the concurrent creates wins
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs <- c.Create(&store.Record{Key: "claim", Value: []byte(strconv.Itoa(i)), Expiry: 50 * time.Millisecond})
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+
+	var created int
+	for err := range errs {
+		switch err {
+		case nil:
+			created++
+		case store.ErrExists:
+		default:
+			t.Fatalf("Unexpected create error %v", err)
+		}
+	}
+	if created != 1 {
+		t.Fatalf("Expected 1 create got %d", created)
+	}
+
+	// the key can be created again once it expired
+	time.Sleep(100 * time.Millisecond)
+	if err := c.Create(&store.Record{Key: "claim", Value: []byte("again")}); err != nil {
+		t.Fatalf("Unexpected create error %v", err)
+	}
+	if err := c.Create(&store.Record{Key: "claim", Value: []byte("again")}); err != store.ErrExists {
+		t.Fatalf("Expected exists error got %v", err)
+	}
+}
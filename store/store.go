@@ -10,6 +10,8 @@ import (
 var (
 	// ErrNotFound is returned when a key doesn't exist
 	ErrNotFound = errors.New("not found")
+	// ErrExists is returned by Create when the key already exists
+	ErrExists = errors.New("already exists")
 )
 
 // Store is a data storage interface
@@ -32,6 +34,13 @@ type Store interface {
 	String() string
 }
 
+// Creator is implemented by the stores which write a record only if its key
+// doesn't exist, the check and the write are atomic
+type Creator interface {
+	// Create writes the record, or returns ErrExists if the key exists.
+	Create(r *Record, opts ...WriteOption) error
+}
+
 // Record is an item stored or retrieved from a Store
 type Record struct {
 	// The key to store the record
@@ -14,9 +14,15 @@ import (
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
 
+	"xmicro/common/component"
+	"xmicro/common/constant"
 	pb "xmicro/transport/grpc/proto"
 )
 
+func init() {
+	component.SetTransportFactory(constant.GrpcKey, NewTransport)
+}
+
 type grpcTransport struct {
 	opts transport.Options
 }
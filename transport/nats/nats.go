@@ -0,0 +1,514 @@
+// Package nats provides a NATS transport. Listeners receive on a subject
+// and every client socket is identified by its reply inbox.
+package nats
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nats-io/nats.go"
+)
+
+import (
+	"xmicro/codec"
+	"xmicro/codec/json"
+	"xmicro/common/component"
+	"xmicro/common/constant"
+	"xmicro/logger"
+	"xmicro/transport"
+)
+
+func init() {
+	component.SetTransportFactory(constant.NatsKey, NewTransport)
+}
+
+var (
+	// DefaultSubjectPrefix of the subjects generated for listeners
+	DefaultSubjectPrefix = "micro.transport."
+
+	// buffered messages per socket
+	socketBuffer = 64
+)
+
+type ntport struct {
+	sync.Mutex
+	addrs []string
+	conn  *nats.Conn
+	opts  transport.Options
+	nopts nats.Options
+}
+
+type ntportClient struct {
+	conn *nats.Conn
+	// subject of the listener
+	addr string
+	// reply inbox of the client
+	id   string
+	sub  *nats.Subscription
+	opts transport.Options
+
+	recv chan *nats.Msg
+	once sync.Once
+	exit chan bool
+}
+
+type ntportSocket struct {
+	conn   *nats.Conn
+	local  string
+	remote string
+	opts   transport.Options
+	l      *ntportListener
+
+	// messages queued by the listener, moved to recv by pump so that
+	// a slow socket doesn't hold up the subscription of the listener
+	mu      sync.Mutex
+	pending []*nats.Msg
+	queued  chan bool
+
+	recv chan *nats.Msg
+	once sync.Once
+	exit chan bool
+}
+
+type ntportListener struct {
+	sync.RWMutex
+	conn *nats.Conn
+	addr string
+	sub  *nats.Subscription
+	opts transport.Options
+
+	fn    func(transport.Socket)
+	ready chan bool
+	once  sync.Once
+	exit  chan bool
+	so    map[string]*ntportSocket
+}
+
+// recv waits for the next message of a socket
+func recv(ch chan *nats.Msg, exit chan bool, timeout time.Duration, c codec.Marshaler, m *transport.Message) error {
+	if m == nil {
+		return errors.New("message passed in is nil")
+	}
+
+	var after <-chan time.Time
+	if timeout > 0 {
+		t := time.NewTimer(timeout)
+		defer t.Stop()
+		after = t.C
+	}
+
+	select {
+	case <-exit:
+		return io.EOF
+	case <-after:
+		return errors.New("recv timeout")
+	case msg := <-ch:
+		// an empty message closes the socket
+		if len(msg.Data) == 0 {
+			return io.EOF
+		}
+		return c.Unmarshal(msg.Data, m)
+	}
+}
+
+func (n *ntportClient) Local() string {
+	return n.id
+}
+
+func (n *ntportClient) Remote() string {
+	return n.addr
+}
+
+func (n *ntportClient) Send(m *transport.Message) error {
+	b, err := n.opts.Codec.Marshal(m)
+	if err != nil {
+		return err
+	}
+
+	select {
+	case <-n.exit:
+		return io.EOF
+	default:
+	}
+
+	return n.conn.PublishRequest(n.addr, n.id, b)
+}
+
+func (n *ntportClient) Recv(m *transport.Message) error {
+	return recv(n.recv, n.exit, n.opts.Timeout, n.opts.Codec, m)
+}
+
+func (n *ntportClient) Close() error {
+	n.once.Do(func() {
+		close(n.exit)
+		n.sub.Unsubscribe()
+		// tell the listener the socket is gone
+		n.conn.PublishRequest(n.addr, n.id, nil)
+	})
+	return nil
+}
+
+func (n *ntportClient) handle(msg *nats.Msg) {
+	select {
+	case n.recv <- msg:
+	case <-n.exit:
+	}
+}
+
+func (n *ntportSocket) Local() string {
+	return n.local
+}
+
+func (n *ntportSocket) Remote() string {
+	return n.remote
+}
+
+func (n *ntportSocket) Send(m *transport.Message) error {
+	b, err := n.opts.Codec.Marshal(m)
+	if err != nil {
+		return err
+	}
+
+	select {
+	case <-n.exit:
+		return io.EOF
+	default:
+	}
+
+	return n.conn.Publish(n.remote, b)
+}
+
+func (n *ntportSocket) Recv(m *transport.Message) error {
+	return recv(n.recv, n.exit, n.opts.Timeout, n.opts.Codec, m)
+}
+
+func (n *ntportSocket) Close() error {
+	n.close(true)
+	return nil
+}
+
+// push queues the message of the socket without blocking
+func (n *ntportSocket) push(msg *nats.Msg) {
+	n.mu.Lock()
+	n.pending = append(n.pending, msg)
+	n.mu.Unlock()
+
+	select {
+	case n.queued <- true:
+	default:
+	}
+}
+
+// pump moves the queued messages to the receive channel in order
+func (n *ntportSocket) pump() {
+	for {
+		n.mu.Lock()
+		if len(n.pending) == 0 {
+			n.mu.Unlock()
+			select {
+			case <-n.queued:
+				continue
+			case <-n.exit:
+				return
+			}
+		}
+		msg := n.pending[0]
+		n.pending[0] = nil
+		n.pending = n.pending[1:]
+		n.mu.Unlock()
+
+		select {
+		case n.recv <- msg:
+		case <-n.exit:
+			return
+		}
+	}
+}
+
+// close closes the socket and notifies the client unless it went away
+func (n *ntportSocket) close(notify bool) {
+	n.once.Do(func() {
+		close(n.exit)
+
+		n.l.Lock()
+		delete(n.l.so, n.remote)
+		n.l.Unlock()
+
+		if notify {
+			n.conn.Publish(n.remote, nil)
+		}
+	})
+}
+
+func (n *ntportListener) Addr() string {
+	return n.addr
+}
+
+func (n *ntportListener) Close() error {
+	n.once.Do(func() {
+		close(n.exit)
+		n.sub.Unsubscribe()
+
+		n.RLock()
+		var socks []*ntportSocket
+		for _, sock := range n.so {
+			socks = append(socks, sock)
+		}
+		n.RUnlock()
+
+		for _, sock := range socks {
+			sock.close(true)
+		}
+	})
+	return nil
+}
+
+func (n *ntportListener) Accept(fn func(transport.Socket)) error {
+	n.Lock()
+	if n.fn != nil {
+		n.Unlock()
+		return errors.New("listener already accepting")
+	}
+	n.fn = fn
+	close(n.ready)
+	n.Unlock()
+
+	<-n.exit
+	return nil
+}
+
+// handle routes a message to the socket of its reply inbox,
+// creating the socket for the first message of a client
+func (n *ntportListener) handle(msg *nats.Msg) {
+	if len(msg.Reply) == 0 {
+		return
+	}
+
+	// wait until messages are accepted
+	select {
+	case <-n.ready:
+	case <-n.exit:
+		return
+	}
+
+	n.Lock()
+	sock, ok := n.so[msg.Reply]
+	if !ok {
+		// the client closed before anything was sent
+		if len(msg.Data) == 0 {
+			n.Unlock()
+			return
+		}
+
+		sock = &ntportSocket{
+			conn:   n.conn,
+			local:  n.addr,
+			remote: msg.Reply,
+			opts:   n.opts,
+			l:      n,
+			queued: make(chan bool, 1),
+			recv:   make(chan *nats.Msg, socketBuffer),
+			exit:   make(chan bool),
+		}
+		n.so[msg.Reply] = sock
+		go sock.pump()
+
+		go func() {
+			// TODO: think of a better error response strategy
+			defer func() {
+				if r := recover(); r != nil {
+					logger.Errorf("[nats]: socket panic: %v", r)
+					sock.Close()
+				}
+			}()
+
+			n.fn(sock)
+		}()
+	}
+	n.Unlock()
+
+	if len(msg.Data) == 0 {
+		sock.close(false)
+		return
+	}
+
+	sock.push(msg)
+}
+
+func (n *ntport) connect() (*nats.Conn, error) {
+	n.Lock()
+	defer n.Unlock()
+
+	if n.conn != nil && !n.conn.IsClosed() {
+		return n.conn, nil
+	}
+
+	opts := n.nopts
+	opts.Servers = n.addrs
+	opts.Secure = n.opts.Secure
+	opts.TLSConfig = n.opts.TLSConfig
+
+	// secure might not be set
+	if n.opts.TLSConfig != nil {
+		opts.Secure = true
+	}
+
+	c, err := opts.Connect()
+	if err != nil {
+		return nil, err
+	}
+
+	n.conn = c
+	return c, nil
+}
+
+func (n *ntport) Dial(addr string, dialOpts ...transport.DialOption) (transport.Client, error) {
+	dopts := transport.DialOptions{
+		Timeout: transport.DefaultDialTimeout,
+	}
+
+	for _, o := range dialOpts {
+		o(&dopts)
+	}
+
+	c, err := n.connect()
+	if err != nil {
+		return nil, err
+	}
+
+	client := &ntportClient{
+		conn: c,
+		addr: addr,
+		id:   nats.NewInbox(),
+		opts: n.opts,
+		recv: make(chan *nats.Msg, socketBuffer),
+		exit: make(chan bool),
+	}
+
+	sub, err := c.Subscribe(client.id, client.handle)
+	if err != nil {
+		return nil, err
+	}
+	client.sub = sub
+
+	// make sure the subscription is known to the server
+	// before the listener replies to the inbox
+	if err := c.FlushTimeout(dopts.Timeout); err != nil {
+		sub.Unsubscribe()
+		return nil, err
+	}
+
+	return client, nil
+}
+
+// Listen receives on the subject addr. A subject is generated
+// when addr is empty or a host:port address.
+func (n *ntport) Listen(addr string, listenOpts ...transport.ListenOption) (transport.Listener, error) {
+	var options transport.ListenOptions
+	for _, o := range listenOpts {
+		o(&options)
+	}
+
+	if len(addr) == 0 || strings.Contains(addr, ":") {
+		addr = DefaultSubjectPrefix + uuid.New().String()
+	}
+
+	c, err := n.connect()
+	if err != nil {
+		return nil, err
+	}
+
+	l := &ntportListener{
+		conn:  c,
+		addr:  addr,
+		opts:  n.opts,
+		ready: make(chan bool),
+		exit:  make(chan bool),
+		so:    make(map[string]*ntportSocket),
+	}
+
+	sub, err := c.Subscribe(addr, l.handle)
+	if err != nil {
+		return nil, err
+	}
+	l.sub = sub
+
+	if err := c.Flush(); err != nil {
+		sub.Unsubscribe()
+		return nil, err
+	}
+
+	return l, nil
+}
+
+func (n *ntport) Init(opts ...transport.Option) error {
+	n.Lock()
+	defer n.Unlock()
+
+	for _, o := range opts {
+		o(&n.opts)
+	}
+	n.configure()
+	return nil
+}
+
+func (n *ntport) configure() {
+	if nopts, ok := n.opts.Context.Value(optionsKey{}).(nats.Options); ok {
+		n.nopts = nopts
+	}
+
+	// transport.Addrs take precedence over nats.Options.Servers
+	addrs := n.opts.Addrs
+	if len(addrs) == 0 {
+		addrs = n.nopts.Servers
+	}
+
+	var cAddrs []string
+	for _, addr := range addrs {
+		if len(addr) == 0 {
+			continue
+		}
+		if !strings.HasPrefix(addr, "nats://") && !strings.HasPrefix(addr, "tls://") {
+			addr = "nats://" + addr
+		}
+		cAddrs = append(cAddrs, addr)
+	}
+	if len(cAddrs) == 0 {
+		cAddrs = []string{nats.DefaultURL}
+	}
+	n.addrs = cAddrs
+}
+
+func (n *ntport) Options() transport.Options {
+	return n.opts
+}
+
+func (n *ntport) String() string {
+	return "nats"
+}
+
+// NewTransport returns a NATS transport connecting to transport.Addrs
+func NewTransport(opts ...transport.Option) transport.Transport {
+	options := transport.Options{
+		// Default codec
+		Codec:   json.Marshaler{},
+		Context: context.Background(),
+	}
+
+	n := &ntport{
+		opts:  options,
+		nopts: nats.GetDefaultOptions(),
+	}
+
+	for _, o := range opts {
+		o(&n.opts)
+	}
+	n.configure()
+
+	return n
+}
@@ -0,0 +1,149 @@
+package nats
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+
+	"xmicro/transport"
+)
+
+func runServer(t *testing.T) *server.Server {
+	s, err := server.NewServer(&server.Options{
+		Host:   "127.0.0.1",
+		Port:   -1,
+		NoLog:  true,
+		NoSigs: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Start()
+	if !s.ReadyForConnections(5 * time.Second) {
+		t.Fatal("nats server not ready")
+	}
+	t.Cleanup(s.Shutdown)
+	return s
+}
+
+func TestTransport(t *testing.T) {
+	s := runServer(t)
+	tr := NewTransport(transport.Addrs(s.ClientURL()), transport.Timeout(5*time.Second))
+
+	l, err := tr.Listen(":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	closed := make(chan bool)
+
+	go l.Accept(func(sock transport.Socket) {
+		defer close(closed)
+		for {
+			var m transport.Message
+			if err := sock.Recv(&m); err != nil {
+				if err != io.EOF {
+					t.Error(err)
+				}
+				return
+			}
+			if err := sock.Send(&m); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	})
+
+	c, err := tr.Dial(l.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, body := range []string{"one", "two", "three"} {
+		m := transport.Message{
+			Header: map[string]string{"Content-Type": "application/json"},
+			Body:   []byte(body),
+		}
+		if err := c.Send(&m); err != nil {
+			t.Fatal(err)
+		}
+
+		var rsp transport.Message
+		if err := c.Recv(&rsp); err != nil {
+			t.Fatal(err)
+		}
+		if string(rsp.Body) != body || rsp.Header["Content-Type"] != "application/json" {
+			t.Fatalf("Unexpected response %+v", rsp)
+		}
+	}
+
+	c.Close()
+
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("server socket was not closed")
+	}
+}
+
+func TestSlowSocket(t *testing.T) {
+	s := runServer(t)
+	tr := NewTransport(transport.Addrs(s.ClientURL()), transport.Timeout(5*time.Second))
+
+	l, err := tr.Listen(":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	// the socket of the slow client stops reading after its first message
+	done := make(chan bool)
+	defer close(done)
+
+	go l.Accept(func(sock transport.Socket) {
+		for {
+			var m transport.Message
+			if err := sock.Recv(&m); err != nil {
+				return
+			}
+			if string(m.Body) == "slow" {
+				<-done
+				return
+			}
+			if err := sock.Send(&m); err != nil {
+				return
+			}
+		}
+	})
+
+	slow, err := tr.Dial(l.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer slow.Close()
+	for i := 0; i < 4*socketBuffer; i++ {
+		if err := slow.Send(&transport.Message{Body: []byte("slow")}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the other sockets of the listener are still served
+	fast, err := tr.Dial(l.Addr(), transport.WithTimeout(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fast.Close()
+	if err := fast.Send(&transport.Message{Body: []byte("fast")}); err != nil {
+		t.Fatal(err)
+	}
+	var rsp transport.Message
+	if err := fast.Recv(&rsp); err != nil {
+		t.Fatalf("Expected the fast socket served got %v", err)
+	}
+	if string(rsp.Body) != "fast" {
+		t.Fatalf("Unexpected response %+v", rsp)
+	}
+}
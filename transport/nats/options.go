@@ -0,0 +1,22 @@
+package nats
+
+import (
+	"context"
+
+	"github.com/nats-io/nats.go"
+
+	"xmicro/transport"
+)
+
+type optionsKey struct{}
+
+// Options allows to inject a nats.Options struct for configuring
+// the nats connection
+func Options(nopts nats.Options) transport.Option {
+	return func(o *transport.Options) {
+		if o.Context == nil {
+			o.Context = context.Background()
+		}
+		o.Context = context.WithValue(o.Context, optionsKey{}, nopts)
+	}
+}
@@ -5,6 +5,8 @@ import (
 	"crypto/tls"
 	"encoding/gob"
 	"errors"
+	"xmicro/common/component"
+	"xmicro/common/constant"
 	"xmicro/logger"
 	"xmicro/transport"
 	maddr "xmicro/util/addr"
@@ -14,6 +16,10 @@ import (
 	"time"
 )
 
+func init() {
+	component.SetTransportFactory(constant.TcpKey, NewTransport)
+}
+
 type tcpTransport struct {
 	opts transport.Options
 }
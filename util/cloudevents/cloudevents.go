@@ -0,0 +1,227 @@
+// Package cloudevents maps broker messages to and from the CloudEvents 1.0 format
+package cloudevents
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"mime"
+	"strings"
+	"time"
+
+	"xmicro/broker"
+)
+
+// Mode is the CloudEvents content mode used for a message
+type Mode int
+
+const (
+	// Binary keeps the payload as the message body and
+	// carries the event attributes in ce- prefixed headers
+	Binary Mode = iota + 1
+	// Structured encodes the attributes and the payload
+	// together as a JSON document in the message body
+	Structured
+)
+
+const (
+	// SpecVersion is the supported CloudEvents version
+	SpecVersion = "1.0"
+	// ContentType of a structured mode event
+	ContentType = "application/cloudevents+json"
+	// HeaderPrefix of the binary mode attribute headers
+	HeaderPrefix = "ce-"
+)
+
+var (
+	ErrInvalidEvent = errors.New("cloudevents: invalid event")
+)
+
+// Event is the structured mode representation of a CloudEvent
+type Event struct {
+	SpecVersion     string          `json:"specversion"`
+	Id              string          `json:"id"`
+	Source          string          `json:"source"`
+	Type            string          `json:"type"`
+	Time            string          `json:"time,omitempty"`
+	DataContentType string          `json:"datacontenttype,omitempty"`
+	TraceParent     string          `json:"traceparent,omitempty"`
+	Data            json.RawMessage `json:"data,omitempty"`
+	DataBase64      string          `json:"data_base64,omitempty"`
+}
+
+// Encode wraps the message published on the topic in a CloudEvents
+// envelope. The id, content type and trace parent are taken from
+// the Micro-Id, Content-Type and Traceparent headers.
+func Encode(msg *broker.Message, mode Mode, source, topic string) (*broker.Message, error) {
+	hdr := make(map[string]string, len(msg.Header)+6)
+	for k, v := range msg.Header {
+		hdr[k] = v
+	}
+
+	ev := Event{
+		SpecVersion:     SpecVersion,
+		Id:              hdr["Micro-Id"],
+		Source:          source,
+		Type:            topic,
+		Time:            time.Now().UTC().Format(time.RFC3339Nano),
+		DataContentType: hdr["Content-Type"],
+		TraceParent:     hdr["Traceparent"],
+	}
+
+	if len(ev.Id) == 0 || len(ev.Source) == 0 || len(ev.Type) == 0 {
+		return nil, ErrInvalidEvent
+	}
+
+	switch mode {
+	case Binary:
+		hdr[HeaderPrefix+"specversion"] = ev.SpecVersion
+		hdr[HeaderPrefix+"id"] = ev.Id
+		hdr[HeaderPrefix+"source"] = ev.Source
+		hdr[HeaderPrefix+"type"] = ev.Type
+		hdr[HeaderPrefix+"time"] = ev.Time
+		if len(ev.TraceParent) > 0 {
+			hdr[HeaderPrefix+"traceparent"] = ev.TraceParent
+		}
+
+		return &broker.Message{
+			Header: hdr,
+			Body:   msg.Body,
+		}, nil
+	case Structured:
+		if isJSON(ev.DataContentType) && json.Valid(msg.Body) {
+			ev.Data = msg.Body
+		} else if len(msg.Body) > 0 {
+			ev.DataBase64 = base64.StdEncoding.EncodeToString(msg.Body)
+		}
+
+		b, err := json.Marshal(&ev)
+		if err != nil {
+			return nil, err
+		}
+
+		hdr["Content-Type"] = ContentType
+
+		return &broker.Message{
+			Header: hdr,
+			Body:   b,
+		}, nil
+	}
+
+	return nil, errors.New("cloudevents: unknown mode")
+}
+
+// Decode unwraps a message in either content mode. The payload becomes the
+// message body and the attributes are mapped back to the Micro headers.
+// Messages which are not CloudEvents are returned unchanged.
+func Decode(msg *broker.Message) (*broker.Message, error) {
+	if msg == nil {
+		return msg, nil
+	}
+
+	ct := header(msg.Header, "Content-Type")
+
+	if mt, _, err := mime.ParseMediaType(ct); err == nil && mt == ContentType {
+		return decodeStructured(msg)
+	}
+
+	if len(header(msg.Header, HeaderPrefix+"specversion")) > 0 {
+		return decodeBinary(msg), nil
+	}
+
+	return msg, nil
+}
+
+func decodeBinary(msg *broker.Message) *broker.Message {
+	hdr := make(map[string]string, len(msg.Header))
+	for k, v := range msg.Header {
+		hdr[k] = v
+	}
+
+	setDefault(hdr, "Micro-Id", header(msg.Header, HeaderPrefix+"id"))
+	setDefault(hdr, "Traceparent", header(msg.Header, HeaderPrefix+"traceparent"))
+
+	return &broker.Message{
+		Header: hdr,
+		Body:   msg.Body,
+	}
+}
+
+func decodeStructured(msg *broker.Message) (*broker.Message, error) {
+	var ev Event
+	if err := json.Unmarshal(msg.Body, &ev); err != nil {
+		return nil, err
+	}
+
+	if len(ev.SpecVersion) == 0 || len(ev.Id) == 0 {
+		return nil, ErrInvalidEvent
+	}
+
+	hdr := make(map[string]string, len(msg.Header))
+	for k, v := range msg.Header {
+		hdr[k] = v
+	}
+
+	// json is the default data content type
+	ct := ev.DataContentType
+	if len(ct) == 0 {
+		ct = "application/json"
+	}
+	hdr["Content-Type"] = ct
+
+	setDefault(hdr, "Micro-Id", ev.Id)
+	setDefault(hdr, "Traceparent", ev.TraceParent)
+
+	var body []byte
+
+	switch {
+	case len(ev.DataBase64) > 0:
+		b, err := base64.StdEncoding.DecodeString(ev.DataBase64)
+		if err != nil {
+			return nil, err
+		}
+		body = b
+	case len(ev.Data) > 0 && !isJSON(ct):
+		// non json data may be carried as a json string
+		var s string
+		if err := json.Unmarshal(ev.Data, &s); err != nil {
+			return nil, err
+		}
+		body = []byte(s)
+	default:
+		body = ev.Data
+	}
+
+	return &broker.Message{
+		Header: hdr,
+		Body:   body,
+	}, nil
+}
+
+func isJSON(ct string) bool {
+	mt, _, err := mime.ParseMediaType(ct)
+	if err != nil {
+		return false
+	}
+	return mt == "application/json" || mt == "text/json" || strings.HasSuffix(mt, "+json")
+}
+
+// header looks up a header ignoring the case of the key
+func header(hdr map[string]string, key string) string {
+	if v, ok := hdr[key]; ok {
+		return v
+	}
+	for k, v := range hdr {
+		if strings.EqualFold(k, key) {
+			return v
+		}
+	}
+	return ""
+}
+
+func setDefault(hdr map[string]string, key, val string) {
+	if len(val) == 0 || len(hdr[key]) > 0 {
+		return
+	}
+	hdr[key] = val
+}
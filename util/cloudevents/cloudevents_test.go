@@ -0,0 +1,91 @@
+package cloudevents
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"xmicro/broker"
+)
+
+func newMessage(ct string, body []byte) *broker.Message {
+	return &broker.Message{
+		Header: map[string]string{
+			"Content-Type": ct,
+			"Micro-Id":     "1234",
+			"Micro-Topic":  "orders",
+			"Traceparent":  "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		},
+		Body: body,
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	testData := []struct {
+		mode Mode
+		ct   string
+		body []byte
+	}{
+		{Binary, "application/json", []byte(`{"id":1}`)},
+		{Structured, "application/json", []byte(`{"id":1}`)},
+		{Structured, "application/protobuf", []byte{0x08, 0x01}},
+	}
+
+	for _, d := range testData {
+		msg, err := Encode(newMessage(d.ct, d.body), d.mode, "billing", "orders")
+		if err != nil {
+			t.Fatalf("Unexpected encode error %v", err)
+		}
+
+		if d.mode == Structured {
+			if ct := msg.Header["Content-Type"]; ct != ContentType {
+				t.Fatalf("Expected content type %s got %s", ContentType, ct)
+			}
+			var ev Event
+			if err := json.Unmarshal(msg.Body, &ev); err != nil {
+				t.Fatalf("Unexpected envelope %s: %v", msg.Body, err)
+			}
+			if ev.Source != "billing" || ev.Type != "orders" || ev.Id != "1234" {
+				t.Fatalf("Unexpected attributes %+v", ev)
+			}
+		} else if msg.Header["ce-source"] != "billing" || msg.Header["ce-type"] != "orders" {
+			t.Fatalf("Unexpected binary headers %v", msg.Header)
+		}
+
+		out, err := Decode(msg)
+		if err != nil {
+			t.Fatalf("Unexpected decode error %v", err)
+		}
+		if !bytes.Equal(out.Body, d.body) {
+			t.Fatalf("Expected body %v got %v", d.body, out.Body)
+		}
+		if ct := out.Header["Content-Type"]; ct != d.ct {
+			t.Fatalf("Expected content type %s got %s", d.ct, ct)
+		}
+	}
+}
+
+func TestDecodeForeign(t *testing.T) {
+	msg := &broker.Message{
+		Header: map[string]string{
+			"Content-Type": "application/cloudevents+json; charset=utf-8",
+		},
+		Body: []byte(`{"specversion":"1.0","id":"abc","source":"/orders","type":"com.example.created","datacontenttype":"text/plain","data":"hello"}`),
+	}
+
+	out, err := Decode(msg)
+	if err != nil {
+		t.Fatalf("Unexpected decode error %v", err)
+	}
+	if string(out.Body) != "hello" {
+		t.Fatalf("Expected hello got %s", out.Body)
+	}
+	if out.Header["Micro-Id"] != "abc" {
+		t.Fatalf("Expected id abc got %s", out.Header["Micro-Id"])
+	}
+
+	plain := &broker.Message{Header: map[string]string{"Content-Type": "application/json"}, Body: []byte(`{}`)}
+	if out, _ := Decode(plain); out != plain {
+		t.Fatal("Expected plain message to be returned unchanged")
+	}
+}
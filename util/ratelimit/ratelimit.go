@@ -0,0 +1,114 @@
+// Package ratelimit limits the requests of the client and the server with
+// token buckets whose rate can be changed while the service runs
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"sync/atomic"
+
+	"golang.org/x/time/rate"
+
+	"xmicro/client"
+	"xmicro/common/component"
+	"xmicro/common/constant"
+	"xmicro/errors"
+	"xmicro/server"
+)
+
+var (
+	// DefaultServerLimiter limits the handlers of the rateLimit server wrapper
+	DefaultServerLimiter = NewLimiter(0, 0)
+	// DefaultClientLimiter limits the calls of the rateLimit client wrapper
+	DefaultClientLimiter = NewLimiter(0, 0)
+)
+
+func init() {
+	component.SetServerWrapper(constant.WrapperRateLimitKey, NewHandlerWrapper(DefaultServerLimiter))
+	component.SetClientWrapper(constant.WrapperRateLimitKey, NewClientWrapper(DefaultClientLimiter))
+}
+
+// Limiter allows the requests up to a rate per second with bursts
+type Limiter struct {
+	// the *rate.Limiter of the latest limit
+	l atomic.Value
+}
+
+// NewLimiter returns a limiter of the rate and the burst, see SetLimit
+func NewLimiter(r float64, burst int) *Limiter {
+	l := &Limiter{}
+	l.SetLimit(r, burst)
+	return l
+}
+
+// SetLimit changes the rate per second and the burst, the bucket starts
+// full. A rate which is not positive is unlimited, the burst defaults to
+// the rate rounded up.
+func (l *Limiter) SetLimit(r float64, burst int) {
+	if r <= 0 {
+		l.l.Store(rate.NewLimiter(rate.Inf, 0))
+		return
+	}
+	if burst <= 0 {
+		burst = int(math.Ceil(r))
+	}
+	l.l.Store(rate.NewLimiter(rate.Limit(r), burst))
+}
+
+// Limit returns the rate per second, 0 if unlimited, and the burst
+func (l *Limiter) Limit() (float64, int) {
+	limiter := l.limiter()
+	if limiter.Limit() == rate.Inf {
+		return 0, 0
+	}
+	return float64(limiter.Limit()), limiter.Burst()
+}
+
+// Allow reports whether a request may happen now
+func (l *Limiter) Allow() bool {
+	return l.limiter().Allow()
+}
+
+func (l *Limiter) limiter() *rate.Limiter {
+	return l.l.Load().(*rate.Limiter)
+}
+
+// NewHandlerWrapper rejects the requests over the limit with a 429 error
+func NewHandlerWrapper(l *Limiter) server.HandlerWrapper {
+	return func(fn server.HandlerFunc) server.HandlerFunc {
+		return func(ctx context.Context, req server.Request, rsp interface{}) error {
+			if !l.Allow() {
+				return errors.New(req.Service(), "rate limit exceeded", http.StatusTooManyRequests)
+			}
+			return fn(ctx, req, rsp)
+		}
+	}
+}
+
+type clientWrapper struct {
+	client.Client
+	l *Limiter
+}
+
+// NewClientWrapper fails the calls and streams over the limit with a 429
+// error before they are sent
+func NewClientWrapper(l *Limiter) client.Wrapper {
+	return func(c client.Client) client.Client {
+		return &clientWrapper{Client: c, l: l}
+	}
+}
+
+func (c *clientWrapper) Call(ctx context.Context, req client.Request, rsp interface{}, opts ...client.CallOption) error {
+	if !c.l.Allow() {
+		return errors.New(req.Service(), "rate limit exceeded", http.StatusTooManyRequests)
+	}
+	return c.Client.Call(ctx, req, rsp, opts...)
+}
+
+func (c *clientWrapper) Stream(ctx context.Context, req client.Request, opts ...client.CallOption) (client.Stream, error) {
+	if !c.l.Allow() {
+		return nil, errors.New(req.Service(), "rate limit exceeded", http.StatusTooManyRequests)
+	}
+	return c.Client.Stream(ctx, req, opts...)
+}
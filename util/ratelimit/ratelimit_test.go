@@ -0,0 +1,100 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"xmicro/client"
+	"xmicro/errors"
+	"xmicro/server"
+)
+
+func allowed(l *Limiter, n int) int {
+	count := 0
+	for i := 0; i < n; i++ {
+		if l.Allow() {
+			count++
+		}
+	}
+	return count
+}
+
+func TestLimiter(t *testing.T) {
+	l := NewLimiter(0, 0)
+	assert.Equal(t, 100, allowed(l, 100))
+	r, burst := l.Limit()
+	assert.Equal(t, 0.0, r)
+	assert.Equal(t, 0, burst)
+
+	// the burst is allowed at once, the rest waits for tokens
+	l.SetLimit(0.001, 5)
+	assert.Equal(t, 5, allowed(l, 100))
+	r, burst = l.Limit()
+	assert.Equal(t, 0.001, r)
+	assert.Equal(t, 5, burst)
+
+	l.SetLimit(-1, 0)
+	assert.Equal(t, 100, allowed(l, 100))
+
+	l = NewLimiter(2.5, 0)
+	_, burst = l.Limit()
+	assert.Equal(t, 3, burst)
+}
+
+type testRequest struct {
+	server.Request
+}
+
+func (r *testRequest) Service() string {
+	return "test"
+}
+
+func TestHandlerWrapper(t *testing.T) {
+	l := NewLimiter(0.001, 1)
+	calls := 0
+	fn := NewHandlerWrapper(l)(func(ctx context.Context, req server.Request, rsp interface{}) error {
+		calls++
+		return nil
+	})
+
+	assert.NoError(t, fn(context.Background(), &testRequest{}, nil))
+	err := fn(context.Background(), &testRequest{}, nil)
+	assert.Error(t, err)
+	assert.EqualValues(t, 429, errors.FromError(err).Code)
+	assert.Equal(t, 1, calls)
+}
+
+type testClient struct {
+	client.Client
+	calls int
+}
+
+func (c *testClient) Call(ctx context.Context, req client.Request, rsp interface{}, opts ...client.CallOption) error {
+	c.calls++
+	return nil
+}
+
+type testClientRequest struct {
+	client.Request
+}
+
+func (r *testClientRequest) Service() string {
+	return "test"
+}
+
+func TestClientWrapper(t *testing.T) {
+	l := NewLimiter(0.001, 2)
+	c := &testClient{}
+	wrapped := NewClientWrapper(l)(c)
+
+	for i := 0; i < 3; i++ {
+		_ = wrapped.Call(context.Background(), &testClientRequest{}, nil)
+	}
+	assert.Equal(t, 2, c.calls)
+
+	l.SetLimit(0, 0)
+	assert.NoError(t, wrapped.Call(context.Background(), &testClientRequest{}, nil))
+	assert.Equal(t, 3, c.calls)
+}
@@ -18,8 +18,10 @@
 package yaml
 
 import (
+	"fmt"
 	"io/ioutil"
 	"path"
+	"strings"
 )
 
 import (
@@ -58,3 +60,52 @@ func UnmarshalYML(data []byte, out interface{}) error {
 func MarshalYML(in interface{}) ([]byte, error) {
 	return yaml.Marshal(in)
 }
+
+// Flatten decodes the yml document into dotted keys. Lists of scalars are
+// joined by commas, other lists are kept as yml documents.
+func Flatten(data []byte) (map[string]string, error) {
+	var in map[interface{}]interface{}
+	if err := yaml.Unmarshal(data, &in); err != nil {
+		return nil, err
+	}
+	out := make(map[string]string)
+	if err := flatten("", in, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func flatten(prefix string, in interface{}, out map[string]string) error {
+	switch v := in.(type) {
+	case map[interface{}]interface{}:
+		for k, value := range v {
+			key := fmt.Sprint(k)
+			if len(prefix) > 0 {
+				key = prefix + "." + key
+			}
+			if err := flatten(key, value, out); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		values := make([]string, 0, len(v))
+		for _, value := range v {
+			switch value.(type) {
+			case map[interface{}]interface{}, []interface{}:
+				b, err := yaml.Marshal(v)
+				if err != nil {
+					return err
+				}
+				out[prefix] = string(b)
+				return nil
+			}
+			values = append(values, fmt.Sprint(value))
+		}
+		out[prefix] = strings.Join(values, ",")
+	case nil:
+		out[prefix] = ""
+	default:
+		out[prefix] = fmt.Sprint(v)
+	}
+	return nil
+}
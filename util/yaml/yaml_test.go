@@ -68,3 +68,21 @@ type Config struct {
 type ChildConfig struct {
 	StrTest string `default:"strTest" default:"default" yaml:"strTest"  json:"strTest,omitempty"`
 }
+
+func TestFlatten(t *testing.T) {
+	m, err := Flatten([]byte(`
+server:
+  name: demo
+  port: 8080
+  tags: [a, b]
+  routes:
+    - path: /a
+empty:
+`))
+	assert.NoError(t, err)
+	assert.Equal(t, "demo", m["server.name"])
+	assert.Equal(t, "8080", m["server.port"])
+	assert.Equal(t, "a,b", m["server.tags"])
+	assert.Equal(t, "- path: /a\n", m["server.routes"])
+	assert.Equal(t, "", m["empty"])
+}